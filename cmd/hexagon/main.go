@@ -48,6 +48,7 @@ func main() {
 
 	var filename = flag.String("filename", "", "The file to write output to")
 	var frame = flag.Bool("frame", false, "Frame the canvas")
+	var scene = flag.String("scene", "", "Also save the scene to this YAML file")
 
 	flag.Parse()
 	if *filename == "" {
@@ -65,6 +66,20 @@ func main() {
 			tuple.NewPoint(0, 5, 5),
 			tuple.NewPoint(0, 0, 0),
 			tuple.NewVector(0, 1, 0)))
+	if *scene != "" {
+		sceneCam := world.Cam{
+			Hsize:       400,
+			Vsize:       400,
+			FieldOfView: math.Pi / 3.0,
+			From:        world.Point{0, 5, 5},
+			To:          world.Point{0, 0, 0},
+			Up:          world.Vector{0, 1, 0},
+		}
+		if err := world.SaveWorld(*scene, w, sceneCam); err != nil {
+			fmt.Printf("Failed to save the scene: %s\n", err)
+			os.Exit(1)
+		}
+	}
 	fmt.Printf("Pixelsize: %v\n", cam.PixelSize())
 	image := cam.Render(w)
 
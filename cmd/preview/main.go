@@ -0,0 +1,160 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/liorokman/raytrace/pkg/camera"
+	"github.com/liorokman/raytrace/pkg/world"
+)
+
+// page is the whole browser side of the preview. It has no external assets, so the
+// preview works offline.
+//
+//go:embed index.html
+var page []byte
+
+func main() {
+
+	var scenefile = flag.String("scene", "", "The scene input file, either a YAML scene or a glTF 2.0 (.gltf or .glb) file")
+	var addr = flag.String("addr", "localhost:8080", "The address to serve the preview on")
+	var at = flag.Float64("time", 0, "The time in an animated scene to preview, in seconds")
+	var poll = flag.Duration("poll", 500*time.Millisecond, "How often the scene file and the files it reads are checked for changes")
+	var tileSize = flag.Int("tilesize", 16, "Width and height in pixels of the tiles handed to the workers")
+	var integrator = flag.String("integrator", "whitted", "Rendering algorithm, either whitted or path")
+	var paths = flag.Int("paths", 16, "Paths traced for every camera ray by the path integrator")
+
+	flag.Parse()
+	if *scenefile == "" {
+		fmt.Printf("Must provide a scene filename.\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	opts := camera.DefaultRenderOptions()
+	opts.TileSize = *tileSize
+	switch *integrator {
+	case "whitted":
+	case "path":
+		pt := world.DefaultPathTracer()
+		pt.Samples = *paths
+		opts.Integrator = pt
+	default:
+		fmt.Printf("Unsupported integrator '%s', use either whitted or path\n", *integrator)
+		os.Exit(1)
+	}
+
+	p := newPreview(*scenefile, *at, opts)
+	p.reload()
+	if err := p.status().Error; err != "" {
+		// The server starts anyway, and shows the scene once it's fixed
+		fmt.Printf("%s\n", err)
+	}
+	go p.watch(*poll)
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page)
+	})
+	http.HandleFunc("/image.png", func(w http.ResponseWriter, r *http.Request) {
+		image := p.latestImage()
+		if image == nil {
+			http.Error(w, "Nothing was rendered yet", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(image)
+	})
+	http.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, p)
+	})
+
+	// The port is taken from the listener, for addresses that let the system pick it
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		os.Exit(1)
+	}
+	host, _, _ := net.SplitHostPort(*addr)
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	http.HandleFunc("/camera", cameraHandler(p, net.JoinHostPort(host, port)))
+
+	fmt.Printf("Previewing %s on http://%s/\n", *scenefile, net.JoinHostPort(host, port))
+	if err := http.Serve(listener, nil); err != nil {
+		fmt.Printf("%s\n", err)
+		os.Exit(1)
+	}
+}
+
+func writeStatus(w http.ResponseWriter, p *preview) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(p.status())
+}
+
+// cameraHandler moves the camera of a preview served on addr. Only JSON requests from
+// the preview's own page are accepted, so that other sites can't move the camera with a
+// simple cross-origin form post, which browsers send without asking the server first.
+// A site can still reach the server through a name of its own that resolves to the
+// server's address, a DNS rebinding, so the Host and Origin headers must name the
+// server itself.
+func cameraHandler(p *preview, addr string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "The camera is moved with a POST", http.StatusMethodNotAllowed)
+			return
+		}
+		if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+			http.Error(w, "The camera move must be sent as application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+		allowed := servedHost(r.Host, addr)
+		if origin := r.Header.Get("Origin"); allowed && origin != "" {
+			u, err := url.Parse(origin)
+			allowed = err == nil && servedHost(u.Host, addr)
+		}
+		if !allowed {
+			http.Error(w, "The camera can only be moved from the preview page", http.StatusForbidden)
+			return
+		}
+		var m move
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			http.Error(w, fmt.Sprintf("Bad camera move: %s", err), http.StatusBadRequest)
+			return
+		}
+		p.moveCamera(m)
+		writeStatus(w, p)
+	}
+}
+
+// servedHost checks that a host from a request names the server on addr: the name it
+// listens on, localhost or an IP address, which no DNS rebinding can fake, together with
+// the port it listens on.
+func servedHost(host, addr string) bool {
+	listenName, listenPort, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		// A host without a port uses the default port of http
+		name, port = strings.Trim(host, "[]"), "80"
+	}
+	if port != listenPort || name == "" {
+		return false
+	}
+	return strings.EqualFold(name, listenName) || strings.EqualFold(name, "localhost") || net.ParseIP(name) != nil
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liorokman/raytrace/pkg/camera"
+	"github.com/liorokman/raytrace/pkg/canvas"
+	"github.com/liorokman/raytrace/pkg/tuple"
+	"github.com/liorokman/raytrace/pkg/world"
+)
+
+// preview holds the scene being previewed and the latest image of it. The scene is
+// rebuilt whenever one of its files changes, and rendered again whenever it's rebuilt or
+// the camera is moved. Every render is progressive, so a rough image shows up quickly and
+// is refined pass by pass.
+type preview struct {
+	scene string
+	time  float64
+	opts  camera.RenderOptions
+
+	mu    sync.Mutex
+	world *world.World
+	// sceneCam is the camera of the scene file, and view is where the camera was moved to
+	// from the browser. The view is kept when the scene is rebuilt, and it's nil until
+	// the camera is moved.
+	sceneCam world.Cam
+	view     *view
+	// files holds the modification time of every file the scene is built from, or the
+	// zero time for files that are missing
+	files map[string]time.Time
+	err   string
+	// renders counts the renders started, so that the passes of a render that was
+	// replaced by a newer one are dropped
+	renders  int
+	cancel   context.CancelFunc
+	progress camera.Progress
+	// image is the latest pass as a PNG, and version counts the images
+	image   []byte
+	version int
+}
+
+// view is the position and orientation of the camera
+type view struct {
+	From world.Point
+	To   world.Point
+	Up   world.Vector
+}
+
+// move is a change to the camera, as sent by the browser
+type move struct {
+	// Yaw and Pitch orbit the camera around the point it looks at, in radians. Yaw turns
+	// around the up vector, and a positive pitch moves the camera towards it.
+	Yaw   float64 `json:"yaw"`
+	Pitch float64 `json:"pitch"`
+	// Zoom multiplies the distance between the camera and the point it looks at
+	Zoom float64 `json:"zoom"`
+	// Reset moves the camera back to where the scene file puts it
+	Reset bool `json:"reset"`
+}
+
+// status is what the browser polls to follow the render
+type status struct {
+	Version  int          `json:"version"`
+	Pass     int          `json:"pass"`
+	Passes   int          `json:"passes"`
+	Progress float64      `json:"progress"`
+	Error    string       `json:"error,omitempty"`
+	Camera   cameraStatus `json:"camera"`
+}
+
+type cameraStatus struct {
+	From        world.Point  `json:"from"`
+	To          world.Point  `json:"to"`
+	Up          world.Vector `json:"up"`
+	FieldOfView float64      `json:"fieldOfView"`
+}
+
+// minPolar is the smallest angle, in radians, between the camera's up vector and the
+// direction from the point it looks at to the camera. Orbiting any closer would flip the
+// camera over.
+const minPolar = 0.01
+
+// minDistance is how close zooming in can get to the point the camera looks at
+const minDistance = 1e-3
+
+func newPreview(scene string, at float64, opts camera.RenderOptions) *preview {
+	opts.Progressive = true
+	return &preview{scene: scene, time: at, opts: opts}
+}
+
+// load builds the world, from either a YAML scene or a glTF file
+func (p *preview) load() (*world.World, world.Cam, error) {
+	if ext := strings.ToLower(filepath.Ext(p.scene)); ext == ".gltf" || ext == ".glb" {
+		return world.NewWorldFromGLTF(p.scene)
+	}
+	return world.NewWorldAt(p.scene, p.time)
+}
+
+// sceneFiles returns the files to watch for changes
+func (p *preview) sceneFiles() []string {
+	files, _ := world.SceneFiles(p.scene)
+	return files
+}
+
+func modTimes(files []string) map[string]time.Time {
+	retval := make(map[string]time.Time, len(files))
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			retval[f] = info.ModTime()
+		} else {
+			retval[f] = time.Time{}
+		}
+	}
+	return retval
+}
+
+// reload builds the world again and renders it. A scene with problems keeps showing the
+// last image that was rendered, together with the problems.
+func (p *preview) reload() {
+	// The files are checked before they're read, so that a change made while the scene
+	// is loading is picked up by the next check
+	files := modTimes(p.sceneFiles())
+	w, cam, err := p.load()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.files = files
+	if err != nil {
+		p.err = fmt.Sprintf("Error parsing the scene file: %s", err)
+		return
+	}
+	p.world, p.sceneCam, p.err = w, cam, ""
+	p.startRender()
+}
+
+// changed reports whether any of the scene's files changed since it was last built
+func (p *preview) changed() bool {
+	p.mu.Lock()
+	files := p.files
+	p.mu.Unlock()
+	for f, stamp := range modTimes(p.sceneFiles()) {
+		if old, ok := files[f]; !ok || !old.Equal(stamp) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch rebuilds the scene whenever its files change
+func (p *preview) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		if p.changed() {
+			fmt.Printf("Scene changed, rendering it again\n")
+			p.reload()
+		}
+	}
+}
+
+// camera returns the scene's camera, moved to the view set from the browser
+func (p *preview) camera() world.Cam {
+	cam := p.sceneCam
+	if p.view != nil {
+		cam.From, cam.To, cam.Up = p.view.From, p.view.To, p.view.Up
+	}
+	return cam
+}
+
+// startRender cancels the render in progress and starts a new one. It must be called
+// with the lock held.
+func (p *preview) startRender() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	c, err := camera.FromScene(p.camera())
+	if err != nil {
+		p.err = fmt.Sprintf("Error in the scene's camera: %s", err)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.renders++
+	p.progress = camera.Progress{}
+	render, w, opts := p.renders, p.world, p.opts
+	opts.Progress = func(progress camera.Progress) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.renders == render {
+			p.progress = progress
+		}
+	}
+	opts.PassDone = func(pass int, image canvas.Canvas) {
+		var buf bytes.Buffer
+		if err := image.WritePNG(&buf, 8); err != nil {
+			fmt.Printf("Failed to encode pass %d: %s\n", pass, err)
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.renders == render {
+			p.image = buf.Bytes()
+			p.version++
+		}
+	}
+	go func() {
+		_, err := c.RenderWithOptions(ctx, w, opts)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if p.renders == render {
+				p.err = fmt.Sprintf("Failed to render the scene: %s", err)
+			}
+		}
+	}()
+}
+
+// moveCamera applies a change from the browser to the camera, and renders the scene
+// again from there
+func (p *preview) moveCamera(m move) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.world == nil {
+		return
+	}
+	if m.Reset {
+		p.view = nil
+	} else {
+		cam := p.camera()
+		v := orbit(view{From: cam.From, To: cam.To, Up: cam.Up}, m.Yaw, m.Pitch, m.Zoom)
+		p.view = &v
+	}
+	p.startRender()
+}
+
+func (p *preview) status() status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cam := p.camera()
+	progress := 0.0
+	if p.progress.TotalTiles > 0 {
+		progress = p.progress.Fraction()
+	}
+	return status{
+		Version:  p.version,
+		Pass:     p.progress.Pass,
+		Passes:   p.progress.TotalPasses,
+		Progress: progress,
+		Error:    p.err,
+		Camera: cameraStatus{
+			From:        cam.From,
+			To:          cam.To,
+			Up:          cam.Up,
+			FieldOfView: cam.FieldOfView,
+		},
+	}
+}
+
+// latestImage returns the last finished pass as a PNG, or nil before the first pass
+func (p *preview) latestImage() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.image
+}
+
+// orbit moves the camera around the point it looks at, and towards or away from it
+func orbit(v view, yaw, pitch, zoom float64) view {
+	to := v.To.ToPoint()
+	offset := v.From.ToPoint().Subtract(to)
+	up := v.Up.ToVector().Normalize()
+
+	offset = rotate(offset, up, yaw)
+	if axis := offset.Cross(up); axis.Magnitude() > 0 {
+		// Turning by a positive angle around this axis moves the camera towards up. The
+		// pitch stops short of up and of down, where the camera would flip over.
+		polar := math.Acos(math.Max(-1, math.Min(1, offset.Normalize().Dot(up))))
+		pitch = math.Max(polar-(math.Pi-minPolar), math.Min(polar-minPolar, pitch))
+		offset = rotate(offset, axis.Normalize(), pitch)
+	}
+	if zoom > 0 {
+		offset = offset.Mult(math.Max(zoom, minDistance/offset.Magnitude()))
+	}
+	from := to.Add(offset)
+	return view{From: world.Point{from.X(), from.Y(), from.Z()}, To: v.To, Up: v.Up}
+}
+
+// rotate turns v by angle radians around the unit vector axis
+func rotate(v, axis tuple.Tuple, angle float64) tuple.Tuple {
+	cos, sin := math.Cos(angle), math.Sin(angle)
+	return v.Mult(cos).Add(axis.Cross(v).Mult(sin)).Add(axis.Mult(axis.Dot(v) * (1 - cos)))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/liorokman/raytrace/pkg/camera"
+	"github.com/liorokman/raytrace/pkg/world"
+	. "github.com/onsi/gomega"
+)
+
+func TestOrbit(t *testing.T) {
+	g := NewGomegaWithT(t)
+	v := view{From: world.Point{0, 0, -5}, To: world.Point{0, 0, 0}, Up: world.Vector{0, 1, 0}}
+
+	// Yaw turns around the up vector and keeps the distance
+	turned := orbit(v, math.Pi/2, 0, 0)
+	g.Expect(turned.From[0]).To(BeNumerically("~", -5, 1e-9))
+	g.Expect(turned.From[1]).To(BeNumerically("~", 0, 1e-9))
+	g.Expect(turned.From[2]).To(BeNumerically("~", 0, 1e-9))
+	g.Expect(turned.To).To(Equal(v.To))
+	g.Expect(turned.Up).To(Equal(v.Up))
+
+	// Pitch moves towards up, but stops short of it
+	raised := orbit(v, 0, math.Pi/4, 0)
+	g.Expect(raised.From[1]).To(BeNumerically("~", 5*math.Sin(math.Pi/4), 1e-9))
+	g.Expect(raised.From[2]).To(BeNumerically("~", -5*math.Cos(math.Pi/4), 1e-9))
+	top := orbit(v, 0, math.Pi, 0)
+	offset := top.From.ToPoint().Subtract(top.To.ToPoint())
+	g.Expect(offset.Magnitude()).To(BeNumerically("~", 5, 1e-9))
+	g.Expect(math.Acos(offset.Normalize().Dot(v.Up.ToVector()))).To(BeNumerically("~", minPolar, 1e-9))
+	bottom := orbit(v, 0, -math.Pi, 0)
+	offset = bottom.From.ToPoint().Subtract(bottom.To.ToPoint())
+	g.Expect(math.Acos(offset.Normalize().Dot(v.Up.ToVector()))).To(BeNumerically("~", math.Pi-minPolar, 1e-9))
+
+	// Zoom scales the distance, but never gets closer than minDistance
+	g.Expect(orbit(v, 0, 0, 0.5).From[2]).To(BeNumerically("~", -2.5, 1e-9))
+	g.Expect(orbit(v, 0, 0, 1e-9).From[2]).To(BeNumerically("~", -minDistance, 1e-12))
+}
+
+func TestCameraHandler(t *testing.T) {
+	g := NewGomegaWithT(t)
+	handler := cameraHandler(newPreview("scene.yaml", 0, camera.DefaultRenderOptions()), "localhost:8080")
+	sendTo := func(host, method, contentType, origin string) int {
+		r := httptest.NewRequest(method, "http://"+host+"/camera", strings.NewReader(`{"yaw": 0.1}`))
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+	send := func(method, contentType, origin string) int {
+		return sendTo("localhost:8080", method, contentType, origin)
+	}
+
+	g.Expect(send(http.MethodGet, "application/json", "")).To(Equal(http.StatusMethodNotAllowed))
+	// Browsers send form posts and text/plain across origins without asking first
+	g.Expect(send(http.MethodPost, "text/plain", "")).To(Equal(http.StatusUnsupportedMediaType))
+	g.Expect(send(http.MethodPost, "", "")).To(Equal(http.StatusUnsupportedMediaType))
+	g.Expect(send(http.MethodPost, "application/json", "http://evil.example")).To(Equal(http.StatusForbidden))
+	g.Expect(send(http.MethodPost, "application/json", "http://localhost:8080")).To(Equal(http.StatusOK))
+	g.Expect(send(http.MethodPost, "application/json; charset=utf-8", "")).To(Equal(http.StatusOK))
+
+	// A page on another name that resolves to the server sends a Host and Origin that
+	// agree, so both must name the server
+	g.Expect(sendTo("attacker.example:8080", http.MethodPost, "application/json", "http://attacker.example:8080")).To(Equal(http.StatusForbidden))
+	g.Expect(sendTo("localhost:8080", http.MethodPost, "application/json", "http://localhost:9090")).To(Equal(http.StatusForbidden))
+	g.Expect(sendTo("127.0.0.1:8080", http.MethodPost, "application/json", "http://127.0.0.1:8080")).To(Equal(http.StatusOK))
+	g.Expect(sendTo("[::1]:8080", http.MethodPost, "application/json", "http://[::1]:8080")).To(Equal(http.StatusOK))
+}
+
+func TestServedHost(t *testing.T) {
+	g := NewGomegaWithT(t)
+	g.Expect(servedHost("localhost:8080", "localhost:8080")).To(BeTrue())
+	g.Expect(servedHost("LOCALHOST:8080", "127.0.0.1:8080")).To(BeTrue())
+	g.Expect(servedHost("render-box:8080", "render-box:8080")).To(BeTrue())
+	g.Expect(servedHost("192.168.1.5:8080", ":8080")).To(BeTrue())
+	g.Expect(servedHost("localhost", "localhost:80")).To(BeTrue())
+
+	g.Expect(servedHost("localhost:8081", "localhost:8080")).To(BeFalse())
+	g.Expect(servedHost("attacker.example:8080", ":8080")).To(BeFalse())
+	g.Expect(servedHost("localhost.attacker.example:8080", "localhost:8080")).To(BeFalse())
+	g.Expect(servedHost("", "localhost:8080")).To(BeFalse())
+}
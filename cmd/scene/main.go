@@ -1,14 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/liorokman/raytrace/pkg/camera"
+	"github.com/liorokman/raytrace/pkg/canvas"
 	"github.com/liorokman/raytrace/pkg/tuple"
 	"github.com/liorokman/raytrace/pkg/world"
 )
@@ -16,10 +24,23 @@ import (
 func main() {
 
 	var filename = flag.String("filename", "", "The file to write output to")
-	var scenefile = flag.String("scene", "", "The scene input file")
+	var scenefile = flag.String("scene", "", "The scene input file, either a YAML scene or a glTF 2.0 (.gltf or .glb) file")
 	var frame = flag.Bool("frame", false, "Frame the canvas")
 	var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
 	var webpprof = flag.Bool("webpprof", false, "Launch a web-based pprof interface")
+	var binaryPPM = flag.Bool("binary", false, "Write PPM files in the binary (P6) format")
+	defaultEncodeOpts := canvas.DefaultEncodeOptions()
+	var bitDepth = flag.Int("bitdepth", defaultEncodeOpts.BitDepth, "Bits per channel for PNG files, 8 or 16")
+	var quality = flag.Int("quality", defaultEncodeOpts.Quality, "JPEG quality, between 1 and 100")
+	var progressive = flag.Bool("progressive", false, "Render a low resolution preview first and refine it")
+	var tileSize = flag.Int("tilesize", 16, "Width and height in pixels of the tiles handed to the workers")
+	var quiet = flag.Bool("quiet", false, "Don't display the progress bar")
+	var integrator = flag.String("integrator", "whitted", "Rendering algorithm, either whitted or path")
+	var paths = flag.Int("paths", 16, "Paths traced for every camera ray by the path integrator")
+	var seed = flag.Uint64("seed", 0, "Seed for the random choices of the path integrator and of jittered lights")
+	var frames = flag.String("frames", "", "Render the frames of an animated scene, either all, a single frame or a range like 10-20. "+
+		"The frame number is added to the output filename, or replaces a verb like %04d in it")
+	var motionBlur = flag.Int("motionblur", 1, "Images rendered across the shutter interval and averaged for every frame of an animation")
 
 	flag.Parse()
 	if *scenefile == "" {
@@ -32,6 +53,11 @@ func main() {
 		flag.Usage()
 		os.Exit(1)
 	}
+	format, err := canvas.FormatForFilename(*filename)
+	if err != nil {
+		fmt.Printf("%s. Supported extensions are .ppm, .png, .jpg, .jpeg and .hdr\n", err)
+		os.Exit(1)
+	}
 	if *cpuprofile != "" {
 		f, err := os.Create(*cpuprofile)
 		if err != nil {
@@ -46,7 +72,13 @@ func main() {
 		}()
 	}
 
-	w, camInput, err := world.NewWorld(*scenefile)
+	loadWorld := world.NewWorldAt
+	if ext := strings.ToLower(filepath.Ext(*scenefile)); ext == ".gltf" || ext == ".glb" {
+		loadWorld = func(file string, _ float64) (*world.World, world.Cam, error) {
+			return world.NewWorldFromGLTF(file)
+		}
+	}
+	w, camInput, err := loadWorld(*scenefile, 0)
 	if err != nil {
 		fmt.Printf("Error parsing the scene file: %s", err)
 		os.Exit(1)
@@ -55,36 +87,214 @@ func main() {
 	fmt.Printf("World is %s\n", w)
 	fmt.Printf("Cam input is %#v\n", camInput)
 
-	cam := camera.NewCamera(camInput.Hsize, camInput.Vsize, camInput.FieldOfView).
-		WithTransform(camera.ViewTransformation(
-			camInput.From.ToPoint(),
-			camInput.To.ToPoint(),
-			camInput.Up.ToVector()))
-	fmt.Printf("Pixelsize: %v\n", cam.PixelSize())
-	image := cam.Render(w)
-
-	if *frame {
-		borderColor := tuple.Red
-		for x := uint32(0); x < cam.HSize(); x++ {
-			for y := uint32(0); y < cam.VSize(); y++ {
-				image.SetPixel(uint32(0), uint32(x), borderColor)
-				image.SetPixel(uint32(cam.VSize()-1), uint32(x), borderColor)
-
-				image.SetPixel(uint32(x), uint32(0), borderColor)
-				image.SetPixel(uint32(x), uint32(cam.HSize()-1), borderColor)
-			}
+	// Interrupting the render writes out whatever was rendered so far
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	opts := camera.DefaultRenderOptions()
+	opts.TileSize = *tileSize
+	opts.Progressive = *progressive
+	opts.Seed = *seed
+	switch *integrator {
+	case "whitted":
+	case "path":
+		pt := world.DefaultPathTracer()
+		pt.Samples = *paths
+		opts.Integrator = pt
+	default:
+		fmt.Printf("Unsupported integrator '%s', use either whitted or path\n", *integrator)
+		os.Exit(1)
+	}
+	if !*quiet {
+		opts.Progress = printProgress
+	}
+	encodeOpts := canvas.EncodeOptions{
+		Binary:   *binaryPPM,
+		BitDepth: *bitDepth,
+		Quality:  *quality,
+	}
+
+	if *frames == "" {
+		cam, err := camera.FromScene(camInput)
+		if err != nil {
+			fmt.Printf("Error in the scene's camera: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Pixelsize: %v\n", cam.PixelSize())
+		image, err := render(ctx, cam, w, opts, *quiet)
+		if err != nil {
+			os.Exit(1)
+		}
+		if *frame {
+			drawFrame(image, cam)
+		}
+		if err := writeImage(*filename, image, format, encodeOpts); err != nil {
+			os.Exit(1)
 		}
+		return
 	}
 
-	file, err := os.Create(*filename)
+	first, last, err := frameRange(*frames, w.Animation)
 	if err != nil {
-		fmt.Printf("Failed to open %s for output: %s\n", *filename, err.Error())
+		fmt.Printf("%s\n", err)
 		os.Exit(1)
 	}
-	defer file.Close()
-	err = image.WritePPM(file)
+	if *motionBlur < 1 {
+		fmt.Printf("motionblur must be at least 1\n")
+		os.Exit(1)
+	}
+	for f := first; f <= last && ctx.Err() == nil; f++ {
+		fmt.Printf("Frame %d of %d-%d\n", f, first, last)
+		// The images of a frame are spread evenly over the time the shutter is open
+		var image canvas.Canvas
+		var cam camera.Camera
+		for i := 0; i < *motionBlur && ctx.Err() == nil; i++ {
+			at := w.Animation.FrameTime(f)
+			if *motionBlur > 1 {
+				at += w.Animation.ShutterTime() * (float64(i) + 0.5) / float64(*motionBlur)
+			}
+			frameWorld, frameCam, err := loadWorld(*scenefile, at)
+			if err != nil {
+				fmt.Printf("Error building frame %d: %s\n", f, err)
+				os.Exit(1)
+			}
+			if cam, err = camera.FromScene(frameCam); err != nil {
+				fmt.Printf("Error in the camera of frame %d: %s\n", f, err)
+				os.Exit(1)
+			}
+			sample, err := render(ctx, cam, frameWorld, opts, *quiet)
+			if err != nil {
+				os.Exit(1)
+			}
+			if image == nil {
+				image = sample
+			} else if err := accumulate(image, sample, i); err != nil {
+				fmt.Printf("Can't blur frame %d: %s\n", f, err)
+				os.Exit(1)
+			}
+		}
+		if *frame {
+			drawFrame(image, cam)
+		}
+		if err := writeImage(frameFilename(*filename, f), image, format, encodeOpts); err != nil {
+			os.Exit(1)
+		}
+	}
+}
+
+// render renders a single image. An interrupted render still returns the partial image.
+func render(ctx context.Context, cam camera.Camera, w *world.World, opts camera.RenderOptions, quiet bool) (canvas.Canvas, error) {
+	image, err := cam.RenderWithOptions(ctx, w, opts)
+	if !quiet {
+		fmt.Fprintln(os.Stderr)
+	}
+	if errors.Is(err, context.Canceled) {
+		fmt.Printf("Render interrupted, writing the partial image\n")
+	} else if err != nil {
+		fmt.Printf("Failed to render the scene: %s\n", err)
+		return nil, err
+	}
+	return image, nil
+}
+
+// accumulate adds the sample to the average of the previous samples in image
+func accumulate(image, sample canvas.Canvas, previous int) error {
+	if image.Width() != sample.Width() || image.Height() != sample.Height() {
+		return fmt.Errorf("The size of the image changes while the shutter is open")
+	}
+	for y := uint32(0); y < image.Height(); y++ {
+		for x := uint32(0); x < image.Width(); x++ {
+			sum, err := image.GetPixel(x, y)
+			if err != nil {
+				return err
+			}
+			c, err := sample.GetPixel(x, y)
+			if err != nil {
+				return err
+			}
+			avg := sum.Mult(float64(previous)).Add(c).Mult(1 / float64(previous+1))
+			if err := image.SetPixel(x, y, avg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func drawFrame(image canvas.Canvas, cam camera.Camera) {
+	borderColor := tuple.Red
+	for x := uint32(0); x < cam.HSize(); x++ {
+		for y := uint32(0); y < cam.VSize(); y++ {
+			image.SetPixel(uint32(0), uint32(x), borderColor)
+			image.SetPixel(uint32(cam.VSize()-1), uint32(x), borderColor)
+
+			image.SetPixel(uint32(x), uint32(0), borderColor)
+			image.SetPixel(uint32(x), uint32(cam.HSize()-1), borderColor)
+		}
+	}
+}
+
+func writeImage(filename string, image canvas.Canvas, format canvas.Format, opts canvas.EncodeOptions) error {
+	file, err := os.Create(filename)
 	if err != nil {
+		fmt.Printf("Failed to open %s for output: %s\n", filename, err.Error())
+		return err
+	}
+	defer file.Close()
+	if err := image.Encode(file, format, opts); err != nil {
 		fmt.Printf("Failed to generate the output file: %s\n", err)
-		os.Exit(1)
+		return err
+	}
+	return nil
+}
+
+// frameRange parses the frames flag, which is either all, a single frame or a range
+func frameRange(frames string, a world.Animation) (int, int, error) {
+	if frames == "all" {
+		if a.Frames == 0 {
+			return 0, 0, fmt.Errorf("The scene has no animation section with the number of frames")
+		}
+		return 0, a.Frames - 1, nil
+	}
+	first, last, isRange := strings.Cut(frames, "-")
+	if !isRange {
+		last = first
+	}
+	from, err := strconv.Atoi(first)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Bad frame '%s' in frames", first)
+	}
+	to, err := strconv.Atoi(last)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Bad frame '%s' in frames", last)
+	}
+	if from < 0 || to < from {
+		return 0, 0, fmt.Errorf("Frames must be a range of frames from 0 up, like 10-20")
+	}
+	return from, to, nil
+}
+
+// frameFilename numbers the output file of a frame. A verb like %04d in the name is
+// replaced with the frame number, otherwise the number is added before the extension.
+func frameFilename(filename string, frame int) string {
+	if strings.Contains(filename, "%") {
+		return fmt.Sprintf(filename, frame)
+	}
+	ext := filepath.Ext(filename)
+	return fmt.Sprintf("%s-%04d%s", strings.TrimSuffix(filename, ext), frame, ext)
+}
+
+const progressBarWidth = 40
+
+var lastProgress time.Time
+
+// printProgress redraws the progress bar, at most ten times a second
+func printProgress(p camera.Progress) {
+	if p.TilesDone < p.TotalTiles && time.Since(lastProgress) < 100*time.Millisecond {
+		return
 	}
+	lastProgress = time.Now()
+	filled := int(p.Fraction() * progressBarWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+	fmt.Fprintf(os.Stderr, "\r[%s] %5.1f%% pass %d/%d, %.0f rays/s, ETA %s   ",
+		bar, 100*p.Fraction(), p.Pass, p.TotalPasses, p.RaysPerSecond, p.ETA.Round(time.Second))
 }
@@ -55,10 +55,10 @@ func main() {
 			if h, ok := shapes.Hit(xs...); ok {
 
 				p := r.Position(h.T)
-				n, _ := h.Shape.NormalAt(p)
+				n, _ := h.Shape.NormalAt(p, h)
 				eyev := r.Direction.Mult(-1)
 
-				c.SetPixel(uint32(x), uint32(y), h.Shape.GetMaterial().Lighting(h.Shape, l, p, eyev, n, false))
+				c.SetPixel(uint32(x), uint32(y), h.Shape.GetMaterial().Lighting(h.Shape, l, p, eyev, n, l.Sample(p, nil), []float64{1}))
 			}
 
 		}
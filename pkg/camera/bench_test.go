@@ -0,0 +1,55 @@
+package camera
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/liorokman/raytrace/pkg/world"
+)
+
+// benchmarkScene renders a scene from the repository's root, where the OBJ files the
+// scenes refer to can be found, at a reduced size
+func benchmarkScene(b *testing.B, scene string, size uint32) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := os.Chdir("../.."); err != nil {
+		b.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+
+	w, camInput, err := world.NewWorld(scene)
+	if err != nil {
+		b.Fatal(err)
+	}
+	camInput.Hsize = size
+	camInput.Vsize = size
+	c, err := FromScene(camInput)
+	if err != nil {
+		b.Fatal(err)
+	}
+	opts := DefaultRenderOptions()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.RenderWithOptions(context.Background(), w, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRenderTeapotLow(b *testing.B) {
+	benchmarkScene(b, "teapot-low.yaml", 100)
+}
+
+func BenchmarkRenderTeapot(b *testing.B) {
+	benchmarkScene(b, "teapot.yaml", 100)
+}
+
+func BenchmarkRayForPixel(b *testing.B) {
+	c := testCamera(100, 100)
+	for i := 0; i < b.N; i++ {
+		c.RayForPixel(uint32(i%100), uint32(i/100%100))
+	}
+}
@@ -1,11 +1,9 @@
 package camera
 
 import (
+	"fmt"
 	"math"
-	"runtime"
-	"sync"
 
-	"github.com/liorokman/raytrace/pkg/canvas"
 	"github.com/liorokman/raytrace/pkg/matrix"
 	"github.com/liorokman/raytrace/pkg/shapes"
 	"github.com/liorokman/raytrace/pkg/tuple"
@@ -34,6 +32,18 @@ type Camera struct {
 	vsize       uint32
 	fieldOfView float64
 	transform   matrix.Matrix
+	// inverse is the inverse of transform, needed for every ray the camera creates
+	inverse    matrix.Matrix4
+	inverseErr error
+	sampling   Sampling
+	// aperture is the radius of the lens. A zero aperture is a pinhole camera, where
+	// everything is in focus.
+	aperture float64
+	// focalDistance is the distance from the camera to the plane that's in focus
+	focalDistance float64
+	// motionBlur casts every ray at a random time while the shutter is open, so moving
+	// shapes are blurred along their path
+	motionBlur bool
 
 	halfWidth  float64
 	halfHeight float64
@@ -46,6 +56,10 @@ func NewCamera(hsize, vsize uint32, fieldOfView float64) Camera {
 		vsize:       vsize,
 		fieldOfView: fieldOfView,
 		transform:   matrix.NewIdentity(),
+		inverse:     matrix.NewIdentity4(),
+		sampling:    DefaultSampling(),
+
+		focalDistance: 1,
 	}
 	halfView := math.Tan(fieldOfView / 2.0)
 	aspect := float64(hsize) / float64(vsize)
@@ -61,31 +75,102 @@ func NewCamera(hsize, vsize uint32, fieldOfView float64) Camera {
 }
 
 func (c Camera) WithTransform(t matrix.Matrix) Camera {
-	return Camera{
-		hsize:       c.hsize,
-		vsize:       c.vsize,
-		fieldOfView: c.fieldOfView,
-		transform:   t,
-		halfWidth:   c.halfWidth,
-		halfHeight:  c.halfHeight,
-		pixelSize:   c.pixelSize,
+	c.transform = t
+	c.inverse, c.inverseErr = t.ToMatrix4().Inverse()
+	return c
+}
+
+// WithLens turns the camera into a thin lens camera. Rays start from random points on
+// a lens of the given radius and converge on the plane at focalDistance, so objects
+// far from that plane are blurred. Combine it with a multi-sample mode to get a smooth
+// blur.
+func (c Camera) WithLens(aperture, focalDistance float64) Camera {
+	if aperture < 0 {
+		panic("Aperture can't be negative")
+	}
+	if focalDistance <= 0 {
+		panic("Focal distance must be positive")
+	}
+	c.aperture = aperture
+	c.focalDistance = focalDistance
+	return c
+}
+
+// WithMotionBlur sets whether rays are cast at random times while the shutter is open.
+// Shapes that move are blurred along their path, and like the lens it takes a
+// multi-sample mode to get a smooth blur.
+func (c Camera) WithMotionBlur(enabled bool) Camera {
+	c.motionBlur = enabled
+	return c
+}
+
+// FromScene creates a camera as described in a scene file
+func FromScene(in world.Cam) (Camera, error) {
+	sampling, err := SamplingFromScene(in.Sampling)
+	if err != nil {
+		return Camera{}, err
 	}
+	if in.Aperture < 0 {
+		return Camera{}, fmt.Errorf("Camera aperture can't be negative")
+	}
+	if in.FocalDistance < 0 {
+		return Camera{}, fmt.Errorf("Camera focal distance can't be negative")
+	}
+	focalDistance := in.FocalDistance
+	if focalDistance == 0 {
+		// Focus on the point the camera looks at
+		focalDistance = in.To.ToPoint().Subtract(in.From.ToPoint()).Magnitude()
+		if focalDistance == 0 {
+			focalDistance = 1
+		}
+	}
+	return NewCamera(in.Hsize, in.Vsize, in.FieldOfView).
+		WithTransform(ViewTransformation(in.From.ToPoint(), in.To.ToPoint(), in.Up.ToVector())).
+		WithSampling(sampling).
+		WithLens(in.Aperture, focalDistance).
+		WithMotionBlur(in.MotionBlur), nil
+}
+
+func (c Camera) WithSampling(s Sampling) Camera {
+	if s.Filter == nil {
+		s.Filter = NewBoxFilter(0.5)
+	}
+	c.sampling = s
+	return c
 }
 
 func (c Camera) RayForPixel(px, py uint32) shapes.Ray {
+	return c.RayForPixelOffset(px, py, 0, 0)
+}
+
+// RayForPixelOffset returns a ray that passes through the pixel at (px, py), shifted by
+// (dx, dy) pixels from the pixel's center
+func (c Camera) RayForPixelOffset(px, py uint32, dx, dy float64) shapes.Ray {
+	return c.RayForPixelLens(px, py, dx, dy, 0.5, 0.5)
+}
 
-	xOffset := (float64(px) + 0.5) * c.pixelSize
-	yOffset := (float64(py) + 0.5) * c.pixelSize
+// RayForPixelLens returns a ray through the pixel at (px, py), shifted by (dx, dy)
+// pixels from the pixel's center, starting at the point (lu, lv) of the lens. Both lens
+// coordinates are in [0,1], and (0.5, 0.5) is the center of the lens.
+func (c Camera) RayForPixelLens(px, py uint32, dx, dy, lu, lv float64) shapes.Ray {
+
+	xOffset := (float64(px) + 0.5 + dx) * c.pixelSize
+	yOffset := (float64(py) + 0.5 + dy) * c.pixelSize
 
 	worldX := c.halfWidth - xOffset
 	worldY := c.halfHeight - yOffset
 
-	transformInverse, err := c.transform.Inverse()
-	if err != nil {
-		panic(err)
+	if c.inverseErr != nil {
+		panic(c.inverseErr)
 	}
-	pixel := transformInverse.MultiplyTuple(tuple.NewPoint(worldX, worldY, -1))
-	origin := transformInverse.MultiplyTuple(tuple.NewPoint(0, 0, 0))
+	transformInverse := c.inverse
+	lensX, lensY := concentricDisk(lu, lv)
+	lensX *= c.aperture
+	lensY *= c.aperture
+	// The pinhole ray through the pixel crosses the focal plane at a point that's in
+	// focus, so every ray through the lens has to pass through it too
+	pixel := transformInverse.MultiplyTuple(tuple.NewPoint(worldX*c.focalDistance, worldY*c.focalDistance, -c.focalDistance))
+	origin := transformInverse.MultiplyTuple(tuple.NewPoint(lensX, lensY, 0))
 	direction := pixel.Subtract(origin).Normalize()
 	ray, err := shapes.NewRay(origin, direction)
 	if err != nil {
@@ -94,45 +179,22 @@ func (c Camera) RayForPixel(px, py uint32) shapes.Ray {
 	return ray
 }
 
-type unitOfWork struct {
-	x, y uint32
-}
-
-type queue chan unitOfWork
-
-func (c Camera) Render(w *world.World) canvas.Canvas {
-	image := canvas.New(c.hsize, c.vsize)
-
-	wg := sync.WaitGroup{}
-	q := make(queue, 2*runtime.NumCPU())
-
-	for cpu := 0; cpu < runtime.NumCPU()/len(w.Lights); cpu++ {
-		wg.Add(1)
-		go func() {
-			for {
-				unit, ok := <-q
-				if !ok {
-					wg.Done()
-					return
-				}
-				ray := c.RayForPixel(unit.x, unit.y)
-				color, err := w.ColorAt(ray, 4)
-				if err != nil {
-					panic(err)
-				}
-				image.SetPixel(unit.x, unit.y, color)
-			}
-		}()
+// concentricDisk maps the unit square to the unit disk, keeping evenly spread points
+// evenly spread
+func concentricDisk(u, v float64) (float64, float64) {
+	sx, sy := 2*u-1, 2*v-1
+	if sx == 0 && sy == 0 {
+		return 0, 0
 	}
-
-	for y := uint32(0); y < c.hsize; y++ {
-		for x := uint32(0); x < c.vsize; x++ {
-			q <- unitOfWork{x: x, y: y}
-		}
+	var r, theta float64
+	if math.Abs(sx) > math.Abs(sy) {
+		r = sx
+		theta = (math.Pi / 4) * (sy / sx)
+	} else {
+		r = sy
+		theta = math.Pi/2 - (math.Pi/4)*(sx/sy)
 	}
-	close(q)
-	wg.Wait()
-	return image
+	return r * math.Cos(theta), r * math.Sin(theta)
 }
 
 func (c Camera) HSize() uint32 {
@@ -159,6 +221,22 @@ func (c Camera) HalfHeight() float64 {
 	return c.halfHeight
 }
 
+func (c Camera) Sampling() Sampling {
+	return c.sampling
+}
+
+func (c Camera) Aperture() float64 {
+	return c.aperture
+}
+
+func (c Camera) MotionBlur() bool {
+	return c.motionBlur
+}
+
+func (c Camera) FocalDistance() float64 {
+	return c.focalDistance
+}
+
 func (c Camera) PixelSize() float64 {
 	return c.pixelSize
 }
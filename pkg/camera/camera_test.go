@@ -2,6 +2,8 @@ package camera
 
 import (
 	"math"
+	"os"
+	"path/filepath"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -122,3 +124,92 @@ func TestRender(t *testing.T) {
 	g.Expect(pixel.Equals(tuple.NewColor(0.38066, 0.47583, 0.2855))).To(BeTrue())
 
 }
+
+func TestThinLens(t *testing.T) {
+	g := NewGomegaWithT(t)
+	c := NewCamera(201, 101, math.Pi/2).
+		WithTransform(matrix.NewRotateY(math.Pi/4.0).Translate(0, -2, 5)).
+		WithLens(0.5, 3)
+
+	// The center of the lens behaves like a pinhole
+	pinhole := c.RayForPixelOffset(20, 30, 0, 0)
+	g.Expect(pinhole.Origin.Equals(tuple.NewPoint(0, 2, -5))).To(BeTrue())
+
+	// Every ray through the lens meets the others on the focal plane
+	inverse, err := c.Transform().Inverse()
+	g.Expect(err).To(BeNil())
+	forward := inverse.MultiplyTuple(tuple.NewVector(0, 0, -1))
+	inFocus := pinhole.Position(3 / pinhole.Direction.Dot(forward))
+	for _, lens := range [][2]float64{{0, 0}, {1, 1}, {0.2, 0.9}, {0.75, 0.5}} {
+		r := c.RayForPixelLens(20, 30, 0, 0, lens[0], lens[1])
+		g.Expect(r.Origin.Subtract(pinhole.Origin).Magnitude()).To(BeNumerically("<=", 0.5+1e-9))
+		toFocus := inFocus.Subtract(r.Origin).Normalize()
+		g.Expect(toFocus.Equals(r.Direction)).To(BeTrue())
+	}
+
+	// Points off the focal plane are seen through different directions
+	a := c.RayForPixelLens(20, 30, 0, 0, 0, 0.5)
+	b := c.RayForPixelLens(20, 30, 0, 0, 1, 0.5)
+	g.Expect(a.Origin.Subtract(b.Origin).Magnitude()).To(BeNumerically("~", 1, 1e-9))
+	g.Expect(a.Position(1).Subtract(b.Position(1)).Magnitude()).To(BeNumerically(">", 0.1))
+
+	g.Expect(func() { c.WithLens(-1, 1) }).To(Panic())
+	g.Expect(func() { c.WithLens(1, 0) }).To(Panic())
+}
+
+func TestLensFromScene(t *testing.T) {
+	g := NewGomegaWithT(t)
+	in := world.Cam{
+		Hsize:       10,
+		Vsize:       10,
+		FieldOfView: math.Pi / 3,
+		From:        world.Point{0, 0, -5},
+		To:          world.Point{0, 0, 3},
+		Up:          world.Vector{0, 1, 0},
+	}
+	c, err := FromScene(in)
+	g.Expect(err).To(BeNil())
+	g.Expect(c.Aperture()).To(Equal(0.0))
+	g.Expect(c.FocalDistance()).To(Equal(8.0))
+
+	in.Aperture = 0.2
+	in.FocalDistance = 4
+	c, err = FromScene(in)
+	g.Expect(err).To(BeNil())
+	g.Expect(c.Aperture()).To(Equal(0.2))
+	g.Expect(c.FocalDistance()).To(Equal(4.0))
+
+	in.Aperture = -1
+	_, err = FromScene(in)
+	g.Expect(err).ToNot(BeNil())
+	in.Aperture = 0
+	in.FocalDistance = -1
+	_, err = FromScene(in)
+	g.Expect(err).ToNot(BeNil())
+}
+
+func TestGLTFCamera(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	gltf := `{
+		"asset": {"version": "2.0"},
+		"scenes": [{"nodes": [0]}],
+		"nodes": [{"camera": 0, "translation": [0, 0, 5]}],
+		"cameras": [{"type": "perspective", "perspective": {"yfov": 1, "aspectRatio": 1}}]
+	}`
+	filename := filepath.Join(t.TempDir(), "camera.gltf")
+	g.Expect(os.WriteFile(filename, []byte(gltf), 0644)).To(Succeed())
+	_, in, err := world.NewWorldFromGLTF(filename)
+	g.Expect(err).To(BeNil())
+	c, err := FromScene(in)
+	g.Expect(err).To(BeNil())
+
+	// Mirroring the scene keeps glTF's +X on the right of the image and +Y at the top
+	right := c.RayForPixel(c.HSize()-1, c.VSize()/2)
+	g.Expect(right.Direction.X()).To(BeNumerically(">", 0))
+	top := c.RayForPixel(c.HSize()/2, 0)
+	g.Expect(top.Direction.Y()).To(BeNumerically(">", 0))
+	center := c.RayForPixel(c.HSize()/2, c.VSize()/2)
+	g.Expect(center.Origin.Equals(tuple.NewPoint(0, 0, -5))).To(BeTrue())
+	g.Expect(center.Direction.Z()).To(BeNumerically("~", 1, 1e-2))
+}
@@ -0,0 +1,235 @@
+package camera
+
+import (
+	"context"
+	"math/rand/v2"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/liorokman/raytrace/pkg/canvas"
+	"github.com/liorokman/raytrace/pkg/tuple"
+	"github.com/liorokman/raytrace/pkg/world"
+)
+
+// Progress describes how far along a render is
+type Progress struct {
+	// TilesDone counts the tiles finished so far, over all the passes
+	TilesDone  int
+	TotalTiles int
+	// Pass is the progressive pass being rendered, counting from 1
+	Pass        int
+	TotalPasses int
+	// Rays is the number of camera rays traced so far. Reflection, refraction and shadow
+	// rays aren't counted.
+	Rays          uint64
+	RaysPerSecond float64
+	Elapsed       time.Duration
+	// ETA is the estimated time until the render is done
+	ETA time.Duration
+}
+
+func (p Progress) Fraction() float64 {
+	if p.TotalTiles == 0 {
+		return 1
+	}
+	return float64(p.TilesDone) / float64(p.TotalTiles)
+}
+
+// RenderOptions controls how the work of rendering an image is distributed and reported
+type RenderOptions struct {
+	// TileSize is the width and height, in pixels, of the squares handed to the workers
+	TileSize int
+	// Workers is the number of goroutines rendering tiles. Defaults to the number of CPUs.
+	Workers int
+	// Progressive renders the image in several passes. The first pass traces one ray for
+	// every 8x8 block of pixels, and every following pass halves the block size until all
+	// the pixels are traced. The total number of rays is the same as a normal render.
+	Progressive bool
+	// Progress, if set, is called after every finished tile. Calls are never concurrent.
+	Progress func(Progress)
+	// PassDone, if set, is called with the image after every progressive pass
+	PassDone func(pass int, image canvas.Canvas)
+	// Integrator computes the color seen by every camera ray
+	Integrator world.Integrator
+	// Seed makes the random choices of the integrator and of jittered lights reproducible.
+	// Every pixel draws its random numbers from its own generator, so the result doesn't
+	// depend on the order the pixels are rendered in.
+	Seed uint64
+}
+
+func DefaultRenderOptions() RenderOptions {
+	return RenderOptions{
+		TileSize:   16,
+		Workers:    runtime.NumCPU(),
+		Integrator: world.Whitted{Depth: 4},
+	}
+}
+
+// progressiveBlock is the block size of the first progressive pass
+const progressiveBlock = 8
+
+type tile struct {
+	x0, y0, x1, y1 uint32
+	// block is the size of the blocks filled by every traced pixel in this pass
+	block uint32
+	// refine is set in the passes that follow a coarser pass
+	refine bool
+}
+
+// Render renders the world, blocking until the whole image is done
+func (c Camera) Render(w *world.World) canvas.Canvas {
+	image, err := c.RenderWithOptions(context.Background(), w, DefaultRenderOptions())
+	if err != nil {
+		panic(err)
+	}
+	return image
+}
+
+// RenderWithOptions renders the world tile by tile. When the context is cancelled the
+// render stops as soon as the tiles in progress are done, and the partially rendered
+// image is returned together with the context's error.
+func (c Camera) RenderWithOptions(ctx context.Context, w *world.World, opts RenderOptions) (canvas.Canvas, error) {
+	image := canvas.New(c.hsize, c.vsize)
+	if opts.TileSize <= 0 {
+		opts.TileSize = DefaultRenderOptions().TileSize
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	if opts.Integrator == nil {
+		opts.Integrator = DefaultRenderOptions().Integrator
+	}
+	blocks := []uint32{1}
+	if opts.Progressive {
+		blocks = []uint32{}
+		for b := uint32(progressiveBlock); b >= 1; b /= 2 {
+			blocks = append(blocks, b)
+		}
+	}
+	tileSize := uint32(opts.TileSize)
+	tilesPerPass := int(((c.hsize + tileSize - 1) / tileSize) * ((c.vsize + tileSize - 1) / tileSize))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var rays uint64
+	var firstErr error
+	var errOnce sync.Once
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	start := time.Now()
+	progress := Progress{
+		TotalTiles:  tilesPerPass * len(blocks),
+		TotalPasses: len(blocks),
+	}
+	for pass, block := range blocks {
+		progress.Pass = pass + 1
+		tiles := make(chan tile)
+		done := make(chan struct{})
+		wg := sync.WaitGroup{}
+		for i := 0; i < opts.Workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for t := range tiles {
+					if err := c.renderTile(ctx, w, image, t, opts, &rays); err != nil {
+						fail(err)
+						continue
+					}
+					done <- struct{}{}
+				}
+			}()
+		}
+		go func() {
+			defer close(tiles)
+			for y := uint32(0); y < c.vsize; y += tileSize {
+				for x := uint32(0); x < c.hsize; x += tileSize {
+					t := tile{x0: x, y0: y, x1: min(x+tileSize, c.hsize), y1: min(y+tileSize, c.vsize), block: block, refine: pass > 0}
+					select {
+					case tiles <- t:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}()
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		for range done {
+			progress.TilesDone++
+			if opts.Progress != nil {
+				progress.Rays = atomic.LoadUint64(&rays)
+				progress.Elapsed = time.Since(start)
+				if secs := progress.Elapsed.Seconds(); secs > 0 {
+					progress.RaysPerSecond = float64(progress.Rays) / secs
+				}
+				progress.ETA = time.Duration(float64(progress.Elapsed) * float64(progress.TotalTiles-progress.TilesDone) / float64(progress.TilesDone))
+				opts.Progress(progress)
+			}
+		}
+		if firstErr != nil {
+			return image, firstErr
+		}
+		if err := ctx.Err(); err != nil {
+			return image, err
+		}
+		if opts.PassDone != nil {
+			opts.PassDone(pass+1, image)
+		}
+	}
+	return image, nil
+}
+
+// renderTile traces the pixels of a tile. In a progressive pass only the pixels on the
+// pass's grid that weren't traced by a coarser pass are traced, and each one fills its
+// block.
+func (c Camera) renderTile(ctx context.Context, w *world.World, image canvas.Canvas, t tile, opts RenderOptions, rays *uint64) error {
+	coarser := 2 * t.block
+	for y := t.y0; y < t.y1; y++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if y%t.block != 0 {
+			continue
+		}
+		for x := t.x0; x < t.x1; x++ {
+			if x%t.block != 0 {
+				continue
+			}
+			if t.refine && x%coarser == 0 && y%coarser == 0 {
+				// Already traced by a previous pass
+				continue
+			}
+			rng := rand.New(rand.NewPCG(opts.Seed, uint64(y)<<32|uint64(x)))
+			color, err := c.sampling.samplePixel(x, y, func(dx, dy float64) (tuple.Color, error) {
+				atomic.AddUint64(rays, 1)
+				ray := c.RayForPixelOffset(x, y, dx, dy)
+				if c.aperture > 0 {
+					ray = c.RayForPixelLens(x, y, dx, dy, rng.Float64(), rng.Float64())
+				}
+				if c.motionBlur {
+					ray = ray.WithTime(rng.Float64())
+				}
+				return opts.Integrator.Radiance(w, ray, rng)
+			})
+			if err != nil {
+				return err
+			}
+			for by := y; by < min(y+t.block, c.vsize); by++ {
+				for bx := x; bx < min(x+t.block, c.hsize); bx++ {
+					image.SetPixel(bx, by, color)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package camera
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/liorokman/raytrace/pkg/canvas"
+	"github.com/liorokman/raytrace/pkg/fixtures"
+	"github.com/liorokman/raytrace/pkg/matrix"
+	"github.com/liorokman/raytrace/pkg/tuple"
+	"github.com/liorokman/raytrace/pkg/world"
+)
+
+func testCamera(hsize, vsize uint32) Camera {
+	return NewCamera(hsize, vsize, math.Pi/2).
+		WithTransform(ViewTransformation(tuple.NewPoint(0, 0, -5), tuple.NewPoint(0, 0, 0), tuple.NewVector(0, 1, 0)))
+}
+
+func expectSameImage(g *WithT, a, b canvas.Canvas) {
+	g.Expect(a.Width()).To(Equal(b.Width()))
+	g.Expect(a.Height()).To(Equal(b.Height()))
+	for y := uint32(0); y < a.Height(); y++ {
+		for x := uint32(0); x < a.Width(); x++ {
+			pa, _ := a.GetPixel(x, y)
+			pb, _ := b.GetPixel(x, y)
+			g.Expect(pa).To(Equal(pb), "pixel (%d,%d)", x, y)
+		}
+	}
+}
+
+func TestRenderNonSquare(t *testing.T) {
+	g := NewGomegaWithT(t)
+	w := defaultWorld()
+	c := testCamera(21, 11)
+
+	image := c.Render(w)
+	g.Expect(image.Width()).To(Equal(uint32(21)))
+	g.Expect(image.Height()).To(Equal(uint32(11)))
+	for y := uint32(0); y < 11; y++ {
+		for x := uint32(0); x < 21; x++ {
+			expected, err := w.ColorAt(c.RayForPixel(x, y), 4)
+			g.Expect(err).To(BeNil())
+			actual, _ := image.GetPixel(x, y)
+			g.Expect(actual).To(Equal(expected))
+		}
+	}
+}
+
+func TestTiledRenderProgress(t *testing.T) {
+	g := NewGomegaWithT(t)
+	w := defaultWorld()
+	c := testCamera(20, 10)
+
+	reports := []Progress{}
+	opts := DefaultRenderOptions()
+	opts.TileSize = 8
+	opts.Workers = 3
+	opts.Progress = func(p Progress) {
+		reports = append(reports, p)
+	}
+	image, err := c.RenderWithOptions(context.Background(), w, opts)
+	g.Expect(err).To(BeNil())
+	expectSameImage(g, image, c.Render(w))
+
+	// 3 columns and 2 rows of tiles
+	g.Expect(reports).To(HaveLen(6))
+	for i, p := range reports {
+		g.Expect(p.TilesDone).To(Equal(i + 1))
+		g.Expect(p.TotalTiles).To(Equal(6))
+		g.Expect(p.Pass).To(Equal(1))
+	}
+	last := reports[len(reports)-1]
+	g.Expect(last.Rays).To(Equal(uint64(200)))
+	g.Expect(last.Fraction()).To(Equal(1.0))
+	g.Expect(last.ETA).To(BeZero())
+}
+
+func TestProgressiveRender(t *testing.T) {
+	g := NewGomegaWithT(t)
+	w := defaultWorld()
+	c := testCamera(21, 13)
+
+	opts := DefaultRenderOptions()
+	opts.TileSize = 5
+	opts.Progressive = true
+	var lastProgress Progress
+	opts.Progress = func(p Progress) {
+		lastProgress = p
+	}
+	passes := []int{}
+	opts.PassDone = func(pass int, image canvas.Canvas) {
+		passes = append(passes, pass)
+		if pass == 1 {
+			// The first pass fills every 8x8 block with the color of its corner
+			corner, _ := image.GetPixel(8, 8)
+			inside, _ := image.GetPixel(15, 12)
+			g.Expect(inside).To(Equal(corner))
+		}
+	}
+	image, err := c.RenderWithOptions(context.Background(), w, opts)
+	g.Expect(err).To(BeNil())
+	g.Expect(passes).To(Equal([]int{1, 2, 3, 4}))
+	g.Expect(lastProgress.TotalPasses).To(Equal(4))
+	// Every pixel is traced exactly once
+	g.Expect(lastProgress.Rays).To(Equal(uint64(21 * 13)))
+	expectSameImage(g, image, c.Render(w))
+}
+
+func TestRenderCancellation(t *testing.T) {
+	g := NewGomegaWithT(t)
+	w := defaultWorld()
+	c := testCamera(40, 40)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := DefaultRenderOptions()
+	opts.TileSize = 4
+	opts.Workers = 1
+	tiles := 0
+	opts.Progress = func(p Progress) {
+		tiles = p.TilesDone
+		if p.TilesDone == 3 {
+			cancel()
+		}
+	}
+	image, err := c.RenderWithOptions(ctx, w, opts)
+	g.Expect(err).To(Equal(context.Canceled))
+	g.Expect(image).ToNot(BeNil())
+	g.Expect(tiles).To(BeNumerically("<", 100))
+}
+
+func TestPathTracedRenderIsReproducible(t *testing.T) {
+	g := NewGomegaWithT(t)
+	w := defaultWorld()
+	c := testCamera(12, 12)
+
+	opts := DefaultRenderOptions()
+	opts.TileSize = 4
+	opts.Integrator = world.DefaultPathTracer()
+	opts.Seed = 42
+	first, err := c.RenderWithOptions(context.Background(), w, opts)
+	g.Expect(err).To(BeNil())
+	opts.Workers = 1
+	second, err := c.RenderWithOptions(context.Background(), w, opts)
+	g.Expect(err).To(BeNil())
+	expectSameImage(g, first, second)
+}
+
+func TestJitteredLightRenderIsReproducible(t *testing.T) {
+	g := NewGomegaWithT(t)
+	w := defaultWorld()
+	w.Lights = []fixtures.Light{fixtures.NewAreaLight(tuple.NewPoint(-11, 9, -11), tuple.NewVector(2, 0, 0), 3, tuple.NewVector(0, 2, 0), 3, tuple.NewColor(1, 1, 1), true)}
+	c := testCamera(12, 12)
+
+	opts := DefaultRenderOptions()
+	opts.TileSize = 4
+	opts.Seed = 5
+	first, err := c.RenderWithOptions(context.Background(), w, opts)
+	g.Expect(err).To(BeNil())
+	opts.Workers = 1
+	second, err := c.RenderWithOptions(context.Background(), w, opts)
+	g.Expect(err).To(BeNil())
+	expectSameImage(g, first, second)
+}
+
+func TestDepthOfFieldRender(t *testing.T) {
+	g := NewGomegaWithT(t)
+	w := defaultWorld()
+	c := testCamera(12, 12).WithLens(0.5, 2)
+
+	opts := DefaultRenderOptions()
+	opts.TileSize = 4
+	opts.Seed = 7
+	first, err := c.RenderWithOptions(context.Background(), w, opts)
+	g.Expect(err).To(BeNil())
+	second, err := c.RenderWithOptions(context.Background(), w, opts)
+	g.Expect(err).To(BeNil())
+	expectSameImage(g, first, second)
+
+	// The sphere is out of focus, so the blurred image differs from the pinhole one
+	sharp := testCamera(12, 12).Render(w)
+	differs := false
+	for y := uint32(0); y < 12; y++ {
+		for x := uint32(0); x < 12; x++ {
+			a, _ := first.GetPixel(x, y)
+			b, _ := sharp.GetPixel(x, y)
+			if !a.Equals(b) {
+				differs = true
+			}
+		}
+	}
+	g.Expect(differs).To(BeTrue())
+}
+
+func TestMotionBlurRender(t *testing.T) {
+	g := NewGomegaWithT(t)
+	w := defaultWorld()
+	w.SetShape(0, w.Shape(0).WithMotion(matrix.NewTranslation(-1.5, 0, 0), matrix.NewTranslation(1.5, 0, 0)))
+	c := testCamera(12, 12).WithMotionBlur(true)
+	g.Expect(c.MotionBlur()).To(BeTrue())
+
+	opts := DefaultRenderOptions()
+	opts.TileSize = 4
+	opts.Seed = 3
+	first, err := c.RenderWithOptions(context.Background(), w, opts)
+	g.Expect(err).To(BeNil())
+	second, err := c.RenderWithOptions(context.Background(), w, opts)
+	g.Expect(err).To(BeNil())
+	expectSameImage(g, first, second)
+
+	// Without motion blur every ray sees the sphere where it starts
+	still := testCamera(12, 12).Render(w)
+	differs := false
+	for y := uint32(0); y < 12; y++ {
+		for x := uint32(0); x < 12; x++ {
+			a, _ := first.GetPixel(x, y)
+			b, _ := still.GetPixel(x, y)
+			if !a.Equals(b) {
+				differs = true
+			}
+		}
+	}
+	g.Expect(differs).To(BeTrue())
+}
@@ -0,0 +1,316 @@
+package camera
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/liorokman/raytrace/pkg/tuple"
+	"github.com/liorokman/raytrace/pkg/world"
+)
+
+type SamplingMode int
+
+const (
+	// SingleSample fires one ray through the center of each pixel
+	SingleSample SamplingMode = iota
+	// RegularSampling fires Samples x Samples rays on a regular grid
+	RegularSampling SamplingMode = iota
+	// JitteredSampling fires Samples x Samples rays, each placed randomly inside its grid cell
+	JitteredSampling SamplingMode = iota
+	// AdaptiveSampling starts with the corners of the pixel and subdivides only the
+	// areas where the samples disagree, up to a resolution of Samples x Samples
+	AdaptiveSampling SamplingMode = iota
+)
+
+const (
+	single   = "single"
+	regular  = "regular"
+	jittered = "jittered"
+	adaptive = "adaptive"
+
+	box      = "box"
+	tent     = "tent"
+	gaussian = "gaussian"
+)
+
+// Filter weighs the contribution of a sample to a pixel, based on the distance of the
+// sample from the center of the pixel, measured in pixels.
+type Filter interface {
+	Radius() float64
+	Weight(dx, dy float64) float64
+}
+
+type boxFilter struct {
+	radius float64
+}
+
+// NewBoxFilter gives all the samples within the radius the same weight
+func NewBoxFilter(radius float64) Filter {
+	return boxFilter{radius: radius}
+}
+
+func (f boxFilter) Radius() float64 {
+	return f.radius
+}
+
+func (f boxFilter) Weight(dx, dy float64) float64 {
+	return 1.0
+}
+
+type tentFilter struct {
+	radius float64
+}
+
+// NewTentFilter weighs samples linearly, falling off to zero at the radius
+func NewTentFilter(radius float64) Filter {
+	return tentFilter{radius: radius}
+}
+
+func (f tentFilter) Radius() float64 {
+	return f.radius
+}
+
+func (f tentFilter) Weight(dx, dy float64) float64 {
+	return math.Max(0, f.radius-math.Abs(dx)) * math.Max(0, f.radius-math.Abs(dy))
+}
+
+type gaussianFilter struct {
+	radius float64
+	alpha  float64
+	edge   float64
+}
+
+// NewGaussianFilter weighs samples by a gaussian that's shifted down to reach zero at
+// the radius
+func NewGaussianFilter(radius float64) Filter {
+	alpha := 2.0
+	return gaussianFilter{
+		radius: radius,
+		alpha:  alpha,
+		edge:   math.Exp(-alpha * radius * radius),
+	}
+}
+
+func (f gaussianFilter) Radius() float64 {
+	return f.radius
+}
+
+func (f gaussianFilter) Weight(dx, dy float64) float64 {
+	g := func(d float64) float64 {
+		return math.Max(0, math.Exp(-f.alpha*d*d)-f.edge)
+	}
+	return g(dx) * g(dy)
+}
+
+// Sampling describes how many rays are fired for every pixel, and how the results are
+// combined into the pixel's color.
+type Sampling struct {
+	Mode SamplingMode
+	// Samples is the number of samples along each axis of the pixel
+	Samples int
+	// Threshold is the color difference between neighbouring samples that makes the
+	// adaptive sampler look closer
+	Threshold float64
+	// Filter combines the samples. Samples are spread over the filter's radius, so a
+	// filter wider than half a pixel overlaps the neighbouring pixels.
+	Filter Filter
+	// Seed makes the jittered sample positions reproducible
+	Seed int64
+}
+
+func DefaultSampling() Sampling {
+	return Sampling{
+		Mode:      SingleSample,
+		Samples:   1,
+		Threshold: 0.1,
+		Filter:    NewBoxFilter(0.5),
+	}
+}
+
+// SamplingFromScene translates the sampling section of a scene file's camera
+func SamplingFromScene(in world.CamSampling) (Sampling, error) {
+	retval := DefaultSampling()
+	switch in.Mode {
+	case "", single:
+		retval.Mode = SingleSample
+	case regular:
+		retval.Mode = RegularSampling
+	case jittered:
+		retval.Mode = JitteredSampling
+	case adaptive:
+		retval.Mode = AdaptiveSampling
+	default:
+		return Sampling{}, fmt.Errorf("Unsupported sampling mode '%s'", in.Mode)
+	}
+	if in.Samples < 0 {
+		return Sampling{}, fmt.Errorf("Number of samples can't be negative")
+	} else if in.Samples > 0 {
+		retval.Samples = in.Samples
+	} else if retval.Mode != SingleSample {
+		retval.Samples = 4
+	}
+	if in.Threshold < 0 {
+		return Sampling{}, fmt.Errorf("Sampling threshold can't be negative")
+	} else if in.Threshold > 0 {
+		retval.Threshold = in.Threshold
+	}
+	radius := 0.5
+	if in.FilterRadius < 0 {
+		return Sampling{}, fmt.Errorf("Filter radius can't be negative")
+	} else if in.FilterRadius > 0 {
+		radius = in.FilterRadius
+	}
+	switch in.Filter {
+	case "", box:
+		retval.Filter = NewBoxFilter(radius)
+	case tent:
+		retval.Filter = NewTentFilter(radius)
+	case gaussian:
+		retval.Filter = NewGaussianFilter(radius)
+	default:
+		return Sampling{}, fmt.Errorf("Unsupported sampling filter '%s'", in.Filter)
+	}
+	retval.Seed = in.Seed
+	return retval, nil
+}
+
+// sampleRNG is a small splitmix64 generator. Every pixel gets its own generator seeded
+// from its position, so the result doesn't depend on the order the pixels are rendered in.
+type sampleRNG uint64
+
+func newSampleRNG(seed int64, x, y uint32) sampleRNG {
+	return sampleRNG(uint64(seed)*0x9E3779B97F4A7C15 ^ uint64(y)<<32 ^ uint64(x))
+}
+
+func (r *sampleRNG) Float64() float64 {
+	*r += 0x9E3779B97F4A7C15
+	z := uint64(*r)
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	z = z ^ (z >> 31)
+	return float64(z>>11) / float64(1<<53)
+}
+
+type sample struct {
+	dx, dy float64 // offset from the center of the pixel
+	color  tuple.Color
+}
+
+type colorFunc func(dx, dy float64) (tuple.Color, error)
+
+// samplePixel computes the color of the pixel at (x,y). The trace function returns the
+// color seen through the given offset from the center of the pixel.
+func (s Sampling) samplePixel(x, y uint32, trace colorFunc) (tuple.Color, error) {
+	if s.Mode == SingleSample || s.Samples <= 1 {
+		return trace(0, 0)
+	}
+	radius := s.Filter.Radius()
+	var samples []sample
+	var err error
+	switch s.Mode {
+	case RegularSampling, JitteredSampling:
+		rng := newSampleRNG(s.Seed, x, y)
+		samples = make([]sample, 0, s.Samples*s.Samples)
+		cell := 2.0 * radius / float64(s.Samples)
+		for i := 0; i < s.Samples; i++ {
+			for j := 0; j < s.Samples; j++ {
+				offX, offY := 0.5, 0.5
+				if s.Mode == JitteredSampling {
+					offX, offY = rng.Float64(), rng.Float64()
+				}
+				dx := -radius + (float64(i)+offX)*cell
+				dy := -radius + (float64(j)+offY)*cell
+				c, err := trace(dx, dy)
+				if err != nil {
+					return tuple.Color{}, err
+				}
+				samples = append(samples, sample{dx: dx, dy: dy, color: c})
+			}
+		}
+	case AdaptiveSampling:
+		samples, err = s.adaptiveSamples(radius, trace)
+		if err != nil {
+			return tuple.Color{}, err
+		}
+	default:
+		return tuple.Color{}, fmt.Errorf("Unsupported sampling mode %d", s.Mode)
+	}
+	return s.reconstruct(samples), nil
+}
+
+func (s Sampling) reconstruct(samples []sample) tuple.Color {
+	retval := tuple.Black
+	total := 0.0
+	for _, smp := range samples {
+		w := s.Filter.Weight(smp.dx, smp.dy)
+		retval = retval.Add(smp.color.Mult(w))
+		total += w
+	}
+	if total == 0 {
+		// All the samples fell on the edge of the filter, fall back to a plain average
+		for _, smp := range samples {
+			retval = retval.Add(smp.color)
+		}
+		total = float64(len(samples))
+	}
+	return retval.Mult(1.0 / total)
+}
+
+// adaptiveSamples samples the corners and the center of a square area, and recursively
+// subdivides it into four quadrants whenever the corners disagree with each other.
+func (s Sampling) adaptiveSamples(radius float64, trace colorFunc) ([]sample, error) {
+	// The square at depth d is split into 2^(d-1) cells along each axis, so the deepest
+	// squares must be at least as fine as the Samples x Samples grid
+	maxDepth := 1 + int(math.Ceil(math.Log2(float64(s.Samples))))
+	cache := map[[2]float64]tuple.Color{}
+	samples := []sample{}
+	at := func(dx, dy float64) (tuple.Color, error) {
+		if c, ok := cache[[2]float64{dx, dy}]; ok {
+			return c, nil
+		}
+		c, err := trace(dx, dy)
+		if err != nil {
+			return tuple.Color{}, err
+		}
+		cache[[2]float64{dx, dy}] = c
+		samples = append(samples, sample{dx: dx, dy: dy, color: c})
+		return c, nil
+	}
+	var subdivide func(x0, y0, size float64, depth int) error
+	subdivide = func(x0, y0, size float64, depth int) error {
+		corners := [][2]float64{{x0, y0}, {x0 + size, y0}, {x0, y0 + size}, {x0 + size, y0 + size}, {x0 + size/2, y0 + size/2}}
+		colors := make([]tuple.Color, len(corners))
+		for i, c := range corners {
+			var err error
+			if colors[i], err = at(c[0], c[1]); err != nil {
+				return err
+			}
+		}
+		if depth >= maxDepth || !s.disagree(colors) {
+			return nil
+		}
+		half := size / 2
+		for _, q := range [][2]float64{{x0, y0}, {x0 + half, y0}, {x0, y0 + half}, {x0 + half, y0 + half}} {
+			if err := subdivide(q[0], q[1], half, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := subdivide(-radius, -radius, 2*radius, 1); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+func (s Sampling) disagree(colors []tuple.Color) bool {
+	for i := range colors {
+		for j := i + 1; j < len(colors); j++ {
+			d := colors[i].Subtract(colors[j])
+			if math.Abs(d.Red()) > s.Threshold || math.Abs(d.Green()) > s.Threshold || math.Abs(d.Blue()) > s.Threshold {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package camera
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/liorokman/raytrace/pkg/tuple"
+	"github.com/liorokman/raytrace/pkg/world"
+)
+
+// halfPlane is white to the left of x and black to its right, counting the number of
+// samples taken
+func halfPlane(edge float64, count *int) colorFunc {
+	return func(dx, dy float64) (tuple.Color, error) {
+		*count++
+		if dx < edge {
+			return tuple.White, nil
+		}
+		return tuple.Black, nil
+	}
+}
+
+func TestSingleSample(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	count := 0
+	c, err := DefaultSampling().samplePixel(0, 0, halfPlane(0.1, &count))
+	g.Expect(err).To(BeNil())
+	g.Expect(count).To(Equal(1))
+	g.Expect(c).To(Equal(tuple.White))
+
+	cam := NewCamera(201, 101, math.Pi/2)
+	g.Expect(cam.RayForPixelOffset(10, 20, 0, 0)).To(Equal(cam.RayForPixel(10, 20)))
+	g.Expect(cam.RayForPixelOffset(10, 20, 0.5, 0.5).Direction.Equals(cam.RayForPixelOffset(11, 21, -0.5, -0.5).Direction)).To(BeTrue())
+}
+
+func TestRegularSampling(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	s := Sampling{Mode: RegularSampling, Samples: 4, Filter: NewBoxFilter(0.5)}
+	count := 0
+	c, err := s.samplePixel(0, 0, halfPlane(0, &count))
+	g.Expect(err).To(BeNil())
+	g.Expect(count).To(Equal(16))
+	g.Expect(c.Equals(tuple.NewColor(0.5, 0.5, 0.5))).To(BeTrue())
+
+	// A tent filter prefers the samples in the middle of the pixel
+	s.Filter = NewTentFilter(0.5)
+	count = 0
+	c, err = s.samplePixel(0, 0, halfPlane(0.2, &count))
+	g.Expect(err).To(BeNil())
+	g.Expect(c.Red()).To(BeNumerically(">", 0.75))
+}
+
+func TestJitteredSamplingIsReproducible(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	s := Sampling{Mode: JitteredSampling, Samples: 3, Filter: NewBoxFilter(0.5), Seed: 17}
+	positions := func(x, y uint32) [][2]float64 {
+		retval := [][2]float64{}
+		_, err := s.samplePixel(x, y, func(dx, dy float64) (tuple.Color, error) {
+			g.Expect(dx).To(BeNumerically(">=", -0.5))
+			g.Expect(dx).To(BeNumerically("<", 0.5))
+			g.Expect(dy).To(BeNumerically(">=", -0.5))
+			g.Expect(dy).To(BeNumerically("<", 0.5))
+			retval = append(retval, [2]float64{dx, dy})
+			return tuple.Black, nil
+		})
+		g.Expect(err).To(BeNil())
+		return retval
+	}
+	first := positions(3, 4)
+	g.Expect(first).To(HaveLen(9))
+	g.Expect(positions(3, 4)).To(Equal(first))
+	g.Expect(positions(4, 3)).ToNot(Equal(first))
+}
+
+func TestAdaptiveSampling(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	s := Sampling{Mode: AdaptiveSampling, Samples: 8, Threshold: 0.1, Filter: NewBoxFilter(0.5)}
+
+	// A uniform pixel only needs the initial samples
+	count := 0
+	c, err := s.samplePixel(0, 0, halfPlane(1, &count))
+	g.Expect(err).To(BeNil())
+	g.Expect(count).To(Equal(5))
+	g.Expect(c).To(Equal(tuple.White))
+
+	// An edge in the pixel is refined, but fewer rays are fired than a full grid
+	count = 0
+	c, err = s.samplePixel(0, 0, halfPlane(0.1, &count))
+	g.Expect(err).To(BeNil())
+	g.Expect(count).To(BeNumerically(">", 5))
+	g.Expect(count).To(BeNumerically("<", 64))
+	g.Expect(c.Red()).To(BeNumerically(">", 0.3))
+	g.Expect(c.Red()).To(BeNumerically("<", 0.9))
+}
+
+func TestAdaptiveSamplingResolution(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// A pixel where every sample disagrees with the others is subdivided all the way down
+	// to the Samples x Samples grid: the corners of its cells, and their centers
+	noise := func(count *int) colorFunc {
+		return func(dx, dy float64) (tuple.Color, error) {
+			*count++
+			return tuple.NewColor(float64(*count%2), 0, 0), nil
+		}
+	}
+	for samples, expected := range map[int]int{2: 3*3 + 2*2, 4: 5*5 + 4*4, 8: 9*9 + 8*8} {
+		s := Sampling{Mode: AdaptiveSampling, Samples: samples, Threshold: 0.1, Filter: NewBoxFilter(0.5)}
+		count := 0
+		_, err := s.samplePixel(0, 0, noise(&count))
+		g.Expect(err).To(BeNil())
+		g.Expect(count).To(Equal(expected), "samples=%d", samples)
+	}
+
+	// A resolution that isn't a power of two is rounded up to the next one
+	s := Sampling{Mode: AdaptiveSampling, Samples: 3, Threshold: 0.1, Filter: NewBoxFilter(0.5)}
+	count := 0
+	_, err := s.samplePixel(0, 0, noise(&count))
+	g.Expect(err).To(BeNil())
+	g.Expect(count).To(Equal(5*5 + 4*4))
+}
+
+func TestFilters(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	for _, f := range []Filter{NewBoxFilter(1), NewTentFilter(1), NewGaussianFilter(1)} {
+		g.Expect(f.Radius()).To(Equal(1.0))
+		g.Expect(f.Weight(0, 0)).To(BeNumerically(">", 0))
+		g.Expect(f.Weight(0, 0)).To(BeNumerically(">=", f.Weight(0.5, 0.5)))
+	}
+	g.Expect(NewTentFilter(1).Weight(1, 0)).To(Equal(0.0))
+	g.Expect(NewGaussianFilter(1).Weight(0, 1)).To(BeNumerically("~", 0, 1e-9))
+}
+
+func TestSamplingFromScene(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	s, err := SamplingFromScene(world.CamSampling{})
+	g.Expect(err).To(BeNil())
+	g.Expect(s.Mode).To(Equal(SingleSample))
+
+	s, err = SamplingFromScene(world.CamSampling{Mode: "adaptive", Samples: 8, Threshold: 0.05, Filter: "gaussian", FilterRadius: 1})
+	g.Expect(err).To(BeNil())
+	g.Expect(s.Mode).To(Equal(AdaptiveSampling))
+	g.Expect(s.Samples).To(Equal(8))
+	g.Expect(s.Threshold).To(Equal(0.05))
+	g.Expect(s.Filter.Radius()).To(Equal(1.0))
+
+	s, err = SamplingFromScene(world.CamSampling{Mode: "jittered"})
+	g.Expect(err).To(BeNil())
+	g.Expect(s.Samples).To(Equal(4))
+
+	_, err = SamplingFromScene(world.CamSampling{Mode: "random"})
+	g.Expect(err).ToNot(BeNil())
+	_, err = SamplingFromScene(world.CamSampling{Filter: "mitchell"})
+	g.Expect(err).ToNot(BeNil())
+	_, err = SamplingFromScene(world.CamSampling{Samples: -1})
+	g.Expect(err).ToNot(BeNil())
+}
+
+func TestRenderWithSupersampling(t *testing.T) {
+	g := NewGomegaWithT(t)
+	w := defaultWorld()
+	c := NewCamera(11, 11, math.Pi/2).
+		WithTransform(ViewTransformation(tuple.NewPoint(0, 0, -5), tuple.NewPoint(0, 0, 0), tuple.NewVector(0, 1, 0))).
+		WithSampling(Sampling{Mode: RegularSampling, Samples: 3})
+
+	image := c.Render(w)
+	// The center of the sphere is smooth, so supersampling doesn't change it much
+	pixel, err := image.GetPixel(5, 5)
+	g.Expect(err).To(BeNil())
+	g.Expect(pixel.Red()).To(BeNumerically("~", 0.38066, 0.02))
+}
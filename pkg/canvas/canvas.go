@@ -3,9 +3,7 @@ package canvas
 import (
 	"fmt"
 	"io"
-	"math"
 	"sync"
-	"text/template"
 
 	"github.com/liorokman/raytrace/pkg/tuple"
 )
@@ -16,6 +14,11 @@ type Canvas interface {
 	Width() uint32
 	Height() uint32
 	WritePPM(wr io.Writer) error
+	WriteP6(wr io.Writer) error
+	WritePNG(wr io.Writer, bitDepth int) error
+	WriteJPEG(wr io.Writer, quality int) error
+	WriteHDR(wr io.Writer) error
+	Encode(wr io.Writer, f Format, opts EncodeOptions) error
 }
 
 type canvas struct {
@@ -63,53 +66,3 @@ func (c *canvas) SetPixel(x, y uint32, v tuple.Color) error {
 	c.Data[c.calcPos(x, y)] = v
 	return nil
 }
-
-func (c *canvas) WritePPM(wr io.Writer) error {
-	c.lock.Lock()
-	defer c.lock.Unlock()
-	ppmTemplate := `P3
-{{ .Width }} {{ .Height }}
-255{{- $pos := 0 }}{{$w := .Width}}
-{{ range $index, $element := .Data }}{{- $scaled := $element.Mult 255  }}
-{{- ceil $scaled.Red | clamp }} {{ ceil $scaled.Green | clamp }} {{ ceil $scaled.Blue | clamp -}}
-{{- $pos = newpos $pos $scaled -}}{{ if or (ge $pos 56) (isnewline $index $w) }}{{ $pos = 0 }}
-{{ else }} {{ end }}{{end}}
-
-	`
-	funcMap := template.FuncMap{
-		"isnewline": func(loc int, width uint32) bool {
-			return (loc+1)%int(width) == 0
-		},
-		"ceil": func(v float64) int { return int(math.Ceil(v)) },
-		"clamp": func(v int) int {
-			if v > 255 {
-				return 255
-			} else if v < 0 {
-				return 0
-			}
-			return v
-		},
-		"newpos": func(pos int, element tuple.Color) int {
-			tmp1 := func(f float64) int {
-				if f <= 9.0 {
-					return 1
-				} else if f <= 99.0 {
-					return 2
-				} else {
-					return 3
-				}
-			}
-			x := 2 // two spaces between the three numbers
-			x = x + tmp1(element.Red())
-			x = x + tmp1(element.Green())
-			x = x + tmp1(element.Blue())
-			return x + pos
-		},
-	}
-
-	tmpl, err := template.New("ppm").Funcs(funcMap).Parse(ppmTemplate)
-	if err != nil {
-		return err
-	}
-	return tmpl.Execute(wr, c)
-}
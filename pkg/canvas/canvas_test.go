@@ -1,7 +1,15 @@
 package canvas
 
 import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
 	"os"
+	"strings"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -47,3 +55,234 @@ func XTestWritePPM(t *testing.T) {
 	err = canv.WritePPM(os.Stdout)
 	g.Expect(err).To(BeNil())
 }
+
+func gradientCanvas(width, height uint32) *canvas {
+	canv := New(width, height)
+	for x := uint32(0); x < width; x++ {
+		for y := uint32(0); y < height; y++ {
+			canv.SetPixel(x, y, tuple.NewColor(float64(x)/float64(width), float64(y)/float64(height), 0.5))
+		}
+	}
+	return canv
+}
+
+func TestWritePlainPPM(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	canv := New(10, 2)
+	for x := uint32(0); x < canv.Width(); x++ {
+		for y := uint32(0); y < canv.Height(); y++ {
+			canv.SetPixel(x, y, tuple.NewColor(1, 0.8, 0.6))
+		}
+	}
+	canv.SetPixel(0, 0, tuple.NewColor(1.5, -0.5, 0))
+	buf := bytes.Buffer{}
+	g.Expect(canv.WritePPM(&buf)).To(Succeed())
+	lines := strings.Split(buf.String(), "\n")
+	g.Expect(lines[0]).To(Equal("P3"))
+	g.Expect(lines[1]).To(Equal("10 2"))
+	g.Expect(lines[2]).To(Equal("255"))
+	g.Expect(lines[3]).To(HavePrefix("255 0 0 255 204 153 "))
+	values := strings.Fields(strings.Join(lines[3:], " "))
+	g.Expect(values).To(HaveLen(10 * 2 * 3))
+	for _, l := range lines {
+		g.Expect(len(l)).To(BeNumerically("<=", 70))
+	}
+	g.Expect(buf.String()).To(HaveSuffix("\n"))
+}
+
+func TestWriteP6(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	canv := New(2, 1)
+	canv.SetPixel(1, 0, tuple.NewColor(1, 0.5, 0))
+	buf := bytes.Buffer{}
+	g.Expect(canv.WriteP6(&buf)).To(Succeed())
+	g.Expect(buf.Bytes()).To(Equal(append([]byte("P6\n2 1\n255\n"), 0, 0, 0, 255, 128, 0)))
+}
+
+func TestWritePNG(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	canv := gradientCanvas(16, 8)
+	for _, depth := range []int{8, 16} {
+		buf := bytes.Buffer{}
+		g.Expect(canv.WritePNG(&buf, depth)).To(Succeed())
+		img, err := png.Decode(&buf)
+		g.Expect(err).To(BeNil())
+		g.Expect(img.Bounds().Dx()).To(Equal(16))
+		g.Expect(img.Bounds().Dy()).To(Equal(8))
+		r, gr, b, _ := img.At(8, 4).RGBA()
+		g.Expect(float64(r) / 65535).To(BeNumerically("~", 0.5, 0.01))
+		g.Expect(float64(gr) / 65535).To(BeNumerically("~", 0.5, 0.01))
+		g.Expect(float64(b) / 65535).To(BeNumerically("~", 0.5, 0.01))
+	}
+	buf := bytes.Buffer{}
+	g.Expect(canv.WritePNG(&buf, 16)).To(Succeed())
+	img, err := png.Decode(&buf)
+	g.Expect(err).To(BeNil())
+	// 16 bits keep values that 8 bits round away
+	r, _, _, _ := img.At(1, 0).RGBA()
+	g.Expect(r).To(Equal(uint32(4096)))
+
+	g.Expect(canv.WritePNG(&buf, 12)).ToNot(Succeed())
+}
+
+func TestWriteJPEG(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	canv := gradientCanvas(32, 32)
+	low, high := bytes.Buffer{}, bytes.Buffer{}
+	g.Expect(canv.WriteJPEG(&low, 10)).To(Succeed())
+	g.Expect(canv.WriteJPEG(&high, 100)).To(Succeed())
+	g.Expect(low.Len()).To(BeNumerically("<", high.Len()))
+	img, err := jpeg.Decode(&high)
+	g.Expect(err).To(BeNil())
+	g.Expect(img.Bounds().Dx()).To(Equal(32))
+
+	g.Expect(canv.WriteJPEG(&low, 0)).ToNot(Succeed())
+	g.Expect(canv.WriteJPEG(&low, 101)).ToNot(Succeed())
+}
+
+// readHDR decodes the pixels of a Radiance file written by WriteHDR
+func readHDR(g *WithT, in *bufio.Reader) (int, int, [][3]float64) {
+	for {
+		line, err := in.ReadString('\n')
+		g.Expect(err).To(BeNil())
+		if line == "\n" {
+			break
+		}
+	}
+	var width, height int
+	line, err := in.ReadString('\n')
+	g.Expect(err).To(BeNil())
+	_, err = fmt.Sscanf(line, "-Y %d +X %d\n", &height, &width)
+	g.Expect(err).To(BeNil())
+
+	retval := make([][3]float64, 0, width*height)
+	for y := 0; y < height; y++ {
+		scanline := make([][4]byte, width)
+		header := make([]byte, 4)
+		_, err := io.ReadFull(in, header)
+		g.Expect(err).To(BeNil())
+		g.Expect(header).To(Equal([]byte{2, 2, byte(width >> 8), byte(width & 0xff)}))
+		for ch := 0; ch < 4; ch++ {
+			for pos := 0; pos < width; {
+				count, err := in.ReadByte()
+				g.Expect(err).To(BeNil())
+				if count > 128 {
+					val, err := in.ReadByte()
+					g.Expect(err).To(BeNil())
+					for i := 0; i < int(count)-128; i++ {
+						scanline[pos][ch] = val
+						pos++
+					}
+				} else {
+					for i := 0; i < int(count); i++ {
+						scanline[pos][ch], err = in.ReadByte()
+						g.Expect(err).To(BeNil())
+						pos++
+					}
+				}
+			}
+		}
+		for _, p := range scanline {
+			f := 0.0
+			if p[3] != 0 {
+				f = math.Ldexp(1, int(p[3])-(128+8))
+			}
+			retval = append(retval, [3]float64{float64(p[0]) * f, float64(p[1]) * f, float64(p[2]) * f})
+		}
+	}
+	return width, height, retval
+}
+
+func TestWriteHDR(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	canv := gradientCanvas(20, 3)
+	canv.SetPixel(3, 1, tuple.NewColor(12.5, 0, 3))
+	buf := bytes.Buffer{}
+	g.Expect(canv.WriteHDR(&buf)).To(Succeed())
+	g.Expect(buf.String()).To(HavePrefix("#?RADIANCE\n"))
+
+	width, height, pixels := readHDR(g, bufio.NewReader(&buf))
+	g.Expect(width).To(Equal(20))
+	g.Expect(height).To(Equal(3))
+	for y := uint32(0); y < 3; y++ {
+		for x := uint32(0); x < 20; x++ {
+			expected, _ := canv.GetPixel(x, y)
+			actual := pixels[y*20+x]
+			g.Expect(actual[0]).To(BeNumerically("~", expected.Red(), 0.01*math.Max(1, expected.Red())))
+			g.Expect(actual[1]).To(BeNumerically("~", expected.Green(), 0.01*math.Max(1, expected.Green())))
+			g.Expect(actual[2]).To(BeNumerically("~", expected.Blue(), 0.01*math.Max(1, expected.Blue())))
+		}
+	}
+}
+
+func TestFormatForFilename(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tests := map[string]Format{
+		"out.ppm":        PPMFormat,
+		"out.PNG":        PNGFormat,
+		"dir/out.jpg":    JPEGFormat,
+		"out.jpeg":       JPEGFormat,
+		"render.hdr":     HDRFormat,
+		"a.b/render.pic": HDRFormat,
+	}
+	for name, expected := range tests {
+		f, err := FormatForFilename(name)
+		g.Expect(err).To(BeNil())
+		g.Expect(f).To(Equal(expected), name)
+	}
+	_, err := FormatForFilename("out.gif")
+	g.Expect(err).ToNot(BeNil())
+	_, err = FormatForFilename("out")
+	g.Expect(err).ToNot(BeNil())
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	canv := gradientCanvas(5, 3)
+	writers := map[string]func(io.Writer) error{
+		"P3":  canv.WritePPM,
+		"P6":  canv.WriteP6,
+		"PNG": func(w io.Writer) error { return canv.WritePNG(w, 16) },
+	}
+	for name, write := range writers {
+		buf := bytes.Buffer{}
+		g.Expect(write(&buf)).To(Succeed())
+		decoded, err := Decode(&buf)
+		g.Expect(err).To(BeNil(), name)
+		g.Expect(decoded.Width()).To(Equal(uint32(5)), name)
+		g.Expect(decoded.Height()).To(Equal(uint32(3)), name)
+		for y := uint32(0); y < 3; y++ {
+			for x := uint32(0); x < 5; x++ {
+				expected, _ := canv.GetPixel(x, y)
+				actual, _ := decoded.GetPixel(x, y)
+				g.Expect(actual.Red()).To(BeNumerically("~", expected.Red(), 1.0/255), name)
+				g.Expect(actual.Green()).To(BeNumerically("~", expected.Green(), 1.0/255), name)
+				g.Expect(actual.Blue()).To(BeNumerically("~", expected.Blue(), 1.0/255), name)
+			}
+		}
+	}
+}
+
+func TestReadPPM(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	in := "P3\n# a comment\n2 1 # trailing comment\n10\n0 5 10\n10 10 0\n"
+	c, err := ReadPPM(strings.NewReader(in))
+	g.Expect(err).To(BeNil())
+	p, _ := c.GetPixel(0, 0)
+	g.Expect(p).To(Equal(tuple.NewColor(0, 0.5, 1)))
+	p, _ = c.GetPixel(1, 0)
+	g.Expect(p).To(Equal(tuple.NewColor(1, 1, 0)))
+
+	_, err = ReadPPM(strings.NewReader("P3\n2 1\n255\n0 0 0\n"))
+	g.Expect(err).ToNot(BeNil())
+	_, err = ReadPPM(strings.NewReader("P2\n2 1\n255\n0 0\n"))
+	g.Expect(err).ToNot(BeNil())
+}
@@ -0,0 +1,153 @@
+package canvas
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"strconv"
+
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+// Decode reads an image in any of the formats that can be read back: PPM (both plain
+// and binary), PNG and JPEG. Channel values are scaled to [0,1].
+func Decode(r io.Reader) (*canvas, error) {
+	in := bufio.NewReader(r)
+	magic, err := in.Peek(2)
+	if err != nil {
+		return nil, fmt.Errorf("Can't read image: %w", err)
+	}
+	if magic[0] == 'P' && (magic[1] == '3' || magic[1] == '6') {
+		return ReadPPM(in)
+	}
+	img, _, err := image.Decode(in)
+	if err != nil {
+		return nil, err
+	}
+	return FromImage(img), nil
+}
+
+// FromImage copies a standard library image into a new canvas
+func FromImage(img image.Image) *canvas {
+	bounds := img.Bounds()
+	c := New(uint32(bounds.Dx()), uint32(bounds.Dy()))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			c.Data[c.calcPos(uint32(x-bounds.Min.X), uint32(y-bounds.Min.Y))] = tuple.NewColor(float64(r)/65535, float64(g)/65535, float64(b)/65535)
+		}
+	}
+	return c
+}
+
+// ppmReader splits a PPM header into its whitespace separated tokens, skipping comments
+type ppmReader struct {
+	in *bufio.Reader
+}
+
+func (p ppmReader) token() (string, error) {
+	tok := []byte{}
+	for {
+		b, err := p.in.ReadByte()
+		if err == io.EOF && len(tok) > 0 {
+			return string(tok), nil
+		} else if err != nil {
+			return "", err
+		}
+		switch {
+		case b == '#' && len(tok) == 0:
+			if _, err := p.in.ReadString('\n'); err != nil {
+				return "", err
+			}
+		case b == ' ' || b == '\t' || b == '\n' || b == '\r':
+			if len(tok) > 0 {
+				return string(tok), nil
+			}
+		default:
+			tok = append(tok, b)
+		}
+	}
+}
+
+func (p ppmReader) number(name string) (int, error) {
+	tok, err := p.token()
+	if err != nil {
+		return 0, fmt.Errorf("Can't read the PPM %s: %w", name, err)
+	}
+	n, err := strconv.Atoi(tok)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("Invalid PPM %s '%s'", name, tok)
+	}
+	return n, nil
+}
+
+// ReadPPM reads a plain (P3) or binary (P6) PPM image
+func ReadPPM(r io.Reader) (*canvas, error) {
+	in, ok := r.(*bufio.Reader)
+	if !ok {
+		in = bufio.NewReader(r)
+	}
+	p := ppmReader{in: in}
+	magic, err := p.token()
+	if err != nil {
+		return nil, fmt.Errorf("Can't read the PPM header: %w", err)
+	}
+	if magic != "P3" && magic != "P6" {
+		return nil, fmt.Errorf("Unsupported PPM type '%s'", magic)
+	}
+	width, err := p.number("width")
+	if err != nil {
+		return nil, err
+	}
+	height, err := p.number("height")
+	if err != nil {
+		return nil, err
+	}
+	maxVal, err := p.number("maximum value")
+	if err != nil {
+		return nil, err
+	}
+	if maxVal == 0 || maxVal > 65535 {
+		return nil, fmt.Errorf("Invalid PPM maximum value %d", maxVal)
+	}
+	c := New(uint32(width), uint32(height))
+	scale := 1.0 / float64(maxVal)
+	rgb := [3]float64{}
+	for i := range c.Data {
+		for ch := 0; ch < 3; ch++ {
+			var v int
+			if magic == "P3" {
+				if v, err = p.number("pixel value"); err != nil {
+					return nil, err
+				}
+			} else {
+				if v, err = readBinarySample(in, maxVal); err != nil {
+					return nil, fmt.Errorf("Can't read the PPM pixels: %w", err)
+				}
+			}
+			rgb[ch] = float64(v) * scale
+		}
+		c.Data[i] = tuple.NewColor(rgb[0], rgb[1], rgb[2])
+	}
+	return c, nil
+}
+
+// readBinarySample reads a single channel value of a P6 file, which takes two bytes
+// when the maximum value is above 255
+func readBinarySample(in *bufio.Reader, maxVal int) (int, error) {
+	hi, err := in.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if maxVal < 256 {
+		return int(hi), nil
+	}
+	lo, err := in.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	return int(hi)<<8 | int(lo), nil
+}
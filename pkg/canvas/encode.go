@@ -0,0 +1,273 @@
+package canvas
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+type Format int
+
+const (
+	PPMFormat  Format = iota
+	PNGFormat  Format = iota
+	JPEGFormat Format = iota
+	HDRFormat  Format = iota
+)
+
+// EncodeOptions holds the format specific settings used by Encode
+type EncodeOptions struct {
+	// Binary writes PPM files in the binary P6 format instead of the ASCII P3 format
+	Binary bool
+	// BitDepth is the number of bits per channel in PNG files, either 8 or 16
+	BitDepth int
+	// Quality is the JPEG quality, in the range [1,100]
+	Quality int
+}
+
+func DefaultEncodeOptions() EncodeOptions {
+	return EncodeOptions{
+		BitDepth: 8,
+		Quality:  jpeg.DefaultQuality,
+	}
+}
+
+// FormatForFilename picks the image format matching the filename's extension
+func FormatForFilename(filename string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".ppm":
+		return PPMFormat, nil
+	case ".png":
+		return PNGFormat, nil
+	case ".jpg", ".jpeg":
+		return JPEGFormat, nil
+	case ".hdr", ".pic":
+		return HDRFormat, nil
+	default:
+		return PPMFormat, fmt.Errorf("Can't determine the image format of '%s'", filename)
+	}
+}
+
+func (c *canvas) Encode(wr io.Writer, f Format, opts EncodeOptions) error {
+	switch f {
+	case PPMFormat:
+		if opts.Binary {
+			return c.WriteP6(wr)
+		}
+		return c.WritePPM(wr)
+	case PNGFormat:
+		return c.WritePNG(wr, opts.BitDepth)
+	case JPEGFormat:
+		return c.WriteJPEG(wr, opts.Quality)
+	case HDRFormat:
+		return c.WriteHDR(wr)
+	default:
+		return fmt.Errorf("Unsupported image format %d", f)
+	}
+}
+
+// to8Bit scales a color channel from [0,1] to [0,255], rounding up the same way the
+// PPM output always did
+func to8Bit(v float64) uint8 {
+	scaled := math.Ceil(v * 255)
+	if scaled > 255 {
+		return 255
+	} else if scaled < 0 || math.IsNaN(scaled) {
+		return 0
+	}
+	return uint8(scaled)
+}
+
+func to16Bit(v float64) uint16 {
+	scaled := math.Round(v * 65535)
+	if scaled > 65535 {
+		return 65535
+	} else if scaled < 0 || math.IsNaN(scaled) {
+		return 0
+	}
+	return uint16(scaled)
+}
+
+func (c *canvas) WritePPM(wr io.Writer) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	out := bufio.NewWriter(wr)
+	fmt.Fprintf(out, "P3\n%d %d\n255\n", c.TheWidth, c.TheHeight)
+	// Lines in a plain PPM file shouldn't be longer than 70 characters
+	line := make([]byte, 0, 80)
+	for y := uint32(0); y < c.TheHeight; y++ {
+		for x := uint32(0); x < c.TheWidth; x++ {
+			p := c.Data[c.calcPos(x, y)]
+			for _, v := range []float64{p.Red(), p.Green(), p.Blue()} {
+				val := strconv.Itoa(int(to8Bit(v)))
+				if len(line)+len(val)+1 > 70 {
+					out.Write(line)
+					out.WriteByte('\n')
+					line = line[:0]
+				}
+				if len(line) > 0 {
+					line = append(line, ' ')
+				}
+				line = append(line, val...)
+			}
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+		line = line[:0]
+	}
+	return out.Flush()
+}
+
+// WriteP6 writes the canvas as a binary PPM file
+func (c *canvas) WriteP6(wr io.Writer) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	out := bufio.NewWriter(wr)
+	fmt.Fprintf(out, "P6\n%d %d\n255\n", c.TheWidth, c.TheHeight)
+	for _, p := range c.Data {
+		out.Write([]byte{to8Bit(p.Red()), to8Bit(p.Green()), to8Bit(p.Blue())})
+	}
+	return out.Flush()
+}
+
+// ToImage converts the canvas to a standard library image, with either 8 or 16 bits
+// per channel. Values outside of [0,1] are clamped.
+func (c *canvas) ToImage(bitDepth int) (image.Image, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	bounds := image.Rect(0, 0, int(c.TheWidth), int(c.TheHeight))
+	switch bitDepth {
+	case 8:
+		img := image.NewNRGBA(bounds)
+		for y := uint32(0); y < c.TheHeight; y++ {
+			for x := uint32(0); x < c.TheWidth; x++ {
+				p := c.Data[c.calcPos(x, y)]
+				img.SetNRGBA(int(x), int(y), color.NRGBA{R: to8Bit(p.Red()), G: to8Bit(p.Green()), B: to8Bit(p.Blue()), A: 255})
+			}
+		}
+		return img, nil
+	case 16:
+		img := image.NewNRGBA64(bounds)
+		for y := uint32(0); y < c.TheHeight; y++ {
+			for x := uint32(0); x < c.TheWidth; x++ {
+				p := c.Data[c.calcPos(x, y)]
+				img.SetNRGBA64(int(x), int(y), color.NRGBA64{R: to16Bit(p.Red()), G: to16Bit(p.Green()), B: to16Bit(p.Blue()), A: 65535})
+			}
+		}
+		return img, nil
+	default:
+		return nil, fmt.Errorf("Unsupported bit depth %d, only 8 and 16 bits per channel are supported", bitDepth)
+	}
+}
+
+func (c *canvas) WritePNG(wr io.Writer, bitDepth int) error {
+	img, err := c.ToImage(bitDepth)
+	if err != nil {
+		return err
+	}
+	return png.Encode(wr, img)
+}
+
+func (c *canvas) WriteJPEG(wr io.Writer, quality int) error {
+	if quality < 1 || quality > 100 {
+		return fmt.Errorf("JPEG quality must be in the range [1,100], not %d", quality)
+	}
+	img, err := c.ToImage(8)
+	if err != nil {
+		return err
+	}
+	return jpeg.Encode(wr, img, &jpeg.Options{Quality: quality})
+}
+
+// toRGBE packs a color into the shared exponent format used by Radiance HDR files
+func toRGBE(p tuple.Color) [4]byte {
+	r, g, b := math.Max(p.Red(), 0), math.Max(p.Green(), 0), math.Max(p.Blue(), 0)
+	v := math.Max(r, math.Max(g, b))
+	if v < 1e-32 || math.IsNaN(v) {
+		return [4]byte{0, 0, 0, 0}
+	}
+	frac, exp := math.Frexp(v)
+	scale := frac * 256.0 / v
+	return [4]byte{byte(r * scale), byte(g * scale), byte(b * scale), byte(exp + 128)}
+}
+
+// WriteHDR writes the canvas as a Radiance HDR file. Unlike the other formats, values
+// above 1.0 are preserved.
+func (c *canvas) WriteHDR(wr io.Writer) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	out := bufio.NewWriter(wr)
+	fmt.Fprintf(out, "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y %d +X %d\n", c.TheHeight, c.TheWidth)
+	scanline := make([][4]byte, c.TheWidth)
+	for y := uint32(0); y < c.TheHeight; y++ {
+		for x := uint32(0); x < c.TheWidth; x++ {
+			scanline[x] = toRGBE(c.Data[c.calcPos(x, y)])
+		}
+		writeRLEScanline(out, scanline)
+	}
+	return out.Flush()
+}
+
+// writeRLEScanline writes a scanline using the run length encoding that Radiance
+// readers expect. Readers only look for the encoding in scanlines between 8 and 32767
+// pixels wide, so other scanlines are written flat.
+func writeRLEScanline(out *bufio.Writer, scanline [][4]byte) {
+	width := len(scanline)
+	if width < 8 || width > 0x7fff {
+		for _, p := range scanline {
+			out.Write(p[:])
+		}
+		return
+	}
+	out.Write([]byte{2, 2, byte(width >> 8), byte(width & 0xff)})
+	const minRun = 4
+	for ch := 0; ch < 4; ch++ {
+		for pos := 0; pos < width; {
+			// Find the next run that's worth encoding
+			runStart, runLen := pos, 0
+			for runStart < width {
+				runLen = 1
+				for runStart+runLen < width && runLen < 127 && scanline[runStart+runLen][ch] == scanline[runStart][ch] {
+					runLen++
+				}
+				if runLen >= minRun {
+					break
+				}
+				runStart += runLen
+			}
+			if runLen < minRun {
+				runStart = width
+			}
+			// Everything before the run is written as literal values
+			for pos < runStart {
+				count := runStart - pos
+				if count > 128 {
+					count = 128
+				}
+				out.WriteByte(byte(count))
+				for i := 0; i < count; i++ {
+					out.WriteByte(scanline[pos+i][ch])
+				}
+				pos += count
+			}
+			if runStart < width {
+				out.Write([]byte{byte(128 + runLen), scanline[runStart][ch]})
+				pos = runStart + runLen
+			}
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package fixtures
+
+import (
+	"math"
+	"math/rand/v2"
+
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+// AreaLight is a rectangular light, spanning the parallelogram from corner along the
+// two edge vectors. It's sampled on a grid of usteps x vsteps cells.
+type AreaLight struct {
+	corner       tuple.Tuple
+	uvec, vvec   tuple.Tuple
+	usteps       int
+	vsteps       int
+	jitter       bool
+	intensity    tuple.Color
+	position     tuple.Tuple
+	cellPosition []tuple.Tuple
+}
+
+func NewAreaLight(corner, fullUVec tuple.Tuple, usteps int, fullVVec tuple.Tuple, vsteps int, intensity tuple.Color, jitter bool) AreaLight {
+	if !corner.IsPoint() {
+		panic("Area light corner can't be a vector")
+	}
+	if !fullUVec.IsVector() || !fullVVec.IsVector() {
+		panic("Area light edges must be vectors")
+	}
+	if usteps < 1 || vsteps < 1 {
+		panic("Area light must have at least one step in each direction")
+	}
+	l := AreaLight{
+		corner:    corner,
+		uvec:      fullUVec.Div(float64(usteps)),
+		vvec:      fullVVec.Div(float64(vsteps)),
+		usteps:    usteps,
+		vsteps:    vsteps,
+		jitter:    jitter,
+		intensity: intensity,
+		position:  corner.Add(fullUVec.Div(2)).Add(fullVVec.Div(2)),
+	}
+	for v := 0; v < vsteps; v++ {
+		for u := 0; u < usteps; u++ {
+			l.cellPosition = append(l.cellPosition, l.pointOnLight(u, v, 0.5, 0.5))
+		}
+	}
+	return l
+}
+
+func (l AreaLight) pointOnLight(u, v int, du, dv float64) tuple.Tuple {
+	return l.corner.Add(l.uvec.Mult(float64(u) + du)).Add(l.vvec.Mult(float64(v) + dv))
+}
+
+func (l AreaLight) Position() tuple.Tuple {
+	return l.position
+}
+
+func (l AreaLight) Intensity() tuple.Color {
+	return l.intensity
+}
+
+func (l AreaLight) IntensityAt(point tuple.Tuple) tuple.Color {
+	return l.intensity
+}
+
+func (l AreaLight) Sample(from tuple.Tuple, rng *rand.Rand) []LightSample {
+	return sampleTowards(from, l.SamplePoints(from, rng)...)
+}
+
+// Samples is the number of shadow rays used for this light
+func (l AreaLight) Samples() int {
+	return l.usteps * l.vsteps
+}
+
+func (l AreaLight) Corner() tuple.Tuple {
+	return l.corner
+}
+
+// Edges returns the two full edges of the light, as given to NewAreaLight
+func (l AreaLight) Edges() (tuple.Tuple, tuple.Tuple) {
+	return l.uvec.Mult(float64(l.usteps)), l.vvec.Mult(float64(l.vsteps))
+}
+
+// Steps returns the number of cells along each edge of the light
+func (l AreaLight) Steps() (int, int) {
+	return l.usteps, l.vsteps
+}
+
+func (l AreaLight) Jittered() bool {
+	return l.jitter
+}
+
+// SamplePoints returns a point in each of the light's cells. Without jitter, or without
+// rng, that's the center of the cell, otherwise a random point inside it.
+func (l AreaLight) SamplePoints(from tuple.Tuple, rng *rand.Rand) []tuple.Tuple {
+	if !l.jitter || rng == nil {
+		return l.cellPosition
+	}
+	retval := make([]tuple.Tuple, 0, l.Samples())
+	for v := 0; v < l.vsteps; v++ {
+		for u := 0; u < l.usteps; u++ {
+			retval = append(retval, l.pointOnLight(u, v, rng.Float64(), rng.Float64()))
+		}
+	}
+	return retval
+}
+
+// SphereLight is a spherical light. It's sampled on the disk of the sphere that faces
+// the point being lit, which is what the sphere looks like from that point.
+type SphereLight struct {
+	position  tuple.Tuple
+	radius    float64
+	samples   int
+	jitter    bool
+	intensity tuple.Color
+}
+
+func NewSphereLight(position tuple.Tuple, radius float64, samples int, intensity tuple.Color, jitter bool) SphereLight {
+	if !position.IsPoint() {
+		panic("Sphere light can't be located at a vector")
+	}
+	if radius < 0 {
+		panic("Sphere light radius can't be negative")
+	}
+	if samples < 1 {
+		panic("Sphere light must have at least one sample")
+	}
+	return SphereLight{
+		position:  position,
+		radius:    radius,
+		samples:   samples,
+		jitter:    jitter,
+		intensity: intensity,
+	}
+}
+
+func (l SphereLight) Position() tuple.Tuple {
+	return l.position
+}
+
+func (l SphereLight) Intensity() tuple.Color {
+	return l.intensity
+}
+
+func (l SphereLight) IntensityAt(point tuple.Tuple) tuple.Color {
+	return l.intensity
+}
+
+func (l SphereLight) Sample(from tuple.Tuple, rng *rand.Rand) []LightSample {
+	return sampleTowards(from, l.SamplePoints(from, rng)...)
+}
+
+func (l SphereLight) Radius() float64 {
+	return l.radius
+}
+
+func (l SphereLight) Samples() int {
+	return l.samples
+}
+
+func (l SphereLight) Jittered() bool {
+	return l.jitter
+}
+
+// SamplePoints spreads the samples over the disk facing from, using a sunflower
+// pattern so that the disk is evenly covered. Jitter rotates the pattern randomly, unless
+// rng is nil.
+func (l SphereLight) SamplePoints(from tuple.Tuple, rng *rand.Rand) []tuple.Tuple {
+	if l.samples == 1 || l.radius == 0 {
+		return []tuple.Tuple{l.position}
+	}
+	// Build an orthonormal basis for the disk
+	w := tuple.NewVector(0, 1, 0)
+	if d := from.Subtract(l.position); d.Magnitude() > 0 {
+		w = d.Normalize()
+	}
+	helper := tuple.NewVector(1, 0, 0)
+	if math.Abs(w.X()) > 0.9 {
+		helper = tuple.NewVector(0, 1, 0)
+	}
+	u := helper.Cross(w).Normalize()
+	v := w.Cross(u)
+
+	rotation := 0.0
+	if l.jitter && rng != nil {
+		rotation = rng.Float64() * 2 * math.Pi
+	}
+	goldenAngle := math.Pi * (3 - math.Sqrt(5))
+	retval := make([]tuple.Tuple, l.samples)
+	for i := range retval {
+		r := l.radius * math.Sqrt((float64(i)+0.5)/float64(l.samples))
+		theta := float64(i)*goldenAngle + rotation
+		retval[i] = l.position.Add(u.Mult(r * math.Cos(theta))).Add(v.Mult(r * math.Sin(theta)))
+	}
+	return retval
+}
@@ -1,12 +1,69 @@
 package fixtures
 
 import (
+	"math"
+	"math/rand/v2"
+
 	"github.com/liorokman/raytrace/pkg/tuple"
 )
 
+// Light is a light source in the scene.
+type Light interface {
+	// Intensity is the nominal color of the light
+	Intensity() tuple.Color
+	// IntensityAt is the color of the light arriving at the given point, before
+	// taking shadows into account
+	IntensityAt(point tuple.Tuple) tuple.Color
+	// Sample returns the directions from the given point towards the light that are
+	// used for shading and shadow testing. A point light has exactly one sample. Lights
+	// with jittered samples draw them from rng, and use the centers of their cells when
+	// rng is nil.
+	Sample(from tuple.Tuple, rng *rand.Rand) []LightSample
+}
+
+// LightSample is a single direction from a point towards a light
+type LightSample struct {
+	// Direction is the normalized vector pointing at the light
+	Direction tuple.Tuple
+	// Distance to the light along Direction, infinite for lights at infinity
+	Distance float64
+}
+
+// sampleTowards returns the samples pointing from a point at the given positions
+func sampleTowards(from tuple.Tuple, positions ...tuple.Tuple) []LightSample {
+	retval := make([]LightSample, len(positions))
+	for i, p := range positions {
+		v := p.Subtract(from)
+		retval[i] = LightSample{Direction: v.Normalize(), Distance: v.Magnitude()}
+	}
+	return retval
+}
+
+// Attenuation dims a light with the distance from it. The light's intensity is divided by
+// Constant + Linear*d + Quadratic*d^2.
+type Attenuation struct {
+	Constant  float64
+	Linear    float64
+	Quadratic float64
+}
+
+// NoAttenuation keeps the light at full strength at any distance
+func NoAttenuation() Attenuation {
+	return Attenuation{Constant: 1}
+}
+
+func (a Attenuation) Factor(distance float64) float64 {
+	d := a.Constant + a.Linear*distance + a.Quadratic*distance*distance
+	if d <= 0 {
+		return 1
+	}
+	return math.Min(1, 1/d)
+}
+
 type PointLight struct {
-	position  tuple.Tuple
-	intensity tuple.Color
+	position    tuple.Tuple
+	intensity   tuple.Color
+	attenuation Attenuation
 }
 
 func NewPointLight(position tuple.Tuple, intensity tuple.Color) PointLight {
@@ -14,11 +71,18 @@ func NewPointLight(position tuple.Tuple, intensity tuple.Color) PointLight {
 		panic("Pointlight can't be located at a vector")
 	}
 	return PointLight{
-		position:  position,
-		intensity: intensity,
+		position:    position,
+		intensity:   intensity,
+		attenuation: NoAttenuation(),
 	}
 }
 
+// WithAttenuation returns a copy of the light that gets dimmer with distance
+func (p PointLight) WithAttenuation(a Attenuation) PointLight {
+	p.attenuation = a
+	return p
+}
+
 func (p PointLight) Position() tuple.Tuple {
 	return p.position
 }
@@ -26,3 +90,15 @@ func (p PointLight) Position() tuple.Tuple {
 func (p PointLight) Intensity() tuple.Color {
 	return p.intensity
 }
+
+func (p PointLight) Attenuation() Attenuation {
+	return p.attenuation
+}
+
+func (p PointLight) IntensityAt(point tuple.Tuple) tuple.Color {
+	return p.intensity.Mult(p.attenuation.Factor(p.position.Subtract(point).Magnitude()))
+}
+
+func (p PointLight) Sample(from tuple.Tuple, rng *rand.Rand) []LightSample {
+	return sampleTowards(from, p.position)
+}
@@ -0,0 +1,136 @@
+package fixtures
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+func TestPointLightSamples(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	l := NewPointLight(tuple.NewPoint(0, 3, 4), tuple.NewColor(1, 1, 1))
+	samples := l.Sample(tuple.NewPoint(0, 0, 0), nil)
+	g.Expect(samples).To(HaveLen(1))
+	g.Expect(samples[0].Direction.Equals(tuple.NewVector(0, 0.6, 0.8))).To(BeTrue())
+	g.Expect(samples[0].Distance).To(BeNumerically("~", 5, 1e-9))
+	g.Expect(l.IntensityAt(tuple.NewPoint(100, 0, 0))).To(Equal(tuple.NewColor(1, 1, 1)))
+}
+
+func TestAttenuation(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	l := NewPointLight(tuple.NewPoint(0, 0, 0), tuple.NewColor(1, 1, 1)).
+		WithAttenuation(Attenuation{Constant: 1, Linear: 0.5, Quadratic: 0.25})
+	g.Expect(l.IntensityAt(tuple.NewPoint(0, 0, 0))).To(Equal(tuple.NewColor(1, 1, 1)))
+	g.Expect(l.IntensityAt(tuple.NewPoint(2, 0, 0)).Equals(tuple.NewColor(1.0/3, 1.0/3, 1.0/3))).To(BeTrue())
+	g.Expect(l.IntensityAt(tuple.NewPoint(0, 4, 0)).Equals(tuple.NewColor(1.0/7, 1.0/7, 1.0/7))).To(BeTrue())
+	g.Expect(l.Intensity()).To(Equal(tuple.NewColor(1, 1, 1)))
+}
+
+func TestSpotLight(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	white := tuple.NewColor(1, 1, 1)
+	l := NewSpotLight(tuple.NewPoint(0, 10, 0), tuple.NewVector(0, -2, 0), math.Pi/6, math.Pi/4, white)
+	g.Expect(l.Direction()).To(Equal(tuple.NewVector(0, -1, 0)))
+
+	// Inside the inner cone
+	g.Expect(l.IntensityAt(tuple.NewPoint(0, 0, 0))).To(Equal(white))
+	g.Expect(l.IntensityAt(tuple.NewPoint(5, 0, 0))).To(Equal(white))
+	// Between the cones the light fades
+	between := l.IntensityAt(tuple.NewPoint(0, 0, 7))
+	g.Expect(between.Red()).To(BeNumerically(">", 0))
+	g.Expect(between.Red()).To(BeNumerically("<", 1))
+	g.Expect(l.IntensityAt(tuple.NewPoint(0, 0, 8)).Red()).To(BeNumerically("<", between.Red()))
+	// Outside the outer cone and behind the light it's dark
+	g.Expect(l.IntensityAt(tuple.NewPoint(11, 0, 0))).To(Equal(tuple.Black))
+	g.Expect(l.IntensityAt(tuple.NewPoint(0, 20, 0))).To(Equal(tuple.Black))
+
+	samples := l.Sample(tuple.NewPoint(0, 0, 0), nil)
+	g.Expect(samples).To(HaveLen(1))
+	g.Expect(samples[0].Direction.Equals(tuple.NewVector(0, 1, 0))).To(BeTrue())
+	g.Expect(samples[0].Distance).To(BeNumerically("~", 10, 1e-9))
+}
+
+func TestDirectionalLight(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	l := NewDirectionalLight(tuple.NewVector(0, -3, 0), tuple.NewColor(1, 1, 1))
+	for _, p := range []tuple.Tuple{tuple.NewPoint(0, 0, 0), tuple.NewPoint(100, -50, 3)} {
+		samples := l.Sample(p, nil)
+		g.Expect(samples).To(HaveLen(1))
+		g.Expect(samples[0].Direction).To(Equal(tuple.NewVector(0, 1, 0)))
+		g.Expect(math.IsInf(samples[0].Distance, 1)).To(BeTrue())
+		g.Expect(l.IntensityAt(p)).To(Equal(tuple.NewColor(1, 1, 1)))
+	}
+}
+
+func TestAreaLight(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	corner := tuple.NewPoint(0, 0, 0)
+	l := NewAreaLight(corner, tuple.NewVector(2, 0, 0), 4, tuple.NewVector(0, 0, 1), 2, tuple.NewColor(1, 1, 1), false)
+	g.Expect(l.Samples()).To(Equal(8))
+	g.Expect(l.Position().Equals(tuple.NewPoint(1, 0, 0.5))).To(BeTrue())
+
+	samples := l.SamplePoints(corner, nil)
+	g.Expect(samples).To(HaveLen(8))
+	g.Expect(samples[0].Equals(tuple.NewPoint(0.25, 0, 0.25))).To(BeTrue())
+	g.Expect(samples[2].Equals(tuple.NewPoint(1.25, 0, 0.25))).To(BeTrue())
+	g.Expect(samples[7].Equals(tuple.NewPoint(1.75, 0, 0.75))).To(BeTrue())
+
+	// Jittered samples stay inside their cells
+	l = NewAreaLight(corner, tuple.NewVector(2, 0, 0), 4, tuple.NewVector(0, 0, 1), 2, tuple.NewColor(1, 1, 1), true)
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := 0; i < 10; i++ {
+		for ind, s := range l.SamplePoints(corner, rng) {
+			u, v := ind%4, ind/4
+			g.Expect(s.X()).To(BeNumerically(">=", float64(u)*0.5))
+			g.Expect(s.X()).To(BeNumerically("<=", float64(u+1)*0.5))
+			g.Expect(s.Z()).To(BeNumerically(">=", float64(v)*0.5))
+			g.Expect(s.Z()).To(BeNumerically("<=", float64(v+1)*0.5))
+		}
+	}
+}
+
+func TestSphereLight(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	center := tuple.NewPoint(0, 5, 0)
+	from := tuple.NewPoint(0, 0, 0)
+	l := NewSphereLight(center, 2, 20, tuple.NewColor(1, 1, 1), true)
+	samples := l.SamplePoints(from, rand.New(rand.NewPCG(1, 2)))
+	g.Expect(samples).To(HaveLen(20))
+	toCenter := center.Subtract(from)
+	for _, s := range samples {
+		// The samples lie on the disk facing the point being lit
+		g.Expect(s.Subtract(center).Magnitude()).To(BeNumerically("<=", 2))
+		g.Expect(s.Subtract(center).Dot(toCenter)).To(BeNumerically("~", 0, 1e-9))
+	}
+
+	l = NewSphereLight(center, 2, 1, tuple.NewColor(1, 1, 1), false)
+	g.Expect(l.SamplePoints(from, nil)).To(Equal([]tuple.Tuple{center}))
+	g.Expect(l.Sample(from, nil)[0].Direction.Equals(tuple.NewVector(0, 1, 0))).To(BeTrue())
+}
+
+func TestJitteredSamplesAreReproducible(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	from := tuple.NewPoint(0, 0, 0)
+	for _, l := range []Light{
+		NewAreaLight(tuple.NewPoint(-1, 5, -1), tuple.NewVector(2, 0, 0), 3, tuple.NewVector(0, 0, 2), 3, tuple.NewColor(1, 1, 1), true),
+		NewSphereLight(tuple.NewPoint(0, 5, 0), 1, 9, tuple.NewColor(1, 1, 1), true),
+	} {
+		// The same random numbers pick the same samples
+		first := l.Sample(from, rand.New(rand.NewPCG(1, 2)))
+		g.Expect(l.Sample(from, rand.New(rand.NewPCG(1, 2)))).To(Equal(first))
+		g.Expect(l.Sample(from, rand.New(rand.NewPCG(3, 4)))).ToNot(Equal(first))
+		// and without random numbers the samples aren't jittered
+		g.Expect(l.Sample(from, nil)).To(Equal(l.Sample(from, nil)))
+	}
+}
@@ -0,0 +1,131 @@
+package fixtures
+
+import (
+	"math"
+	"math/rand/v2"
+
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+// SpotLight is a point light that only shines inside a cone. The light is at full
+// strength inside the inner angle and fades smoothly to nothing at the outer angle.
+type SpotLight struct {
+	position    tuple.Tuple
+	direction   tuple.Tuple
+	inner       float64
+	outer       float64
+	cosInner    float64
+	cosOuter    float64
+	intensity   tuple.Color
+	attenuation Attenuation
+}
+
+// NewSpotLight creates a spot light. The angles are measured in radians from the
+// direction of the light to the edge of the cone.
+func NewSpotLight(position, direction tuple.Tuple, innerAngle, outerAngle float64, intensity tuple.Color) SpotLight {
+	if !position.IsPoint() {
+		panic("Spotlight can't be located at a vector")
+	}
+	if !direction.IsVector() || direction.Magnitude() == 0 {
+		panic("Spotlight direction must be a non-zero vector")
+	}
+	if innerAngle < 0 || outerAngle < innerAngle || outerAngle > math.Pi {
+		panic("Spotlight angles must satisfy 0 <= inner <= outer <= pi")
+	}
+	return SpotLight{
+		position:    position,
+		direction:   direction.Normalize(),
+		inner:       innerAngle,
+		outer:       outerAngle,
+		cosInner:    math.Cos(innerAngle),
+		cosOuter:    math.Cos(outerAngle),
+		intensity:   intensity,
+		attenuation: NoAttenuation(),
+	}
+}
+
+// WithAttenuation returns a copy of the light that gets dimmer with distance
+func (s SpotLight) WithAttenuation(a Attenuation) SpotLight {
+	s.attenuation = a
+	return s
+}
+
+func (s SpotLight) Position() tuple.Tuple {
+	return s.position
+}
+
+func (s SpotLight) Direction() tuple.Tuple {
+	return s.direction
+}
+
+func (s SpotLight) Intensity() tuple.Color {
+	return s.intensity
+}
+
+// Angles returns the inner and outer angles of the cone, in radians
+func (s SpotLight) Angles() (float64, float64) {
+	return s.inner, s.outer
+}
+
+func (s SpotLight) Attenuation() Attenuation {
+	return s.attenuation
+}
+
+func (s SpotLight) IntensityAt(point tuple.Tuple) tuple.Color {
+	v := point.Subtract(s.position)
+	distance := v.Magnitude()
+	if distance == 0 {
+		return s.intensity
+	}
+	cosAngle := v.Div(distance).Dot(s.direction)
+	var falloff float64
+	switch {
+	case cosAngle >= s.cosInner:
+		falloff = 1
+	case cosAngle <= s.cosOuter:
+		return tuple.Black
+	default:
+		// smoothstep between the outer and the inner cones
+		t := (cosAngle - s.cosOuter) / (s.cosInner - s.cosOuter)
+		falloff = t * t * (3 - 2*t)
+	}
+	return s.intensity.Mult(falloff * s.attenuation.Factor(distance))
+}
+
+func (s SpotLight) Sample(from tuple.Tuple, rng *rand.Rand) []LightSample {
+	return sampleTowards(from, s.position)
+}
+
+// DirectionalLight is a light at infinity, like the sun. All its rays are parallel
+// and it doesn't get dimmer with distance.
+type DirectionalLight struct {
+	direction tuple.Tuple
+	intensity tuple.Color
+}
+
+// NewDirectionalLight creates a light shining along the given direction
+func NewDirectionalLight(direction tuple.Tuple, intensity tuple.Color) DirectionalLight {
+	if !direction.IsVector() || direction.Magnitude() == 0 {
+		panic("Directional light direction must be a non-zero vector")
+	}
+	return DirectionalLight{
+		direction: direction.Normalize(),
+		intensity: intensity,
+	}
+}
+
+func (d DirectionalLight) Direction() tuple.Tuple {
+	return d.direction
+}
+
+func (d DirectionalLight) Intensity() tuple.Color {
+	return d.intensity
+}
+
+func (d DirectionalLight) IntensityAt(point tuple.Tuple) tuple.Color {
+	return d.intensity
+}
+
+func (d DirectionalLight) Sample(from tuple.Tuple, rng *rand.Rand) []LightSample {
+	return []LightSample{{Direction: d.direction.Negate(), Distance: math.Inf(1)}}
+}
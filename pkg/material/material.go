@@ -18,6 +18,7 @@ type Material struct {
 	reflective      float64
 	transparency    float64
 	refractiveIndex float64
+	emissive        tuple.Color
 }
 
 type MaterialBuilder struct {
@@ -87,6 +88,15 @@ func (b *MaterialBuilder) WithShininess(a float64) *MaterialBuilder {
 	return b
 }
 
+// WithEmissive makes the material glow with the given color, regardless of the lights
+func (b *MaterialBuilder) WithEmissive(c tuple.Color) *MaterialBuilder {
+	if c.Red() < 0 || c.Green() < 0 || c.Blue() < 0 {
+		panic("Emissive color can't be negative")
+	}
+	b.m.emissive = c
+	return b
+}
+
 func (b *MaterialBuilder) WithPattern(p Pattern) *MaterialBuilder {
 	b.m.Pattern = p
 	return b
@@ -139,6 +149,22 @@ func Glass() Material {
 	return New(NewSolidPattern(tuple.White), 0.1, 0.1, 0.9, 200.0, 0.0, 1.0, 1.5)
 }
 
+func (m Material) Ambient() float64 {
+	return m.ambient
+}
+
+func (m Material) Diffuse() float64 {
+	return m.diffuse
+}
+
+func (m Material) Specular() float64 {
+	return m.specular
+}
+
+func (m Material) Shininess() float64 {
+	return m.shininess
+}
+
 func (m Material) Transparency() float64 {
 	return m.transparency
 }
@@ -151,26 +177,42 @@ func (m Material) RefractiveIndex() float64 {
 	return m.refractiveIndex
 }
 
-func (m Material) Lighting(shape types.ShapeTransformer, l fixtures.PointLight, point tuple.Tuple, eyev, normal tuple.Tuple, inShadow bool) tuple.Color {
-	effectiveColor := m.Pattern.PatternAtObject(shape, point).MultColor(l.Intensity())
-	lightV := l.Position().Subtract(point).Normalize()
+func (m Material) Emissive() tuple.Color {
+	return m.emissive
+}
 
-	ambient := effectiveColor.Mult(m.ambient)
-	diffuse := tuple.Black
-	specular := tuple.Black
+// Lighting computes the color of the point as lit by l, through the given samples of the
+// light. The visibility of every sample is the fraction of its light that reaches the
+// point, 0 when it's in shadow and 1 when it's lit, so shading and shadows agree on which
+// parts of the light are seen. The ambient term uses the light's nominal intensity, so
+// that it isn't affected by the light's cone or attenuation.
+func (m Material) Lighting(shape types.ShapeTransformer, l fixtures.Light, point tuple.Tuple, eyev, normal tuple.Tuple, samples []fixtures.LightSample, visibility []float64) tuple.Color {
+	color := m.Pattern.PatternAtObject(shape, point)
 
-	lightDotNormal := lightV.Dot(normal)
-	if lightDotNormal >= 0 {
-		diffuse = effectiveColor.Mult(m.diffuse * lightDotNormal)
+	ambient := color.MultColor(l.Intensity()).Mult(m.ambient)
+	if len(samples) == 0 {
+		return ambient
+	}
+	intensity := l.IntensityAt(point)
+	effectiveColor := color.MultColor(intensity)
+	sum := tuple.Black
+	for i, sample := range samples {
+		if visibility[i] <= 0 {
+			continue
+		}
+		lightV := sample.Direction
+		lightDotNormal := lightV.Dot(normal)
+		if lightDotNormal < 0 {
+			continue
+		}
+		lit := effectiveColor.Mult(m.diffuse * lightDotNormal)
 		reflectV := lightV.Mult(-1).Reflect(normal)
 		reflectDotEye := reflectV.Dot(eyev)
 		if reflectDotEye > 0 {
 			factor := math.Pow(reflectDotEye, m.shininess)
-			specular = l.Intensity().Mult(m.specular * factor)
+			lit = lit.Add(intensity.Mult(m.specular * factor))
 		}
+		sum = sum.Add(lit.Mult(visibility[i]))
 	}
-	if inShadow {
-		return ambient
-	}
-	return ambient.Add(diffuse).Add(specular)
+	return ambient.Add(sum.Mult(1 / float64(len(samples))))
 }
@@ -5,7 +5,7 @@ import (
 	"math"
 	"testing"
 
-	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega"
 
 	"github.com/liorokman/raytrace/pkg/fixtures"
 	"github.com/liorokman/raytrace/pkg/matrix"
@@ -24,8 +24,19 @@ func (t testShape) WorldToObject(point tuple.Tuple) (tuple.Tuple, error) {
 	return tuple.Tuple{}, nil
 }
 
+// lighting lights the point through the samples of l without jitter, all with the same
+// visibility
+func lighting(m Material, shape testShape, l fixtures.Light, point, eyev, normal tuple.Tuple, visibility float64) tuple.Color {
+	samples := l.Sample(point, nil)
+	visible := make([]float64, len(samples))
+	for i := range visible {
+		visible[i] = visibility
+	}
+	return m.Lighting(shape, l, point, eyev, normal, samples, visible)
+}
+
 func TestLighting(t *testing.T) {
-	g := NewGomegaWithT(t)
+	g := gomega.NewGomegaWithT(t)
 	m := Default()
 	pos := tuple.NewPoint(0, 0, 0)
 	identity := testShape{matrix.NewIdentity()}
@@ -33,37 +44,73 @@ func TestLighting(t *testing.T) {
 	eyev := tuple.NewVector(0, 0, -1)
 	normalv := tuple.NewVector(0, 0, -1)
 	l := fixtures.NewPointLight(tuple.NewPoint(0, 0, -10), tuple.NewColor(1, 1, 1))
-	r := m.Lighting(identity, l, pos, eyev, normalv, false)
-	g.Expect(r.Equals(tuple.NewColor(1.9, 1.9, 1.9))).To(BeTrue())
+	r := lighting(m, identity, l, pos, eyev, normalv, 1.0)
+	g.Expect(r.Equals(tuple.NewColor(1.9, 1.9, 1.9))).To(gomega.BeTrue())
 
 	eyev = tuple.NewVector(0, math.Sqrt(2.0)/2.0, -math.Sqrt(2.0)/2.0)
 	normalv = tuple.NewVector(0, 0, -1)
 	l = fixtures.NewPointLight(tuple.NewPoint(0, 0, -10), tuple.NewColor(1, 1, 1))
-	r = m.Lighting(identity, l, pos, eyev, normalv, false)
-	g.Expect(r.Equals(tuple.NewColor(1, 1, 1))).To(BeTrue())
+	r = lighting(m, identity, l, pos, eyev, normalv, 1.0)
+	g.Expect(r.Equals(tuple.NewColor(1, 1, 1))).To(gomega.BeTrue())
 
 	eyev = tuple.NewVector(0, 0, -1)
 	normalv = tuple.NewVector(0, 0, -1)
 	l = fixtures.NewPointLight(tuple.NewPoint(0, 10, -10), tuple.NewColor(1, 1, 1))
-	r = m.Lighting(identity, l, pos, eyev, normalv, false)
-	g.Expect(r.Equals(tuple.NewColor(0.7364, 0.7364, 0.7364))).To(BeTrue())
+	r = lighting(m, identity, l, pos, eyev, normalv, 1.0)
+	g.Expect(r.Equals(tuple.NewColor(0.7364, 0.7364, 0.7364))).To(gomega.BeTrue())
 
 	eyev = tuple.NewVector(0, -math.Sqrt(2.0)/2.0, -math.Sqrt(2.0)/2.0)
 	normalv = tuple.NewVector(0, 0, -1)
 	l = fixtures.NewPointLight(tuple.NewPoint(0, 10, -10), tuple.NewColor(1, 1, 1))
-	r = m.Lighting(identity, l, pos, eyev, normalv, false)
-	g.Expect(r.Equals(tuple.NewColor(1.6364, 1.6364, 1.6364))).To(BeTrue())
+	r = lighting(m, identity, l, pos, eyev, normalv, 1.0)
+	g.Expect(r.Equals(tuple.NewColor(1.6364, 1.6364, 1.6364))).To(gomega.BeTrue())
 
 	eyev = tuple.NewVector(0, 0, -1)
 	normalv = tuple.NewVector(0, 0, -1)
 	l = fixtures.NewPointLight(tuple.NewPoint(0, 0, -10), tuple.NewColor(1, 1, 1))
-	r = m.Lighting(identity, l, pos, eyev, normalv, false)
+	r = lighting(m, identity, l, pos, eyev, normalv, 1.0)
 	fmt.Printf("%#v\n", r)
-	g.Expect(r.Equals(tuple.NewColor(1.9, 1.9, 1.9))).To(BeTrue())
+	g.Expect(r.Equals(tuple.NewColor(1.9, 1.9, 1.9))).To(gomega.BeTrue())
 
 	eyev = tuple.NewVector(0, 0, -1)
 	normalv = tuple.NewVector(0, 0, -1)
 	l = fixtures.NewPointLight(tuple.NewPoint(0, 0, -10), tuple.NewColor(1, 1, 1))
-	r = m.Lighting(identity, l, pos, eyev, normalv, true)
-	g.Expect(r.Equals(tuple.NewColor(0.1, 0.1, 0.1))).To(BeTrue())
+	r = lighting(m, identity, l, pos, eyev, normalv, 0.0)
+	g.Expect(r.Equals(tuple.NewColor(0.1, 0.1, 0.1))).To(gomega.BeTrue())
+
+	// Diffuse and specular scale with the light's visibility
+	r = lighting(m, identity, l, pos, eyev, normalv, 0.5)
+	g.Expect(r.Equals(tuple.NewColor(1.0, 1.0, 1.0))).To(gomega.BeTrue())
+}
+
+func TestLightingWithAreaLight(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	m := New(NewSolidPattern(tuple.NewColor(1, 1, 1)), 0.1, 0.9, 0, 200, 0, 0, 1)
+	identity := testShape{matrix.NewIdentity()}
+	l := fixtures.NewAreaLight(tuple.NewPoint(-0.5, -0.5, -5), tuple.NewVector(1, 0, 0), 2, tuple.NewVector(0, 1, 0), 2, tuple.NewColor(1, 1, 1), false)
+	eye := tuple.NewPoint(0, 0, -5)
+
+	tests := []struct {
+		point    tuple.Tuple
+		expected float64
+	}{
+		{tuple.NewPoint(0, 0, -1), 0.9965},
+		{tuple.NewPoint(0, 0.7071, -0.7071), 0.6232},
+	}
+	for _, test := range tests {
+		eyev := eye.Subtract(test.point).Normalize()
+		normalv := tuple.NewVector(test.point.X(), test.point.Y(), test.point.Z())
+		r := lighting(m, identity, l, test.point, eyev, normalv, 1.0)
+		g.Expect(r.Red()).To(gomega.BeNumerically("~", test.expected, 0.0001))
+		g.Expect(r.Red()).To(gomega.Equal(r.Green()))
+		g.Expect(r.Red()).To(gomega.Equal(r.Blue()))
+
+		// Every sample only adds its own light when it's visible
+		samples := l.Sample(test.point, nil)
+		first := m.Lighting(identity, l, test.point, eyev, normalv, samples, []float64{1, 0, 0, 0})
+		rest := m.Lighting(identity, l, test.point, eyev, normalv, samples, []float64{0, 1, 1, 1})
+		none := m.Lighting(identity, l, test.point, eyev, normalv, samples, []float64{0, 0, 0, 0})
+		g.Expect(first.Add(rest).Subtract(none).Equals(r)).To(gomega.BeTrue())
+		g.Expect(none.Equals(tuple.NewColor(0.1, 0.1, 0.1))).To(gomega.BeTrue())
+	}
 }
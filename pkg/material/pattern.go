@@ -10,21 +10,27 @@ import (
 )
 
 type Pattern struct {
-	transform matrix.Matrix
-	pat       pattern
+	transform  matrix.Matrix
+	inverse    matrix.Matrix4
+	inverseErr error
+	pat        pattern
 }
 
 func newPattern(pat pattern) Pattern {
 	return Pattern{
 		transform: matrix.NewIdentity(),
+		inverse:   matrix.NewIdentity4(),
 		pat:       pat,
 	}
 }
 
 func (p Pattern) WithTransform(t matrix.Matrix) Pattern {
+	inv, err := t.ToMatrix4().Inverse()
 	return Pattern{
-		transform: t,
-		pat:       p.pat,
+		transform:  t,
+		inverse:    inv,
+		inverseErr: err,
+		pat:        p.pat,
 	}
 }
 
@@ -35,11 +41,27 @@ func (p Pattern) PatternAtObject(shape types.ShapeTransformer, point tuple.Tuple
 		panic(err)
 	}
 
-	patTransInv, err := p.transform.Inverse()
-	if err != nil {
-		panic(err)
+	if p.inverseErr != nil {
+		panic(p.inverseErr)
+	}
+	patPoint := p.inverse.MultiplyTuple(objPoint)
+	if tp, ok := p.pat.(textureMapPattern); ok && tp.mapping == ShapeMapping {
+		if mapper, ok := shape.(types.UVMapper); ok {
+			// The shape maps its own points, so the pattern's transform moves the texture
+			// in texture space instead, with u along X and v along Y
+			u, v := mapper.UVAt(objPoint)
+			uv := p.inverse.MultiplyTuple(tuple.NewPoint(u, v, 0))
+			return tp.colorAtUV(uv.X(), uv.Y())
+		}
+	}
+	if vp, ok := p.pat.(vertexColorPattern); ok {
+		if colorer, ok := shape.(types.VertexColorer); ok {
+			if c, ok := colorer.VertexColorAt(); ok {
+				return c
+			}
+		}
+		return vp.fallback
 	}
-	patPoint := patTransInv.MultiplyTuple(objPoint)
 	return p.pat.ColorAt(patPoint)
 }
 
@@ -47,6 +69,75 @@ func (p Pattern) ColorAt(point tuple.Tuple) tuple.Color {
 	return p.pat.ColorAt(point)
 }
 
+// PatternKind tells what kind of pattern a Pattern is
+type PatternKind int
+
+const (
+	SolidKind       PatternKind = iota
+	StripeKind      PatternKind = iota
+	GradientKind    PatternKind = iota
+	RingKind        PatternKind = iota
+	CheckerKind     PatternKind = iota
+	TextureKind     PatternKind = iota
+	VertexColorKind PatternKind = iota
+	TestKind        PatternKind = iota
+)
+
+func (p Pattern) Kind() PatternKind {
+	switch p.pat.(type) {
+	case solidPattern:
+		return SolidKind
+	case stripePattern:
+		return StripeKind
+	case gradientPattern:
+		return GradientKind
+	case ringPattern:
+		return RingKind
+	case checkerPattern:
+		return CheckerKind
+	case textureMapPattern:
+		return TextureKind
+	case vertexColorPattern:
+		return VertexColorKind
+	default:
+		return TestKind
+	}
+}
+
+// Colors returns the colors the pattern was created with. Vertex color patterns return
+// their fallback color, and texture and test patterns return nothing.
+func (p Pattern) Colors() []tuple.Color {
+	switch pat := p.pat.(type) {
+	case solidPattern:
+		return []tuple.Color{tuple.Color(pat)}
+	case stripePattern:
+		return pat.colors
+	case gradientPattern:
+		return []tuple.Color{pat.base, pat.base.Add(pat.distance)}
+	case ringPattern:
+		return pat.colors
+	case checkerPattern:
+		return pat.colors
+	case vertexColorPattern:
+		return []tuple.Color{pat.fallback}
+	default:
+		return nil
+	}
+}
+
+// Texture returns the texture of a texture pattern, and how it's mapped and filtered.
+// The texture is nil for any other pattern.
+func (p Pattern) Texture() (*Texture, UVMapping, TextureFilter) {
+	if pat, ok := p.pat.(textureMapPattern); ok {
+		return pat.texture, pat.mapping, pat.filter
+	}
+	return nil, ShapeMapping, BilinearFilter
+}
+
+func (p Pattern) Transform() matrix.Matrix {
+	return p.transform
+}
+
 type pattern interface {
 	ColorAt(tuple.Tuple) tuple.Color
 }
@@ -61,6 +152,20 @@ func (p solidPattern) ColorAt(point tuple.Tuple) tuple.Color {
 	return tuple.Color(p)
 }
 
+type vertexColorPattern struct {
+	fallback tuple.Color
+}
+
+// NewVertexColorPattern uses the colors of the vertices of shapes that have them, such as
+// meshes loaded from PLY files, and the fallback color everywhere else
+func NewVertexColorPattern(fallback tuple.Color) Pattern {
+	return newPattern(vertexColorPattern{fallback: fallback})
+}
+
+func (p vertexColorPattern) ColorAt(point tuple.Tuple) tuple.Color {
+	return p.fallback
+}
+
 type stripePattern struct {
 	colors []tuple.Color
 }
@@ -3,73 +3,107 @@ package material
 import (
 	"testing"
 
-	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega"
 
 	"github.com/liorokman/raytrace/pkg/matrix"
 	"github.com/liorokman/raytrace/pkg/tuple"
 )
 
 func TestStripePattern(t *testing.T) {
-	g := NewGomegaWithT(t)
+	g := gomega.NewGomegaWithT(t)
 	sp := NewStripePattern(tuple.White, tuple.Black)
 	// Stable in Y()
-	g.Expect(sp.ColorAt(tuple.NewPoint(0, 0, 0))).To(Equal(tuple.White))
-	g.Expect(sp.ColorAt(tuple.NewPoint(0, 1, 0))).To(Equal(tuple.White))
-	g.Expect(sp.ColorAt(tuple.NewPoint(0, 2, 0))).To(Equal(tuple.White))
+	g.Expect(sp.ColorAt(tuple.NewPoint(0, 0, 0))).To(gomega.Equal(tuple.White))
+	g.Expect(sp.ColorAt(tuple.NewPoint(0, 1, 0))).To(gomega.Equal(tuple.White))
+	g.Expect(sp.ColorAt(tuple.NewPoint(0, 2, 0))).To(gomega.Equal(tuple.White))
 
 	// Stable in Z()
-	g.Expect(sp.ColorAt(tuple.NewPoint(0, 0, 1))).To(Equal(tuple.White))
-	g.Expect(sp.ColorAt(tuple.NewPoint(0, 0, 2))).To(Equal(tuple.White))
-	g.Expect(sp.ColorAt(tuple.NewPoint(0, 0, 3))).To(Equal(tuple.White))
+	g.Expect(sp.ColorAt(tuple.NewPoint(0, 0, 1))).To(gomega.Equal(tuple.White))
+	g.Expect(sp.ColorAt(tuple.NewPoint(0, 0, 2))).To(gomega.Equal(tuple.White))
+	g.Expect(sp.ColorAt(tuple.NewPoint(0, 0, 3))).To(gomega.Equal(tuple.White))
 
 	// Alternates in X()
-	g.Expect(sp.ColorAt(tuple.NewPoint(0, 0, 1))).To(Equal(tuple.White))
-	g.Expect(sp.ColorAt(tuple.NewPoint(0.9, 0, 2))).To(Equal(tuple.White))
-	g.Expect(sp.ColorAt(tuple.NewPoint(1, 0, 3))).To(Equal(tuple.Black))
-	g.Expect(sp.ColorAt(tuple.NewPoint(-0.1, 0, 3))).To(Equal(tuple.Black))
-	g.Expect(sp.ColorAt(tuple.NewPoint(-1, 0, 3))).To(Equal(tuple.Black))
-	g.Expect(sp.ColorAt(tuple.NewPoint(-1.1, 0, 3))).To(Equal(tuple.White))
+	g.Expect(sp.ColorAt(tuple.NewPoint(0, 0, 1))).To(gomega.Equal(tuple.White))
+	g.Expect(sp.ColorAt(tuple.NewPoint(0.9, 0, 2))).To(gomega.Equal(tuple.White))
+	g.Expect(sp.ColorAt(tuple.NewPoint(1, 0, 3))).To(gomega.Equal(tuple.Black))
+	g.Expect(sp.ColorAt(tuple.NewPoint(-0.1, 0, 3))).To(gomega.Equal(tuple.Black))
+	g.Expect(sp.ColorAt(tuple.NewPoint(-1, 0, 3))).To(gomega.Equal(tuple.Black))
+	g.Expect(sp.ColorAt(tuple.NewPoint(-1.1, 0, 3))).To(gomega.Equal(tuple.White))
 }
 
 func TestRingPattern(t *testing.T) {
-	g := NewGomegaWithT(t)
+	g := gomega.NewGomegaWithT(t)
 
 	p := NewRingPattern(tuple.White, tuple.Black)
-	g.Expect(p.ColorAt(tuple.NewPoint(0, 0, 0))).To(Equal(tuple.White))
-	g.Expect(p.ColorAt(tuple.NewPoint(1, 0, 0))).To(Equal(tuple.Black))
-	g.Expect(p.ColorAt(tuple.NewPoint(0, 0, 1))).To(Equal(tuple.Black))
+	g.Expect(p.ColorAt(tuple.NewPoint(0, 0, 0))).To(gomega.Equal(tuple.White))
+	g.Expect(p.ColorAt(tuple.NewPoint(1, 0, 0))).To(gomega.Equal(tuple.Black))
+	g.Expect(p.ColorAt(tuple.NewPoint(0, 0, 1))).To(gomega.Equal(tuple.Black))
 	// 0.708 = just slightly more than √2/2
-	g.Expect(p.ColorAt(tuple.NewPoint(0.708, 0, 0.708))).To(Equal(tuple.Black))
+	g.Expect(p.ColorAt(tuple.NewPoint(0.708, 0, 0.708))).To(gomega.Equal(tuple.Black))
 }
 
 func TestCheckerPattern(t *testing.T) {
-	g := NewGomegaWithT(t)
+	g := gomega.NewGomegaWithT(t)
 
 	p := NewCheckerPattern(tuple.White, tuple.Black)
 	// Repeat in X
-	g.Expect(p.ColorAt(tuple.NewPoint(0, 0, 0))).To(Equal(tuple.White))
-	g.Expect(p.ColorAt(tuple.NewPoint(0.99, 0, 0))).To(Equal(tuple.White))
-	g.Expect(p.ColorAt(tuple.NewPoint(1.01, 0, 0))).To(Equal(tuple.Black))
+	g.Expect(p.ColorAt(tuple.NewPoint(0, 0, 0))).To(gomega.Equal(tuple.White))
+	g.Expect(p.ColorAt(tuple.NewPoint(0.99, 0, 0))).To(gomega.Equal(tuple.White))
+	g.Expect(p.ColorAt(tuple.NewPoint(1.01, 0, 0))).To(gomega.Equal(tuple.Black))
 	// Repeat in Y
-	g.Expect(p.ColorAt(tuple.NewPoint(0, 0, 0))).To(Equal(tuple.White))
-	g.Expect(p.ColorAt(tuple.NewPoint(0, 0.99, 0))).To(Equal(tuple.White))
-	g.Expect(p.ColorAt(tuple.NewPoint(0, 1.01, 0))).To(Equal(tuple.Black))
+	g.Expect(p.ColorAt(tuple.NewPoint(0, 0, 0))).To(gomega.Equal(tuple.White))
+	g.Expect(p.ColorAt(tuple.NewPoint(0, 0.99, 0))).To(gomega.Equal(tuple.White))
+	g.Expect(p.ColorAt(tuple.NewPoint(0, 1.01, 0))).To(gomega.Equal(tuple.Black))
 	// Repeat in Z
-	g.Expect(p.ColorAt(tuple.NewPoint(0, 0, 0))).To(Equal(tuple.White))
-	g.Expect(p.ColorAt(tuple.NewPoint(0, 0, 0.99))).To(Equal(tuple.White))
-	g.Expect(p.ColorAt(tuple.NewPoint(0, 0, 1.01))).To(Equal(tuple.Black))
+	g.Expect(p.ColorAt(tuple.NewPoint(0, 0, 0))).To(gomega.Equal(tuple.White))
+	g.Expect(p.ColorAt(tuple.NewPoint(0, 0, 0.99))).To(gomega.Equal(tuple.White))
+	g.Expect(p.ColorAt(tuple.NewPoint(0, 0, 1.01))).To(gomega.Equal(tuple.Black))
 }
 
 func TestPatternAt(t *testing.T) {
-	g := NewGomegaWithT(t)
+	g := gomega.NewGomegaWithT(t)
 
 	transform := testShape{matrix.NewScale(2, 2, 2)}
 
 	p := NewStripePattern(tuple.White, tuple.Black)
-	g.Expect(p.PatternAtObject(transform, tuple.NewPoint(1.5, 0, 0))).To(Equal(tuple.White))
+	g.Expect(p.PatternAtObject(transform, tuple.NewPoint(1.5, 0, 0))).To(gomega.Equal(tuple.White))
 
 	p = p.WithTransform(matrix.NewScale(2, 2, 2))
-	g.Expect(p.PatternAtObject(testShape{matrix.NewIdentity()}, tuple.NewPoint(1.5, 0, 0))).To(Equal(tuple.White))
+	g.Expect(p.PatternAtObject(testShape{matrix.NewIdentity()}, tuple.NewPoint(1.5, 0, 0))).To(gomega.Equal(tuple.White))
 
-	g.Expect(p.PatternAtObject(transform, tuple.NewPoint(1.5, 0, 0))).To(Equal(tuple.White))
+	g.Expect(p.PatternAtObject(transform, tuple.NewPoint(1.5, 0, 0))).To(gomega.Equal(tuple.White))
+}
+
+func TestPatternWithSingularTransform(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	p := NewStripePattern(tuple.White, tuple.Black).WithTransform(matrix.NewScale(0, 1, 1))
+	g.Expect(func() { p.PatternAtObject(testShape{matrix.NewIdentity()}, tuple.NewPoint(1, 0, 0)) }).To(gomega.Panic())
+}
+
+// colorShape is a hit on a shape with vertex colors, which may be outside of the faces
+// that have colors
+type colorShape struct {
+	identityShape
+	color tuple.Color
+	ok    bool
+}
+
+func (s colorShape) VertexColorAt() (tuple.Color, bool) {
+	return s.color, s.ok
+}
+
+func TestVertexColorPattern(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	p := NewVertexColorPattern(tuple.White)
+	shape := colorShape{identityShape{testShape{matrix.NewIdentity()}}, tuple.NewColor(0.5, 0, 0), true}
+	g.Expect(p.PatternAtObject(shape, tuple.NewPoint(0.5, 0, 0))).To(gomega.Equal(tuple.NewColor(0.5, 0, 0)))
+	// The color comes from the hit, not from the point
+	g.Expect(p.PatternAtObject(shape, tuple.NewPoint(-0.5, 0, 0))).To(gomega.Equal(tuple.NewColor(0.5, 0, 0)))
+	shape.ok = false
+	g.Expect(p.PatternAtObject(shape, tuple.NewPoint(0.5, 0, 0))).To(gomega.Equal(tuple.White))
+	// Shapes without vertex colors use the fallback color
+	g.Expect(p.PatternAtObject(shape.identityShape, tuple.NewPoint(0.5, 0, 0))).To(gomega.Equal(tuple.White))
+	g.Expect(p.ColorAt(tuple.NewPoint(0.5, 0, 0))).To(gomega.Equal(tuple.White))
 }
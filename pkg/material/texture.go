@@ -0,0 +1,138 @@
+package material
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/liorokman/raytrace/pkg/canvas"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+type TextureFilter int
+
+const (
+	// NearestFilter uses the color of the texel the coordinates fall in
+	NearestFilter TextureFilter = iota
+	// BilinearFilter blends the four texels closest to the coordinates
+	BilinearFilter TextureFilter = iota
+)
+
+// Texture is an image that can be sampled with (u,v) coordinates. (0,0) is the bottom
+// left corner of the image and (1,1) is the top right one. Coordinates outside of that
+// range wrap around.
+type Texture struct {
+	width  int
+	height int
+	texels []tuple.Color
+	// source is the file the texture was loaded from, if any
+	source string
+}
+
+func NewTexture(width, height int, texels []tuple.Color) (*Texture, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("Texture dimensions must be positive, not %dx%d", width, height)
+	}
+	if len(texels) != width*height {
+		return nil, fmt.Errorf("Texture of %dx%d requires %d texels, got %d", width, height, width*height, len(texels))
+	}
+	return &Texture{
+		width:  width,
+		height: height,
+		texels: texels,
+	}, nil
+}
+
+// LoadTexture reads a texture from a PNG, JPEG or PPM file
+func LoadTexture(filename string) (*Texture, error) {
+	in, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	t, err := DecodeTexture(in)
+	if err != nil {
+		return nil, fmt.Errorf("Can't read texture '%s': %w", filename, err)
+	}
+	t.source = filename
+	return t, nil
+}
+
+// DecodeTexture reads a texture in the PNG, JPEG or PPM format
+func DecodeTexture(in io.Reader) (*Texture, error) {
+	c, err := canvas.Decode(in)
+	if err != nil {
+		return nil, err
+	}
+	return NewTexture(int(c.Width()), int(c.Height()), c.Data)
+}
+
+func (t *Texture) Width() int {
+	return t.width
+}
+
+func (t *Texture) Height() int {
+	return t.height
+}
+
+// Source returns the file the texture was loaded from, or an empty string if it wasn't
+// loaded by LoadTexture
+func (t *Texture) Source() string {
+	return t.source
+}
+
+// texel returns the texel at the given column and row, counted from the top left
+// corner, wrapping around the edges
+func (t *Texture) texel(x, y int) tuple.Color {
+	x = ((x % t.width) + t.width) % t.width
+	y = ((y % t.height) + t.height) % t.height
+	return t.texels[y*t.width+x]
+}
+
+func (t *Texture) At(u, v float64, filter TextureFilter) tuple.Color {
+	u = fraction(u)
+	v = fraction(v)
+	// Images are stored top row first, while v grows upwards
+	x := u * float64(t.width)
+	y := (1 - v) * float64(t.height)
+	if filter == NearestFilter {
+		return t.texel(int(math.Min(math.Floor(x), float64(t.width-1))), int(math.Min(math.Floor(y), float64(t.height-1))))
+	}
+	// Texel centers are at half coordinates
+	x -= 0.5
+	y -= 0.5
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+	c00 := t.texel(int(x0), int(y0))
+	c10 := t.texel(int(x0)+1, int(y0))
+	c01 := t.texel(int(x0), int(y0)+1)
+	c11 := t.texel(int(x0)+1, int(y0)+1)
+	top := c00.Mult(1 - fx).Add(c10.Mult(fx))
+	bottom := c01.Mult(1 - fx).Add(c11.Mult(fx))
+	return top.Mult(1 - fy).Add(bottom.Mult(fy))
+}
+
+type textureMapPattern struct {
+	texture *Texture
+	mapping UVMapping
+	filter  TextureFilter
+}
+
+// NewTextureMapPattern wraps a texture around a shape using the given mapping
+func NewTextureMapPattern(t *Texture, mapping UVMapping, filter TextureFilter) Pattern {
+	return newPattern(textureMapPattern{
+		texture: t,
+		mapping: mapping,
+		filter:  filter,
+	})
+}
+
+func (p textureMapPattern) ColorAt(point tuple.Tuple) tuple.Color {
+	u, v := p.mapping.Map(point)
+	return p.texture.At(u, v, p.filter)
+}
+
+func (p textureMapPattern) colorAtUV(u, v float64) tuple.Color {
+	return p.texture.At(u, v, p.filter)
+}
@@ -0,0 +1,143 @@
+package material
+
+import (
+	"math"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/liorokman/raytrace/pkg/matrix"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+func TestSphericalMap(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	tests := []struct {
+		point tuple.Tuple
+		u, v  float64
+	}{
+		{tuple.NewPoint(0, 0, -1), 0.0, 0.5},
+		{tuple.NewPoint(1, 0, 0), 0.25, 0.5},
+		{tuple.NewPoint(0, 0, 1), 0.5, 0.5},
+		{tuple.NewPoint(-1, 0, 0), 0.75, 0.5},
+		{tuple.NewPoint(0, 1, 0), 0.5, 1.0},
+		{tuple.NewPoint(0, -1, 0), 0.5, 0.0},
+		{tuple.NewPoint(math.Sqrt2/2, math.Sqrt2/2, 0), 0.25, 0.75},
+	}
+	for _, test := range tests {
+		u, v := SphericalMap(test.point)
+		g.Expect(u).To(gomega.BeNumerically("~", test.u, 1e-9), test.point.String())
+		g.Expect(v).To(gomega.BeNumerically("~", test.v, 1e-9), test.point.String())
+	}
+}
+
+func TestPlanarAndCylindricalMap(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	u, v := PlanarMap(tuple.NewPoint(0.25, 0, -0.25))
+	g.Expect(u).To(gomega.Equal(0.25))
+	g.Expect(v).To(gomega.Equal(0.75))
+	u, v = PlanarMap(tuple.NewPoint(-1.75, 0.5, 1.5))
+	g.Expect(u).To(gomega.Equal(0.25))
+	g.Expect(v).To(gomega.Equal(0.5))
+
+	u, v = CylindricalMap(tuple.NewPoint(0, 0, -1))
+	g.Expect(u).To(gomega.BeNumerically("~", 0, 1e-9))
+	g.Expect(v).To(gomega.Equal(0.0))
+	u, v = CylindricalMap(tuple.NewPoint(0.70711, -0.5, -0.70711))
+	g.Expect(u).To(gomega.BeNumerically("~", 0.125, 1e-5))
+	g.Expect(v).To(gomega.Equal(0.5))
+	u, v = CylindricalMap(tuple.NewPoint(-1, 1.25, 0))
+	g.Expect(u).To(gomega.BeNumerically("~", 0.75, 1e-9))
+	g.Expect(v).To(gomega.Equal(0.25))
+}
+
+func TestCubeMap(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	// The center of every face lands in the center of its cell in the cross
+	tests := []struct {
+		point tuple.Tuple
+		u, v  float64
+	}{
+		{tuple.NewPoint(0, 1, 0), 1.5 / 4, 2.5 / 3},
+		{tuple.NewPoint(-1, 0, 0), 0.5 / 4, 1.5 / 3},
+		{tuple.NewPoint(0, 0, 1), 1.5 / 4, 1.5 / 3},
+		{tuple.NewPoint(1, 0, 0), 2.5 / 4, 1.5 / 3},
+		{tuple.NewPoint(0, 0, -1), 3.5 / 4, 1.5 / 3},
+		{tuple.NewPoint(0, -1, 0), 1.5 / 4, 0.5 / 3},
+		// Corners of the front face
+		{tuple.NewPoint(-0.9, 0.9, 1), (1 + 0.05) / 4, (1 + 0.95) / 3},
+		{tuple.NewPoint(0.9, -0.9, 1), (1 + 0.95) / 4, (1 + 0.05) / 3},
+	}
+	for _, test := range tests {
+		u, v := CubeMap(test.point)
+		g.Expect(u).To(gomega.BeNumerically("~", test.u, 1e-9), test.point.String())
+		g.Expect(v).To(gomega.BeNumerically("~", test.v, 1e-9), test.point.String())
+	}
+}
+
+// checkerTexture is a 2x2 texture with a black and a white diagonal
+func checkerTexture(g *gomega.WithT) *Texture {
+	tex, err := NewTexture(2, 2, []tuple.Color{tuple.White, tuple.Black, tuple.Black, tuple.White})
+	g.Expect(err).To(gomega.BeNil())
+	return tex
+}
+
+func TestTextureFiltering(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	tex := checkerTexture(g)
+
+	// v grows upwards, so the top left texel is at (0,1)
+	g.Expect(tex.At(0.25, 0.75, NearestFilter)).To(gomega.Equal(tuple.White))
+	g.Expect(tex.At(0.75, 0.75, NearestFilter)).To(gomega.Equal(tuple.Black))
+	g.Expect(tex.At(0.25, 0.25, NearestFilter)).To(gomega.Equal(tuple.Black))
+	g.Expect(tex.At(0.99, 0.01, NearestFilter)).To(gomega.Equal(tuple.White))
+	// Coordinates wrap around
+	g.Expect(tex.At(1.25, -0.25, NearestFilter)).To(gomega.Equal(tuple.White))
+
+	// Bilinear filtering is exact at the texel centers and blends between them
+	g.Expect(tex.At(0.25, 0.75, BilinearFilter).Equals(tuple.White)).To(gomega.BeTrue())
+	g.Expect(tex.At(0.5, 0.75, BilinearFilter).Equals(tuple.NewColor(0.5, 0.5, 0.5))).To(gomega.BeTrue())
+	g.Expect(tex.At(0.375, 0.75, BilinearFilter).Equals(tuple.NewColor(0.75, 0.75, 0.75))).To(gomega.BeTrue())
+
+	_, err := NewTexture(2, 2, []tuple.Color{tuple.White})
+	g.Expect(err).ToNot(gomega.BeNil())
+}
+
+// identityShape is a shape whose object space is the world space
+type identityShape struct {
+	testShape
+}
+
+func (s identityShape) WorldToObject(point tuple.Tuple) (tuple.Tuple, error) {
+	return point, nil
+}
+
+type uvShape struct {
+	identityShape
+}
+
+func (s uvShape) UVAt(point tuple.Tuple) (float64, float64) {
+	return 0.75, 0.75
+}
+
+func TestTextureMapPattern(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	tex := checkerTexture(g)
+	identity := identityShape{testShape{matrix.NewIdentity()}}
+
+	p := NewTextureMapPattern(tex, PlanarMapping, NearestFilter)
+	g.Expect(p.PatternAtObject(identity, tuple.NewPoint(0.25, 0, 0.75))).To(gomega.Equal(tuple.White))
+	g.Expect(p.PatternAtObject(identity, tuple.NewPoint(0.75, 0, 0.75))).To(gomega.Equal(tuple.Black))
+
+	// The shape mapping asks the shape for the texture coordinates
+	p = NewTextureMapPattern(tex, ShapeMapping, NearestFilter)
+	g.Expect(p.PatternAtObject(uvShape{identity}, tuple.NewPoint(0, 0, -1))).To(gomega.Equal(tuple.Black))
+	// and the pattern's transform moves the texture coordinates
+	moved := p.WithTransform(matrix.NewTranslation(0.5, 0, 0))
+	g.Expect(moved.PatternAtObject(uvShape{identity}, tuple.NewPoint(0, 0, -1))).To(gomega.Equal(tuple.White))
+	// Shapes that can't map fall back to a spherical mapping
+	g.Expect(p.PatternAtObject(identity, tuple.NewPoint(0, 0, -1))).To(gomega.Equal(tex.At(0, 0.5, NearestFilter)))
+}
@@ -0,0 +1,137 @@
+package material
+
+import (
+	"math"
+
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+// UVMapping selects how a point in pattern space is mapped onto a texture
+type UVMapping int
+
+const (
+	// ShapeMapping uses the shape's own mapping: spherical for spheres, planar for
+	// planes, cylindrical for cylinders and cones, cube for cubes, and the texture
+	// coordinates of triangles
+	ShapeMapping       UVMapping = iota
+	SphericalMapping   UVMapping = iota
+	PlanarMapping      UVMapping = iota
+	CylindricalMapping UVMapping = iota
+	// CubeMapping expects the texture to hold the six faces of the cube laid out as a
+	// horizontal cross, four faces wide and three faces high
+	CubeMapping UVMapping = iota
+)
+
+// Map converts a point to (u,v) texture coordinates, each in the range [0,1]. The
+// ShapeMapping falls back to a spherical mapping, since there is no shape to ask.
+func (m UVMapping) Map(p tuple.Tuple) (float64, float64) {
+	switch m {
+	case PlanarMapping:
+		return PlanarMap(p)
+	case CylindricalMapping:
+		return CylindricalMap(p)
+	case CubeMapping:
+		return CubeMap(p)
+	default:
+		return SphericalMap(p)
+	}
+}
+
+// fraction wraps a value into [0,1)
+func fraction(v float64) float64 {
+	return v - math.Floor(v)
+}
+
+// SphericalMap maps a point on the unit sphere using its longitude and latitude
+func SphericalMap(p tuple.Tuple) (float64, float64) {
+	theta := math.Atan2(p.X(), p.Z())
+	radius := tuple.NewVector(p.X(), p.Y(), p.Z()).Magnitude()
+	if radius == 0 {
+		return 0.5, 0.5
+	}
+	phi := math.Acos(math.Max(-1, math.Min(1, p.Y()/radius)))
+	rawU := theta / (2 * math.Pi)
+	return 1 - (rawU + 0.5), 1 - phi/math.Pi
+}
+
+// PlanarMap repeats the texture every unit along the x and z axes
+func PlanarMap(p tuple.Tuple) (float64, float64) {
+	return fraction(p.X()), fraction(p.Z())
+}
+
+// CylindricalMap wraps the texture around the y axis, repeating every unit along it
+func CylindricalMap(p tuple.Tuple) (float64, float64) {
+	theta := math.Atan2(p.X(), p.Z())
+	rawU := theta / (2 * math.Pi)
+	return 1 - (rawU + 0.5), fraction(p.Y())
+}
+
+type cubeFace int
+
+const (
+	cubeLeft  cubeFace = iota
+	cubeRight cubeFace = iota
+	cubeFront cubeFace = iota
+	cubeBack  cubeFace = iota
+	cubeUp    cubeFace = iota
+	cubeDown  cubeFace = iota
+)
+
+// crossCells is the column and row, counted from the top, of every face in the cross
+var crossCells = map[cubeFace][2]int{
+	cubeUp:    {1, 0},
+	cubeLeft:  {0, 1},
+	cubeFront: {1, 1},
+	cubeRight: {2, 1},
+	cubeBack:  {3, 1},
+	cubeDown:  {1, 2},
+}
+
+func faceFromPoint(p tuple.Tuple) cubeFace {
+	absX, absY, absZ := math.Abs(p.X()), math.Abs(p.Y()), math.Abs(p.Z())
+	coord := math.Max(absX, math.Max(absY, absZ))
+	switch coord {
+	case p.X():
+		return cubeRight
+	case -p.X():
+		return cubeLeft
+	case p.Y():
+		return cubeUp
+	case -p.Y():
+		return cubeDown
+	case p.Z():
+		return cubeFront
+	default:
+		return cubeBack
+	}
+}
+
+// faceUV maps a point on a face of the cube between -1 and 1 to [0,1]
+func faceUV(face cubeFace, p tuple.Tuple) (float64, float64) {
+	half := func(v float64) float64 {
+		return math.Max(0, math.Min(1, (v+1)/2))
+	}
+	switch face {
+	case cubeFront:
+		return half(p.X()), half(p.Y())
+	case cubeBack:
+		return half(-p.X()), half(p.Y())
+	case cubeLeft:
+		return half(p.Z()), half(p.Y())
+	case cubeRight:
+		return half(-p.Z()), half(p.Y())
+	case cubeUp:
+		return half(p.X()), half(-p.Z())
+	default:
+		return half(p.X()), half(p.Z())
+	}
+}
+
+// CubeMap maps a point on the surface of the unit cube into a texture holding a
+// horizontal cross of faces
+func CubeMap(p tuple.Tuple) (float64, float64) {
+	face := faceFromPoint(p)
+	u, v := faceUV(face, p)
+	cell := crossCells[face]
+	return (float64(cell[0]) + u) / 4, (float64(2-cell[1]) + v) / 3
+}
@@ -24,6 +24,10 @@ func New(row, col int) Matrix {
 	}
 }
 
+func (m Matrix) At(row, col int) float64 {
+	return m.data[row*m.cols+col]
+}
+
 func (m Matrix) Equals(other Matrix) bool {
 	if m.rows != other.rows || m.cols != other.cols {
 		return false
@@ -51,14 +55,12 @@ func (l Matrix) Multiply(r Matrix) Matrix {
 }
 
 func (l Matrix) MultiplyTuple(r tuple.Tuple) tuple.Tuple {
-
-	right := Matrix{
-		rows: 4,
-		cols: 1,
-		data: []float64{r.X(), r.Y(), r.Z(), r.W()},
+	var result tuple.Tuple
+	for i := 0; i < 4; i++ {
+		row := l.data[i*4 : (i+1)*4]
+		result[i] = row[0]*r[0] + row[1]*r[1] + row[2]*r[2] + row[3]*r[3]
 	}
-	result := l.Multiply(right)
-	return tuple.Tuple{result.data[0], result.data[1], result.data[2], result.data[3]}
+	return result
 }
 
 func (l Matrix) Transpose() Matrix {
@@ -113,6 +115,13 @@ func (m Matrix) Cofactor(row, col int) float64 {
 }
 
 func (m Matrix) Inverse() (Matrix, error) {
+	if m.rows == 4 && m.cols == 4 {
+		inv, err := m.ToMatrix4().Inverse()
+		if err != nil {
+			return m, err
+		}
+		return inv.ToMatrix(), nil
+	}
 	d := m.Determinant()
 	if utils.FloatEqual(d, 0.0) {
 		return m, fmt.Errorf("Matrix is not invertable")
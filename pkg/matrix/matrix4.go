@@ -0,0 +1,173 @@
+package matrix
+
+import (
+	"fmt"
+
+	"github.com/liorokman/raytrace/pkg/tuple"
+	"github.com/liorokman/raytrace/pkg/utils"
+)
+
+// Matrix4 is a 4x4 matrix stored by value. It's used on the hot path of the renderer,
+// where transforming points and vectors mustn't allocate.
+type Matrix4 [4][4]float64
+
+func NewIdentity4() Matrix4 {
+	return Matrix4{
+		{1, 0, 0, 0},
+		{0, 1, 0, 0},
+		{0, 0, 1, 0},
+		{0, 0, 0, 1},
+	}
+}
+
+// ToMatrix4 converts a 4x4 Matrix to a Matrix4. It panics if the matrix is a different size.
+func (m Matrix) ToMatrix4() Matrix4 {
+	if m.rows != 4 || m.cols != 4 {
+		panic(fmt.Sprintf("Can't convert a %dx%d matrix to a 4x4 matrix", m.rows, m.cols))
+	}
+	var retval Matrix4
+	for row := 0; row < 4; row++ {
+		copy(retval[row][:], m.data[row*4:(row+1)*4])
+	}
+	return retval
+}
+
+// ToMatrix converts the matrix back to the general Matrix type
+func (m Matrix4) ToMatrix() Matrix {
+	retval := New(4, 4)
+	for row := 0; row < 4; row++ {
+		copy(retval.data[row*4:(row+1)*4], m[row][:])
+	}
+	return retval
+}
+
+func (m Matrix4) At(row, col int) float64 {
+	return m[row][col]
+}
+
+func (m Matrix4) Equals(other Matrix4) bool {
+	for row := 0; row < 4; row++ {
+		for col := 0; col < 4; col++ {
+			if !utils.FloatEqual(m[row][col], other[row][col]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (m Matrix4) Multiply(o Matrix4) Matrix4 {
+	var retval Matrix4
+	for row := 0; row < 4; row++ {
+		for col := 0; col < 4; col++ {
+			retval[row][col] = m[row][0]*o[0][col] + m[row][1]*o[1][col] + m[row][2]*o[2][col] + m[row][3]*o[3][col]
+		}
+	}
+	return retval
+}
+
+// MultiplyInPlace replaces m with m*o
+func (m *Matrix4) MultiplyInPlace(o Matrix4) {
+	*m = m.Multiply(o)
+}
+
+func (m Matrix4) MultiplyTuple(t tuple.Tuple) tuple.Tuple {
+	return tuple.Tuple{
+		m[0][0]*t[0] + m[0][1]*t[1] + m[0][2]*t[2] + m[0][3]*t[3],
+		m[1][0]*t[0] + m[1][1]*t[1] + m[1][2]*t[2] + m[1][3]*t[3],
+		m[2][0]*t[0] + m[2][1]*t[1] + m[2][2]*t[2] + m[2][3]*t[3],
+		m[3][0]*t[0] + m[3][1]*t[1] + m[3][2]*t[2] + m[3][3]*t[3],
+	}
+}
+
+func (m Matrix4) Transpose() Matrix4 {
+	var retval Matrix4
+	for row := 0; row < 4; row++ {
+		for col := 0; col < 4; col++ {
+			retval[col][row] = m[row][col]
+		}
+	}
+	return retval
+}
+
+// Lerp interpolates linearly between the matrix and o, element by element. t is 0 for the
+// matrix and 1 for o.
+func (m Matrix4) Lerp(o Matrix4, t float64) Matrix4 {
+	var retval Matrix4
+	for row := 0; row < 4; row++ {
+		for col := 0; col < 4; col++ {
+			retval[row][col] = m[row][col] + t*(o[row][col]-m[row][col])
+		}
+	}
+	return retval
+}
+
+// minors2 returns the determinants of the 2x2 matrices made of the top two rows and of
+// the bottom two rows, for every pair of columns. Both the determinant and the inverse
+// are expanded from these.
+func (m Matrix4) minors2() (top, bottom [6]float64) {
+	top = [6]float64{
+		m[0][0]*m[1][1] - m[0][1]*m[1][0],
+		m[0][0]*m[1][2] - m[0][2]*m[1][0],
+		m[0][0]*m[1][3] - m[0][3]*m[1][0],
+		m[0][1]*m[1][2] - m[0][2]*m[1][1],
+		m[0][1]*m[1][3] - m[0][3]*m[1][1],
+		m[0][2]*m[1][3] - m[0][3]*m[1][2],
+	}
+	bottom = [6]float64{
+		m[2][0]*m[3][1] - m[2][1]*m[3][0],
+		m[2][0]*m[3][2] - m[2][2]*m[3][0],
+		m[2][0]*m[3][3] - m[2][3]*m[3][0],
+		m[2][1]*m[3][2] - m[2][2]*m[3][1],
+		m[2][1]*m[3][3] - m[2][3]*m[3][1],
+		m[2][2]*m[3][3] - m[2][3]*m[3][2],
+	}
+	return top, bottom
+}
+
+func (m Matrix4) Determinant() float64 {
+	s, c := m.minors2()
+	return s[0]*c[5] - s[1]*c[4] + s[2]*c[3] + s[3]*c[2] - s[4]*c[1] + s[5]*c[0]
+}
+
+// Inverse computes the inverse in closed form, by Laplace expansion along the top two rows
+func (m Matrix4) Inverse() (Matrix4, error) {
+	s, c := m.minors2()
+	d := s[0]*c[5] - s[1]*c[4] + s[2]*c[3] + s[3]*c[2] - s[4]*c[1] + s[5]*c[0]
+	if utils.FloatEqual(d, 0.0) {
+		return m, fmt.Errorf("Matrix is not invertable")
+	}
+	inv := 1 / d
+	retval := Matrix4{
+		{
+			(m[1][1]*c[5] - m[1][2]*c[4] + m[1][3]*c[3]) * inv,
+			(-m[0][1]*c[5] + m[0][2]*c[4] - m[0][3]*c[3]) * inv,
+			(m[3][1]*s[5] - m[3][2]*s[4] + m[3][3]*s[3]) * inv,
+			(-m[2][1]*s[5] + m[2][2]*s[4] - m[2][3]*s[3]) * inv,
+		},
+		{
+			(-m[1][0]*c[5] + m[1][2]*c[2] - m[1][3]*c[1]) * inv,
+			(m[0][0]*c[5] - m[0][2]*c[2] + m[0][3]*c[1]) * inv,
+			(-m[3][0]*s[5] + m[3][2]*s[2] - m[3][3]*s[1]) * inv,
+			(m[2][0]*s[5] - m[2][2]*s[2] + m[2][3]*s[1]) * inv,
+		},
+		{
+			(m[1][0]*c[4] - m[1][1]*c[2] + m[1][3]*c[0]) * inv,
+			(-m[0][0]*c[4] + m[0][1]*c[2] - m[0][3]*c[0]) * inv,
+			(m[3][0]*s[4] - m[3][1]*s[2] + m[3][3]*s[0]) * inv,
+			(-m[2][0]*s[4] + m[2][1]*s[2] - m[2][3]*s[0]) * inv,
+		},
+		{
+			(-m[1][0]*c[3] + m[1][1]*c[1] - m[1][2]*c[0]) * inv,
+			(m[0][0]*c[3] - m[0][1]*c[1] + m[0][2]*c[0]) * inv,
+			(-m[3][0]*s[3] + m[3][1]*s[1] - m[3][2]*s[0]) * inv,
+			(m[2][0]*s[3] - m[2][1]*s[1] + m[2][2]*s[0]) * inv,
+		},
+	}
+	if m[3] == [4]float64{0, 0, 0, 1} {
+		// The inverse of an affine transform is affine too. Keeping the bottom row exact
+		// keeps transformed points and vectors from drifting in their W component.
+		retval[3] = m[3]
+	}
+	return retval, nil
+}
@@ -0,0 +1,92 @@
+package matrix
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+func TestMatrix4(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	a := Matrix{
+		rows: 4,
+		cols: 4,
+		data: []float64{
+			3, -9, 7, 3,
+			3, -8, 2, -9,
+			-4, 4, 4, 1,
+			-6, 5, -1, 1},
+	}
+	b := NewRotateX(0.3).Translate(1, 2, 3).Scale(2, -1, 0.5).Shear(1, 0, 0, 2, 0, 1)
+
+	a4, b4 := a.ToMatrix4(), b.ToMatrix4()
+	g.Expect(a4.At(1, 3)).To(Equal(-9.0))
+	g.Expect(a4.ToMatrix().Equals(a)).To(BeTrue())
+	g.Expect(a4.Multiply(b4).ToMatrix().Equals(a.Multiply(b))).To(BeTrue())
+	g.Expect(a4.Transpose().ToMatrix().Equals(a.Transpose())).To(BeTrue())
+	g.Expect(a4.Determinant()).To(BeNumerically("~", a.Determinant(), 1e-9))
+	g.Expect(b4.Determinant()).To(BeNumerically("~", b.Determinant(), 1e-9))
+
+	p := tuple.NewPoint(1, -2, 3)
+	g.Expect(b4.MultiplyTuple(p).Equals(b.MultiplyTuple(p))).To(BeTrue())
+
+	inv, err := b4.Inverse()
+	g.Expect(err).To(BeNil())
+	g.Expect(inv.Multiply(b4).Equals(NewIdentity4())).To(BeTrue())
+	g.Expect(inv.MultiplyTuple(p).IsPoint()).To(BeTrue())
+	g.Expect(NewIdentity4().ToMatrix().Equals(NewIdentity())).To(BeTrue())
+
+	from, to := NewTranslation(0, 0, 0).ToMatrix4(), NewTranslation(4, -2, 0).ToMatrix4()
+	g.Expect(from.Lerp(to, 0).Equals(from)).To(BeTrue())
+	g.Expect(from.Lerp(to, 1).Equals(to)).To(BeTrue())
+	g.Expect(from.Lerp(to, 0.25).MultiplyTuple(p).Equals(tuple.NewPoint(2, -2.5, 3))).To(BeTrue())
+
+	m := a4
+	m.MultiplyInPlace(b4)
+	g.Expect(m.Equals(a4.Multiply(b4))).To(BeTrue())
+
+	_, err = NewScale(1, 0, 1).ToMatrix4().Inverse()
+	g.Expect(err).ToNot(BeNil())
+	g.Expect(func() { New(3, 3).ToMatrix4() }).To(Panic())
+}
+
+func TestMatrix4DoesNotAllocate(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	m := NewTranslation(1, 2, 3).Scale(2, 2, 2).ToMatrix4()
+	p := tuple.NewPoint(1, 2, 3)
+	allocs := testing.AllocsPerRun(100, func() {
+		inv, _ := m.Inverse()
+		p = inv.Transpose().Multiply(m).MultiplyTuple(p)
+	})
+	g.Expect(allocs).To(Equal(0.0))
+
+	general := NewRotateZ(1)
+	allocs = testing.AllocsPerRun(100, func() {
+		p = general.MultiplyTuple(p)
+	})
+	g.Expect(allocs).To(Equal(0.0))
+}
+
+func BenchmarkInverse4(b *testing.B) {
+	m := Matrix4{
+		{8, -5, 9, 2},
+		{7, 5, 6, 1},
+		{-6, 0, 9, 6},
+		{-3, 0, -9, -4},
+	}
+	for bb := 0; bb < b.N; bb++ {
+		m.Inverse()
+	}
+}
+
+func BenchmarkMultiplyTuple4(b *testing.B) {
+	m := NewRotateY(1).Translate(1, 2, 3).ToMatrix4()
+	p := tuple.NewPoint(1, 2, 3)
+	for bb := 0; bb < b.N; bb++ {
+		p = m.MultiplyTuple(p)
+	}
+}
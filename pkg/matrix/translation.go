@@ -105,3 +105,23 @@ func NewShear(xy, xz, yx, yz, zx, zy float64) Matrix {
 func (m Matrix) Shear(xy, xz, yx, yz, zx, zy float64) Matrix {
 	return m.Multiply(NewShear(xy, xz, yx, yz, zx, zy))
 }
+
+// NewRotateQuaternion creates the rotation described by the quaternion x*i + y*j + z*k + w.
+// The quaternion is normalized first.
+func NewRotateQuaternion(x, y, z, w float64) Matrix {
+	if l := math.Sqrt(x*x + y*y + z*z + w*w); l > 0 {
+		x, y, z, w = x/l, y/l, z/l, w/l
+	}
+	return Matrix{
+		rows: 4,
+		cols: 4,
+		data: []float64{1 - 2*(y*y+z*z), 2 * (x*y - z*w), 2 * (x*z + y*w), 0,
+			2 * (x*y + z*w), 1 - 2*(x*x+z*z), 2 * (y*z - x*w), 0,
+			2 * (x*z - y*w), 2 * (y*z + x*w), 1 - 2*(x*x+y*y), 0,
+			0, 0, 0, 1},
+	}
+}
+
+func (m Matrix) RotateQuaternion(x, y, z, w float64) Matrix {
+	return m.Multiply(NewRotateQuaternion(x, y, z, w))
+}
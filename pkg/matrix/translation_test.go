@@ -94,6 +94,17 @@ func TestRotateZ(t *testing.T) {
 	g.Expect(fullQuarter.MultiplyTuple(p).Equals(tuple.NewPoint(-1, 0, 0))).To(BeTrue())
 }
 
+func TestRotateQuaternion(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	s := math.Sin(math.Pi / 4)
+	g.Expect(NewRotateQuaternion(s, 0, 0, s).Equals(NewRotateX(math.Pi / 2))).To(BeTrue())
+	g.Expect(NewRotateQuaternion(0, s, 0, s).Equals(NewRotateY(math.Pi / 2))).To(BeTrue())
+	g.Expect(NewRotateQuaternion(0, 0, 2*s, 2*s).Equals(NewRotateZ(math.Pi / 2))).To(BeTrue())
+	g.Expect(NewRotateQuaternion(0, 0, 0, 1).Equals(NewIdentity())).To(BeTrue())
+	g.Expect(NewIdentity().RotateQuaternion(0, 0, 0, 1).Equals(NewIdentity())).To(BeTrue())
+}
+
 func TestShear(t *testing.T) {
 	g := NewGomegaWithT(t)
 
@@ -0,0 +1,197 @@
+package shapes
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/liorokman/raytrace/pkg/matrix"
+	"github.com/liorokman/raytrace/pkg/tuple"
+	"github.com/liorokman/raytrace/pkg/utils"
+)
+
+// BoundingBox is an axis-aligned box described by its minimal and maximal corners.
+// Infinite coordinates are allowed, and are used to describe shapes like planes that
+// extend forever along some axis.
+type BoundingBox struct {
+	Min tuple.Tuple
+	Max tuple.Tuple
+}
+
+func NewBoundingBox(min, max tuple.Tuple) BoundingBox {
+	return BoundingBox{
+		Min: tuple.NewPoint(min.X(), min.Y(), min.Z()),
+		Max: tuple.NewPoint(max.X(), max.Y(), max.Z()),
+	}
+}
+
+// EmptyBoundingBox returns a box that contains nothing. Adding a point or another
+// box to it results in a box that contains exactly that point or box.
+func EmptyBoundingBox() BoundingBox {
+	inf := math.Inf(1)
+	return BoundingBox{
+		Min: tuple.NewPoint(inf, inf, inf),
+		Max: tuple.NewPoint(-inf, -inf, -inf),
+	}
+}
+
+// InfiniteBoundingBox returns a box that contains all of space.
+func InfiniteBoundingBox() BoundingBox {
+	inf := math.Inf(1)
+	return BoundingBox{
+		Min: tuple.NewPoint(-inf, -inf, -inf),
+		Max: tuple.NewPoint(inf, inf, inf),
+	}
+}
+
+func (b BoundingBox) String() string {
+	return fmt.Sprintf("min: %s, max: %s", b.Min, b.Max)
+}
+
+func (b BoundingBox) Add(points ...tuple.Tuple) BoundingBox {
+	for _, p := range points {
+		b.Min = tuple.NewPoint(math.Min(b.Min.X(), p.X()), math.Min(b.Min.Y(), p.Y()), math.Min(b.Min.Z(), p.Z()))
+		b.Max = tuple.NewPoint(math.Max(b.Max.X(), p.X()), math.Max(b.Max.Y(), p.Y()), math.Max(b.Max.Z(), p.Z()))
+	}
+	return b
+}
+
+func (b BoundingBox) Union(other BoundingBox) BoundingBox {
+	return BoundingBox{
+		Min: tuple.NewPoint(math.Min(b.Min.X(), other.Min.X()), math.Min(b.Min.Y(), other.Min.Y()), math.Min(b.Min.Z(), other.Min.Z())),
+		Max: tuple.NewPoint(math.Max(b.Max.X(), other.Max.X()), math.Max(b.Max.Y(), other.Max.Y()), math.Max(b.Max.Z(), other.Max.Z())),
+	}
+}
+
+// Transform returns the axis aligned box that contains this box after it's
+// transformed by m.
+func (b BoundingBox) Transform(m matrix.Matrix) BoundingBox {
+	if b.IsEmpty() {
+		return b
+	}
+	// Each axis of the result is computed separately from the matrix rows (Arvo's method)
+	// instead of transforming the eight corners, so that infinite extents multiplied by
+	// a zero matrix entry don't turn into NaNs.
+	var min, max [3]float64
+	for row := 0; row < 3; row++ {
+		min[row] = m.At(row, 3)
+		max[row] = m.At(row, 3)
+		for col := 0; col < 3; col++ {
+			factor := m.At(row, col)
+			if factor == 0 {
+				continue
+			}
+			a := factor * b.Min[col]
+			c := factor * b.Max[col]
+			min[row] += math.Min(a, c)
+			max[row] += math.Max(a, c)
+		}
+	}
+	return BoundingBox{
+		Min: tuple.NewPoint(min[0], min[1], min[2]),
+		Max: tuple.NewPoint(max[0], max[1], max[2]),
+	}
+}
+
+// IsEmpty is true for a box that doesn't contain any point
+func (b BoundingBox) IsEmpty() bool {
+	return b.Min.X() > b.Max.X() || b.Min.Y() > b.Max.Y() || b.Min.Z() > b.Max.Z()
+}
+
+// IsBounded is true when the box has a finite extent on every axis. Shapes like
+// planes or cylinders without a minimum and maximum have unbounded boxes, as does
+// any group or CSG that contains them.
+func (b BoundingBox) IsBounded() bool {
+	if b.IsEmpty() {
+		return false
+	}
+	for i := tuple.XPos; i <= tuple.ZPos; i++ {
+		if math.IsInf(b.Min[i], 0) || math.IsInf(b.Max[i], 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// Contains checks whether the point is inside the box or on its surface
+func (b BoundingBox) Contains(p tuple.Tuple) bool {
+	for i := tuple.XPos; i <= tuple.ZPos; i++ {
+		if p[i] < b.Min[i] || p[i] > b.Max[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ContainsBox checks whether the other box is entirely inside this box. An empty box
+// is contained in any box.
+func (b BoundingBox) ContainsBox(other BoundingBox) bool {
+	if other.IsEmpty() {
+		return true
+	}
+	return b.Contains(other.Min) && b.Contains(other.Max)
+}
+
+// Size returns the extent of the box along each axis, as a vector
+func (b BoundingBox) Size() tuple.Tuple {
+	if b.IsEmpty() {
+		return tuple.NewVector(0, 0, 0)
+	}
+	return b.Max.Subtract(b.Min)
+}
+
+// Center returns the middle of the box. The center of an unbounded box isn't
+// meaningful, and can contain infinite or NaN coordinates.
+func (b BoundingBox) Center() tuple.Tuple {
+	return tuple.NewPoint((b.Min.X()+b.Max.X())/2.0, (b.Min.Y()+b.Max.Y())/2.0, (b.Min.Z()+b.Max.Z())/2.0)
+}
+
+// SurfaceArea is the total area of the box's six faces
+func (b BoundingBox) SurfaceArea() float64 {
+	if b.IsEmpty() {
+		return 0
+	}
+	dx := b.Max.X() - b.Min.X()
+	dy := b.Max.Y() - b.Min.Y()
+	dz := b.Max.Z() - b.Min.Z()
+	return 2.0 * (dx*dy + dy*dz + dz*dx)
+}
+
+// Intersects checks whether the line the ray travels on passes through the box. Boxes
+// behind the ray's origin are not rejected, since intersections with a negative time
+// are still needed when figuring out refraction indices.
+func (b BoundingBox) Intersects(r Ray) bool {
+	_, _, ok := b.Intersect(r)
+	return ok
+}
+
+// Intersect returns the times at which the line the ray travels on enters and leaves
+// the box. Either time may be negative, or infinite for an unbounded box.
+func (b BoundingBox) Intersect(r Ray) (float64, float64, bool) {
+	if b.IsEmpty() {
+		return 0, 0, false
+	}
+	tmin, tmax := math.Inf(-1), math.Inf(1)
+	for i := tuple.XPos; i <= tuple.ZPos; i++ {
+		// The box is padded a little so that rays grazing the edge of a shape aren't
+		// rejected due to rounding errors that the shape's own test tolerates.
+		min, max := b.Min[i]-utils.EPSILON, b.Max[i]+utils.EPSILON
+		origin, direction := r.Origin[i], r.Direction[i]
+		if direction == 0 {
+			if origin < min || origin > max {
+				return 0, 0, false
+			}
+			continue
+		}
+		t0 := (min - origin) / direction
+		t1 := (max - origin) / direction
+		if t0 > t1 {
+			t0, t1 = t1, t0
+		}
+		tmin = math.Max(tmin, t0)
+		tmax = math.Min(tmax, t1)
+		if tmin > tmax {
+			return 0, 0, false
+		}
+	}
+	return tmin, tmax, true
+}
@@ -0,0 +1,145 @@
+package shapes
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/liorokman/raytrace/pkg/matrix"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+func TestShapeLocalBounds(t *testing.T) {
+	inf := math.Inf(1)
+	tests := []struct {
+		name    string
+		shape   Shape
+		min     tuple.Tuple
+		max     tuple.Tuple
+		bounded bool
+	}{
+		{"sphere", NewSphere(), tuple.NewPoint(-1, -1, -1), tuple.NewPoint(1, 1, 1), true},
+		{"cube", NewCube(), tuple.NewPoint(-1, -1, -1), tuple.NewPoint(1, 1, 1), true},
+		{"plane", NewPlane(), tuple.NewPoint(-inf, 0, -inf), tuple.NewPoint(inf, 0, inf), false},
+		{"cylinder", NewCylinder(), tuple.NewPoint(-1, -inf, -1), tuple.NewPoint(1, inf, 1), false},
+		{"constrained cylinder", NewConstrainedCylinder(-5, 3, true), tuple.NewPoint(-1, -5, -1), tuple.NewPoint(1, 3, 1), true},
+		{"cone", NewCone(), tuple.NewPoint(-inf, -inf, -inf), tuple.NewPoint(inf, inf, inf), false},
+		{"constrained cone", NewConstrainedCone(-5, 3, false), tuple.NewPoint(-5, -5, -5), tuple.NewPoint(5, 3, 5), true},
+		{"triangle", NewTriangle(tuple.NewPoint(-3, 7, 2), tuple.NewPoint(6, 2, -4), tuple.NewPoint(2, -1, -1)),
+			tuple.NewPoint(-3, -1, -4), tuple.NewPoint(6, 7, 2), true},
+		{"empty group", NewGroup(), tuple.NewPoint(inf, inf, inf), tuple.NewPoint(-inf, -inf, -inf), false},
+	}
+
+	g := NewGomegaWithT(t)
+	for _, test := range tests {
+		b := test.shape.LocalBounds()
+		g.Expect(b.Min).To(Equal(test.min), test.name)
+		g.Expect(b.Max).To(Equal(test.max), test.name)
+		g.Expect(b.IsBounded()).To(Equal(test.bounded), test.name)
+	}
+}
+
+func TestCSGBounds(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	left := NewSphere()
+	right := NewSphere().WithTransform(matrix.NewTranslation(2, 3, 4))
+	c := NewCSG(&left, &right, DifferenceOp)
+	b := c.LocalBounds()
+	g.Expect(b.Min.Equals(tuple.NewPoint(-1, -1, -1))).To(BeTrue())
+	g.Expect(b.Max.Equals(tuple.NewPoint(3, 4, 5))).To(BeTrue())
+}
+
+func TestWorldBoundsFollowParents(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	outer := NewGroup().WithTransform(matrix.NewTranslation(10, 0, 0))
+	inner := NewGroup().WithTransform(matrix.NewScale(2, 2, 2))
+	inner, err := Connect(outer, inner)
+	g.Expect(err).To(BeNil())
+	s, err := Connect(inner, NewSphere().WithTransform(matrix.NewTranslation(0, 1, 0)))
+	g.Expect(err).To(BeNil())
+
+	b := s.Bounds()
+	g.Expect(b.Min.Equals(tuple.NewPoint(-1, 0, -1))).To(BeTrue())
+	g.Expect(b.Max.Equals(tuple.NewPoint(1, 2, 1))).To(BeTrue())
+
+	b = s.WorldBounds()
+	g.Expect(b.Min.Equals(tuple.NewPoint(8, 0, -2))).To(BeTrue())
+	g.Expect(b.Max.Equals(tuple.NewPoint(12, 4, 2))).To(BeTrue())
+
+	g.Expect(outer.WorldBounds().ContainsBox(b)).To(BeTrue())
+}
+
+func TestBoundingBoxContains(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	b := NewBoundingBox(tuple.NewPoint(5, -2, 0), tuple.NewPoint(11, 4, 7))
+	points := []struct {
+		p        tuple.Tuple
+		expected bool
+	}{
+		{tuple.NewPoint(5, -2, 0), true},
+		{tuple.NewPoint(11, 4, 7), true},
+		{tuple.NewPoint(8, 1, 3), true},
+		{tuple.NewPoint(3, 0, 3), false},
+		{tuple.NewPoint(8, -4, 3), false},
+		{tuple.NewPoint(8, 1, -1), false},
+		{tuple.NewPoint(13, 1, 3), false},
+		{tuple.NewPoint(8, 5, 3), false},
+		{tuple.NewPoint(8, 1, 8), false},
+	}
+	for _, p := range points {
+		g.Expect(b.Contains(p.p)).To(Equal(p.expected), p.p.String())
+	}
+
+	g.Expect(b.ContainsBox(NewBoundingBox(tuple.NewPoint(6, -1, 1), tuple.NewPoint(10, 3, 6)))).To(BeTrue())
+	g.Expect(b.ContainsBox(NewBoundingBox(tuple.NewPoint(4, -3, -1), tuple.NewPoint(10, 3, 6)))).To(BeFalse())
+	g.Expect(b.ContainsBox(EmptyBoundingBox())).To(BeTrue())
+	g.Expect(InfiniteBoundingBox().ContainsBox(b)).To(BeTrue())
+	g.Expect(EmptyBoundingBox().Contains(tuple.NewPoint(0, 0, 0))).To(BeFalse())
+}
+
+func TestBoundingBoxUnion(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	b1 := NewBoundingBox(tuple.NewPoint(-5, -2, 0), tuple.NewPoint(7, 4, 4))
+	b2 := NewBoundingBox(tuple.NewPoint(8, -7, -2), tuple.NewPoint(14, 2, 8))
+	u := b1.Union(b2)
+	g.Expect(u.Min).To(Equal(tuple.NewPoint(-5, -7, -2)))
+	g.Expect(u.Max).To(Equal(tuple.NewPoint(14, 4, 8)))
+	g.Expect(u.Size()).To(Equal(tuple.NewVector(19, 11, 10)))
+
+	g.Expect(b1.Union(EmptyBoundingBox())).To(Equal(b1))
+	g.Expect(EmptyBoundingBox().Union(b1)).To(Equal(b1))
+	g.Expect(EmptyBoundingBox().Size()).To(Equal(tuple.NewVector(0, 0, 0)))
+}
+
+func TestBoundingBoxIntersectTimes(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	b := NewBoundingBox(tuple.NewPoint(-1, -1, -1), tuple.NewPoint(1, 1, 1))
+	r, err := NewRay(tuple.NewPoint(0, 0, -5), tuple.NewVector(0, 0, 1))
+	g.Expect(err).To(BeNil())
+	t0, t1, ok := b.Intersect(r)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(t0).To(BeNumerically("~", 4, 0.001))
+	g.Expect(t1).To(BeNumerically("~", 6, 0.001))
+
+	// A ray parallel to a plane only hits its box when it lies in the plane
+	_, _, ok = NewPlane().Bounds().Intersect(r)
+	g.Expect(ok).To(BeTrue())
+	r, err = NewRay(tuple.NewPoint(0, 1, -5), tuple.NewVector(0, 0, 1))
+	g.Expect(err).To(BeNil())
+	_, _, ok = NewPlane().Bounds().Intersect(r)
+	g.Expect(ok).To(BeFalse())
+
+	// A ray travelling along an infinite axis is inside the box forever
+	r, err = NewRay(tuple.NewPoint(0, 0, 0), tuple.NewVector(0, 1, 0))
+	g.Expect(err).To(BeNil())
+	t0, t1, ok = NewCylinder().Bounds().Intersect(r)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(math.IsInf(t0, -1)).To(BeTrue())
+	g.Expect(math.IsInf(t1, 1)).To(BeTrue())
+}
@@ -0,0 +1,266 @@
+package shapes
+
+import (
+	"math"
+	"sort"
+
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+type SplitHeuristic int
+
+const (
+	// SplitSAH chooses the split that minimizes the surface area heuristic cost
+	SplitSAH SplitHeuristic = iota
+	// SplitMidpoint splits the longest axis of the node in the middle
+	SplitMidpoint SplitHeuristic = iota
+	// SplitMedian splits the shapes into two equally sized halves along the longest axis
+	SplitMedian SplitHeuristic = iota
+)
+
+const (
+	defaultMaxLeafSize = 4
+	sahBuckets         = 12
+)
+
+// BVHOptions controls how a bounding volume hierarchy is built. The zero value
+// selects the defaults.
+type BVHOptions struct {
+	// Disabled makes the hierarchy test every shape against every ray
+	Disabled bool
+	// MaxLeafSize is the number of shapes below which a node isn't split any further
+	MaxLeafSize int
+	// Split is the heuristic used for deciding how to divide a node
+	Split SplitHeuristic
+}
+
+func DefaultBVHOptions() BVHOptions {
+	return BVHOptions{
+		MaxLeafSize: defaultMaxLeafSize,
+		Split:       SplitSAH,
+	}
+}
+
+// BVH is a bounding volume hierarchy over a set of shapes. Shapes without finite
+// bounds (e.g. planes) are kept outside of the hierarchy and are always tested.
+type BVH struct {
+	unbounded []Shape
+	bounded   []Shape
+	root      *bvhNode
+}
+
+// bvhNode is a node in a hierarchy of items that are kept elsewhere. The leaves refer
+// to the items by their index, so that the same hierarchy works for shapes and for the
+// faces of a mesh.
+type bvhNode struct {
+	box         BoundingBox
+	left, right *bvhNode
+	content     []int
+}
+
+type bvhEntry struct {
+	index    int
+	box      BoundingBox
+	centroid tuple.Tuple
+}
+
+func NewBVH(content []Shape, opts BVHOptions) *BVH {
+	if opts.MaxLeafSize <= 0 {
+		opts.MaxLeafSize = defaultMaxLeafSize
+	}
+	retval := &BVH{}
+	if opts.Disabled {
+		retval.unbounded = append([]Shape{}, content...)
+		return retval
+	}
+	entries := []bvhEntry{}
+	for _, s := range content {
+		box := s.Bounds()
+		if !box.IsBounded() {
+			retval.unbounded = append(retval.unbounded, s)
+			continue
+		}
+		entries = append(entries, bvhEntry{index: len(retval.bounded), box: box, centroid: box.Center()})
+		retval.bounded = append(retval.bounded, s)
+	}
+	if len(entries) > 0 {
+		retval.root = buildBVHNode(entries, opts)
+	}
+	return retval
+}
+
+func buildBVHNode(entries []bvhEntry, opts BVHOptions) *bvhNode {
+	node := &bvhNode{box: EmptyBoundingBox()}
+	centroids := EmptyBoundingBox()
+	for _, e := range entries {
+		node.box = node.box.Union(e.box)
+		centroids = centroids.Add(e.centroid)
+	}
+	if len(entries) <= opts.MaxLeafSize {
+		return node.makeLeaf(entries)
+	}
+
+	axis := tuple.XPos
+	extent := centroids.Max.Subtract(centroids.Min)
+	if extent.Y() > extent[axis] {
+		axis = tuple.YPos
+	}
+	if extent.Z() > extent[axis] {
+		axis = tuple.ZPos
+	}
+	if extent[axis] == 0 {
+		// All the centroids are in the same place, no split can separate them
+		return node.makeLeaf(entries)
+	}
+
+	var mid int
+	switch opts.Split {
+	case SplitMedian:
+		mid = splitMedian(entries, axis)
+	case SplitMidpoint:
+		mid = splitMidpoint(entries, axis, (centroids.Min[axis]+centroids.Max[axis])/2.0)
+	default:
+		var ok bool
+		if mid, ok = splitSAH(entries, axis, node.box, centroids); !ok {
+			return node.makeLeaf(entries)
+		}
+	}
+	if mid == 0 || mid == len(entries) {
+		mid = splitMedian(entries, axis)
+	}
+	node.left = buildBVHNode(entries[:mid], opts)
+	node.right = buildBVHNode(entries[mid:], opts)
+	return node
+}
+
+func (n *bvhNode) makeLeaf(entries []bvhEntry) *bvhNode {
+	n.content = make([]int, len(entries))
+	for i := range entries {
+		n.content[i] = entries[i].index
+	}
+	return n
+}
+
+// partition reorders entries so that all the entries for which the predicate holds come
+// first, and returns the number of such entries.
+func partition(entries []bvhEntry, pred func(bvhEntry) bool) int {
+	mid := 0
+	for i := range entries {
+		if pred(entries[i]) {
+			entries[i], entries[mid] = entries[mid], entries[i]
+			mid++
+		}
+	}
+	return mid
+}
+
+func splitMidpoint(entries []bvhEntry, axis int, pivot float64) int {
+	return partition(entries, func(e bvhEntry) bool {
+		return e.centroid[axis] < pivot
+	})
+}
+
+func splitMedian(entries []bvhEntry, axis int) int {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].centroid[axis] < entries[j].centroid[axis]
+	})
+	return len(entries) / 2
+}
+
+func splitSAH(entries []bvhEntry, axis int, box, centroids BoundingBox) (int, bool) {
+	type bucket struct {
+		count int
+		box   BoundingBox
+	}
+	buckets := make([]bucket, sahBuckets)
+	for i := range buckets {
+		buckets[i].box = EmptyBoundingBox()
+	}
+	bucketOf := func(e bvhEntry) int {
+		b := int(sahBuckets * (e.centroid[axis] - centroids.Min[axis]) / (centroids.Max[axis] - centroids.Min[axis]))
+		if b >= sahBuckets {
+			b = sahBuckets - 1
+		}
+		return b
+	}
+	for _, e := range entries {
+		b := bucketOf(e)
+		buckets[b].count++
+		buckets[b].box = buckets[b].box.Union(e.box)
+	}
+
+	// Cost of splitting after each bucket, relative to the cost of intersecting a single shape
+	bestCost, bestSplit := math.Inf(1), -1
+	for split := 0; split < sahBuckets-1; split++ {
+		left, right := EmptyBoundingBox(), EmptyBoundingBox()
+		leftCount, rightCount := 0, 0
+		for i := 0; i <= split; i++ {
+			left = left.Union(buckets[i].box)
+			leftCount += buckets[i].count
+		}
+		for i := split + 1; i < sahBuckets; i++ {
+			right = right.Union(buckets[i].box)
+			rightCount += buckets[i].count
+		}
+		cost := 0.125 + (float64(leftCount)*left.SurfaceArea()+float64(rightCount)*right.SurfaceArea())/box.SurfaceArea()
+		if cost < bestCost {
+			bestCost, bestSplit = cost, split
+		}
+	}
+	// A flat node has no surface area, in which case the cost can't be compared
+	if box.SurfaceArea() > 0 && bestCost >= float64(len(entries)) {
+		return 0, false
+	}
+	return partition(entries, func(e bvhEntry) bool {
+		return bucketOf(e) <= bestSplit
+	}), true
+}
+
+// Intersect returns all the intersections of the ray with the shapes in the hierarchy,
+// sorted by time.
+func (b *BVH) Intersect(r Ray) []Intersection {
+	retval := []Intersection{}
+	for _, s := range b.unbounded {
+		retval = append(retval, r.Intersect(s)...)
+	}
+	if b.root != nil {
+		retval = b.root.intersect(r, retval, func(i int, retval []Intersection) []Intersection {
+			return append(retval, r.Intersect(b.bounded[i])...)
+		})
+	}
+	sort.Sort(ByTime(retval))
+	return retval
+}
+
+// intersect calls intersectItem for every item in the leaves whose boxes the ray hits
+func (n *bvhNode) intersect(r Ray, retval []Intersection, intersectItem func(int, []Intersection) []Intersection) []Intersection {
+	if !n.box.Intersects(r) {
+		return retval
+	}
+	for _, i := range n.content {
+		retval = intersectItem(i, retval)
+	}
+	if n.left != nil {
+		retval = n.left.intersect(r, retval, intersectItem)
+	}
+	if n.right != nil {
+		retval = n.right.intersect(r, retval, intersectItem)
+	}
+	return retval
+}
+
+// Depth returns the number of levels in the hierarchy
+func (b *BVH) Depth() int {
+	return b.root.depth()
+}
+
+func (n *bvhNode) depth() int {
+	if n == nil {
+		return 0
+	}
+	l, r := n.left.depth(), n.right.depth()
+	if l > r {
+		return l + 1
+	}
+	return r + 1
+}
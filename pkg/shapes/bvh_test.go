@@ -0,0 +1,152 @@
+package shapes
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/liorokman/raytrace/pkg/matrix"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+func randomPoint(rnd *rand.Rand, size float64) tuple.Tuple {
+	return tuple.NewPoint(size*(2*rnd.Float64()-1), size*(2*rnd.Float64()-1), size*(2*rnd.Float64()-1))
+}
+
+func randomVector(rnd *rand.Rand, size float64) tuple.Tuple {
+	return randomPoint(rnd, size).Subtract(tuple.NewPoint(0, 0, 0))
+}
+
+func randomScene(rnd *rand.Rand) []Shape {
+	retval := []Shape{NewPlane().WithTransform(matrix.NewTranslation(0, -12, 0))}
+	for i := 0; i < 300; i++ {
+		p := randomPoint(rnd, 10)
+		retval = append(retval, NewTriangle(p, p.Add(randomVector(rnd, 1)), p.Add(randomVector(rnd, 1))))
+	}
+	for i := 0; i < 50; i++ {
+		p := randomPoint(rnd, 10)
+		retval = append(retval, NewSphere().WithTransform(matrix.NewTranslation(p.X(), p.Y(), p.Z()).Scale(0.5, 0.5, 0.5)))
+	}
+	for i := 0; i < 10; i++ {
+		p := randomPoint(rnd, 10)
+		retval = append(retval, NewConstrainedCylinder(-1, 1, true).WithTransform(matrix.NewTranslation(p.X(), p.Y(), p.Z()).RotateX(rnd.Float64())))
+	}
+	return retval
+}
+
+func sortedForComparison(xs []Intersection) []Intersection {
+	sort.SliceStable(xs, func(i, j int) bool {
+		if xs[i].T != xs[j].T {
+			return xs[i].T < xs[j].T
+		}
+		return xs[i].Shape.ID() < xs[j].Shape.ID()
+	})
+	return xs
+}
+
+func TestBoundingBoxTransform(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	b := NewSphere().WithTransform(matrix.NewTranslation(1, 2, 3).Scale(2, 2, 2)).Bounds()
+	g.Expect(b.Min.Equals(tuple.NewPoint(-1, 0, 1))).To(BeTrue())
+	g.Expect(b.Max.Equals(tuple.NewPoint(3, 4, 5))).To(BeTrue())
+
+	// A rotated plane is still infinite, but doesn't produce NaNs
+	b = NewPlane().WithTransform(matrix.NewRotateZ(1.0)).Bounds()
+	g.Expect(b.IsBounded()).To(BeFalse())
+	for i := tuple.XPos; i <= tuple.ZPos; i++ {
+		g.Expect(b.Min[i]).ToNot(BeNumerically(">", b.Max[i]))
+	}
+
+	group := NewGroup()
+	_, err := Connect(group, NewCube().WithTransform(matrix.NewTranslation(5, 0, 0)))
+	g.Expect(err).To(BeNil())
+	_, err = Connect(group, NewTriangle(tuple.NewPoint(-3, 0, 0), tuple.NewPoint(0, 4, 0), tuple.NewPoint(0, 0, -2)))
+	g.Expect(err).To(BeNil())
+	b = group.Bounds()
+	g.Expect(b.Min.Equals(tuple.NewPoint(-3, -1, -2))).To(BeTrue())
+	g.Expect(b.Max.Equals(tuple.NewPoint(6, 4, 1))).To(BeTrue())
+}
+
+func TestBoundingBoxIntersects(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	b := NewBoundingBox(tuple.NewPoint(-1, -1, -1), tuple.NewPoint(1, 1, 1))
+	tests := []struct {
+		origin    tuple.Tuple
+		direction tuple.Tuple
+		expected  bool
+	}{
+		{tuple.NewPoint(5, 0.5, 0), tuple.NewVector(-1, 0, 0), true},
+		{tuple.NewPoint(0, 0, 0), tuple.NewVector(0, 0, 1), true},
+		{tuple.NewPoint(-2, 0, 0), tuple.NewVector(2, 4, 6), false},
+		{tuple.NewPoint(2, 2, 0), tuple.NewVector(0, 0, -1), false},
+		{tuple.NewPoint(0, 0, 5), tuple.NewVector(0, 0, 1), true},
+	}
+	for _, test := range tests {
+		r, err := NewRay(test.origin, test.direction.Normalize())
+		g.Expect(err).To(BeNil())
+		g.Expect(b.Intersects(r)).To(Equal(test.expected))
+	}
+}
+
+func TestBVHMatchesLinearIntersection(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	rnd := rand.New(rand.NewSource(42))
+	content := randomScene(rnd)
+	linear := NewBVH(content, BVHOptions{Disabled: true})
+
+	hierarchies := map[string]*BVH{
+		"sah":      NewBVH(content, BVHOptions{Split: SplitSAH}),
+		"midpoint": NewBVH(content, BVHOptions{Split: SplitMidpoint, MaxLeafSize: 2}),
+		"median":   NewBVH(content, BVHOptions{Split: SplitMedian, MaxLeafSize: 8}),
+	}
+	for name, h := range hierarchies {
+		g.Expect(h.Depth()).To(BeNumerically(">", 2), name)
+	}
+
+	hits := 0
+	for i := 0; i < 200; i++ {
+		r, err := NewRay(randomPoint(rnd, 15), randomVector(rnd, 1).Normalize())
+		g.Expect(err).To(BeNil())
+		expected := sortedForComparison(linear.Intersect(r))
+		hits += len(expected)
+		for name, h := range hierarchies {
+			actual := sortedForComparison(h.Intersect(r))
+			g.Expect(len(actual)).To(Equal(len(expected)), name)
+			for j := range expected {
+				g.Expect(actual[j].Equals(expected[j])).To(BeTrue(), name)
+			}
+		}
+	}
+	// Make sure the comparison actually covered some hits
+	g.Expect(hits).To(BeNumerically(">", 100))
+}
+
+func TestGroupWithAndWithoutBVH(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	rnd := rand.New(rand.NewSource(7))
+	accelerated := NewGroup().WithTransform(matrix.NewRotateY(0.5).Scale(0.5, 1, 2))
+	plain := NewGroup().WithTransform(matrix.NewRotateY(0.5).Scale(0.5, 1, 2))
+	plain.InnerShape().(Group).SetBVHOptions(BVHOptions{Disabled: true})
+	for _, s := range randomScene(rnd) {
+		_, err := Connect(accelerated, s)
+		g.Expect(err).To(BeNil())
+		_, err = Connect(plain, s)
+		g.Expect(err).To(BeNil())
+	}
+	for i := 0; i < 200; i++ {
+		r, err := NewRay(randomPoint(rnd, 15), randomVector(rnd, 1).Normalize())
+		g.Expect(err).To(BeNil())
+		expected := sortedForComparison(r.Intersect(plain))
+		actual := sortedForComparison(r.Intersect(accelerated))
+		g.Expect(len(actual)).To(Equal(len(expected)))
+		for j := range expected {
+			g.Expect(actual[j].Equals(expected[j])).To(BeTrue())
+		}
+	}
+}
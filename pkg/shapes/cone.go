@@ -54,6 +54,15 @@ func (c cone) normalAt(point tuple.Tuple, hit Intersection) tuple.Tuple {
 	return tuple.NewVector(point.X(), y, point.Z())
 }
 
+func (c cone) bounds() BoundingBox {
+	limit := math.Max(math.Abs(c.Min), math.Abs(c.Max))
+	return NewBoundingBox(tuple.NewPoint(-limit, c.Min, -limit), tuple.NewPoint(limit, c.Max, limit))
+}
+
+func (c cone) uvAt(point tuple.Tuple) (float64, float64) {
+	return material.CylindricalMap(point)
+}
+
 func (c cone) localIntersect(ray Ray, outer Shape) []Intersection {
 
 	A := ray.Direction.X()*ray.Direction.X() - ray.Direction.Y()*ray.Direction.Y() + ray.Direction.Z()*ray.Direction.Z()
@@ -3,6 +3,7 @@ package shapes
 import (
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/liorokman/raytrace/pkg/material"
 	"github.com/liorokman/raytrace/pkg/matrix"
@@ -59,12 +60,15 @@ func includes(a, b Shape) bool {
 	case csg:
 		return includes(inner.left, b) || includes(inner.right, b)
 	case Group:
-		for _, curr := range inner.content {
+		for _, curr := range inner.children() {
 			if includes(curr, b) {
 				return true
 			}
 		}
 		return false
+	case instance:
+		// Hits on an instance are identified by the instance's ID followed by the shape's ID
+		return strings.HasPrefix(b.ID(), a.ID()+"/")
 	default:
 		return (a.ID() == b.ID())
 	}
@@ -94,6 +98,15 @@ func (c csg) normalAt(point tuple.Tuple, hit Intersection) tuple.Tuple {
 	panic("CSG normalAt should never be called")
 }
 
+func (c csg) bounds() BoundingBox {
+	return c.left.Bounds().Union(c.right.Bounds())
+}
+
+// uvAt is never used, since hits are always reported on the CSG's children
+func (c csg) uvAt(point tuple.Tuple) (float64, float64) {
+	return material.SphericalMap(point)
+}
+
 func (c csg) localIntersect(ray Ray, outer Shape) []Intersection {
 	hits := ray.Intersect(c.left)
 	hits = append(hits, ray.Intersect(c.right)...)
@@ -30,6 +30,14 @@ func (c cube) normalAt(point tuple.Tuple, hit Intersection) tuple.Tuple {
 	return tuple.NewVector(0, 0, point.Z())
 }
 
+func (c cube) bounds() BoundingBox {
+	return NewBoundingBox(tuple.NewPoint(-1, -1, -1), tuple.NewPoint(1, 1, 1))
+}
+
+func (c cube) uvAt(point tuple.Tuple) (float64, float64) {
+	return material.CubeMap(point)
+}
+
 func (c cube) localIntersect(ray Ray, outer Shape) []Intersection {
 	xtmin, xtmax := checkAxis(ray.Origin.X(), ray.Direction.X())
 	ytmin, ytmax := checkAxis(ray.Origin.Y(), ray.Direction.Y())
@@ -51,6 +51,14 @@ func (c cylinder) normalAt(point tuple.Tuple, hit Intersection) tuple.Tuple {
 	return tuple.NewVector(point.X(), 0, point.Z())
 }
 
+func (c cylinder) bounds() BoundingBox {
+	return NewBoundingBox(tuple.NewPoint(-1, c.Min, -1), tuple.NewPoint(1, c.Max, 1))
+}
+
+func (c cylinder) uvAt(point tuple.Tuple) (float64, float64) {
+	return material.CylindricalMap(point)
+}
+
 func (c cylinder) localIntersect(ray Ray, outer Shape) []Intersection {
 	A := ray.Direction.X()*ray.Direction.X() + ray.Direction.Z()*ray.Direction.Z()
 
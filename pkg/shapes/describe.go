@@ -0,0 +1,152 @@
+package shapes
+
+import (
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+// ShapeKind tells what kind of shape a Shape is
+type ShapeKind int
+
+const (
+	SphereKind         ShapeKind = iota
+	PlaneKind          ShapeKind = iota
+	CubeKind           ShapeKind = iota
+	CylinderKind       ShapeKind = iota
+	ConeKind           ShapeKind = iota
+	TorusKind          ShapeKind = iota
+	TriangleKind       ShapeKind = iota
+	SmoothTriangleKind ShapeKind = iota
+	GroupKind          ShapeKind = iota
+	CSGKind            ShapeKind = iota
+	ImplicitKind       ShapeKind = iota
+	MeshKind           ShapeKind = iota
+	InstanceKind       ShapeKind = iota
+)
+
+// Description holds the parameters a shape was created with, for code that needs to
+// take shapes apart, like the scene exporter. Only the fields of the shape's kind are set.
+type Description struct {
+	Kind ShapeKind
+	// Cylinders and cones
+	Minimum, Maximum float64
+	Closed           bool
+	// Tori
+	Major, Minor float64
+	// Triangles and smooth triangles. Normals are only set for smooth triangles.
+	Points  [3]tuple.Tuple
+	Normals [3]tuple.Tuple
+	UVs     [3]TextureCoord
+	// Groups
+	Children []Shape
+	// CSGs
+	Left, Right Shape
+	Operation   CSGOp
+	// Implicit shapes
+	Field SDF
+	// Meshes
+	Mesh Mesh
+	// Instances
+	Prototype Shape
+}
+
+// Describe returns the parameters of the shape
+func Describe(s Shape) Description {
+	switch inner := s.InnerShape().(type) {
+	case sphere:
+		return Description{Kind: SphereKind}
+	case plane:
+		return Description{Kind: PlaneKind}
+	case cube:
+		return Description{Kind: CubeKind}
+	case cylinder:
+		return Description{Kind: CylinderKind, Minimum: inner.Min, Maximum: inner.Max, Closed: inner.Closed}
+	case cone:
+		return Description{Kind: ConeKind, Minimum: inner.Min, Maximum: inner.Max, Closed: inner.Closed}
+	case torus:
+		return Description{Kind: TorusKind, Major: inner.Major, Minor: inner.Minor}
+	case triangle:
+		return Description{Kind: TriangleKind, Points: [3]tuple.Tuple{inner.P1, inner.P2, inner.P3}, UVs: inner.UV}
+	case smoothTriangle:
+		return Description{
+			Kind:    SmoothTriangleKind,
+			Points:  [3]tuple.Tuple{inner.P1, inner.P2, inner.P3},
+			Normals: [3]tuple.Tuple{inner.N1, inner.N2, inner.N3},
+			UVs:     inner.UV,
+		}
+	case Group:
+		return Description{Kind: GroupKind, Children: inner.Children()}
+	case csg:
+		return Description{Kind: CSGKind, Left: inner.left, Right: inner.right, Operation: inner.operation}
+	case implicit:
+		return Description{Kind: ImplicitKind, Field: inner.field}
+	case Mesh:
+		return Description{Kind: MeshKind, Mesh: inner}
+	case instance:
+		return Description{Kind: InstanceKind, Prototype: inner.prototype}
+	default:
+		panic("Unknown shape kind")
+	}
+}
+
+// IsDefaultUV is true when the texture coordinates are the ones given to triangles
+// created without any
+func IsDefaultUV(uvs [3]TextureCoord) bool {
+	return uvs == defaultTextureCoords
+}
+
+// SDFKind tells what kind of node an SDF is
+type SDFKind int
+
+const (
+	// SDFFuncKind is a field created by NewDistanceFunc, which can't be taken apart
+	SDFFuncKind         SDFKind = iota
+	SDFSphereKind       SDFKind = iota
+	SDFBoxKind          SDFKind = iota
+	SDFCapsuleKind      SDFKind = iota
+	SDFTorusKind        SDFKind = iota
+	SDFUnionKind        SDFKind = iota
+	SDFIntersectionKind SDFKind = iota
+	SDFSubtractionKind  SDFKind = iota
+	SDFRepeatKind       SDFKind = iota
+)
+
+// SDFDescription holds the parameters of a node in a signed distance field. Only the
+// fields of the node's kind are set. The first child of a subtraction is the base that
+// the other children are cut out of.
+type SDFDescription struct {
+	Kind       SDFKind
+	Center     tuple.Tuple
+	Radius     float64
+	HalfSize   tuple.Tuple
+	Rounding   float64
+	A, B       tuple.Tuple
+	Major      float64
+	Minor      float64
+	Smoothness float64
+	Period     tuple.Tuple
+	Children   []SDF
+}
+
+// DescribeSDF returns the parameters of a node in a signed distance field
+func DescribeSDF(f SDF) SDFDescription {
+	switch node := f.(type) {
+	case sdfSphere:
+		return SDFDescription{Kind: SDFSphereKind, Center: node.center, Radius: node.radius}
+	case sdfBox:
+		return SDFDescription{Kind: SDFBoxKind, Center: node.center, HalfSize: node.halfSize, Rounding: node.rounding}
+	case sdfCapsule:
+		return SDFDescription{Kind: SDFCapsuleKind, A: node.a, B: node.b, Radius: node.radius}
+	case sdfTorus:
+		return SDFDescription{Kind: SDFTorusKind, Major: node.major, Minor: node.minor}
+	case sdfUnion:
+		return SDFDescription{Kind: SDFUnionKind, Smoothness: node.smoothness, Children: node.children}
+	case sdfIntersection:
+		return SDFDescription{Kind: SDFIntersectionKind, Children: node.children}
+	case sdfSubtraction:
+		return SDFDescription{Kind: SDFSubtractionKind, Smoothness: node.smoothness, Children: append([]SDF{node.base}, node.cuts...)}
+	case sdfRepeat:
+		return SDFDescription{Kind: SDFRepeatKind, Period: node.period, Children: []SDF{node.child}}
+	default:
+		return SDFDescription{Kind: SDFFuncKind}
+	}
+}
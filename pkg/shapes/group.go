@@ -3,6 +3,7 @@ package shapes
 import (
 	"fmt"
 	"sort"
+	"sync"
 
 	"github.com/liorokman/raytrace/pkg/material"
 	"github.com/liorokman/raytrace/pkg/matrix"
@@ -10,12 +11,45 @@ import (
 )
 
 type Group struct {
+	kids  *groupChildren
+	accel *groupAccel
+}
+
+// groupChildren holds the shapes in a group. A copy of a group gets its own map of
+// children, which point at the copy as their parent. They're only re-parented the first
+// time the copy's children are used, so copying a group doesn't walk the whole tree
+// below it, and copies that are replaced before they're used cost very little.
+type groupChildren struct {
+	once    sync.Once
+	parent  Shape
 	content map[string]Shape
 }
 
+// children returns the group's shapes, keyed by their IDs
+func (g Group) children() map[string]Shape {
+	g.kids.once.Do(func() {
+		if g.kids.parent == nil {
+			return
+		}
+		for id, c := range g.kids.content {
+			g.kids.content[id] = c.SetParent(g.kids.parent)
+		}
+		g.kids.parent = nil
+	})
+	return g.kids.content
+}
+
+// groupAccel holds the bounding volume hierarchy of a group. It's built the first
+// time the group is intersected, and thrown away whenever the group's content changes.
+type groupAccel struct {
+	once sync.Once
+	opts BVHOptions
+	bvh  *BVH
+}
+
 func (g Group) String() string {
 	retval := "\n"
-	for _, s := range g.content {
+	for _, s := range g.children() {
 		retval = retval + "\t" + s.String() + "\n"
 	}
 	return retval
@@ -23,7 +57,8 @@ func (g Group) String() string {
 
 func NewGroup() Shape {
 	return newShape(material.Default(), matrix.NewIdentity(), Group{
-		content: map[string]Shape{},
+		kids:  &groupChildren{content: map[string]Shape{}},
+		accel: &groupAccel{opts: DefaultBVHOptions()},
 	})
 }
 
@@ -38,11 +73,57 @@ func Connect(group, child Shape) (Shape, error) {
 }
 
 func (g Group) Add(s Shape) {
-	g.content[s.ID()] = s
+	g.children()[s.ID()] = s
+	g.SetBVHOptions(g.accel.opts)
+}
+
+// adopt returns a copy of the group for the given copy of the group's shape. The copy's
+// children see self as their parent, while the children of g are left as they are.
+func (g Group) adopt(self shapeCore) shapeCore {
+	content := make(map[string]Shape, len(g.children()))
+	for id, c := range g.children() {
+		content[id] = c
+	}
+	kids := &groupChildren{content: content}
+	self.shape = Group{
+		kids:  kids,
+		accel: &groupAccel{opts: g.accel.opts},
+	}
+	kids.parent = self
+	return self
+}
+
+// SetBVHOptions changes how the group's bounding volume hierarchy is built. The
+// hierarchy is rebuilt the next time the group is intersected.
+func (g Group) SetBVHOptions(opts BVHOptions) {
+	*g.accel = groupAccel{opts: opts}
+}
+
+func (g Group) hierarchy() *BVH {
+	g.accel.once.Do(func() {
+		content := make([]Shape, 0, len(g.children()))
+		for _, s := range g.children() {
+			content = append(content, s)
+		}
+		g.accel.bvh = NewBVH(content, g.accel.opts)
+	})
+	return g.accel.bvh
 }
 
 func (g Group) Size() int {
-	return len(g.content)
+	return len(g.children())
+}
+
+// Children returns the shapes in the group, ordered by their IDs
+func (g Group) Children() []Shape {
+	retval := make([]Shape, 0, len(g.children()))
+	for _, s := range g.children() {
+		retval = append(retval, s)
+	}
+	sort.Slice(retval, func(i, j int) bool {
+		return retval[i].ID() < retval[j].ID()
+	})
+	return retval
 }
 
 func (g Group) shapeIdPrefix() string {
@@ -53,11 +134,19 @@ func (g Group) normalAt(point tuple.Tuple, hit Intersection) tuple.Tuple {
 	panic("group NormalAt should never be called")
 }
 
-func (g Group) localIntersect(ray Ray, outer Shape) []Intersection {
-	retval := []Intersection{}
-	for _, s := range g.content {
-		retval = append(retval, ray.Intersect(s)...)
+func (g Group) bounds() BoundingBox {
+	retval := EmptyBoundingBox()
+	for _, s := range g.children() {
+		retval = retval.Union(s.Bounds())
 	}
-	sort.Sort(ByTime(retval))
 	return retval
 }
+
+// uvAt is never used, since hits are always reported on the group's children
+func (g Group) uvAt(point tuple.Tuple) (float64, float64) {
+	return material.SphericalMap(point)
+}
+
+func (g Group) localIntersect(ray Ray, outer Shape) []Intersection {
+	return g.hierarchy().Intersect(ray)
+}
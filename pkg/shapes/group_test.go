@@ -32,6 +32,71 @@ func TestGroupWorldToObject(t *testing.T) {
 
 }
 
+func TestGroupBuiltBottomUp(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// The same groups as above, but every transform is set after the children were connected
+	group2 := NewGroup()
+	_, err := Connect(group2, NewSphere().WithTransform(matrix.NewTranslation(5, 0, 0)))
+	g.Expect(err).To(BeNil())
+	group2 = group2.WithTransform(matrix.NewScale(2, 2, 2))
+	group1 := NewGroup()
+	_, err = Connect(group1, group2)
+	g.Expect(err).To(BeNil())
+	group1 = group1.WithTransform(matrix.NewRotateY(math.Pi / 2.0))
+
+	children := group1.InnerShape().(Group).Children()
+	g.Expect(children).To(HaveLen(1))
+	children = children[0].InnerShape().(Group).Children()
+	g.Expect(children).To(HaveLen(1))
+	sphere := children[0]
+
+	p, err := sphere.WorldToObject(tuple.NewPoint(-2, 0, -10))
+	g.Expect(err).To(BeNil())
+	g.Expect(p.Equals(tuple.NewPoint(0, 0, -1))).To(BeTrue())
+
+	left, right := NewSphere(), NewCube()
+	c := NewCSG(&left, &right, UnionOp).WithTransform(matrix.NewTranslation(0, 3, 0))
+	r, err := NewRay(tuple.NewPoint(0, 3, -5), tuple.NewVector(0, 0, 1))
+	g.Expect(err).To(BeNil())
+	xs := r.Intersect(c)
+	g.Expect(xs).To(HaveLen(2))
+	p, err = xs[0].Shape.WorldToObject(tuple.NewPoint(0, 3, -1))
+	g.Expect(err).To(BeNil())
+	g.Expect(p.Equals(tuple.NewPoint(0, 0, -1))).To(BeTrue())
+}
+
+func TestCopiedGroupKeepsOriginal(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	original := NewGroup()
+	sphere, err := Connect(original, NewSphere())
+	g.Expect(err).To(BeNil())
+	moved := original.WithTransform(matrix.NewTranslation(5, 0, 0))
+
+	// The copy's children see the copy, and the original's children still see the original
+	p, err := moved.InnerShape().(Group).Children()[0].WorldToObject(tuple.NewPoint(5, 0, 0))
+	g.Expect(err).To(BeNil())
+	g.Expect(p.Equals(tuple.NewPoint(0, 0, 0))).To(BeTrue())
+	children := original.InnerShape().(Group).Children()
+	g.Expect(children).To(HaveLen(1))
+	g.Expect(children[0].Parent().GetTransform().Equals(matrix.NewIdentity())).To(BeTrue())
+	p, err = sphere.WorldToObject(tuple.NewPoint(5, 0, 0))
+	g.Expect(err).To(BeNil())
+	g.Expect(p.Equals(tuple.NewPoint(5, 0, 0))).To(BeTrue())
+
+	// Shapes added to one of them don't show up in the other
+	_, err = Connect(moved, NewCube())
+	g.Expect(err).To(BeNil())
+	g.Expect(moved.InnerShape().(Group).Size()).To(Equal(2))
+	g.Expect(original.InnerShape().(Group).Size()).To(Equal(1))
+
+	r, err := NewRay(tuple.NewPoint(0, 0, -5), tuple.NewVector(0, 0, 1))
+	g.Expect(err).To(BeNil())
+	g.Expect(r.Intersect(original)).To(HaveLen(2))
+	g.Expect(r.Intersect(moved)).To(BeEmpty())
+}
+
 func TestGroups(t *testing.T) {
 
 	g := NewGomegaWithT(t)
@@ -0,0 +1,96 @@
+package shapes
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/liorokman/raytrace/pkg/material"
+	"github.com/liorokman/raytrace/pkg/matrix"
+	"github.com/liorokman/raytrace/pkg/tuple"
+	"github.com/liorokman/raytrace/pkg/utils"
+)
+
+const (
+	// marchHitDistance is how close to the surface the ray has to get to count as a hit.
+	// It's well below EPSILON so that rays leaving the surface from an over point don't
+	// hit the surface they're leaving.
+	marchHitDistance = utils.EPSILON / 100
+	// marchMaxSteps limits the work spent on rays that graze the surface
+	marchMaxSteps = 1000
+	// marchMaxDistance limits how far a ray is marched through an unbounded field
+	marchMaxDistance = 1000.0
+	// normalDelta is the offset used to estimate the gradient of the field
+	normalDelta = utils.EPSILON / 10
+)
+
+// implicit is a surface defined by a signed distance field, rendered by sphere tracing
+type implicit struct {
+	field SDF
+}
+
+// NewImplicit creates a shape whose surface is where the field's distance is zero
+func NewImplicit(field SDF) Shape {
+	return newShape(material.Default(), matrix.NewIdentity(), implicit{field: field})
+}
+
+func (i implicit) String() string {
+	return fmt.Sprintf("Implicit: %T", i.field)
+}
+
+func (i implicit) shapeIdPrefix() string {
+	return "IM"
+}
+
+// normalAt estimates the gradient of the field with central differences
+func (i implicit) normalAt(point tuple.Tuple, hit Intersection) tuple.Tuple {
+	var n tuple.Tuple
+	for axis := tuple.XPos; axis <= tuple.ZPos; axis++ {
+		plus, minus := point, point
+		plus[axis] += normalDelta
+		minus[axis] -= normalDelta
+		n[axis] = i.field.Distance(plus) - i.field.Distance(minus)
+	}
+	return n.Normalize()
+}
+
+func (i implicit) bounds() BoundingBox {
+	return i.field.Bounds()
+}
+
+func (i implicit) uvAt(point tuple.Tuple) (float64, float64) {
+	return material.SphericalMap(point)
+}
+
+// localIntersect marches the ray through the part of it that's inside the field's
+// bounds. Both the points where the ray enters the surface and the points where it leaves
+// are reported, so that implicit shapes work in CSG and refract properly.
+func (i implicit) localIntersect(ray Ray, outer Shape) []Intersection {
+	tmin, tmax, ok := i.field.Bounds().Intersect(ray)
+	if !ok {
+		return []Intersection{}
+	}
+	speed := ray.Direction.Magnitude()
+	if math.IsInf(tmin, -1) {
+		tmin = 0
+	}
+	tmax = math.Min(tmax, tmin+marchMaxDistance/speed)
+
+	retval := []Intersection{}
+	t := tmin
+	inside := i.field.Distance(ray.Position(t)) < 0
+	for step := 0; step < marchMaxSteps && t <= tmax; step++ {
+		dist := i.field.Distance(ray.Position(t))
+		if inside {
+			dist = -dist
+		}
+		if dist < marchHitDistance {
+			retval = append(retval, Intersection{T: t, Shape: outer})
+			inside = !inside
+			// Step through the surface before marching on the other side of it
+			t += utils.EPSILON / speed
+			continue
+		}
+		t += dist / speed
+	}
+	return retval
+}
@@ -0,0 +1,149 @@
+package shapes
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/liorokman/raytrace/pkg/matrix"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+func TestSDFDistances(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	origin := tuple.NewPoint(0, 0, 0)
+	sphere := NewSDFSphere(tuple.NewPoint(1, 0, 0), 0.5)
+	g.Expect(sphere.Distance(origin)).To(BeNumerically("~", 0.5, 1e-9))
+	g.Expect(sphere.Distance(tuple.NewPoint(1, 0, 0))).To(BeNumerically("~", -0.5, 1e-9))
+
+	box := NewSDFBox(origin, tuple.NewVector(1, 2, 3), 0)
+	g.Expect(box.Distance(tuple.NewPoint(2, 0, 0))).To(BeNumerically("~", 1, 1e-9))
+	g.Expect(box.Distance(origin)).To(BeNumerically("~", -1, 1e-9))
+	g.Expect(box.Distance(tuple.NewPoint(2, 3, 0))).To(BeNumerically("~", math.Sqrt(2), 1e-9))
+	rounded := NewSDFBox(origin, tuple.NewVector(1, 1, 1), 0.5)
+	g.Expect(rounded.Distance(tuple.NewPoint(2, 0, 0))).To(BeNumerically("~", 1, 1e-9))
+	g.Expect(rounded.Distance(tuple.NewPoint(1, 1, 0))).To(BeNumerically("~", math.Sqrt(0.5)-0.5, 1e-9))
+
+	capsule := NewSDFCapsule(tuple.NewPoint(0, -1, 0), tuple.NewPoint(0, 1, 0), 0.5)
+	g.Expect(capsule.Distance(tuple.NewPoint(1, 0.5, 0))).To(BeNumerically("~", 0.5, 1e-9))
+	g.Expect(capsule.Distance(tuple.NewPoint(0, 3, 0))).To(BeNumerically("~", 1.5, 1e-9))
+
+	torus := NewSDFTorus(1, 0.25)
+	g.Expect(torus.Distance(tuple.NewPoint(2, 0, 0))).To(BeNumerically("~", 0.75, 1e-9))
+
+	a := NewSDFSphere(tuple.NewPoint(-1, 0, 0), 1)
+	b := NewSDFSphere(tuple.NewPoint(1, 0, 0), 1)
+	g.Expect(NewSDFUnion(a, b).Distance(origin)).To(BeNumerically("~", 0, 1e-9))
+	g.Expect(NewSDFIntersection(a, b).Distance(origin)).To(BeNumerically("~", 0, 1e-9))
+	g.Expect(NewSDFSubtraction(a, b).Distance(tuple.NewPoint(-1, 0, 0))).To(BeNumerically("~", -1, 1e-9))
+	g.Expect(NewSDFSubtraction(a, b).Distance(tuple.NewPoint(0.5, 0, 0))).To(BeNumerically("~", 0.5, 1e-9))
+	// Blending fills in the gap between the spheres
+	g.Expect(NewSDFSmoothUnion(0.5, a, b).Distance(origin)).To(BeNumerically("<", 0))
+	g.Expect(NewSDFSmoothUnion(0.5, a, b).Distance(tuple.NewPoint(-3, 0, 0))).To(BeNumerically("~", 1, 1e-9))
+	// and rounds the edge of the cut
+	edge := tuple.NewPoint(-0.1, 0, 0)
+	g.Expect(NewSDFSmoothSubtraction(0.5, a, b).Distance(edge)).To(BeNumerically(">", NewSDFSubtraction(a, b).Distance(edge)))
+
+	repeated := NewSDFRepeat(tuple.NewVector(4, 0, 0), NewSDFSphere(origin, 1))
+	g.Expect(repeated.Distance(tuple.NewPoint(8, 0, 0))).To(BeNumerically("~", -1, 1e-9))
+	g.Expect(repeated.Distance(tuple.NewPoint(-6, 0, 0))).To(BeNumerically("~", 1, 1e-9))
+	g.Expect(repeated.Distance(tuple.NewPoint(0, 3, 0))).To(BeNumerically("~", 2, 1e-9))
+	g.Expect(repeated.Bounds().IsBounded()).To(BeFalse())
+}
+
+func TestSDFBounds(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	a := NewSDFSphere(tuple.NewPoint(-1, 0, 0), 1)
+	b := NewSDFSphere(tuple.NewPoint(1, 0, 0), 1)
+
+	u := NewSDFSmoothUnion(0.4, a, b).Bounds()
+	g.Expect(u.Min.Equals(tuple.NewPoint(-2.1, -1.1, -1.1))).To(BeTrue())
+	g.Expect(u.Max.Equals(tuple.NewPoint(2.1, 1.1, 1.1))).To(BeTrue())
+
+	i := NewSDFIntersection(a, b).Bounds()
+	g.Expect(i.Min.Equals(tuple.NewPoint(0, -1, -1))).To(BeTrue())
+	g.Expect(i.Max.Equals(tuple.NewPoint(0, 1, 1))).To(BeTrue())
+
+	c := NewSDFCapsule(tuple.NewPoint(0, -1, 0), tuple.NewPoint(0, 1, 0), 0.5).Bounds()
+	g.Expect(c.Min.Equals(tuple.NewPoint(-0.5, -1.5, -0.5))).To(BeTrue())
+	g.Expect(c.Max.Equals(tuple.NewPoint(0.5, 1.5, 0.5))).To(BeTrue())
+}
+
+func TestImplicitIntersections(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// A ray marched sphere agrees with the analytic one
+	s := NewImplicit(NewSDFSphere(tuple.NewPoint(0, 0, 0), 1))
+	tests := []struct {
+		origin tuple.Tuple
+		ts     []float64
+	}{
+		{tuple.NewPoint(0, 0, -5), []float64{4, 6}},
+		{tuple.NewPoint(0, 0.5, -5), []float64{5 - math.Sqrt(0.75), 5 + math.Sqrt(0.75)}},
+		{tuple.NewPoint(0, 2, -5), []float64{}},
+		{tuple.NewPoint(0, 0, 0), []float64{-1, 1}},
+		{tuple.NewPoint(0, 0, 5), []float64{-6, -4}},
+	}
+	for _, curr := range tests {
+		r, err := NewRay(curr.origin, tuple.NewVector(0, 0, 1))
+		g.Expect(err).To(BeNil())
+		xs := s.LocalIntersect(r)
+		g.Expect(xs).To(HaveLen(len(curr.ts)), "ray from %v", curr.origin)
+		for i := range curr.ts {
+			g.Expect(xs[i].T).To(BeNumerically("~", curr.ts[i], 1e-4))
+		}
+	}
+
+	// A transformed shape, hit by a ray that isn't normalized in object space
+	s = NewImplicit(NewSDFSphere(tuple.NewPoint(0, 0, 0), 1)).WithTransform(matrix.NewScale(2, 2, 2))
+	r, err := NewRay(tuple.NewPoint(0, 0, -5), tuple.NewVector(0, 0, 1))
+	g.Expect(err).To(BeNil())
+	xs := r.Intersect(s)
+	g.Expect(xs).To(HaveLen(2))
+	g.Expect(xs[0].T).To(BeNumerically("~", 3, 1e-4))
+	g.Expect(xs[1].T).To(BeNumerically("~", 7, 1e-4))
+
+	// Repeated spheres along the X axis
+	s = NewImplicit(NewSDFRepeat(tuple.NewVector(4, 0, 0), NewSDFSphere(tuple.NewPoint(0, 0, 0), 1)))
+	r, err = NewRay(tuple.NewPoint(-2, 0, 0), tuple.NewVector(1, 0, 0))
+	g.Expect(err).To(BeNil())
+	xs = s.LocalIntersect(r)
+	g.Expect(len(xs)).To(BeNumerically(">", 4))
+	g.Expect(xs[0].T).To(BeNumerically("~", 1, 1e-4))
+	g.Expect(xs[1].T).To(BeNumerically("~", 3, 1e-4))
+	g.Expect(xs[2].T).To(BeNumerically("~", 5, 1e-4))
+}
+
+func TestImplicitNormal(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	s := NewImplicit(NewSDFSphere(tuple.NewPoint(0, 0, 0), 1))
+	p := tuple.NewPoint(math.Sqrt(3)/3, math.Sqrt(3)/3, math.Sqrt(3)/3)
+	n, err := s.NormalAt(p, Intersection{})
+	g.Expect(err).To(BeNil())
+	g.Expect(n.Equals(tuple.NewVector(math.Sqrt(3)/3, math.Sqrt(3)/3, math.Sqrt(3)/3))).To(BeTrue())
+
+	s = NewImplicit(NewSDFBox(tuple.NewPoint(0, 0, 0), tuple.NewVector(1, 1, 1), 0))
+	n, err = s.NormalAt(tuple.NewPoint(1, 0.3, -0.2), Intersection{})
+	g.Expect(err).To(BeNil())
+	g.Expect(n.Equals(tuple.NewVector(1, 0, 0))).To(BeTrue())
+}
+
+func TestImplicitInCSG(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	s1 := NewImplicit(NewSDFSphere(tuple.NewPoint(0, 0, 0), 1))
+	s2 := NewSphere().WithTransform(matrix.NewTranslation(0, 0, 0.5))
+	c := NewCSG(&s1, &s2, DifferenceOp)
+	r, err := NewRay(tuple.NewPoint(0, 0, -5), tuple.NewVector(0, 0, 1))
+	g.Expect(err).To(BeNil())
+	xs := r.Intersect(c)
+	g.Expect(xs).To(HaveLen(2))
+	g.Expect(xs[0].T).To(BeNumerically("~", 4, 1e-4))
+	g.Expect(xs[0].Shape.ID()).To(Equal(s1.ID()))
+	g.Expect(xs[1].T).To(BeNumerically("~", 4.5, 1e-4))
+	g.Expect(xs[1].Shape.ID()).To(Equal(s2.ID()))
+}
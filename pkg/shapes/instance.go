@@ -0,0 +1,101 @@
+package shapes
+
+import (
+	"github.com/liorokman/raytrace/pkg/material"
+	"github.com/liorokman/raytrace/pkg/matrix"
+	"github.com/liorokman/raytrace/pkg/tuple"
+	"github.com/liorokman/raytrace/pkg/types"
+)
+
+// instance places a shape that's defined once in many places. Every instance has its own
+// transform and parent, while the prototype, with all of its geometry and its bounding
+// volume hierarchy, is shared by all of them.
+type instance struct {
+	prototype Shape
+}
+
+// NewInstance creates an instance of the prototype. The prototype must not be connected to
+// any group, and it must not change once instances of it were created.
+func NewInstance(prototype Shape) Shape {
+	return newShape(material.Default(), matrix.NewIdentity(), instance{prototype: prototype})
+}
+
+func (i instance) shapeIdPrefix() string {
+	return "I"
+}
+
+func (i instance) normalAt(point tuple.Tuple, hit Intersection) tuple.Tuple {
+	panic("instance NormalAt should never be called")
+}
+
+func (i instance) bounds() BoundingBox {
+	return i.prototype.Bounds()
+}
+
+// uvAt is never used, since hits are always reported on the prototype's shapes
+func (i instance) uvAt(point tuple.Tuple) (float64, float64) {
+	return material.SphericalMap(point)
+}
+
+func (i instance) localIntersect(ray Ray, outer Shape) []Intersection {
+	xs := ray.Intersect(i.prototype)
+	for j := range xs {
+		xs[j].Shape = instanceHit{Shape: xs[j].Shape, instance: outer}
+	}
+	return xs
+}
+
+// instanceHit is the shape reported by hits on an instance. The shape that was hit only
+// knows the way up to the prototype, and the instance takes over from there.
+type instanceHit struct {
+	Shape
+	instance Shape
+}
+
+// ID tells apart the hits on different instances of the same prototype
+func (h instanceHit) ID() string {
+	return h.instance.ID() + "/" + h.Shape.ID()
+}
+
+func (h instanceHit) WorldToObject(point tuple.Tuple) (tuple.Tuple, error) {
+	return h.WorldToObjectAt(point, 0)
+}
+
+func (h instanceHit) WorldToObjectAt(point tuple.Tuple, time float64) (tuple.Tuple, error) {
+	p, err := h.instance.WorldToObjectAt(point, time)
+	if err != nil {
+		return p, err
+	}
+	return h.Shape.WorldToObjectAt(p, time)
+}
+
+func (h instanceHit) NormalToWorld(vector tuple.Tuple) (tuple.Tuple, error) {
+	return h.NormalToWorldAt(vector, 0)
+}
+
+func (h instanceHit) NormalToWorldAt(vector tuple.Tuple, time float64) (tuple.Tuple, error) {
+	n, err := h.Shape.NormalToWorldAt(vector, time)
+	if err != nil {
+		return n, err
+	}
+	return h.instance.NormalToWorldAt(n, time)
+}
+
+func (h instanceHit) NormalAt(point tuple.Tuple, hit Intersection) (tuple.Tuple, error) {
+	p, err := h.instance.WorldToObjectAt(point, hit.Time)
+	if err != nil {
+		return p, err
+	}
+	n, err := h.Shape.NormalAt(p, hit)
+	if err != nil {
+		return n, err
+	}
+	return h.instance.NormalToWorldAt(n, hit.Time)
+}
+
+func (h instanceHit) VertexColorAt() (tuple.Color, bool) {
+	if colorer, ok := h.Shape.(types.VertexColorer); ok {
+		return colorer.VertexColorAt()
+	}
+	return tuple.Color{}, false
+}
@@ -0,0 +1,64 @@
+package shapes
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/liorokman/raytrace/pkg/matrix"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+func TestInstances(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	prototype := NewGroup().WithTransform(matrix.NewScale(2, 2, 2))
+	_, err := Connect(prototype, NewSphere())
+	g.Expect(err).To(BeNil())
+
+	parent := NewGroup()
+	i1, err := Connect(parent, NewInstance(prototype).WithTransform(matrix.NewTranslation(10, 0, 0)))
+	g.Expect(err).To(BeNil())
+	i2, err := Connect(parent, NewInstance(prototype).WithTransform(matrix.NewTranslation(-10, 0, 0)))
+	g.Expect(err).To(BeNil())
+	g.Expect(i1.Bounds().Min.Equals(tuple.NewPoint(8, -2, -2))).To(BeTrue())
+
+	for _, x := range []float64{10, -10} {
+		r, err := NewRay(tuple.NewPoint(x, 0, -10), tuple.NewVector(0, 0, 1))
+		g.Expect(err).To(BeNil())
+		xs := r.Intersect(parent)
+		g.Expect(xs).To(HaveLen(2))
+		g.Expect(xs[0].T).To(BeNumerically("~", 8))
+
+		p, err := xs[0].Shape.WorldToObject(tuple.NewPoint(x, 0, -2))
+		g.Expect(err).To(BeNil())
+		g.Expect(p.Equals(tuple.NewPoint(0, 0, -1))).To(BeTrue())
+		n, err := xs[0].Shape.NormalAt(tuple.NewPoint(x, 0, -2), xs[0])
+		g.Expect(err).To(BeNil())
+		g.Expect(n.Equals(tuple.NewVector(0, 0, -1))).To(BeTrue())
+	}
+
+	r, err := NewRay(tuple.NewPoint(10, 0, -10), tuple.NewVector(0, 0, 1))
+	g.Expect(err).To(BeNil())
+	hit1 := r.Intersect(i1)[0]
+	r, err = NewRay(tuple.NewPoint(-10, 0, -10), tuple.NewVector(0, 0, 1))
+	g.Expect(err).To(BeNil())
+	hit2 := r.Intersect(i2)[0]
+	g.Expect(hit1.Shape.ID()).ToNot(Equal(hit2.Shape.ID()))
+}
+
+func TestInstancesInCSG(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	prototype := NewSphere()
+	left := NewInstance(prototype)
+	right := NewInstance(prototype).WithTransform(matrix.NewTranslation(0.5, 0, 0))
+	c := NewCSG(&left, &right, UnionOp)
+
+	r, err := NewRay(tuple.NewPoint(-5, 0, 0), tuple.NewVector(1, 0, 0))
+	g.Expect(err).To(BeNil())
+	xs := r.Intersect(c)
+	g.Expect(xs).To(HaveLen(2))
+	g.Expect(xs[0].T).To(BeNumerically("~", 4))
+	g.Expect(xs[1].T).To(BeNumerically("~", 6.5))
+}
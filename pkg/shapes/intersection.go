@@ -10,7 +10,12 @@ import (
 type Intersection struct {
 	T     float64
 	Shape Shape
-	U, V  float64
+	// U and V are the barycentric coordinates of the hit on a triangle
+	U, V float64
+	// Face is the index of the triangle that was hit in a mesh
+	Face int
+	// Time is the time of the ray that made the hit, for finding where a moving shape was
+	Time float64
 }
 
 type Computation struct {
@@ -98,6 +103,10 @@ func (i Intersection) PrepareComputation(r Ray, xs ...Intersection) (Computation
 			break
 		}
 	}
+	if i.Time != 0 {
+		// Patterns find the point on the shape where it was when the ray hit it
+		retval.Shape = timedShape{Shape: i.Shape, time: i.Time}
+	}
 	return retval, nil
 }
 
@@ -0,0 +1,275 @@
+package shapes
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/liorokman/raytrace/pkg/material"
+	"github.com/liorokman/raytrace/pkg/matrix"
+	"github.com/liorokman/raytrace/pkg/tuple"
+	"github.com/liorokman/raytrace/pkg/utils"
+)
+
+// MeshFace is a triangle in a mesh. Every vertex of the triangle is given by its index in
+// the mesh's vertices, and optionally by the index of its normal and of its texture
+// coordinates. A face whose Normals or UVs has a negative index doesn't use them.
+type MeshFace struct {
+	Vertices [3]int
+	Normals  [3]int
+	UVs      [3]int
+}
+
+// NewMeshFace creates a face with no normals or texture coordinates
+func NewMeshFace(v1, v2, v3 int) MeshFace {
+	return MeshFace{
+		Vertices: [3]int{v1, v2, v3},
+		Normals:  [3]int{-1, -1, -1},
+		UVs:      [3]int{-1, -1, -1},
+	}
+}
+
+func (f MeshFace) smooth() bool {
+	return f.Normals[0] >= 0 && f.Normals[1] >= 0 && f.Normals[2] >= 0
+}
+
+func (f MeshFace) textured() bool {
+	return f.UVs[0] >= 0 && f.UVs[1] >= 0 && f.UVs[2] >= 0
+}
+
+// meshFace keeps what's needed to intersect a face, so it's only computed once
+type meshFace struct {
+	MeshFace
+	p1, e1, e2 tuple.Tuple
+	normal     tuple.Tuple
+}
+
+// Mesh is a set of triangles that share their vertices, normals and texture coordinates.
+// Unlike a group of triangles, the faces aren't shapes of their own. Hits report the face
+// that was hit in Intersection.Face.
+type Mesh struct {
+	*meshData
+}
+
+// meshData is shared by every copy of a mesh, and by the hits on it
+type meshData struct {
+	vertices []tuple.Tuple
+	// colors is either empty or holds a color for every vertex
+	colors  []tuple.Color
+	normals []tuple.Tuple
+	uvs     []TextureCoord
+	faces   []meshFace
+	box     BoundingBox
+	accel   *meshAccel
+}
+
+// meshAccel holds the bounding volume hierarchy of the faces of a mesh. Like the one of
+// a group, it's built the first time the mesh is intersected.
+type meshAccel struct {
+	once sync.Once
+	opts BVHOptions
+	root *bvhNode
+}
+
+// NewMesh creates a mesh. Every index in the faces must be valid for the slice it refers to.
+func NewMesh(vertices, normals []tuple.Tuple, uvs []TextureCoord, faces []MeshFace) (Shape, error) {
+	return NewColoredMesh(vertices, nil, normals, uvs, faces)
+}
+
+// NewColoredMesh creates a mesh with a color for every vertex. The colors are used by
+// materials with a vertex color pattern.
+func NewColoredMesh(vertices []tuple.Tuple, colors []tuple.Color, normals []tuple.Tuple, uvs []TextureCoord, faces []MeshFace) (Shape, error) {
+	if len(colors) > 0 && len(colors) != len(vertices) {
+		return nil, fmt.Errorf("The mesh has %d vertices but %d vertex colors", len(vertices), len(colors))
+	}
+	m := Mesh{&meshData{
+		vertices: vertices,
+		colors:   colors,
+		normals:  normals,
+		uvs:      uvs,
+		faces:    make([]meshFace, len(faces)),
+		box:      EmptyBoundingBox(),
+		accel:    &meshAccel{opts: DefaultBVHOptions()},
+	}}
+	for i, f := range faces {
+		for j := 0; j < 3; j++ {
+			if f.Vertices[j] < 0 || f.Vertices[j] >= len(vertices) {
+				return nil, fmt.Errorf("Face %d refers to vertex %d, but the mesh has %d vertices", i, f.Vertices[j], len(vertices))
+			}
+			if f.Normals[j] >= len(normals) {
+				return nil, fmt.Errorf("Face %d refers to normal %d, but the mesh has %d normals", i, f.Normals[j], len(normals))
+			}
+			if f.UVs[j] >= len(uvs) {
+				return nil, fmt.Errorf("Face %d refers to texture coordinate %d, but the mesh has %d texture coordinates", i, f.UVs[j], len(uvs))
+			}
+		}
+		p1, p2, p3 := vertices[f.Vertices[0]], vertices[f.Vertices[1]], vertices[f.Vertices[2]]
+		face := meshFace{
+			MeshFace: f,
+			p1:       p1,
+			e1:       p2.Subtract(p1),
+			e2:       p3.Subtract(p1),
+		}
+		face.normal = face.e2.Cross(face.e1).Normalize()
+		m.faces[i] = face
+		m.box = m.box.Add(p1, p2, p3)
+	}
+	return newShape(material.Default(), matrix.NewIdentity(), m), nil
+}
+
+// SetBVHOptions changes how the mesh's bounding volume hierarchy is built. The
+// hierarchy is rebuilt the next time the mesh is intersected.
+func (m Mesh) SetBVHOptions(opts BVHOptions) {
+	*m.accel = meshAccel{opts: opts}
+}
+
+func (m Mesh) hierarchy() *bvhNode {
+	m.accel.once.Do(func() {
+		if len(m.faces) == 0 {
+			return
+		}
+		entries := make([]bvhEntry, len(m.faces))
+		for i, f := range m.faces {
+			box := EmptyBoundingBox().Add(f.p1, f.p1.Add(f.e1), f.p1.Add(f.e2))
+			entries[i] = bvhEntry{index: i, box: box, centroid: box.Center()}
+		}
+		if m.accel.opts.MaxLeafSize <= 0 {
+			m.accel.opts.MaxLeafSize = defaultMaxLeafSize
+		}
+		if m.accel.opts.Disabled {
+			m.accel.root = (&bvhNode{box: m.box}).makeLeaf(entries)
+		} else {
+			m.accel.root = buildBVHNode(entries, m.accel.opts)
+		}
+	})
+	return m.accel.root
+}
+
+func (m Mesh) String() string {
+	return fmt.Sprintf("Mesh: %d vertices, %d faces", len(m.vertices), len(m.faces))
+}
+
+func (m Mesh) shapeIdPrefix() string {
+	return "M"
+}
+
+// Size returns the number of faces in the mesh
+func (m Mesh) Size() int {
+	return len(m.faces)
+}
+
+// Vertices returns the vertices the mesh was created with
+func (m Mesh) Vertices() []tuple.Tuple {
+	return m.vertices
+}
+
+// Colors returns the colors of the vertices, or nothing if the mesh has no vertex colors
+func (m Mesh) Colors() []tuple.Color {
+	return m.colors
+}
+
+// Normals returns the normals the mesh was created with
+func (m Mesh) Normals() []tuple.Tuple {
+	return m.normals
+}
+
+// UVs returns the texture coordinates the mesh was created with
+func (m Mesh) UVs() []TextureCoord {
+	return m.uvs
+}
+
+// Faces returns the faces the mesh was created with
+func (m Mesh) Faces() []MeshFace {
+	retval := make([]MeshFace, len(m.faces))
+	for i := range m.faces {
+		retval[i] = m.faces[i].MeshFace
+	}
+	return retval
+}
+
+func (m Mesh) normalAt(point tuple.Tuple, hit Intersection) tuple.Tuple {
+	f := m.faces[hit.Face]
+	if !f.smooth() {
+		return f.normal
+	}
+	n1, n2, n3 := m.normals[f.Normals[0]], m.normals[f.Normals[1]], m.normals[f.Normals[2]]
+	return n2.Mult(hit.U).Add(n3.Mult(hit.V)).Add(n1.Mult(1.0 - hit.U - hit.V))
+}
+
+func (m Mesh) bounds() BoundingBox {
+	return m.box
+}
+
+// uvAt is never used, since hits on a mesh report a meshHit, which knows which face was hit
+func (m Mesh) uvAt(point tuple.Tuple) (float64, float64) {
+	return material.SphericalMap(point)
+}
+
+// meshHit is the shape reported by hits on a mesh. It's the mesh itself, except that the
+// texture coordinates and vertex colors are interpolated over the face that was hit.
+type meshHit struct {
+	Shape
+	mesh *meshData
+	face int
+	u, v float64
+}
+
+func (h meshHit) VertexColorAt() (tuple.Color, bool) {
+	if len(h.mesh.colors) == 0 {
+		return tuple.Color{}, false
+	}
+	f := h.mesh.faces[h.face]
+	c1, c2, c3 := h.mesh.colors[f.Vertices[0]], h.mesh.colors[f.Vertices[1]], h.mesh.colors[f.Vertices[2]]
+	return c2.Mult(h.u).Add(c3.Mult(h.v)).Add(c1.Mult(1.0 - h.u - h.v)), true
+}
+
+// UVAt interpolates the texture coordinates of the face with the barycentric coordinates
+// of the hit, so the point isn't needed
+func (h meshHit) UVAt(point tuple.Tuple) (float64, float64) {
+	f := h.mesh.faces[h.face]
+	uv := defaultTextureCoords
+	if f.textured() {
+		uv = [3]TextureCoord{h.mesh.uvs[f.UVs[0]], h.mesh.uvs[f.UVs[1]], h.mesh.uvs[f.UVs[2]]}
+	}
+	w := 1.0 - h.u - h.v
+	return w*uv[0].U + h.u*uv[1].U + h.v*uv[2].U, w*uv[0].V + h.u*uv[1].V + h.v*uv[2].V
+}
+
+func (m Mesh) localIntersect(ray Ray, outer Shape) []Intersection {
+	root := m.hierarchy()
+	if root == nil {
+		return []Intersection{}
+	}
+	retval := root.intersect(ray, []Intersection{}, func(i int, retval []Intersection) []Intersection {
+		if t, u, v, ok := m.faces[i].intersect(ray); ok {
+			retval = append(retval, Intersection{T: t, Shape: meshHit{Shape: outer, mesh: m.meshData, face: i, u: u, v: v}, U: u, V: v, Face: i})
+		}
+		return retval
+	})
+	sort.Sort(ByTime(retval))
+	return retval
+}
+
+// intersect is the same Möller–Trumbore test that triangles use
+func (f meshFace) intersect(ray Ray) (float64, float64, float64, bool) {
+	dirCrossE2 := ray.Direction.Cross(f.e2)
+	det := f.e1.Dot(dirCrossE2)
+	if math.Abs(det) < utils.EPSILON {
+		return 0, 0, 0, false
+	}
+
+	inv := 1.0 / det
+	p1ToOrigin := ray.Origin.Subtract(f.p1)
+	u := inv * p1ToOrigin.Dot(dirCrossE2)
+	if u < 0 || u > 1 {
+		return 0, 0, 0, false
+	}
+
+	originCrossE1 := p1ToOrigin.Cross(f.e1)
+	v := inv * ray.Direction.Dot(originCrossE1)
+	if v < 0 || (u+v) > 1 {
+		return 0, 0, 0, false
+	}
+	return inv * f.e2.Dot(originCrossE1), u, v, true
+}
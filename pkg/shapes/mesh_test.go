@@ -0,0 +1,154 @@
+package shapes
+
+import (
+	"math/rand"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/liorokman/raytrace/pkg/matrix"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+// testMesh is a unit square in the XY plane, split into two triangles
+func testMesh(g *WithT) Shape {
+	vertices := []tuple.Tuple{
+		tuple.NewPoint(0, 0, 0),
+		tuple.NewPoint(1, 0, 0),
+		tuple.NewPoint(1, 1, 0),
+		tuple.NewPoint(0, 1, 0),
+	}
+	normals := []tuple.Tuple{
+		tuple.NewVector(0, 0, -1),
+		tuple.NewVector(1, 0, 0),
+		tuple.NewVector(0, 1, 0),
+	}
+	uvs := []TextureCoord{{0, 0}, {1, 0}, {1, 1}, {0, 1}}
+	lower := NewMeshFace(0, 1, 2)
+	lower.UVs = [3]int{0, 1, 2}
+	upper := NewMeshFace(0, 2, 3)
+	upper.Normals = [3]int{0, 1, 2}
+	m, err := NewMesh(vertices, normals, uvs, []MeshFace{lower, upper})
+	g.Expect(err).To(BeNil())
+	return m
+}
+
+func TestMeshIntersections(t *testing.T) {
+	g := NewGomegaWithT(t)
+	m := testMesh(g)
+
+	g.Expect(m.InnerShape().(Mesh).Size()).To(Equal(2))
+	g.Expect(m.LocalBounds().Min.Equals(tuple.NewPoint(0, 0, 0))).To(BeTrue())
+	g.Expect(m.LocalBounds().Max.Equals(tuple.NewPoint(1, 1, 0))).To(BeTrue())
+
+	r, err := NewRay(tuple.NewPoint(0.75, 0.25, -5), tuple.NewVector(0, 0, 1))
+	g.Expect(err).To(BeNil())
+	xs := m.LocalIntersect(r)
+	g.Expect(xs).To(HaveLen(1))
+	g.Expect(xs[0].T).To(BeNumerically("~", 5, 1e-9))
+	g.Expect(xs[0].Face).To(Equal(0))
+	g.Expect(xs[0].Shape.ID()).To(Equal(m.ID()))
+	// Barycentric coordinates are relative to the face's second and third vertices
+	g.Expect(xs[0].U).To(BeNumerically("~", 0.5, 1e-9))
+	g.Expect(xs[0].V).To(BeNumerically("~", 0.25, 1e-9))
+
+	r, err = NewRay(tuple.NewPoint(0.25, 0.75, -5), tuple.NewVector(0, 0, 1))
+	g.Expect(err).To(BeNil())
+	xs = m.LocalIntersect(r)
+	g.Expect(xs).To(HaveLen(1))
+	g.Expect(xs[0].Face).To(Equal(1))
+
+	r, err = NewRay(tuple.NewPoint(1.5, 0.5, -5), tuple.NewVector(0, 0, 1))
+	g.Expect(err).To(BeNil())
+	g.Expect(m.LocalIntersect(r)).To(BeEmpty())
+}
+
+func TestMeshNormalsAndUV(t *testing.T) {
+	g := NewGomegaWithT(t)
+	m := testMesh(g).WithTransform(matrix.NewTranslation(0, 0, 2))
+
+	// The flat face
+	r, err := NewRay(tuple.NewPoint(0.75, 0.25, -5), tuple.NewVector(0, 0, 1))
+	g.Expect(err).To(BeNil())
+	xs := r.Intersect(m)
+	g.Expect(xs).To(HaveLen(1))
+	comps, err := xs[0].PrepareComputation(r, xs...)
+	g.Expect(err).To(BeNil())
+	g.Expect(comps.NormalV.Equals(tuple.NewVector(0, 0, -1))).To(BeTrue())
+	u, v := xs[0].Shape.UVAt(tuple.NewPoint(0.75, 0.25, 0))
+	g.Expect(u).To(BeNumerically("~", 0.75, 1e-9))
+	g.Expect(v).To(BeNumerically("~", 0.25, 1e-9))
+
+	// The smooth face interpolates its vertex normals, and stretches the texture from its
+	// first vertex since it has no texture coordinates
+	r, err = NewRay(tuple.NewPoint(0.25, 0.75, -5), tuple.NewVector(0, 0, 1))
+	g.Expect(err).To(BeNil())
+	xs = r.Intersect(m)
+	g.Expect(xs).To(HaveLen(1))
+	n, err := xs[0].Shape.NormalAt(tuple.NewPoint(0.25, 0.75, 2), xs[0])
+	g.Expect(err).To(BeNil())
+	expected := tuple.NewVector(0.25, 0.5, -0.25).Normalize()
+	g.Expect(n.Equals(expected)).To(BeTrue(), "normal %v", n)
+	u, v = xs[0].Shape.UVAt(tuple.NewPoint(0.25, 0.75, 0))
+	g.Expect(u).To(BeNumerically("~", 0.25, 1e-9))
+	g.Expect(v).To(BeNumerically("~", 0.5, 1e-9))
+	// The texture coordinates come from where the ray hit the face, whatever the point
+	u, v = xs[0].Shape.UVAt(tuple.NewPoint(0, 0, 0))
+	g.Expect(u).To(BeNumerically("~", 0.25, 1e-9))
+	g.Expect(v).To(BeNumerically("~", 0.5, 1e-9))
+}
+
+func TestMeshValidation(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	vertices := []tuple.Tuple{tuple.NewPoint(0, 0, 0), tuple.NewPoint(1, 0, 0), tuple.NewPoint(0, 1, 0)}
+	_, err := NewMesh(vertices, nil, nil, []MeshFace{NewMeshFace(0, 1, 3)})
+	g.Expect(err).ToNot(BeNil())
+	face := NewMeshFace(0, 1, 2)
+	face.Normals = [3]int{0, 0, 0}
+	_, err = NewMesh(vertices, nil, nil, []MeshFace{face})
+	g.Expect(err).ToNot(BeNil())
+	face = NewMeshFace(0, 1, 2)
+	face.UVs = [3]int{0, 1, 2}
+	_, err = NewMesh(vertices, nil, []TextureCoord{{0, 0}}, []MeshFace{face})
+	g.Expect(err).ToNot(BeNil())
+
+	m, err := NewMesh(vertices, nil, nil, nil)
+	g.Expect(err).To(BeNil())
+	r, _ := NewRay(tuple.NewPoint(0, 0, -5), tuple.NewVector(0, 0, 1))
+	g.Expect(m.LocalIntersect(r)).To(BeEmpty())
+}
+
+func TestMeshBVHMatchesLinear(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	rnd := rand.New(rand.NewSource(7))
+	vertices := []tuple.Tuple{}
+	faces := []MeshFace{}
+	for i := 0; i < 300; i++ {
+		base := tuple.NewPoint(rnd.Float64()*10-5, rnd.Float64()*10-5, rnd.Float64()*10-5)
+		for j := 0; j < 3; j++ {
+			vertices = append(vertices, base.Add(tuple.NewVector(rnd.Float64(), rnd.Float64(), rnd.Float64())))
+		}
+		faces = append(faces, NewMeshFace(3*i, 3*i+1, 3*i+2))
+	}
+	accelerated, err := NewMesh(vertices, nil, nil, faces)
+	g.Expect(err).To(BeNil())
+	linear, err := NewMesh(vertices, nil, nil, faces)
+	g.Expect(err).To(BeNil())
+	linear.InnerShape().(Mesh).SetBVHOptions(BVHOptions{Disabled: true})
+
+	hits := 0
+	for i := 0; i < 200; i++ {
+		r, _ := NewRay(tuple.NewPoint(rnd.Float64()*10-5, rnd.Float64()*10-5, -10), tuple.NewVector(rnd.Float64()-0.5, rnd.Float64()-0.5, 1))
+		expected := linear.LocalIntersect(r)
+		actual := accelerated.LocalIntersect(r)
+		g.Expect(actual).To(HaveLen(len(expected)))
+		for j := range expected {
+			g.Expect(actual[j].T).To(Equal(expected[j].T))
+			g.Expect(actual[j].Face).To(Equal(expected[j].Face))
+		}
+		hits += len(expected)
+	}
+	g.Expect(hits).To(BeNumerically(">", 0))
+}
@@ -0,0 +1,75 @@
+package shapes
+
+import (
+	"math"
+
+	"github.com/liorokman/raytrace/pkg/matrix"
+	"github.com/liorokman/raytrace/pkg/tuple"
+	"github.com/liorokman/raytrace/pkg/types"
+)
+
+// WithMotion makes the shape move while the shutter is open. The transforms are spread
+// evenly over the time the shutter is open, from the first one when it opens to the last
+// one when it closes, and every ray sees the shape interpolated between the two transforms
+// around its time. The first transform is also the shape's transform for everything that
+// doesn't know about time.
+func (s shapeCore) WithMotion(transforms ...matrix.Matrix) Shape {
+	if len(transforms) == 0 {
+		return s.WithTransform(s.transform)
+	}
+	retval := newShape(s.material, transforms[0], s.shape)
+	if len(transforms) > 1 {
+		retval.motion = make([]matrix.Matrix4, len(transforms))
+		for i := range transforms {
+			retval.motion[i] = transforms[i].ToMatrix4()
+		}
+	}
+	return retval.adoptChildren()
+}
+
+// GetMotion returns the transforms set with WithMotion, or nil if the shape doesn't move
+func (s shapeCore) GetMotion() []matrix.Matrix {
+	if s.motion == nil {
+		return nil
+	}
+	retval := make([]matrix.Matrix, len(s.motion))
+	for i := range s.motion {
+		retval[i] = s.motion[i].ToMatrix()
+	}
+	return retval
+}
+
+// GetInverseTransformAt returns the inverse of the shape's transform at the given time,
+// which is a fraction of the time the shutter is open
+func (s shapeCore) GetInverseTransformAt(time float64) (matrix.Matrix4, error) {
+	if s.motion == nil {
+		return s.inverse, s.inverseErr
+	}
+	last := len(s.motion) - 1
+	at := math.Max(0, math.Min(1, time)) * float64(last)
+	key := min(int(at), last-1)
+	return s.motion[key].Lerp(s.motion[key+1], at-float64(key)).Inverse()
+}
+
+// timedShape is the shape of a computation whose ray was cast while the shutter was open.
+// Patterns only know about points, so it converts them with the transforms of the time
+// that the shape was hit.
+type timedShape struct {
+	Shape
+	time float64
+}
+
+func (t timedShape) WorldToObject(point tuple.Tuple) (tuple.Tuple, error) {
+	return t.Shape.WorldToObjectAt(point, t.time)
+}
+
+func (t timedShape) NormalToWorld(vector tuple.Tuple) (tuple.Tuple, error) {
+	return t.Shape.NormalToWorldAt(vector, t.time)
+}
+
+func (t timedShape) VertexColorAt() (tuple.Color, bool) {
+	if colorer, ok := t.Shape.(types.VertexColorer); ok {
+		return colorer.VertexColorAt()
+	}
+	return tuple.Color{}, false
+}
@@ -0,0 +1,65 @@
+package shapes
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/liorokman/raytrace/pkg/matrix"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+func TestMotion(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	s := NewSphere().WithMotion(matrix.NewTranslation(0, 0, 0), matrix.NewTranslation(4, 0, 0))
+	g.Expect(s.GetTransform().Equals(matrix.NewIdentity())).To(BeTrue())
+	g.Expect(s.GetMotion()).To(HaveLen(2))
+	g.Expect(s.Bounds().Min.Equals(tuple.NewPoint(-1, -1, -1))).To(BeTrue())
+	g.Expect(s.Bounds().Max.Equals(tuple.NewPoint(5, 1, 1))).To(BeTrue())
+
+	// The ray sees the sphere where it is at the ray's time
+	r, err := NewRay(tuple.NewPoint(2, 0, -5), tuple.NewVector(0, 0, 1))
+	g.Expect(err).To(BeNil())
+	g.Expect(r.Intersect(s)).To(BeEmpty())
+	xs := r.WithTime(0.5).Intersect(s)
+	g.Expect(xs).To(HaveLen(2))
+	g.Expect(xs[0].T).To(BeNumerically("~", 4))
+	g.Expect(xs[0].Time).To(Equal(0.5))
+	g.Expect(r.WithTime(2).Intersect(s)).To(BeEmpty())
+
+	n, err := s.NormalAt(tuple.NewPoint(2, 0, -1), xs[0])
+	g.Expect(err).To(BeNil())
+	g.Expect(n.Equals(tuple.NewVector(0, 0, -1))).To(BeTrue())
+
+	// Patterns see the point on the shape at the time it was hit
+	comps, err := xs[0].PrepareComputation(r.WithTime(0.5), xs...)
+	g.Expect(err).To(BeNil())
+	p, err := comps.Shape.WorldToObject(tuple.NewPoint(2, 0, -1))
+	g.Expect(err).To(BeNil())
+	g.Expect(p.Equals(tuple.NewPoint(0, 0, -1))).To(BeTrue())
+
+	// A moving group moves its children, and a single transform doesn't move at all
+	group := NewGroup()
+	_, err = Connect(group, NewSphere())
+	g.Expect(err).To(BeNil())
+	moving := group.WithMotion(matrix.NewIdentity(), matrix.NewTranslation(0, 4, 0), matrix.NewTranslation(4, 4, 0))
+	r, err = NewRay(tuple.NewPoint(2, 4, -5), tuple.NewVector(0, 0, 1))
+	g.Expect(err).To(BeNil())
+	g.Expect(r.WithTime(0.75).Intersect(moving)).To(HaveLen(2))
+	g.Expect(r.WithTime(0.25).Intersect(moving)).To(BeEmpty())
+	g.Expect(NewSphere().WithMotion(matrix.NewScale(2, 2, 2)).GetMotion()).To(BeNil())
+
+	child := Describe(moving).Children[0]
+	p, err = child.WorldToObjectAt(tuple.NewPoint(2, 4, 0), 0.75)
+	g.Expect(err).To(BeNil())
+	g.Expect(p.Equals(tuple.NewPoint(0, 0, 0))).To(BeTrue())
+	g.Expect(child.WorldBounds().Max.Equals(tuple.NewPoint(5, 5, 1))).To(BeTrue())
+
+	// The transform in between keys is interpolated, and then inverted
+	spinning := NewCube().WithMotion(matrix.NewRotateZ(0), matrix.NewRotateZ(math.Pi/2))
+	inv, err := spinning.GetInverseTransformAt(0.5)
+	g.Expect(err).To(BeNil())
+	g.Expect(inv.MultiplyTuple(tuple.NewPoint(0, 1, 0)).Equals(tuple.NewPoint(1, 1, 0))).To(BeTrue())
+}
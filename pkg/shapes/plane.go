@@ -24,6 +24,14 @@ func (p plane) normalAt(tuple.Tuple, Intersection) tuple.Tuple {
 	return tuple.NewVector(0, 1, 0)
 }
 
+func (p plane) bounds() BoundingBox {
+	return NewBoundingBox(tuple.NewPoint(math.Inf(-1), 0, math.Inf(-1)), tuple.NewPoint(math.Inf(1), 0, math.Inf(1)))
+}
+
+func (p plane) uvAt(point tuple.Tuple) (float64, float64) {
+	return material.PlanarMap(point)
+}
+
 func (p plane) localIntersect(ray Ray, outer Shape) []Intersection {
 	if math.Abs(ray.Direction.Y()) < utils.EPSILON {
 		return []Intersection{}
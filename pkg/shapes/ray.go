@@ -10,6 +10,9 @@ import (
 type Ray struct {
 	Origin    tuple.Tuple
 	Direction tuple.Tuple
+	// Time is when the ray is cast, as a fraction of the time the shutter is open. Moving
+	// shapes are intersected where they are at that time.
+	Time float64
 }
 
 func NewRay(origin, direction tuple.Tuple) (Ray, error) {
@@ -19,7 +22,13 @@ func NewRay(origin, direction tuple.Tuple) (Ray, error) {
 	if !direction.IsVector() {
 		return Ray{}, fmt.Errorf("Direction is not a vector")
 	}
-	return Ray{origin, direction}, nil
+	return Ray{Origin: origin, Direction: direction}, nil
+}
+
+// WithTime returns a copy of the ray that's cast at the given time
+func (r Ray) WithTime(time float64) Ray {
+	r.Time = time
+	return r
 }
 
 func (r Ray) Position(time float64) tuple.Tuple {
@@ -27,18 +36,17 @@ func (r Ray) Position(time float64) tuple.Tuple {
 }
 
 func (r Ray) Intersect(shape Shape) []Intersection {
-	invShapeTransform, err := shape.GetTransform().Inverse()
+	invShapeTransform, err := shape.GetInverseTransformAt(r.Time)
 	if err != nil {
 		panic(err)
 	}
-	tr := r.Transform(invShapeTransform)
-	ints := shape.LocalIntersect(tr)
-
-	retval := make([]Intersection, len(ints))
-	for i := range ints {
-		retval[i] = Intersection{T: ints[i].T, Shape: ints[i].Shape}
+	xs := shape.LocalIntersect(r.Transform4(invShapeTransform))
+	if r.Time != 0 {
+		for i := range xs {
+			xs[i].Time = r.Time
+		}
 	}
-	return retval
+	return xs
 }
 
 func (r Ray) Transform(m matrix.Matrix) Ray {
@@ -46,5 +54,15 @@ func (r Ray) Transform(m matrix.Matrix) Ray {
 	return Ray{
 		Origin:    m.MultiplyTuple(r.Origin),
 		Direction: m.MultiplyTuple(r.Direction),
+		Time:      r.Time,
+	}
+}
+
+// Transform4 is the same as Transform, for a fixed size matrix
+func (r Ray) Transform4(m matrix.Matrix4) Ray {
+	return Ray{
+		Origin:    m.MultiplyTuple(r.Origin),
+		Direction: m.MultiplyTuple(r.Direction),
+		Time:      r.Time,
 	}
 }
@@ -5,6 +5,7 @@ import (
 
 	. "github.com/onsi/gomega"
 
+	"github.com/liorokman/raytrace/pkg/material"
 	"github.com/liorokman/raytrace/pkg/matrix"
 	"github.com/liorokman/raytrace/pkg/tuple"
 	"github.com/liorokman/raytrace/pkg/utils"
@@ -95,3 +96,48 @@ func TestTransformRay(t *testing.T) {
 	g.Expect(tr.Origin.Equals(tuple.NewPoint(2, 6, 12))).To(BeTrue())
 	g.Expect(tr.Direction.Equals(tuple.NewVector(0, 3, 0))).To(BeTrue())
 }
+
+func TestCachedInverseTransform(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	transform := matrix.NewTranslation(1, 2, 3).Scale(2, 2, 2)
+	inverse, err := transform.Inverse()
+	g.Expect(err).To(BeNil())
+	expected := inverse.ToMatrix4()
+	s := NewSphere().WithTransform(transform)
+	inv, err := s.GetInverseTransform()
+	g.Expect(err).To(BeNil())
+	g.Expect(inv.Equals(expected)).To(BeTrue())
+
+	// Changing the material keeps the cached inverse
+	inv, err = s.WithMaterial(material.Glass()).GetInverseTransform()
+	g.Expect(err).To(BeNil())
+	g.Expect(inv.Equals(expected)).To(BeTrue())
+
+	// A transform that can't be inverted is reported when it's used
+	s = NewSphere().WithTransform(matrix.NewScale(1, 0, 1))
+	_, err = s.GetInverseTransform()
+	g.Expect(err).ToNot(BeNil())
+	_, err = s.WorldToObject(tuple.NewPoint(0, 0, 0))
+	g.Expect(err).ToNot(BeNil())
+	_, err = s.NormalToWorld(tuple.NewVector(0, 1, 0))
+	g.Expect(err).ToNot(BeNil())
+	r, _ := NewRay(tuple.NewPoint(0, 0, -5), tuple.NewVector(0, 0, 1))
+	g.Expect(func() { r.Intersect(s) }).To(Panic())
+}
+
+func BenchmarkRayIntersect(b *testing.B) {
+	s := NewSphere().WithTransform(matrix.NewTranslation(1, 2, 3).Scale(2, 2, 2))
+	r, _ := NewRay(tuple.NewPoint(0, 0, -5), tuple.NewVector(0, 0, 1))
+	for i := 0; i < b.N; i++ {
+		r.Intersect(s)
+	}
+}
+
+func BenchmarkNormalAt(b *testing.B) {
+	s := NewSphere().WithTransform(matrix.NewTranslation(1, 2, 3).Scale(2, 2, 2))
+	p := tuple.NewPoint(1, 2, 1)
+	for i := 0; i < b.N; i++ {
+		s.NormalAt(p, Intersection{})
+	}
+}
@@ -0,0 +1,268 @@
+package shapes
+
+import (
+	"math"
+
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+// SDF is a signed distance function. Distance is negative inside the surface, positive
+// outside, and never more than the distance from the point to the surface, so that a ray
+// can always safely advance by it. Bounds contains every point where Distance is negative.
+type SDF interface {
+	Distance(p tuple.Tuple) float64
+	Bounds() BoundingBox
+}
+
+type distanceFunc struct {
+	f      func(tuple.Tuple) float64
+	bounds BoundingBox
+}
+
+// NewDistanceFunc turns any distance function into an SDF. The surface must be within
+// the given bounds.
+func NewDistanceFunc(f func(tuple.Tuple) float64, bounds BoundingBox) SDF {
+	return distanceFunc{f: f, bounds: bounds}
+}
+
+func (d distanceFunc) Distance(p tuple.Tuple) float64 {
+	return d.f(p)
+}
+
+func (d distanceFunc) Bounds() BoundingBox {
+	return d.bounds
+}
+
+type sdfSphere struct {
+	center tuple.Tuple
+	radius float64
+}
+
+func NewSDFSphere(center tuple.Tuple, radius float64) SDF {
+	return sdfSphere{center: center, radius: radius}
+}
+
+func (s sdfSphere) Distance(p tuple.Tuple) float64 {
+	return p.Subtract(s.center).Magnitude() - s.radius
+}
+
+func (s sdfSphere) Bounds() BoundingBox {
+	return padBounds(NewBoundingBox(s.center, s.center), s.radius)
+}
+
+type sdfBox struct {
+	center   tuple.Tuple
+	halfSize tuple.Tuple
+	rounding float64
+}
+
+// NewSDFBox creates a box with the given center and half its size along every axis. The
+// box's edges are rounded with the given radius.
+func NewSDFBox(center, halfSize tuple.Tuple, rounding float64) SDF {
+	return sdfBox{center: center, halfSize: halfSize, rounding: rounding}
+}
+
+func (b sdfBox) Distance(p tuple.Tuple) float64 {
+	var outside, inside float64
+	inside = math.Inf(-1)
+	for i := tuple.XPos; i <= tuple.ZPos; i++ {
+		q := math.Abs(p[i]-b.center[i]) - (b.halfSize[i] - b.rounding)
+		outside += math.Max(q, 0) * math.Max(q, 0)
+		inside = math.Max(inside, q)
+	}
+	return math.Sqrt(outside) + math.Min(inside, 0) - b.rounding
+}
+
+func (b sdfBox) Bounds() BoundingBox {
+	return NewBoundingBox(b.center.Subtract(b.halfSize), b.center.Add(b.halfSize))
+}
+
+type sdfCapsule struct {
+	a, b   tuple.Tuple
+	radius float64
+}
+
+// NewSDFCapsule creates a cylinder with rounded ends around the segment from a to b
+func NewSDFCapsule(a, b tuple.Tuple, radius float64) SDF {
+	return sdfCapsule{a: a, b: b, radius: radius}
+}
+
+func (c sdfCapsule) Distance(p tuple.Tuple) float64 {
+	pa := p.Subtract(c.a)
+	ba := c.b.Subtract(c.a)
+	h := 0.0
+	if l := ba.Dot(ba); l > 0 {
+		h = math.Max(0, math.Min(1, pa.Dot(ba)/l))
+	}
+	return pa.Subtract(ba.Mult(h)).Magnitude() - c.radius
+}
+
+func (c sdfCapsule) Bounds() BoundingBox {
+	return padBounds(EmptyBoundingBox().Add(c.a, c.b), c.radius)
+}
+
+type sdfTorus struct {
+	major, minor float64
+}
+
+// NewSDFTorus creates a ring around the Y axis, like NewTorus
+func NewSDFTorus(major, minor float64) SDF {
+	return sdfTorus{major: major, minor: minor}
+}
+
+func (t sdfTorus) Distance(p tuple.Tuple) float64 {
+	qx := math.Sqrt(p.X()*p.X()+p.Z()*p.Z()) - t.major
+	return math.Sqrt(qx*qx+p.Y()*p.Y()) - t.minor
+}
+
+func (t sdfTorus) Bounds() BoundingBox {
+	return torus{Major: t.major, Minor: t.minor}.bounds()
+}
+
+type sdfUnion struct {
+	children []SDF
+	// smoothness is the size of the blend between the children, 0 for a sharp union
+	smoothness float64
+}
+
+func NewSDFUnion(children ...SDF) SDF {
+	return sdfUnion{children: children}
+}
+
+// NewSDFSmoothUnion blends the children into each other. k is roughly the distance over
+// which the surfaces are blended, which is what makes metaballs out of spheres.
+func NewSDFSmoothUnion(k float64, children ...SDF) SDF {
+	return sdfUnion{children: children, smoothness: k}
+}
+
+func (u sdfUnion) Distance(p tuple.Tuple) float64 {
+	if len(u.children) == 0 {
+		return math.Inf(1)
+	}
+	retval := u.children[0].Distance(p)
+	for _, c := range u.children[1:] {
+		retval = smoothMin(retval, c.Distance(p), u.smoothness)
+	}
+	return retval
+}
+
+func (u sdfUnion) Bounds() BoundingBox {
+	retval := EmptyBoundingBox()
+	for _, c := range u.children {
+		retval = retval.Union(c.Bounds())
+	}
+	// The blend can bulge out by up to a quarter of its size
+	return padBounds(retval, u.smoothness/4)
+}
+
+type sdfIntersection struct {
+	children []SDF
+}
+
+func NewSDFIntersection(children ...SDF) SDF {
+	return sdfIntersection{children: children}
+}
+
+func (i sdfIntersection) Distance(p tuple.Tuple) float64 {
+	retval := math.Inf(-1)
+	for _, c := range i.children {
+		retval = math.Max(retval, c.Distance(p))
+	}
+	return retval
+}
+
+func (i sdfIntersection) Bounds() BoundingBox {
+	if len(i.children) == 0 {
+		return EmptyBoundingBox()
+	}
+	retval := i.children[0].Bounds()
+	for _, c := range i.children[1:] {
+		b := c.Bounds()
+		for axis := tuple.XPos; axis <= tuple.ZPos; axis++ {
+			retval.Min[axis] = math.Max(retval.Min[axis], b.Min[axis])
+			retval.Max[axis] = math.Min(retval.Max[axis], b.Max[axis])
+		}
+	}
+	return retval
+}
+
+type sdfSubtraction struct {
+	base       SDF
+	cuts       []SDF
+	smoothness float64
+}
+
+// NewSDFSubtraction cuts all the other shapes out of base
+func NewSDFSubtraction(base SDF, cuts ...SDF) SDF {
+	return sdfSubtraction{base: base, cuts: cuts}
+}
+
+// NewSDFSmoothSubtraction cuts the other shapes out of base, rounding the edges of the
+// cut over a distance of roughly k
+func NewSDFSmoothSubtraction(k float64, base SDF, cuts ...SDF) SDF {
+	return sdfSubtraction{base: base, cuts: cuts, smoothness: k}
+}
+
+func (s sdfSubtraction) Distance(p tuple.Tuple) float64 {
+	retval := s.base.Distance(p)
+	for _, c := range s.cuts {
+		retval = -smoothMin(-retval, c.Distance(p), s.smoothness)
+	}
+	return retval
+}
+
+func (s sdfSubtraction) Bounds() BoundingBox {
+	return s.base.Bounds()
+}
+
+type sdfRepeat struct {
+	period tuple.Tuple
+	child  SDF
+}
+
+// NewSDFRepeat repeats the child endlessly, every period units along each axis. An axis
+// with a zero period isn't repeated. The child should fit inside a single period around
+// the origin.
+func NewSDFRepeat(period tuple.Tuple, child SDF) SDF {
+	return sdfRepeat{period: period, child: child}
+}
+
+func (r sdfRepeat) Distance(p tuple.Tuple) float64 {
+	for i := tuple.XPos; i <= tuple.ZPos; i++ {
+		if r.period[i] > 0 {
+			p[i] -= r.period[i] * math.Round(p[i]/r.period[i])
+		}
+	}
+	return r.child.Distance(p)
+}
+
+func (r sdfRepeat) Bounds() BoundingBox {
+	retval := r.child.Bounds()
+	for i := tuple.XPos; i <= tuple.ZPos; i++ {
+		if r.period[i] > 0 {
+			retval.Min[i] = math.Inf(-1)
+			retval.Max[i] = math.Inf(1)
+		}
+	}
+	return retval
+}
+
+// smoothMin is a polynomial smooth minimum of a and b over a blend of size k. With
+// k == 0 it's the plain minimum.
+func smoothMin(a, b, k float64) float64 {
+	if k <= 0 {
+		return math.Min(a, b)
+	}
+	h := math.Max(0, math.Min(1, 0.5+0.5*(b-a)/k))
+	return b + (a-b)*h - k*h*(1-h)
+}
+
+func padBounds(b BoundingBox, pad float64) BoundingBox {
+	if b.IsEmpty() {
+		return b
+	}
+	return NewBoundingBox(
+		tuple.NewPoint(b.Min.X()-pad, b.Min.Y()-pad, b.Min.Z()-pad),
+		tuple.NewPoint(b.Max.X()+pad, b.Max.Y()+pad, b.Max.Z()+pad),
+	)
+}
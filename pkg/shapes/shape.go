@@ -12,14 +12,24 @@ import (
 type Shape interface {
 	ID() string
 	GetTransform() matrix.Matrix
+	GetInverseTransform() (matrix.Matrix4, error)
+	GetInverseTransformAt(time float64) (matrix.Matrix4, error)
+	GetMotion() []matrix.Matrix
 	GetMaterial() material.Material
 
 	WithTransform(matrix.Matrix) Shape
+	WithMotion(transforms ...matrix.Matrix) Shape
 	WithMaterial(material.Material) Shape
 	NormalAt(tuple.Tuple, Intersection) (tuple.Tuple, error)
 	LocalIntersect(ray Ray) []Intersection
+	LocalBounds() BoundingBox
+	Bounds() BoundingBox
+	WorldBounds() BoundingBox
 	WorldToObject(point tuple.Tuple) (tuple.Tuple, error)
 	NormalToWorld(vector tuple.Tuple) (tuple.Tuple, error)
+	WorldToObjectAt(point tuple.Tuple, time float64) (tuple.Tuple, error)
+	NormalToWorldAt(vector tuple.Tuple, time float64) (tuple.Tuple, error)
+	UVAt(point tuple.Tuple) (float64, float64)
 
 	SetParent(p Shape) Shape
 	Parent() Shape
@@ -43,6 +53,8 @@ type ShapeDetails interface {
 	shapeIdPrefix() string
 	normalAt(tuple.Tuple, Intersection) tuple.Tuple
 	localIntersect(ray Ray, outer Shape) []Intersection
+	bounds() BoundingBox
+	uvAt(tuple.Tuple) (float64, float64)
 }
 
 var shapeCounter int32 = 0
@@ -57,6 +69,16 @@ type shapeCore struct {
 	material  material.Material
 	shape     ShapeDetails
 	parent    Shape
+
+	// The inverse of the transform and its transpose are needed for every ray and every
+	// normal, so they're computed once when the transform is set
+	inverse          matrix.Matrix4
+	inverseTranspose matrix.Matrix4
+	inverseErr       error
+
+	// motion holds the transforms of a shape that moves while the shutter is open. It's
+	// nil for shapes that stay in place, which only use transform.
+	motion []matrix.Matrix4
 }
 
 func (s shapeCore) String() string {
@@ -69,6 +91,21 @@ func (s shapeCore) InnerShape() ShapeDetails {
 
 func (s shapeCore) SetParent(p Shape) Shape {
 	s.parent = p
+	return s.adoptChildren()
+}
+
+// adoptChildren points the children of a group or a CSG at the shape. Shapes are copied
+// whenever their transform or parent change, and the children must see the copy that's
+// actually used, or they would miss its transform.
+func (s shapeCore) adoptChildren() shapeCore {
+	switch inner := s.shape.(type) {
+	case Group:
+		return inner.adopt(s)
+	case csg:
+		inner.left = inner.left.SetParent(s)
+		inner.right = inner.right.SetParent(s)
+		s.shape = inner
+	}
 	return s
 }
 
@@ -80,16 +117,26 @@ func (s shapeCore) GetTransform() matrix.Matrix {
 	return s.transform
 }
 
+// GetInverseTransform returns the inverse of the shape's transform, or an error if the
+// transform can't be inverted
+func (s shapeCore) GetInverseTransform() (matrix.Matrix4, error) {
+	return s.inverse, s.inverseErr
+}
+
 func (s shapeCore) GetMaterial() material.Material {
 	return s.material
 }
 
 func newShape(m material.Material, t matrix.Matrix, s ShapeDetails) shapeCore {
+	inv, err := t.ToMatrix4().Inverse()
 	return shapeCore{
-		id:        atomic.AddInt32(&shapeCounter, 1),
-		material:  m,
-		transform: t,
-		shape:     s,
+		id:               atomic.AddInt32(&shapeCounter, 1),
+		material:         m,
+		transform:        t,
+		shape:            s,
+		inverse:          inv,
+		inverseTranspose: inv.Transpose(),
+		inverseErr:       err,
 	}
 }
 
@@ -98,29 +145,47 @@ func (s shapeCore) NormalAt(point tuple.Tuple, hit Intersection) (tuple.Tuple, e
 		return tuple.Tuple{}, fmt.Errorf("Can't compute a normal at a Vector")
 	}
 
-	localPoint, err := s.WorldToObject(point)
+	localPoint, err := s.WorldToObjectAt(point, hit.Time)
 	if err != nil {
 		return tuple.Tuple{}, err
 	}
 	localNormal := s.shape.normalAt(localPoint, hit)
-	normal, err := s.NormalToWorld(localNormal)
+	normal, err := s.NormalToWorldAt(localNormal, hit.Time)
 	if err != nil {
 		return tuple.Tuple{}, err
 	}
 	return normal, nil
 }
 
+// UVAt maps a point on the shape, given in object space, to texture coordinates
+func (s shapeCore) UVAt(point tuple.Tuple) (float64, float64) {
+	return s.shape.uvAt(point)
+}
+
 func (s shapeCore) NormalToWorld(vector tuple.Tuple) (tuple.Tuple, error) {
-	inv, err := s.transform.Inverse()
-	if err != nil {
-		return tuple.Tuple{}, err
+	return s.NormalToWorldAt(vector, 0)
+}
+
+// NormalToWorldAt converts a normal to world coordinates, using the transforms of the
+// shape and its parents at the given time
+func (s shapeCore) NormalToWorldAt(vector tuple.Tuple, time float64) (tuple.Tuple, error) {
+	inverseTranspose := s.inverseTranspose
+	if s.motion != nil {
+		inv, err := s.GetInverseTransformAt(time)
+		if err != nil {
+			return tuple.Tuple{}, err
+		}
+		inverseTranspose = inv.Transpose()
+	} else if s.inverseErr != nil {
+		return tuple.Tuple{}, s.inverseErr
 	}
-	retval := inv.Transpose().MultiplyTuple(vector)
+	retval := inverseTranspose.MultiplyTuple(vector)
 	retval[tuple.WPos] = 0
 	retval = retval.Normalize()
 
 	if s.Parent() != nil {
-		retval, err = s.Parent().NormalToWorld(retval)
+		var err error
+		retval, err = s.Parent().NormalToWorldAt(retval, time)
 		if err != nil {
 			return tuple.Tuple{}, err
 		}
@@ -129,15 +194,21 @@ func (s shapeCore) NormalToWorld(vector tuple.Tuple) (tuple.Tuple, error) {
 }
 
 func (s shapeCore) WorldToObject(point tuple.Tuple) (tuple.Tuple, error) {
+	return s.WorldToObjectAt(point, 0)
+}
+
+// WorldToObjectAt converts a point to object coordinates, using the transforms of the
+// shape and its parents at the given time
+func (s shapeCore) WorldToObjectAt(point tuple.Tuple, time float64) (tuple.Tuple, error) {
 	var err error
 	retval := point
 	if s.Parent() != nil {
-		retval, err = s.Parent().WorldToObject(point)
+		retval, err = s.Parent().WorldToObjectAt(point, time)
 		if err != nil {
 			return retval, err
 		}
 	}
-	inv, err := s.transform.Inverse()
+	inv, err := s.GetInverseTransformAt(time)
 	if err != nil {
 		return retval, err
 	}
@@ -148,14 +219,53 @@ func (s shapeCore) LocalIntersect(ray Ray) []Intersection {
 	return s.shape.localIntersect(ray, s)
 }
 
+// LocalBounds returns the box containing the shape, in object coordinates
+func (s shapeCore) LocalBounds() BoundingBox {
+	return s.shape.bounds()
+}
+
+// Bounds returns the box containing the shape, in the coordinates of its parent
+func (s shapeCore) Bounds() BoundingBox {
+	return s.transformBounds(s.shape.bounds())
+}
+
+// transformBounds moves a box from object coordinates to the coordinates of the parent.
+// A moving shape's box holds it all the time that the shutter is open.
+func (s shapeCore) transformBounds(b BoundingBox) BoundingBox {
+	if s.motion == nil {
+		return b.Transform(s.transform)
+	}
+	retval := EmptyBoundingBox()
+	for _, m := range s.motion {
+		retval = retval.Union(b.Transform(m.ToMatrix()))
+	}
+	return retval
+}
+
+// WorldBounds returns the box containing the shape in world coordinates, taking the
+// transforms of all its parents into account
+func (s shapeCore) WorldBounds() BoundingBox {
+	retval := s.Bounds()
+	for p := s.Parent(); p != nil; p = p.Parent() {
+		if parent, ok := p.(shapeCore); ok {
+			retval = parent.transformBounds(retval)
+		} else {
+			retval = retval.Transform(p.GetTransform())
+		}
+	}
+	return retval
+}
+
 func (s shapeCore) ID() string {
 	return fmt.Sprintf("%s%d", s.shape.shapeIdPrefix(), s.id)
 }
 
 func (s shapeCore) WithTransform(t matrix.Matrix) Shape {
-	return newShape(s.material, t, s.shape)
+	return newShape(s.material, t, s.shape).adoptChildren()
 }
 
 func (s shapeCore) WithMaterial(m material.Material) Shape {
-	return newShape(m, s.transform, s.shape)
+	s.id = atomic.AddInt32(&shapeCounter, 1)
+	s.material = m
+	return s
 }
@@ -14,9 +14,15 @@ type smoothTriangle struct {
 	P1, P2, P3 tuple.Tuple
 	E1, E2     tuple.Tuple
 	N1, N2, N3 tuple.Tuple
+	UV         [3]TextureCoord
 }
 
 func NewSmoothTriangle(p1, p2, p3, n1, n2, n3 tuple.Tuple) Shape {
+	return NewTexturedSmoothTriangle(p1, p2, p3, n1, n2, n3, defaultTextureCoords[0], defaultTextureCoords[1], defaultTextureCoords[2])
+}
+
+// NewTexturedSmoothTriangle creates a smooth triangle with texture coordinates at every vertex
+func NewTexturedSmoothTriangle(p1, p2, p3, n1, n2, n3 tuple.Tuple, uv1, uv2, uv3 TextureCoord) Shape {
 	return newShape(material.Default(), matrix.NewIdentity(), smoothTriangle{
 		P1: p1,
 		P2: p2,
@@ -26,6 +32,7 @@ func NewSmoothTriangle(p1, p2, p3, n1, n2, n3 tuple.Tuple) Shape {
 		N3: n3,
 		E1: p2.Subtract(p1),
 		E2: p3.Subtract(p1),
+		UV: [3]TextureCoord{uv1, uv2, uv3},
 	})
 }
 
@@ -41,6 +48,14 @@ func (t smoothTriangle) normalAt(point tuple.Tuple, hit Intersection) tuple.Tupl
 	return t.N2.Mult(hit.U).Add(t.N3.Mult(hit.V)).Add(t.N1.Mult(1.0 - hit.U - hit.V))
 }
 
+func (t smoothTriangle) bounds() BoundingBox {
+	return EmptyBoundingBox().Add(t.P1, t.P2, t.P3)
+}
+
+func (t smoothTriangle) uvAt(point tuple.Tuple) (float64, float64) {
+	return interpolateUV(t.P1, t.E1, t.E2, point, t.UV)
+}
+
 func (t smoothTriangle) localIntersect(ray Ray, outer Shape) []Intersection {
 	dirCrossE2 := ray.Direction.Cross(t.E2)
 	det := t.E1.Dot(dirCrossE2)
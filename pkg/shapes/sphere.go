@@ -27,6 +27,14 @@ func (s sphere) normalAt(point tuple.Tuple, hit Intersection) tuple.Tuple {
 	return point.Subtract(tuple.NewPoint(0, 0, 0))
 }
 
+func (s sphere) bounds() BoundingBox {
+	return NewBoundingBox(tuple.NewPoint(-1, -1, -1), tuple.NewPoint(1, 1, 1))
+}
+
+func (s sphere) uvAt(point tuple.Tuple) (float64, float64) {
+	return material.SphericalMap(point)
+}
+
 func (s sphere) localIntersect(ray Ray, outer Shape) []Intersection {
 
 	sr := ray.Origin.Subtract(tuple.NewPoint(0, 0, 0))
@@ -0,0 +1,94 @@
+package shapes
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/liorokman/raytrace/pkg/material"
+	"github.com/liorokman/raytrace/pkg/matrix"
+	"github.com/liorokman/raytrace/pkg/tuple"
+	"github.com/liorokman/raytrace/pkg/utils"
+)
+
+// torus is a ring around the Y axis. The center of the tube is a circle of radius Major
+// in the XZ plane, and the tube itself has a radius of Minor.
+type torus struct {
+	Major float64
+	Minor float64
+}
+
+func NewTorus(major, minor float64) Shape {
+	if major < 0 || minor <= 0 {
+		panic("Torus radii must be positive")
+	}
+	return newShape(material.Default(), matrix.NewIdentity(), torus{
+		Major: major,
+		Minor: minor,
+	})
+}
+
+func (t torus) String() string {
+	return fmt.Sprintf("Major: %f Minor: %f", t.Major, t.Minor)
+}
+
+func (t torus) shapeIdPrefix() string {
+	return "TO"
+}
+
+func (t torus) normalAt(point tuple.Tuple, hit Intersection) tuple.Tuple {
+	// The normal points away from the closest point on the circle at the tube's center
+	dist := math.Sqrt(point.X()*point.X() + point.Z()*point.Z())
+	if utils.FloatEqual(dist, 0) {
+		return tuple.NewVector(0, math.Copysign(1, point.Y()), 0)
+	}
+	scale := t.Major / dist
+	return tuple.NewVector(point.X()-point.X()*scale, point.Y(), point.Z()-point.Z()*scale)
+}
+
+func (t torus) bounds() BoundingBox {
+	outer := t.Major + t.Minor
+	return NewBoundingBox(tuple.NewPoint(-outer, -t.Minor, -outer), tuple.NewPoint(outer, t.Minor, outer))
+}
+
+// uvAt maps u around the Y axis and v around the tube
+func (t torus) uvAt(point tuple.Tuple) (float64, float64) {
+	theta := math.Atan2(point.X(), point.Z())
+	phi := math.Atan2(point.Y(), math.Sqrt(point.X()*point.X()+point.Z()*point.Z())-t.Major)
+	return 1 - (theta/(2*math.Pi) + 0.5), phi/(2*math.Pi) + 0.5
+}
+
+func (t torus) localIntersect(ray Ray, outer Shape) []Intersection {
+	// The quartic loses precision quickly as the ray's origin moves away from the torus,
+	// so when the origin is outside the torus' bounding sphere it's first moved up to the
+	// sphere
+	origin := tuple.NewPoint(0, 0, 0)
+	radius := t.Major + t.Minor
+	d := ray.Direction
+	dd := d.Dot(d)
+	shift := 0.0
+	if o := ray.Origin.Subtract(origin); o.Magnitude() > radius {
+		hits := utils.SolveQuadratic(dd, 2*d.Dot(o), o.Dot(o)-radius*radius)
+		if len(hits) < 2 {
+			return []Intersection{}
+		}
+		shift = hits[0]
+	}
+	o := ray.Position(shift).Subtract(origin)
+
+	sqMajor := t.Major * t.Major
+	od := o.Dot(d)
+	k := o.Dot(o) - t.Minor*t.Minor - sqMajor
+
+	roots := utils.SolveQuartic(
+		dd*dd,
+		4*dd*od,
+		2*dd*k+4*od*od+4*sqMajor*d.Y()*d.Y(),
+		4*k*od+8*sqMajor*o.Y()*d.Y(),
+		k*k-4*sqMajor*(t.Minor*t.Minor-o.Y()*o.Y()),
+	)
+	retval := make([]Intersection, 0, len(roots))
+	for _, root := range roots {
+		retval = append(retval, Intersection{T: root + shift, Shape: outer})
+	}
+	return retval
+}
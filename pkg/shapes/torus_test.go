@@ -0,0 +1,93 @@
+package shapes
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/liorokman/raytrace/pkg/matrix"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+func TestTorusIntersections(t *testing.T) {
+	tests := []struct {
+		origin    tuple.Tuple
+		direction tuple.Tuple
+		ts        []float64
+	}{
+		// Through both sides of the ring
+		{tuple.NewPoint(-5, 0, 0), tuple.NewVector(1, 0, 0), []float64{3.75, 4.25, 5.75, 6.25}},
+		// Down through the hole
+		{tuple.NewPoint(0, 5, 0), tuple.NewVector(0, -1, 0), []float64{}},
+		// Down through the tube
+		{tuple.NewPoint(1, 5, 0), tuple.NewVector(0, -1, 0), []float64{4.75, 5.25}},
+		// Starting inside the tube
+		{tuple.NewPoint(0, 0, -1), tuple.NewVector(0, 0, 1), []float64{-0.25, 0.25, 1.75, 2.25}},
+		// Missing the bounding sphere
+		{tuple.NewPoint(-5, 2, 0), tuple.NewVector(1, 0, 0), []float64{}},
+		// A long way off, where the quartic's coefficients are huge
+		{tuple.NewPoint(-10000, 0, 0), tuple.NewVector(1, 0, 0), []float64{9998.75, 9999.25, 10000.75, 10001.25}},
+		// Tangent to the top of the tube
+		{tuple.NewPoint(-5, 0.25, 1), tuple.NewVector(1, 0, 0), []float64{5, 5}},
+	}
+
+	g := NewGomegaWithT(t)
+	torus := NewTorus(1, 0.25)
+	for _, curr := range tests {
+		r, err := NewRay(curr.origin, curr.direction)
+		g.Expect(err).To(BeNil())
+		xs := torus.LocalIntersect(r)
+		g.Expect(xs).To(HaveLen(len(curr.ts)), "ray from %v", curr.origin)
+		for i := range curr.ts {
+			g.Expect(xs[i].T).To(BeNumerically("~", curr.ts[i], 1e-6))
+		}
+	}
+}
+
+func TestTorusNormal(t *testing.T) {
+	tests := []struct {
+		point  tuple.Tuple
+		normal tuple.Tuple
+	}{
+		{tuple.NewPoint(1.25, 0, 0), tuple.NewVector(1, 0, 0)},
+		{tuple.NewPoint(0.75, 0, 0), tuple.NewVector(-1, 0, 0)},
+		{tuple.NewPoint(0, 0.25, 1), tuple.NewVector(0, 1, 0)},
+		{tuple.NewPoint(0, -0.25, -1), tuple.NewVector(0, -1, 0)},
+		{tuple.NewPoint(1+0.25*math.Sqrt(2)/2, 0.25*math.Sqrt(2)/2, 0), tuple.NewVector(math.Sqrt(2)/2, math.Sqrt(2)/2, 0)},
+	}
+
+	g := NewGomegaWithT(t)
+	torus := NewTorus(1, 0.25)
+	for _, curr := range tests {
+		n, err := torus.NormalAt(curr.point, Intersection{})
+		g.Expect(err).To(BeNil())
+		g.Expect(n.Equals(curr.normal)).To(BeTrue(), "normal at %v is %v", curr.point, n)
+	}
+}
+
+func TestTorusBounds(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	b := NewTorus(2, 0.5).LocalBounds()
+	g.Expect(b.Min.Equals(tuple.NewPoint(-2.5, -0.5, -2.5))).To(BeTrue())
+	g.Expect(b.Max.Equals(tuple.NewPoint(2.5, 0.5, 2.5))).To(BeTrue())
+
+	g.Expect(func() { NewTorus(1, 0) }).To(Panic())
+}
+
+func TestTorusInCSG(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// Cutting the near half of the ring away leaves only the far side
+	s1 := NewTorus(1, 0.25)
+	s2 := NewCube().WithTransform(matrix.NewTranslation(-1, 0, 0))
+	c := NewCSG(&s1, &s2, DifferenceOp)
+	r, err := NewRay(tuple.NewPoint(-5, 0, 0), tuple.NewVector(1, 0, 0))
+	g.Expect(err).To(BeNil())
+	xs := r.Intersect(c)
+	g.Expect(xs).To(HaveLen(2))
+	g.Expect(xs[0].T).To(BeNumerically("~", 5.75, 1e-6))
+	g.Expect(xs[1].T).To(BeNumerically("~", 6.25, 1e-6))
+	g.Expect(xs[0].Shape.ID()).To(Equal(s1.ID()))
+}
@@ -10,25 +10,59 @@ import (
 	"github.com/liorokman/raytrace/pkg/utils"
 )
 
+// TextureCoord is a position on a texture, as found in the vt lines of OBJ files
+type TextureCoord struct {
+	U, V float64
+}
+
+// defaultTextureCoords stretches the texture over the triangle, with the first vertex
+// at the texture's origin
+var defaultTextureCoords = [3]TextureCoord{{0, 0}, {1, 0}, {0, 1}}
+
 type triangle struct {
 	P1, P2, P3 tuple.Tuple
 	E1, E2     tuple.Tuple
 	Normal     tuple.Tuple
+	UV         [3]TextureCoord
 }
 
 func NewTriangle(p1, p2, p3 tuple.Tuple) Shape {
+	return NewTexturedTriangle(p1, p2, p3, defaultTextureCoords[0], defaultTextureCoords[1], defaultTextureCoords[2])
+}
 
+// NewTexturedTriangle creates a triangle with texture coordinates at every vertex
+func NewTexturedTriangle(p1, p2, p3 tuple.Tuple, uv1, uv2, uv3 TextureCoord) Shape {
 	t := triangle{
 		P1: p1,
 		P2: p2,
 		P3: p3,
 		E1: p2.Subtract(p1),
 		E2: p3.Subtract(p1),
+		UV: [3]TextureCoord{uv1, uv2, uv3},
 	}
 	t.Normal = t.E2.Cross(t.E1).Normalize()
 	return newShape(material.Default(), matrix.NewIdentity(), t)
 }
 
+// interpolateUV computes the barycentric coordinates of a point on the triangle
+// and uses them to interpolate the texture coordinates of the vertices
+func interpolateUV(p1, e1, e2, point tuple.Tuple, uv [3]TextureCoord) (float64, float64) {
+	toPoint := point.Subtract(p1)
+	d00 := e1.Dot(e1)
+	d01 := e1.Dot(e2)
+	d11 := e2.Dot(e2)
+	d20 := toPoint.Dot(e1)
+	d21 := toPoint.Dot(e2)
+	denom := d00*d11 - d01*d01
+	if denom == 0 {
+		return uv[0].U, uv[0].V
+	}
+	b2 := (d11*d20 - d01*d21) / denom
+	b3 := (d00*d21 - d01*d20) / denom
+	b1 := 1 - b2 - b3
+	return b1*uv[0].U + b2*uv[1].U + b3*uv[2].U, b1*uv[0].V + b2*uv[1].V + b3*uv[2].V
+}
+
 func (t triangle) String() string {
 	return fmt.Sprintf("P1: %s, P2: %s, P3: %s", t.P1, t.P2, t.P3)
 }
@@ -41,6 +75,14 @@ func (t triangle) normalAt(point tuple.Tuple, hit Intersection) tuple.Tuple {
 	return t.Normal
 }
 
+func (t triangle) bounds() BoundingBox {
+	return EmptyBoundingBox().Add(t.P1, t.P2, t.P3)
+}
+
+func (t triangle) uvAt(point tuple.Tuple) (float64, float64) {
+	return interpolateUV(t.P1, t.E1, t.E2, point, t.UV)
+}
+
 func (t triangle) localIntersect(ray Ray, outer Shape) []Intersection {
 	dirCrossE2 := ray.Direction.Cross(t.E2)
 	det := t.E1.Dot(dirCrossE2)
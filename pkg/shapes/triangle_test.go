@@ -57,3 +57,36 @@ func TestTriangleIntersect(t *testing.T) {
 	g.Expect(xs[0].T).To(Equal(2.0))
 
 }
+
+func TestTriangleTextureCoords(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	p1, p2, p3 := tuple.NewPoint(0, 1, 0), tuple.NewPoint(-1, 0, 0), tuple.NewPoint(1, 0, 0)
+	tri := NewTexturedTriangle(p1, p2, p3, TextureCoord{0.5, 1}, TextureCoord{0, 0}, TextureCoord{1, 0})
+	tests := []struct {
+		point tuple.Tuple
+		u, v  float64
+	}{
+		{p1, 0.5, 1},
+		{p2, 0, 0},
+		{p3, 1, 0},
+		{tuple.NewPoint(0, 0, 0), 0.5, 0},
+		{tuple.NewPoint(0, 0.5, 0), 0.5, 0.5},
+	}
+	for _, test := range tests {
+		u, v := tri.UVAt(test.point)
+		g.Expect(u).To(BeNumerically("~", test.u, 1e-9), test.point.String())
+		g.Expect(v).To(BeNumerically("~", test.v, 1e-9), test.point.String())
+	}
+
+	// Without texture coordinates the texture is stretched from the first vertex
+	u, v := NewTriangle(p1, p2, p3).UVAt(p3)
+	g.Expect(u).To(BeNumerically("~", 0, 1e-9))
+	g.Expect(v).To(BeNumerically("~", 1, 1e-9))
+
+	smooth := NewTexturedSmoothTriangle(p1, p2, p3, tuple.NewVector(0, 1, 0), tuple.NewVector(-1, 0, 0), tuple.NewVector(1, 0, 0),
+		TextureCoord{0.5, 1}, TextureCoord{0, 0}, TextureCoord{1, 0})
+	u, v = smooth.UVAt(tuple.NewPoint(0, 0.5, 0))
+	g.Expect(u).To(BeNumerically("~", 0.5, 1e-9))
+	g.Expect(v).To(BeNumerically("~", 0.5, 1e-9))
+}
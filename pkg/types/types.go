@@ -9,3 +9,16 @@ type ShapeTransformer interface {
 	GetTransform() matrix.Matrix
 	WorldToObject(point tuple.Tuple) (tuple.Tuple, error)
 }
+
+// UVMapper is implemented by shapes that know how to map a point on their surface,
+// given in object space, to texture coordinates
+type UVMapper interface {
+	UVAt(point tuple.Tuple) (float64, float64)
+}
+
+// VertexColorer is implemented by the hits on shapes that have colors assigned to their
+// vertices. The color is interpolated over the face that was hit, and it's only valid
+// when the second value is true.
+type VertexColorer interface {
+	VertexColorAt() (tuple.Color, bool)
+}
@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"math"
+	"sort"
+)
+
+// rootEpsilon is the tolerance used for the polynomial solvers. It's far smaller than
+// EPSILON, since the coefficients are squared and cubed along the way.
+const rootEpsilon float64 = 1e-12
+
+func isZero(x float64) bool {
+	return math.Abs(x) < rootEpsilon
+}
+
+// SolveQuadratic returns the real roots of a*x^2 + b*x + c in ascending order
+func SolveQuadratic(a, b, c float64) []float64 {
+	if isZero(a) {
+		if isZero(b) {
+			return []float64{}
+		}
+		return []float64{-c / b}
+	}
+	disc := b*b - 4*a*c
+	if disc < 0 {
+		return []float64{}
+	}
+	if disc == 0 {
+		return []float64{-b / (2 * a)}
+	}
+	// Avoid subtracting two nearly equal numbers when b is large
+	q := -0.5 * (b + math.Copysign(math.Sqrt(disc), b))
+	x0, x1 := q/a, c/q
+	if x0 > x1 {
+		x0, x1 = x1, x0
+	}
+	return []float64{x0, x1}
+}
+
+// SolveCubic returns the real roots of a*x^3 + b*x^2 + c*x + d in ascending order
+func SolveCubic(a, b, c, d float64) []float64 {
+	if isZero(a) {
+		return SolveQuadratic(b, c, d)
+	}
+	roots := solveNormalizedCubic(b/a, c/a, d/a)
+	for i := range roots {
+		roots[i] = polish(roots[i], a, b, c, d)
+	}
+	sort.Float64s(roots)
+	return roots
+}
+
+// solveNormalizedCubic returns the real roots of x^3 + A*x^2 + B*x + C, using Cardano's
+// method for a single real root and the trigonometric method for three
+func solveNormalizedCubic(A, B, C float64) []float64 {
+	// Substitute x = y - A/3 to eliminate the square term: y^3 + 3p*y + 2q = 0
+	sqA := A * A
+	p := (-sqA/3 + B) / 3
+	q := (2.0/27*A*sqA - A*B/3 + C) / 2
+	cbP := p * p * p
+	D := q*q + cbP
+
+	var roots []float64
+	if isZero(D) {
+		if isZero(q) {
+			roots = []float64{0}
+		} else {
+			u := math.Cbrt(-q)
+			roots = []float64{2 * u, -u}
+		}
+	} else if D < 0 {
+		phi := math.Acos(math.Max(-1, math.Min(1, -q/math.Sqrt(-cbP)))) / 3
+		t := 2 * math.Sqrt(-p)
+		roots = []float64{
+			t * math.Cos(phi),
+			-t * math.Cos(phi+math.Pi/3),
+			-t * math.Cos(phi-math.Pi/3),
+		}
+	} else {
+		sqrtD := math.Sqrt(D)
+		roots = []float64{math.Cbrt(sqrtD-q) - math.Cbrt(sqrtD+q)}
+	}
+	for i := range roots {
+		roots[i] -= A / 3
+	}
+	return roots
+}
+
+// SolveQuartic returns the real roots of a*x^4 + b*x^3 + c*x^2 + d*x + e in ascending
+// order. The roots are found with Ferrari's method and then refined with a few Newton
+// iterations on the original polynomial, which takes care of most of the precision
+// that's lost along the way.
+func SolveQuartic(a, b, c, d, e float64) []float64 {
+	if isZero(a) {
+		return SolveCubic(b, c, d, e)
+	}
+	A, B, C, D := b/a, c/a, d/a, e/a
+
+	// Substitute x = y - A/4 to eliminate the cubic term: y^4 + p*y^2 + q*y + r = 0
+	sqA := A * A
+	p := -3.0/8*sqA + B
+	q := sqA*A/8 - A*B/2 + C
+	r := -3.0/256*sqA*sqA + sqA*B/16 - A*C/4 + D
+
+	var roots []float64
+	if isZero(r) {
+		// y(y^3 + p*y + q) = 0
+		roots = append(solveNormalizedCubic(0, p, q), 0)
+	} else {
+		// Take one real root of the resolvent cubic, and use it to split the quartic into
+		// two quadratics
+		z := solveNormalizedCubic(-p/2, -r, r*p/2-q*q/8)[0]
+		u := z*z - r
+		v := 2*z - p
+		if isZero(u) {
+			u = 0
+		} else if u > 0 {
+			u = math.Sqrt(u)
+		} else {
+			return []float64{}
+		}
+		if isZero(v) {
+			v = 0
+		} else if v > 0 {
+			v = math.Sqrt(v)
+		} else {
+			return []float64{}
+		}
+		if q < 0 {
+			v = -v
+		}
+		roots = append(SolveQuadratic(1, v, z-u), SolveQuadratic(1, -v, z+u)...)
+	}
+
+	for i := range roots {
+		roots[i] = polish(roots[i]-A/4, a, b, c, d, e)
+	}
+	sort.Float64s(roots)
+	return roots
+}
+
+// polish improves a root of the polynomial with the given coefficients, highest power
+// first, with a few iterations of Newton's method
+func polish(x float64, coeffs ...float64) float64 {
+	for i := 0; i < 4; i++ {
+		f, df := 0.0, 0.0
+		for _, c := range coeffs {
+			df = df*x + f
+			f = f*x + c
+		}
+		if df == 0 {
+			break
+		}
+		next := x - f/df
+		if math.IsNaN(next) || math.IsInf(next, 0) {
+			break
+		}
+		x = next
+	}
+	return x
+}
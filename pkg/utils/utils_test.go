@@ -12,3 +12,47 @@ func TestFloatEqual(t *testing.T) {
 	g.Expect(FloatEqual(3, 2)).To(BeFalse())
 	g.Expect(FloatEqual(3, 3.000001)).To(BeTrue())
 }
+
+func expectRoots(g *WithT, roots []float64, expected ...float64) {
+	g.Expect(roots).To(HaveLen(len(expected)))
+	for i := range expected {
+		g.Expect(roots[i]).To(BeNumerically("~", expected[i], 1e-9))
+	}
+}
+
+func TestSolveQuadratic(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	expectRoots(g, SolveQuadratic(1, -3, 2), 1, 2)
+	expectRoots(g, SolveQuadratic(1, 0, 1))
+	expectRoots(g, SolveQuadratic(0, 2, -4), 2)
+	// Catastrophic cancellation in the textbook formula
+	expectRoots(g, SolveQuadratic(1, -1e8, 1), 1e-8, 1e8)
+}
+
+func TestSolveCubic(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// (x-1)(x-2)(x-3)
+	expectRoots(g, SolveCubic(1, -6, 11, -6), 1, 2, 3)
+	// (x-1)(x^2+1)
+	expectRoots(g, SolveCubic(1, -1, 1, -1), 1)
+	// x^3
+	expectRoots(g, SolveCubic(1, 0, 0, 0), 0)
+}
+
+func TestSolveQuartic(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// (x-1)(x-2)(x-3)(x-4)
+	expectRoots(g, SolveQuartic(1, -10, 35, -50, 24), 1, 2, 3, 4)
+	// 2(x+1)(x-0.5)(x^2+1)
+	expectRoots(g, SolveQuartic(2, 1, 1, 1, -1), -1, 0.5)
+	// x^4 + 1 has no real roots
+	expectRoots(g, SolveQuartic(1, 0, 0, 0, 1))
+	// x(x-1)(x+2)(x-5), with a zero constant term
+	expectRoots(g, SolveQuartic(1, -4, -7, 10, 0), -2, 0, 1, 5)
+	// Widely spread roots: (x-0.001)(x-1)(x-10)(x-1000)
+	roots := SolveQuartic(1, -1011.001, 11011.011, -10011.01, 10)
+	expectRoots(g, roots, 0.001, 1, 10, 1000)
+}
@@ -0,0 +1,203 @@
+package world
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// timeVariable is the variable that holds the time of the frame being built, in seconds
+	timeVariable = "time"
+	// keyframesKey marks a value that changes over time
+	keyframesKey = "keyframes"
+
+	// easings
+	lineareasing    = "linear"
+	easeineasing    = "easein"
+	easeouteasing   = "easeout"
+	easeinouteasing = "easeinout"
+
+	defaultFPS     = 24
+	defaultShutter = 0.5
+)
+
+// easings map the fraction of the time between two keyframes to the fraction of the way
+// between their values. None of them overshoot, so values never leave the range of the
+// keyframes around them.
+var easings = map[string]func(float64) float64{
+	lineareasing:    func(u float64) float64 { return u },
+	easeineasing:    func(u float64) float64 { return u * u },
+	easeouteasing:   func(u float64) float64 { return 1 - (1-u)*(1-u) },
+	easeinouteasing: func(u float64) float64 { return u * u * (3 - 2*u) },
+}
+
+// Animation describes the frames of an animated scene
+type Animation struct {
+	// Frames is the number of frames, numbered from 0
+	Frames int `yaml:",omitempty"`
+	// FPS is the number of frames in every second of the animation, defaults to 24
+	FPS float64 `yaml:"fps,omitempty"`
+	// Shutter is the part of the time between frames that the shutter is open, for motion
+	// blur. Defaults to 0.5
+	Shutter float64 `yaml:",omitempty"`
+}
+
+// FrameTime returns the time of a frame, in seconds
+func (a Animation) FrameTime(frame int) float64 {
+	fps := a.FPS
+	if fps == 0 {
+		fps = defaultFPS
+	}
+	return float64(frame) / fps
+}
+
+// check makes sure that the animation can be played
+func (a Animation) check() error {
+	if a.Frames < 0 {
+		return at("frames", fmt.Errorf("The number of frames can't be negative"))
+	}
+	if a.FPS < 0 {
+		return at("fps", fmt.Errorf("The frame rate can't be negative"))
+	}
+	if a.Shutter < 0 || a.Shutter > 1 {
+		return at("shutter", fmt.Errorf("The shutter must be between 0 and 1, not %g", a.Shutter))
+	}
+	return nil
+}
+
+// ShutterTime returns the length of time that the shutter is open in every frame, in seconds
+func (a Animation) ShutterTime() float64 {
+	shutter := a.Shutter
+	if shutter == 0 {
+		shutter = defaultShutter
+	}
+	return a.FrameTime(1) * shutter
+}
+
+type keyframe struct {
+	Time   interface{}
+	Value  interface{}
+	Easing string
+}
+
+// animate replaces every value that has keyframes with its value at the current time.
+// The keyframes are given as
+//
+//	keyframes:
+//	- time: 0
+//	  value: [ 0, 1, 0 ]
+//	- time: 2
+//	  value: [ 0, 3, 0 ]
+//	  easing: easeinout
+//
+// where the easing of a keyframe is how the value gets to it from the keyframe before it.
+func (vars variables) animate(val interface{}) (interface{}, error) {
+	switch v := val.(type) {
+	case map[interface{}]interface{}:
+		if keys, ok := v[keyframesKey]; ok {
+			return vars.interpolate(keys)
+		}
+		retval := make(map[interface{}]interface{}, len(v))
+		for k, item := range v {
+			var err error
+			if retval[k], err = vars.animate(item); err != nil {
+				return nil, fmt.Errorf("%v: %w", k, err)
+			}
+		}
+		return retval, nil
+	case yaml.MapSlice:
+		retval := make(yaml.MapSlice, len(v))
+		for i, item := range v {
+			if item.Key == keyframesKey {
+				return vars.interpolate(item.Value)
+			}
+			animated, err := vars.animate(item.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", item.Key, err)
+			}
+			retval[i] = yaml.MapItem{Key: item.Key, Value: animated}
+		}
+		return retval, nil
+	case []interface{}:
+		retval := make([]interface{}, len(v))
+		for i := range v {
+			var err error
+			if retval[i], err = vars.animate(v[i]); err != nil {
+				return nil, err
+			}
+		}
+		return retval, nil
+	default:
+		return val, nil
+	}
+}
+
+// interpolate finds the value of a list of keyframes at the current time
+func (vars variables) interpolate(raw interface{}) (interface{}, error) {
+	var keys []keyframe
+	asYaml, _ := yaml.Marshal(raw)
+	if err := yaml.Unmarshal(asYaml, &keys); err != nil {
+		return nil, fmt.Errorf("Keyframes must be a list of times and values: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("Keyframes must have at least one keyframe")
+	}
+	times := make([]float64, len(keys))
+	values := make([][]float64, len(keys))
+	_, isList := keys[0].Value.([]interface{})
+	for i, k := range keys {
+		var err error
+		if times[i], err = vars.number(k.Time); err != nil {
+			return nil, fmt.Errorf("Time of keyframe %d: %w", i, err)
+		}
+		if i > 0 && times[i] <= times[i-1] {
+			return nil, fmt.Errorf("Keyframe %d must come after keyframe %d", i, i-1)
+		}
+		list, ok := k.Value.([]interface{})
+		if !ok {
+			list = []interface{}{k.Value}
+		}
+		if ok != isList || (i > 0 && len(list) != len(values[0])) {
+			return nil, fmt.Errorf("Keyframe %d has a different number of values than keyframe 0", i)
+		}
+		values[i] = make([]float64, len(list))
+		for j := range list {
+			if values[i][j], err = vars.number(list[j]); err != nil {
+				return nil, fmt.Errorf("Value of keyframe %d: %w", i, err)
+			}
+		}
+		if _, ok := easings[k.Easing]; !ok && k.Easing != "" {
+			return nil, fmt.Errorf("Unknown easing %s in keyframe %d", k.Easing, i)
+		}
+	}
+
+	now := vars[timeVariable]
+	result := values[len(values)-1]
+	switch {
+	case now <= times[0]:
+		result = values[0]
+	case now < times[len(times)-1]:
+		next := 1
+		for times[next] <= now {
+			next++
+		}
+		ease := easings[keys[next].Easing]
+		if ease == nil {
+			ease = easings[lineareasing]
+		}
+		u := ease((now - times[next-1]) / (times[next] - times[next-1]))
+		result = make([]float64, len(values[next]))
+		for j := range result {
+			result[j] = values[next-1][j] + u*(values[next][j]-values[next-1][j])
+		}
+	}
+	if !isList {
+		return result[0], nil
+	}
+	retval := make([]interface{}, len(result))
+	for j := range result {
+		retval[j] = result[j]
+	}
+	return retval, nil
+}
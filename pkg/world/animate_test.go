@@ -0,0 +1,301 @@
+package world
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v2"
+
+	"github.com/liorokman/raytrace/pkg/fixtures"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+func TestKeyframes(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	var raw interface{}
+	g.Expect(yaml.Unmarshal([]byte(`
+position:
+  keyframes:
+  - time: 1
+    value: [ 0, 0, 0 ]
+  - time: 3
+    value: [ 4, 2*height, 0 ]
+  - time: 4
+    value: [ 4, 0, 0 ]
+    easing: easeinout
+size:
+  keyframes:
+  - time: 0
+    value: 1
+  - time: 1
+    value: 3
+    easing: easein
+`), &raw)).To(Succeed())
+
+	tests := []struct {
+		time     float64
+		position []interface{}
+		size     float64
+	}{
+		{0, []interface{}{0.0, 0.0, 0.0}, 1},
+		{0.5, []interface{}{0.0, 0.0, 0.0}, 1.5},
+		{2, []interface{}{2.0, 1.0, 0.0}, 3},
+		{3.5, []interface{}{4.0, 1.0, 0.0}, 3},
+		{3.25, []interface{}{4.0, 2 * (1 - 0.15625), 0.0}, 3},
+		{10, []interface{}{4.0, 0.0, 0.0}, 3},
+	}
+	for _, test := range tests {
+		vars := variables{timeVariable: test.time, "height": 1}
+		animated, err := vars.animate(raw)
+		g.Expect(err).To(BeNil())
+		m := animated.(map[interface{}]interface{})
+		g.Expect(m["position"]).To(HaveLen(3))
+		for i, v := range m["position"].([]interface{}) {
+			g.Expect(v).To(BeNumerically("~", test.position[i]), "time %g", test.time)
+		}
+		g.Expect(m["size"]).To(BeNumerically("~", test.size), "time %g", test.time)
+	}
+
+	for _, bad := range []string{
+		"keyframes: []",
+		"keyframes: 3",
+		"keyframes:\n- time: 1\n  value: 1\n- time: 1\n  value: 2\n",
+		"keyframes:\n- time: 0\n  value: [ 1, 2 ]\n- time: 1\n  value: [ 1, 2, 3 ]\n",
+		"keyframes:\n- time: 0\n  value: 1\n- time: 1\n  value: [ 1 ]\n",
+		"keyframes:\n- time: 0\n  value: 1\n- time: 1\n  value: 2\n  easing: bounce\n",
+		"keyframes:\n- time: soon\n  value: 1\n",
+	} {
+		var raw interface{}
+		g.Expect(yaml.Unmarshal([]byte(bad), &raw)).To(Succeed())
+		_, err := variables{}.animate(raw)
+		g.Expect(err).ToNot(BeNil(), bad)
+	}
+
+	a := Animation{Frames: 10, FPS: 25}
+	g.Expect(a.FrameTime(5)).To(Equal(0.2))
+	g.Expect(a.ShutterTime()).To(Equal(0.02))
+	g.Expect(Animation{}.FrameTime(12)).To(Equal(0.5))
+}
+
+const turntableScene = `
+animation:
+  frames: 48
+  fps: 24
+vars:
+  spin:
+    keyframes:
+    - time: 0
+      value: 0
+    - time: 2
+      value: 360
+camera:
+  hsize: 100
+  vsize: 50
+  fieldOfView: pi/3
+  from:
+    keyframes:
+    - time: 0
+      value: [ 0, 1.5, -5 ]
+    - time: 2
+      value: [ 0, 3.5, -5 ]
+  to: [ 0, 1, 0 ]
+  up: [ 0, 1, 0 ]
+fixtures:
+- type: pointlight
+  position: [ -10, 10 - time, -10 ]
+  color: [ 1, 1, 1 ]
+objects:
+- type: cube
+  transform:
+  - type: rotatey
+    params: [ spin deg ]
+  material:
+    pattern:
+      type: solid
+      colors:
+      - [ 1, 0, 0 ]
+    ambient:
+      keyframes:
+      - time: 0
+        value: 0.1
+      - time: 1
+        value: 0.5
+        easing: easeout
+`
+
+func TestAnimatedScene(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "scene.yaml")
+	g.Expect(os.WriteFile(filename, []byte(turntableScene), 0644)).To(Succeed())
+
+	w, cam, err := NewWorld(filename)
+	g.Expect(err).To(BeNil())
+	g.Expect(w.Animation).To(Equal(Animation{Frames: 48, FPS: 24}))
+	g.Expect(cam.From).To(Equal(Point{0, 1.5, -5}))
+
+	w, cam, err = NewWorldAt(filename, w.Animation.FrameTime(12))
+	g.Expect(err).To(BeNil())
+	g.Expect(cam.From).To(Equal(Point{0, 2, -5}))
+	g.Expect(w.Lights[0].(fixtures.PointLight).Position().Equals(tuple.NewPoint(-10, 9.5, -10))).To(BeTrue())
+	g.Expect(w.Shape(0).GetMaterial().Ambient()).To(BeNumerically("~", 0.5*(1-0.25)+0.1*0.25))
+
+	// Half way through the turntable, the cube has turned 180 degrees
+	w, _, err = NewWorldAt(filename, 1)
+	g.Expect(err).To(BeNil())
+	p := w.Shape(0).GetTransform().MultiplyTuple(tuple.NewPoint(1, 0, 0))
+	g.Expect(p.Equals(tuple.NewPoint(-1, 0, 0))).To(BeTrue())
+}
+
+func TestAnimationProblems(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := t.TempDir()
+	g.Expect(os.WriteFile(filepath.Join(dir, "animated.yaml"), []byte("animation:\n  frames: 2\n"), 0644)).To(Succeed())
+
+	tests := []struct {
+		scene string
+		file  string
+		line  int
+		path  string
+	}{
+		// Every keyframe is checked, not only the first one
+		{"objects:\n- type: sphere\n  material:\n    pattern:\n      type: solid\n      colors:\n      - [ 1, 1, 1 ]\n    ambient:\n      keyframes:\n      - time: 0\n        value: 0.5\n      - time: 1\n        value: 1.5\n", "scene.yaml", 20, "objects[0].material.ambient"},
+		{"objects:\n- type: sphere\n  transform:\n  - type: scale\n    params:\n      keyframes:\n      - time: 0\n        value: [ 1, 1, 1 ]\n      - time: 1\n        value: [ 1, 1 ]\n", "scene.yaml", 17, "objects[0].transform[0].params.keyframes[1].value"},
+		{"vars:\n  a:\n    keyframes:\n    - time: 1\n      value: 1\n    - time: 0.5\n      value: 2\n", "scene.yaml", 13, "vars.a.keyframes[1].time"},
+		{"vars:\n  a:\n    keyframes:\n    - time: 1\n      value: 1\n      easing: bounce\n", "scene.yaml", 13, "vars.a.keyframes[0].easing"},
+		{"vars:\n  a:\n    keyframes: []\n", "scene.yaml", 10, "vars.a.keyframes"},
+		{"vars:\n  a:\n    keyframes:\n    - value: 1\n", "scene.yaml", 11, "vars.a.keyframes[0]"},
+		{"vars:\n  time: 1\n", "scene.yaml", 9, "vars.time"},
+		{"animation:\n  frames: 0\n", "scene.yaml", 9, "animation.frames"},
+		{"animation:\n  fps: -24\n", "scene.yaml", 9, "animation.fps"},
+		{"include:\n- animated.yaml\n", "animated.yaml", 2, "animation"},
+	}
+	for _, test := range tests {
+		_, err := loadScene(g, dir, validCamera+test.scene)
+		var verr *ValidationError
+		g.Expect(errors.As(err, &verr)).To(BeTrue(), test.scene)
+		g.Expect(verr.Problems).To(HaveLen(1), test.scene)
+		g.Expect(filepath.Base(verr.Problems[0].File)).To(Equal(test.file), test.scene)
+		g.Expect(verr.Problems[0].Line).To(Equal(test.line), test.scene)
+		g.Expect(verr.Problems[0].Path).To(Equal(test.path), test.scene)
+		g.Expect(strings.Count(err.Error(), "\n")).To(Equal(0), test.scene)
+	}
+}
+
+func TestTimeDependentProblems(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := t.TempDir()
+
+	// Values that use the time are fine at the start of the animation, and are out of
+	// range or singular only at later frames
+	tests := []struct {
+		scene    string
+		expected string
+	}{
+		{"objects:\n- type: sphere\n  material:\n    pattern:\n      type: solid\n      colors:\n      - [ 1, 1, 1 ]\n    ambient: time/2\n", "objects[0].material.ambient"},
+		{"objects:\n- type: sphere\n  material:\n    pattern:\n      type: stripe\n      colors:\n      - [ 1, 1, 1 ]\n      - [ 0, 0, 0 ]\n      transform:\n      - type: scale\n        params: [ 1, 1, 5 - time ]\n", "objects[0].material.pattern.transform"},
+	}
+	for _, test := range tests {
+		filename := filepath.Join(dir, "scene.yaml")
+		g.Expect(os.WriteFile(filename, []byte(validCamera+test.scene), 0644)).To(Succeed())
+		_, _, err := NewWorldAt(filename, 0)
+		g.Expect(err).To(BeNil(), test.scene)
+		g.Expect(func() { _, _, err = NewWorldAt(filename, 5) }).ToNot(Panic(), test.scene)
+		var verr *ValidationError
+		g.Expect(errors.As(err, &verr)).To(BeTrue(), test.scene)
+		g.Expect(verr.Problems).To(HaveLen(1), test.scene)
+		g.Expect(verr.Problems[0].Path).To(Equal(test.expected), test.scene)
+	}
+
+	// The builder checks the values too, instead of panicking in the material builder
+	cache := newSceneCache()
+	cache.vars[timeVariable] = 5
+	solid := pattern{Type: "solid", Colors: []color{{1, 1, 1}}}
+	_, err := materialInput{Pattern: solid, Params: map[string]interface{}{ambient: "time/2"}}.toMaterial(cache)
+	g.Expect(err).To(MatchError("ambient: Material ambient must be between 0 and 1, not 2.5"))
+	_, err = materialInput{Pattern: solid, Params: map[string]interface{}{shininess: "-time"}}.toMaterial(cache)
+	g.Expect(err).To(MatchError("shininess: Material shininess must be at least 0, not -5"))
+	solid.Transform = []transform{{Type: "scale", Params: []float64{1, 1, 0}}}
+	_, err = materialInput{Pattern: solid}.toMaterial(cache)
+	g.Expect(err).To(MatchError("pattern.transform: The transform is singular, it can't be inverted"))
+}
+
+func TestMotionBlurScene(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := t.TempDir()
+	w, err := loadScene(g, dir, `
+camera:
+  hsize: 100
+  vsize: 50
+  fieldOfView: pi/3
+  from: [ 0, 1.5, -5 ]
+  to: [ 0, 1, 0 ]
+  up: [ 0, 1, 0 ]
+  motionBlur: true
+objects:
+- type: sphere
+  transform:
+  - type: translate
+    params: [ -1, 0, 0 ]
+  transformEnd:
+  - type: translate
+    params: [ 1, 0, 0 ]
+- type: cube
+  transform:
+  - type: rotatey
+    params: [ 0 ]
+  transformEnd:
+  - type: rotatey
+    params: [ 180deg ]
+- type: cube
+  transform:
+  - type: scale
+    params: [ 1, 2, 1 ]
+  transformEnd:
+  - type: translate
+    params: [ 0, 1, 0 ]
+  - type: scale
+    params: [ 1, 2, 1 ]
+`)
+	g.Expect(err).To(BeNil())
+	_, cam, err := NewWorld(filepath.Join(dir, "scene.yaml"))
+	g.Expect(err).To(BeNil())
+	g.Expect(cam.MotionBlur).To(BeTrue())
+
+	g.Expect(w.Shape(0).GetMotion()).To(HaveLen(motionSteps + 1))
+	g.Expect(w.Shape(2).GetMotion()).To(HaveLen(2))
+	// Rotations are interpolated by their angle, so half way through the cube has turned
+	// by 90 degrees
+	inv, err := w.Shape(1).GetInverseTransformAt(0.5)
+	g.Expect(err).To(BeNil())
+	g.Expect(inv.MultiplyTuple(tuple.NewPoint(1, 0, 0)).Equals(tuple.NewPoint(0, 0, 1))).To(BeTrue())
+
+	// Moving objects are saved with their end transform
+	data, err := MarshalWorld(w, cam)
+	g.Expect(err).To(BeNil())
+	g.Expect(string(data)).To(ContainSubstring("transformEnd"))
+	saved, err := loadScene(g, t.TempDir(), string(data))
+	g.Expect(err).To(BeNil())
+	motion := saved.Shape(2).GetMotion()
+	g.Expect(motion).ToNot(BeNil())
+	g.Expect(motion[len(motion)-1].Equals(w.Shape(2).GetMotion()[1])).To(BeTrue())
+
+	for _, test := range []struct {
+		scene string
+		path  string
+	}{
+		{"objects:\n- type: sphere\n  transformEnd:\n  - type: scale\n    params: [ 0, 1, 1 ]\n", "objects[0].transformEnd"},
+		{"  motionBlur: often\n", "camera.motionBlur"},
+	} {
+		_, err := loadScene(g, t.TempDir(), validCamera+test.scene)
+		var verr *ValidationError
+		g.Expect(errors.As(err, &verr)).To(BeTrue(), test.scene)
+		g.Expect(verr.Problems).To(HaveLen(1), test.scene)
+		g.Expect(verr.Problems[0].Path).To(Equal(test.path), test.scene)
+	}
+}
@@ -1,9 +1,13 @@
 package world
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math"
+	"os"
+	"path/filepath"
+	"slices"
 
 	"gopkg.in/yaml.v2"
 
@@ -12,9 +16,13 @@ import (
 	"github.com/liorokman/raytrace/pkg/matrix"
 	"github.com/liorokman/raytrace/pkg/shapes"
 	"github.com/liorokman/raytrace/pkg/tuple"
+	"github.com/liorokman/raytrace/pkg/utils"
 )
 
 type world struct {
+	Include   []string
+	Animation Animation
+	Define    []definition
 	Objects   []object
 	Fixtures  []fixture
 	Materials []materialInput
@@ -30,13 +38,30 @@ const (
 	cone     = "cone"
 	group    = "group"
 	triangle = "triangle"
+	mesh     = "mesh"
 	csg      = "csg"
+	torus    = "torus"
+	sdf      = "sdf"
 
 	// patterns
-	solid    = "solid"
-	gradient = "gradient"
-	ring     = "ring"
-	checkers = "checker"
+	solid       = "solid"
+	stripe      = "stripe"
+	gradient    = "gradient"
+	ring        = "ring"
+	checkers    = "checker"
+	texture     = "texture"
+	vertexcolor = "vertexcolor"
+
+	// texture mappings
+	shapemapping       = "shape"
+	sphericalmapping   = "spherical"
+	planarmapping      = "planar"
+	cylindricalmapping = "cylindrical"
+	cubemapping        = "cube"
+
+	// texture filters
+	nearestfilter  = "nearest"
+	bilinearfilter = "bilinear"
 
 	// translations
 	translate = "translate"
@@ -46,9 +71,14 @@ const (
 	rotatey   = "rotatey"
 	rotatez   = "rotatez"
 	shear     = "shear"
+	matrixop  = "matrix"
 
 	// fixtures
-	POINTLIGHT = "pointlight"
+	POINTLIGHT       = "pointlight"
+	AREALIGHT        = "arealight"
+	SPHERELIGHT      = "spherelight"
+	SPOTLIGHT        = "spotlight"
+	DIRECTIONALLIGHT = "directionallight"
 
 	// csg operations
 	unionop      = "union"
@@ -59,38 +89,155 @@ const (
 type Cam struct {
 	Hsize       uint32
 	Vsize       uint32
-	FieldOfView float64 `yaml:"fieldOfView"`
-	From        Point
-	To          Point
-	Up          Vector
+	FieldOfView float64     `yaml:"fieldOfView"`
+	From        Point       `yaml:",flow"`
+	To          Point       `yaml:",flow"`
+	Up          Vector      `yaml:",flow"`
+	Sampling    CamSampling `yaml:",omitempty"`
+	// Aperture is the radius of the lens, zero for a pinhole camera
+	Aperture float64 `yaml:",omitempty"`
+	// FocalDistance is the distance to the plane in focus, defaults to the distance
+	// between From and To
+	FocalDistance float64 `yaml:"focalDistance,omitempty"`
+	// MotionBlur blurs the objects that move while the shutter is open
+	MotionBlur bool `yaml:"motionBlur,omitempty"`
+}
+
+// check makes sure that the camera can see the scene
+func (c Cam) check() error {
+	if c.Hsize == 0 {
+		return at("hsize", fmt.Errorf("The camera must be at least one pixel wide"))
+	}
+	if c.Vsize == 0 {
+		return at("vsize", fmt.Errorf("The camera must be at least one pixel high"))
+	}
+	if c.FieldOfView <= 0 || c.FieldOfView >= math.Pi {
+		return at("fieldOfView", fmt.Errorf("The field of view must be between 0 and pi, not %g", c.FieldOfView))
+	}
+	forward := c.To.ToPoint().Subtract(c.From.ToPoint())
+	if forward.Magnitude() == 0 {
+		return at("to", fmt.Errorf("The camera can't look at the point it's at"))
+	}
+	if forward.Cross(c.Up.ToVector()).Magnitude() < utils.EPSILON {
+		return at("up", fmt.Errorf("The up vector can't be zero or parallel to the direction the camera looks in"))
+	}
+	return nil
+}
+
+// CamSampling describes how many rays are fired through every pixel
+type CamSampling struct {
+	Mode         string
+	Samples      int     `yaml:",omitempty"`
+	Threshold    float64 `yaml:",omitempty"`
+	Filter       string  `yaml:",omitempty"`
+	FilterRadius float64 `yaml:"filterRadius,omitempty"`
+	Seed         int64   `yaml:",omitempty"`
 }
 
 type fixture struct {
 	Type     string
-	Position Point `yaml:",flow"`
+	Position Point `yaml:",flow,omitempty"`
 	Color    color `yaml:",flow"`
+	// Area light
+	Corner Point  `yaml:",flow,omitempty"`
+	UVec   Vector `yaml:",flow,omitempty"`
+	VVec   Vector `yaml:",flow,omitempty"`
+	USteps int    `yaml:",omitempty"`
+	VSteps int    `yaml:",omitempty"`
+	// Sphere light
+	Radius  float64 `yaml:",omitempty"`
+	Samples int     `yaml:",omitempty"`
+	// Area and sphere lights
+	Jitter bool `yaml:",omitempty"`
+	// Spot and directional lights
+	Direction Vector `yaml:",flow,omitempty"`
+	// Spot light
+	InnerAngle float64 `yaml:"innerAngle,omitempty"`
+	OuterAngle float64 `yaml:"outerAngle,omitempty"`
+	// Point and spot lights, [ constant, linear, quadratic ]
+	Attenuation []float64 `yaml:",flow,omitempty"`
 }
 
-func (f fixture) toFixture() (fixtures.PointLight, error) {
+func (f fixture) attenuation() (fixtures.Attenuation, error) {
+	if len(f.Attenuation) == 0 {
+		return fixtures.NoAttenuation(), nil
+	}
+	if len(f.Attenuation) != 3 {
+		return fixtures.Attenuation{}, fmt.Errorf("Attenuation requires 3 values: constant, linear and quadratic")
+	}
+	for _, v := range f.Attenuation {
+		if v < 0 {
+			return fixtures.Attenuation{}, fmt.Errorf("Attenuation values can't be negative")
+		}
+	}
+	if f.Attenuation[0] == 0 && f.Attenuation[1] == 0 && f.Attenuation[2] == 0 {
+		return fixtures.Attenuation{}, fmt.Errorf("At least one attenuation value must be positive")
+	}
+	return fixtures.Attenuation{Constant: f.Attenuation[0], Linear: f.Attenuation[1], Quadratic: f.Attenuation[2]}, nil
+}
+
+func (f fixture) toFixture() (fixtures.Light, error) {
+	if f.Color[0] < 0 || f.Color[1] < 0 || f.Color[2] < 0 {
+		return nil, at("color", fmt.Errorf("Light color values can't be negative"))
+	}
 	switch f.Type {
 	case POINTLIGHT:
-		return fixtures.NewPointLight(f.Position.ToPoint(), f.Color.toColor()), nil
+		a, err := f.attenuation()
+		if err != nil {
+			return nil, err
+		}
+		return fixtures.NewPointLight(f.Position.ToPoint(), f.Color.toColor()).WithAttenuation(a), nil
+	case SPOTLIGHT:
+		a, err := f.attenuation()
+		if err != nil {
+			return nil, err
+		}
+		if f.Direction.ToVector().Magnitude() == 0 {
+			return nil, fmt.Errorf("Spot light requires a non-zero direction")
+		}
+		if f.InnerAngle < 0 || f.OuterAngle < f.InnerAngle || f.OuterAngle > math.Pi {
+			return nil, fmt.Errorf("Spot light angles must satisfy 0 <= innerAngle <= outerAngle <= pi")
+		}
+		return fixtures.NewSpotLight(f.Position.ToPoint(), f.Direction.ToVector(), f.InnerAngle, f.OuterAngle, f.Color.toColor()).WithAttenuation(a), nil
+	case DIRECTIONALLIGHT:
+		if f.Direction.ToVector().Magnitude() == 0 {
+			return nil, fmt.Errorf("Directional light requires a non-zero direction")
+		}
+		return fixtures.NewDirectionalLight(f.Direction.ToVector(), f.Color.toColor()), nil
+	case AREALIGHT:
+		if f.USteps < 1 || f.VSteps < 1 {
+			return nil, fmt.Errorf("Area light requires usteps and vsteps of at least 1")
+		}
+		if f.UVec.ToVector().Magnitude() == 0 || f.VVec.ToVector().Magnitude() == 0 {
+			return nil, fmt.Errorf("Area light requires non-zero uvec and vvec")
+		}
+		return fixtures.NewAreaLight(f.Corner.ToPoint(), f.UVec.ToVector(), f.USteps, f.VVec.ToVector(), f.VSteps, f.Color.toColor(), f.Jitter), nil
+	case SPHERELIGHT:
+		if f.Radius < 0 {
+			return nil, fmt.Errorf("Sphere light radius can't be negative")
+		}
+		samples := f.Samples
+		if samples == 0 {
+			samples = 1
+		} else if samples < 0 {
+			return nil, fmt.Errorf("Sphere light samples can't be negative")
+		}
+		return fixtures.NewSphereLight(f.Position.ToPoint(), f.Radius, samples, f.Color.toColor(), f.Jitter), nil
 	default:
-		return fixtures.PointLight{}, fmt.Errorf("Unsupported fixture %s", f.Type)
+		return nil, fmt.Errorf("Unsupported fixture %s", f.Type)
 	}
 }
 
-func extractFloatSliceParam(bag map[string]interface{}, name string) ([]float64, bool, error) {
+func extractFloatSliceParam(bag map[string]interface{}, vars variables, name string) ([]float64, bool, error) {
 	if val, ok := bag[name]; ok {
 		if arr, ok := val.([]interface{}); ok {
 			r := make([]float64, len(arr))
 			for i := range arr {
-				switch fval := arr[i].(type) {
-				case float64:
-					r[i] = fval
-				case int:
-					r[i] = float64(fval)
+				fval, err := vars.number(arr[i])
+				if err != nil {
+					return []float64{}, false, fmt.Errorf("Item %d of %s: %w", i, name, err)
 				}
+				r[i] = fval
 			}
 			return r, true, nil
 		} else {
@@ -101,6 +248,59 @@ func extractFloatSliceParam(bag map[string]interface{}, name string) ([]float64,
 	}
 }
 
+// extractVertexParams reads a parameter of the given size for each vertex of a triangle.
+// Either all of the parameters are given, or none of them.
+func extractVertexParams(bag map[string]interface{}, vars variables, size int, names ...string) ([][]float64, bool, error) {
+	retval := make([][]float64, 0, len(names))
+	for _, name := range names {
+		val, ok, err := extractFloatSliceParam(bag, vars, name)
+		if err != nil {
+			return nil, false, err
+		} else if !ok {
+			continue
+		}
+		if len(val) != size {
+			return nil, false, fmt.Errorf("%s must have %d values, not %d", name, size, len(val))
+		}
+		retval = append(retval, val)
+	}
+	if len(retval) == 0 {
+		return nil, false, nil
+	} else if len(retval) != len(names) {
+		return nil, false, fmt.Errorf("Either all or none of %v must be given", names)
+	}
+	return retval, true, nil
+}
+
+// extractFloatListParam reads a list of float arrays. Every array must have one of the
+// given sizes.
+func extractFloatListParam(bag map[string]interface{}, vars variables, name string, sizes ...int) ([][]float64, bool, error) {
+	val, ok := bag[name]
+	if !ok {
+		return nil, false, nil
+	}
+	arr, ok := val.([]interface{})
+	if !ok {
+		return nil, false, fmt.Errorf("%s found but is not an array", name)
+	}
+	retval := make([][]float64, len(arr))
+	for i := range arr {
+		item, ok := arr[i].([]interface{})
+		if !ok || !slices.Contains(sizes, len(item)) {
+			return nil, false, fmt.Errorf("Item %d of %s must be an array of %v values", i, name, sizes)
+		}
+		retval[i] = make([]float64, len(item))
+		for j := range item {
+			fval, err := vars.number(item[j])
+			if err != nil {
+				return nil, false, fmt.Errorf("Item %d of %s has a value that isn't a number: %w", i, name, err)
+			}
+			retval[i][j] = fval
+		}
+	}
+	return retval, true, nil
+}
+
 func sliceToPoint(s []float64) (Point, error) {
 
 	if len(s) == 3 {
@@ -109,21 +309,22 @@ func sliceToPoint(s []float64) (Point, error) {
 	return Point{}, fmt.Errorf("Mismatched number of indices for a point")
 }
 
-func extractFloatParam(bag map[string]interface{}, name string) (float64, bool, error) {
+func extractFloatParam(bag map[string]interface{}, vars variables, name string) (float64, bool, error) {
 	if val, ok := bag[name]; ok {
-		switch fval := val.(type) {
-		case float64:
-			return fval, true, nil
-		case int:
-			return float64(fval), true, nil
+		fval, err := vars.number(val)
+		if err != nil {
+			return 0, false, fmt.Errorf("%s found but is not a number: %w", name, err)
 		}
-		return 0, false, fmt.Errorf("%s found but is not a float64 value", name)
+		return fval, true, nil
 	} else {
 		return 0, false, nil
 	}
 }
 
-func newShape(sType string, params map[string]interface{}, cache map[string]material.Material) (shapes.Shape, error) {
+// errUnknownShape is returned by newShape for types that aren't shapes
+var errUnknownShape = errors.New("Unknown shape")
+
+func newShape(sType string, params map[string]interface{}, cache *sceneCache) (shapes.Shape, error) {
 	switch sType {
 	case sphere:
 		return shapes.NewSphere(), nil
@@ -132,7 +333,7 @@ func newShape(sType string, params map[string]interface{}, cache map[string]mate
 	case cube:
 		return shapes.NewCube(), nil
 	case triangle:
-		p1Raw, ok, err := extractFloatSliceParam(params, "p1")
+		p1Raw, ok, err := extractFloatSliceParam(params, cache.variables(), "p1")
 		if err != nil {
 			return nil, err
 		} else if !ok {
@@ -142,7 +343,7 @@ func newShape(sType string, params map[string]interface{}, cache map[string]mate
 		if err != nil {
 			return nil, err
 		}
-		p2Raw, ok, err := extractFloatSliceParam(params, "p2")
+		p2Raw, ok, err := extractFloatSliceParam(params, cache.variables(), "p2")
 		if err != nil {
 			return nil, err
 		} else if !ok {
@@ -153,7 +354,7 @@ func newShape(sType string, params map[string]interface{}, cache map[string]mate
 			return nil, err
 		}
 
-		p3Raw, ok, err := extractFloatSliceParam(params, "p3")
+		p3Raw, ok, err := extractFloatSliceParam(params, cache.variables(), "p3")
 		if err != nil {
 			return nil, err
 		} else if !ok {
@@ -163,34 +364,61 @@ func newShape(sType string, params map[string]interface{}, cache map[string]mate
 		if err != nil {
 			return nil, err
 		}
-		return shapes.NewTriangle(p1.ToPoint(), p2.ToPoint(), p3.ToPoint()), nil
+		normals, smooth, err := extractVertexParams(params, cache.variables(), 3, "n1", "n2", "n3")
+		if err != nil {
+			return nil, err
+		}
+		uvs, textured, err := extractVertexParams(params, cache.variables(), 2, "uv1", "uv2", "uv3")
+		if err != nil {
+			return nil, err
+		}
+		var n [3]tuple.Tuple
+		for i := range normals {
+			n[i] = tuple.NewVector(normals[i][0], normals[i][1], normals[i][2])
+		}
+		var uv [3]shapes.TextureCoord
+		for i := range uvs {
+			uv[i] = shapes.TextureCoord{U: uvs[i][0], V: uvs[i][1]}
+		}
+		switch {
+		case smooth && textured:
+			return shapes.NewTexturedSmoothTriangle(p1.ToPoint(), p2.ToPoint(), p3.ToPoint(), n[0], n[1], n[2], uv[0], uv[1], uv[2]), nil
+		case smooth:
+			return shapes.NewSmoothTriangle(p1.ToPoint(), p2.ToPoint(), p3.ToPoint(), n[0], n[1], n[2]), nil
+		case textured:
+			return shapes.NewTexturedTriangle(p1.ToPoint(), p2.ToPoint(), p3.ToPoint(), uv[0], uv[1], uv[2]), nil
+		default:
+			return shapes.NewTriangle(p1.ToPoint(), p2.ToPoint(), p3.ToPoint()), nil
+		}
+	case mesh:
+		return newMesh(params, cache.variables())
+	case instance:
+		return cache.instance(params)
 
 	case csg:
 		var left, right shapes.Shape
 		var csgop shapes.CSGOp
 		var err error
 		if val, ok := params["left"]; ok {
-			asYaml, _ := yaml.Marshal(val)
 			var content object = object{}
-			if err := yaml.Unmarshal(asYaml, &content); err != nil {
-				return nil, err
+			if err := cache.variables().decode(val, &content); err != nil {
+				return nil, at("left", err)
 			}
 			left, err = translater(content, cache)
 			if err != nil {
-				return nil, err
+				return nil, at("left", err)
 			}
 		} else {
 			return nil, fmt.Errorf("A CSG must have a 'left' object")
 		}
 		if val, ok := params["right"]; ok {
-			asYaml, _ := yaml.Marshal(val)
 			var content object = object{}
-			if err := yaml.Unmarshal(asYaml, &content); err != nil {
-				return nil, err
+			if err := cache.variables().decode(val, &content); err != nil {
+				return nil, at("right", err)
 			}
 			right, err = translater(content, cache)
 			if err != nil {
-				return nil, err
+				return nil, at("right", err)
 			}
 		} else {
 			return nil, fmt.Errorf("A CSG must have a 'right' object")
@@ -204,7 +432,7 @@ func newShape(sType string, params map[string]interface{}, cache map[string]mate
 			case intersectop:
 				csgop = shapes.IntersectOp
 			default:
-				return nil, fmt.Errorf("Unsupported operation %s", op)
+				return nil, at("operation", fmt.Errorf("Unsupported operation %s", op))
 			}
 		} else {
 			return nil, fmt.Errorf("A CSG must have an 'operation'")
@@ -213,15 +441,14 @@ func newShape(sType string, params map[string]interface{}, cache map[string]mate
 	case group:
 		g := shapes.NewGroup()
 		if val, ok := params["content"]; ok {
-			asYaml, _ := yaml.Marshal(val)
 			var content []object = []object{}
-			if err := yaml.Unmarshal(asYaml, &content); err != nil {
-				return nil, err
+			if err := cache.variables().decode(val, &content); err != nil {
+				return nil, at("content", err)
 			}
-			for _, o := range content {
+			for i, o := range content {
 				s, err := translater(o, cache)
 				if err != nil {
-					return nil, err
+					return nil, at(index("content", i), err)
 				}
 				if _, err = shapes.Connect(g, s); err != nil {
 					return nil, err
@@ -231,12 +458,22 @@ func newShape(sType string, params map[string]interface{}, cache map[string]mate
 			if strVal, ok := val.(string); ok {
 				objIn := newObjReader()
 				if err := objIn.ReadObj(strVal); err != nil {
-					return nil, err
+					return nil, at("objfile", err)
 				}
 				return objIn.AsGroup(), nil
 			} else {
 				return nil, fmt.Errorf("group parameter objfile isn't a string")
 			}
+		} else if val, ok := params["meshfile"]; ok {
+			if strVal, ok := val.(string); ok {
+				s, err := readMeshFile(strVal)
+				if err != nil {
+					return nil, at("meshfile", err)
+				}
+				return s, nil
+			} else {
+				return nil, fmt.Errorf("group parameter meshfile isn't a string")
+			}
 		}
 		return g, nil
 	case cone, cylinder: // These two shapes have the same parameters
@@ -250,26 +487,128 @@ func newShape(sType string, params map[string]interface{}, cache map[string]mate
 				return nil, fmt.Errorf("Closed param for cylinder/cone should be a bool")
 			}
 		}
-		val, ok, err := extractFloatParam(params, "minimum")
+		val, ok, err := extractFloatParam(params, cache.variables(), "minimum")
 		if err != nil {
-			return nil, err
+			return nil, at("minimum", err)
 		} else if ok {
 			min = val
 		}
-		val, ok, err = extractFloatParam(params, "maximum")
+		val, ok, err = extractFloatParam(params, cache.variables(), "maximum")
 		if err != nil {
-			return nil, err
+			return nil, at("maximum", err)
 		} else if ok {
 			max = val
 		}
+		if max < min {
+			return nil, at("maximum", fmt.Errorf("The maximum of a %s can't be smaller than its minimum", sType))
+		}
 		if sType == cone {
 			return shapes.NewConstrainedCone(min, max, closed), nil
 		} else {
 			return shapes.NewConstrainedCylinder(min, max, closed), nil
 		}
+	case torus:
+		major, minor := 1.0, 0.25
+		val, ok, err := extractFloatParam(params, cache.variables(), "major")
+		if err != nil {
+			return nil, at("major", err)
+		} else if ok {
+			major = val
+		}
+		val, ok, err = extractFloatParam(params, cache.variables(), "minor")
+		if err != nil {
+			return nil, at("minor", err)
+		} else if ok {
+			minor = val
+		}
+		if major < 0 {
+			return nil, at("major", fmt.Errorf("torus major radius can't be negative"))
+		}
+		if minor <= 0 {
+			return nil, at("minor", fmt.Errorf("torus minor radius must be positive"))
+		}
+		return shapes.NewTorus(major, minor), nil
+	case sdf:
+		val, ok := params["node"]
+		if !ok {
+			return nil, fmt.Errorf("An sdf must have a 'node'")
+		}
+		var node sdfNode
+		if err := cache.variables().decode(val, &node); err != nil {
+			return nil, at("node", err)
+		}
+		field, err := node.toSDF()
+		if err != nil {
+			return nil, at("node", err)
+		}
+		return shapes.NewImplicit(field), nil
 	default:
-		return nil, fmt.Errorf("Unknown shape %s", sType)
+		return nil, fmt.Errorf("%w %s", errUnknownShape, sType)
+	}
+}
+
+// newMesh creates a mesh from its vertices and faces. Faces refer to the vertices, normals
+// and texture coordinates by their index, starting at 0.
+func newMesh(params map[string]interface{}, vars variables) (shapes.Shape, error) {
+	vertices, ok, err := extractFloatListParam(params, vars, "vertices", 3)
+	if err != nil {
+		return nil, at("vertices", err)
+	} else if !ok {
+		return nil, fmt.Errorf("A mesh must have 'vertices'")
+	}
+	normals, _, err := extractFloatListParam(params, vars, "normals", 3)
+	if err != nil {
+		return nil, at("normals", err)
+	}
+	uvs, _, err := extractFloatListParam(params, vars, "uvs", 2)
+	if err != nil {
+		return nil, at("uvs", err)
+	}
+	colors, _, err := extractFloatListParam(params, vars, "colors", 3)
+	if err != nil {
+		return nil, at("colors", err)
+	}
+	faces, ok, err := extractFloatListParam(params, vars, "faces", 3, 9)
+	if err != nil {
+		return nil, at("faces", err)
+	} else if !ok {
+		return nil, fmt.Errorf("A mesh must have 'faces'")
+	}
+
+	meshVertices := make([]tuple.Tuple, len(vertices))
+	for i, v := range vertices {
+		meshVertices[i] = tuple.NewPoint(v[0], v[1], v[2])
 	}
+	meshNormals := make([]tuple.Tuple, len(normals))
+	for i, n := range normals {
+		meshNormals[i] = tuple.NewVector(n[0], n[1], n[2])
+	}
+	meshUVs := make([]shapes.TextureCoord, len(uvs))
+	for i, uv := range uvs {
+		meshUVs[i] = shapes.TextureCoord{U: uv[0], V: uv[1]}
+	}
+	meshColors := make([]tuple.Color, len(colors))
+	for i, c := range colors {
+		meshColors[i] = tuple.NewColor(c[0], c[1], c[2])
+	}
+	meshFaces := make([]shapes.MeshFace, len(faces))
+	for i, f := range faces {
+		for j, idx := range f {
+			if idx != math.Trunc(idx) {
+				return nil, at(index("faces", i), fmt.Errorf("Face %d has an index that isn't an integer", i))
+			}
+			// Missing normals and texture coordinates are given as -1
+			if j >= 3 && idx < -1 {
+				return nil, at(index("faces", i), fmt.Errorf("Normal and texture coordinate indices must be -1 or more"))
+			}
+		}
+		meshFaces[i] = shapes.NewMeshFace(int(f[0]), int(f[1]), int(f[2]))
+		if len(f) == 9 {
+			meshFaces[i].Normals = [3]int{int(f[3]), int(f[4]), int(f[5])}
+			meshFaces[i].UVs = [3]int{int(f[6]), int(f[7]), int(f[8])}
+		}
+	}
+	return shapes.NewColoredMesh(meshVertices, meshColors, meshNormals, meshUVs, meshFaces)
 }
 
 const (
@@ -280,6 +619,7 @@ const (
 	reflective      = "reflective"
 	transparency    = "transparency"
 	refractiveindex = "refractiveIndex"
+	emissive        = "emissive"
 
 	defaultmaterial = "default"
 	glassmaterial   = "glass"
@@ -290,91 +630,89 @@ type materialInput struct {
 	Params  map[string]interface{} `yaml:",inline"`
 }
 
-func (m materialInput) toMaterial(cache map[string]material.Material) (material.Material, error) {
+func (m materialInput) toMaterial(cache *sceneCache) (material.Material, error) {
+	vars := cache.variables()
 	mb := material.NewBuilder(material.Default())
 	if matType, ok := m.Params["preset"]; ok {
-		if str, ok := matType.(string); ok {
-			switch str {
-			case defaultmaterial:
-				mb = material.NewBuilder(material.Default())
-			case glassmaterial:
-				mb = material.NewBuilder(material.Glass())
-			default:
-				if cache != nil {
-					if cached, ok := cache[str]; ok {
-						return cached, nil
-					}
-				}
-				mb = material.NewBuilder(material.Default())
+		str, ok := matType.(string)
+		if !ok {
+			return material.Material{}, at("preset", fmt.Errorf("The preset must be a string"))
+		}
+		switch str {
+		case defaultmaterial:
+			mb = material.NewBuilder(material.Default())
+		case glassmaterial:
+			mb = material.NewBuilder(material.Glass())
+		default:
+			cached, ok := cache.material(str)
+			if !ok {
+				return material.Material{}, at("preset", fmt.Errorf("Unknown preset '%s', must be default, glass or the name of a material defined above", str))
 			}
+			return cached, nil
 		}
 	}
 	{
 		pat, err := m.Pattern.toPattern()
 		if err != nil {
-			return material.Material{}, err
+			return material.Material{}, at("pattern", err)
 		}
-		finalTransform := matrix.NewIdentity()
-		for _, t := range m.Pattern.Transform {
-			if mat, err := t.toMatrix(); err != nil {
-				return material.Material{}, err
-			} else {
-				finalTransform = finalTransform.Multiply(mat)
-			}
+		finalTransform, err := cache.toInvertibleMatrix(m.Pattern.Transform)
+		if err != nil {
+			return material.Material{}, at(join("pattern", "transform"), err)
 		}
 		pat = pat.WithTransform(finalTransform)
 		mb = mb.WithPattern(pat)
 	}
 	for k := range m.Params {
+		// The material builder panics on values out of range, so they're checked here
+		// first. Expressions can make any value out of range, e.g. at a later frame.
+		var set func(float64) *material.MaterialBuilder
+		min, max := 0.0, 1.0
 		switch k {
 		case ambient:
-			if val, ok, err := extractFloatParam(m.Params, ambient); err != nil {
-				return material.Material{}, err
-			} else if ok {
-				mb.WithAmbient(val)
-			}
+			set = mb.WithAmbient
 		case diffuse:
-			if val, ok, err := extractFloatParam(m.Params, diffuse); err != nil {
-				return material.Material{}, err
-			} else if ok {
-				mb.WithDiffuse(val)
-			}
+			set = mb.WithDiffuse
 		case specular:
-			if val, ok, err := extractFloatParam(m.Params, specular); err != nil {
-				return material.Material{}, err
-			} else if ok {
-				mb.WithSpecular(val)
-			}
-		case shininess:
-			if val, ok, err := extractFloatParam(m.Params, shininess); err != nil {
-				return material.Material{}, err
-			} else if ok {
-				mb.WithShininess(val)
-			}
+			set = mb.WithSpecular
 		case reflective:
-			if val, ok, err := extractFloatParam(m.Params, reflective); err != nil {
-				return material.Material{}, err
-			} else if ok {
-				mb.WithReflective(val)
-			}
+			set = mb.WithReflective
+		case shininess:
+			set, max = mb.WithShininess, math.Inf(1)
 		case transparency:
-			if val, ok, err := extractFloatParam(m.Params, transparency); err != nil {
-				return material.Material{}, err
-			} else if ok {
-				mb.WithTransparency(val)
-			}
+			set, max = mb.WithTransparency, math.Inf(1)
 		case refractiveindex:
-			if val, ok, err := extractFloatParam(m.Params, refractiveindex); err != nil {
-				return material.Material{}, err
+			set, max = mb.WithRefractiveIndex, math.Inf(1)
+		case emissive:
+			if val, ok, err := extractFloatSliceParam(m.Params, vars, emissive); err != nil {
+				return material.Material{}, at(emissive, err)
 			} else if ok {
-				mb.WithRefractiveIndex(val)
+				if len(val) != 3 || val[0] < 0 || val[1] < 0 || val[2] < 0 {
+					return material.Material{}, at(emissive, fmt.Errorf("Emissive must be a non-negative [r, g, b] color"))
+				}
+				mb.WithEmissive(tuple.NewColor(val[0], val[1], val[2]))
 			}
+			continue
+		default:
+			continue
 		}
-	}
-	if cache != nil {
-		if cacheName, ok := m.Params["name"]; ok {
-			cache[fmt.Sprintf("%s", cacheName)] = mb.Build()
+		val, ok, err := extractFloatParam(m.Params, vars, k)
+		if err != nil {
+			return material.Material{}, at(k, err)
 		}
+		if !ok {
+			continue
+		}
+		if val < min || val > max || math.IsNaN(val) {
+			if math.IsInf(max, 1) {
+				return material.Material{}, at(k, fmt.Errorf("Material %s must be at least %g, not %g", k, min, val))
+			}
+			return material.Material{}, at(k, fmt.Errorf("Material %s must be between %g and %g, not %g", k, min, max, val))
+		}
+		set(val)
+	}
+	if cacheName, ok := m.Params["name"]; ok {
+		cache.setMaterial(fmt.Sprintf("%s", cacheName), mb.Build())
 	}
 
 	return mb.Build(), nil
@@ -382,8 +720,47 @@ func (m materialInput) toMaterial(cache map[string]material.Material) (material.
 
 type pattern struct {
 	Type      string
-	Colors    []color     `yaml:",flow"`
-	Transform []transform `yaml:",flow"`
+	Colors    []color     `yaml:",flow,omitempty"`
+	Transform []transform `yaml:",flow,omitempty"`
+	// Texture patterns
+	File    string `yaml:",omitempty"`
+	Mapping string `yaml:",omitempty"`
+	Filter  string `yaml:",omitempty"`
+}
+
+func (p pattern) toTexturePattern() (material.Pattern, error) {
+	if p.File == "" {
+		return material.Pattern{}, fmt.Errorf("Texture pattern requires a file")
+	}
+	var mapping material.UVMapping
+	switch p.Mapping {
+	case "", shapemapping:
+		mapping = material.ShapeMapping
+	case sphericalmapping:
+		mapping = material.SphericalMapping
+	case planarmapping:
+		mapping = material.PlanarMapping
+	case cylindricalmapping:
+		mapping = material.CylindricalMapping
+	case cubemapping:
+		mapping = material.CubeMapping
+	default:
+		return material.Pattern{}, fmt.Errorf("Unrecognized texture mapping %s", p.Mapping)
+	}
+	var filter material.TextureFilter
+	switch p.Filter {
+	case "", bilinearfilter:
+		filter = material.BilinearFilter
+	case nearestfilter:
+		filter = material.NearestFilter
+	default:
+		return material.Pattern{}, fmt.Errorf("Unrecognized texture filter %s", p.Filter)
+	}
+	tex, err := material.LoadTexture(p.File)
+	if err != nil {
+		return material.Pattern{}, err
+	}
+	return material.NewTextureMapPattern(tex, mapping, filter), nil
 }
 
 type color [3]float64
@@ -398,12 +775,22 @@ func (c Point) ToPoint() tuple.Tuple {
 	return tuple.NewPoint(c[0], c[1], c[2])
 }
 
+// IsZero lets fields marked with omitempty leave out the origin
+func (c Point) IsZero() bool {
+	return c == Point{}
+}
+
 type Vector [3]float64
 
 func (c Vector) ToVector() tuple.Tuple {
 	return tuple.NewVector(c[0], c[1], c[2])
 }
 
+// IsZero lets fields marked with omitempty leave out the zero vector
+func (c Vector) IsZero() bool {
+	return c == Vector{}
+}
+
 func (p pattern) toPattern() (material.Pattern, error) {
 	switch p.Type {
 	case solid:
@@ -411,6 +798,11 @@ func (p pattern) toPattern() (material.Pattern, error) {
 			return material.Pattern{}, fmt.Errorf("Solid pattern requires exactly one parameter. Have %d parameters.", len(p.Colors))
 		}
 		return material.NewSolidPattern(p.Colors[0].toColor()), nil
+	case stripe:
+		if len(p.Colors) != 2 {
+			return material.Pattern{}, fmt.Errorf("Stripe pattern requires exactly two parameters. Have %d parameters.", len(p.Colors))
+		}
+		return material.NewStripePattern(p.Colors[0].toColor(), p.Colors[1].toColor()), nil
 	case gradient:
 		if len(p.Colors) != 2 {
 			return material.Pattern{}, fmt.Errorf("Gradient pattern requires exactly two parameters. Have %d parameters.", len(p.Colors))
@@ -426,6 +818,13 @@ func (p pattern) toPattern() (material.Pattern, error) {
 			return material.Pattern{}, fmt.Errorf("Checkers pattern requires exactly two parameters. Have %d parameters.", len(p.Colors))
 		}
 		return material.NewCheckerPattern(p.Colors[0].toColor(), p.Colors[1].toColor()), nil
+	case texture:
+		return p.toTexturePattern()
+	case vertexcolor:
+		if len(p.Colors) != 1 {
+			return material.Pattern{}, fmt.Errorf("Vertex color pattern requires exactly one parameter. Have %d parameters.", len(p.Colors))
+		}
+		return material.NewVertexColorPattern(p.Colors[0].toColor()), nil
 	default:
 		return material.Pattern{}, fmt.Errorf("Unrecognized pattern %s", p.Type)
 	}
@@ -434,13 +833,18 @@ func (p pattern) toPattern() (material.Pattern, error) {
 type object struct {
 	Type      string      `yaml:"type"`
 	Transform []transform `yaml:",flow"`
-	Material  *materialInput
-	Params    map[string]interface{} `yaml:"params,omitempty"`
+	// TransformEnd is where the object is when the shutter closes, for motion blur. The
+	// object moves there from Transform while the shutter is open.
+	TransformEnd []transform `yaml:"transformEnd,flow,omitempty"`
+	Material     *materialInput
+	Params       map[string]interface{} `yaml:"params,omitempty"`
 }
 
 type transform struct {
-	Type   string
-	Params []float64 `yaml:",flow"`
+	Type   string    `yaml:",omitempty"`
+	Params []float64 `yaml:",flow,omitempty"`
+	// Use is the name of a transform from the define section, instead of a type and params
+	Use string `yaml:",omitempty"`
 }
 
 func (t transform) toMatrix() (matrix.Matrix, error) {
@@ -480,69 +884,183 @@ func (t transform) toMatrix() (matrix.Matrix, error) {
 			return matrix.Matrix{}, fmt.Errorf("Shear transform requires (xy, xz, yx, yz, zx, zy) parameters. Have %d params instead.", len(t.Params))
 		}
 		return matrix.NewShear(t.Params[0], t.Params[1], t.Params[2], t.Params[3], t.Params[4], t.Params[5]), nil
+	case matrixop:
+		if len(t.Params) != 16 {
+			return matrix.Matrix{}, fmt.Errorf("Matrix transform requires the 16 values of a 4x4 matrix, row by row. Have %d params instead.", len(t.Params))
+		}
+		m := matrix.New(4, 4)
+		m.Fill(t.Params)
+		return m, nil
 	default:
 		return matrix.Matrix{}, fmt.Errorf("Unsupported transform '%s'", t.Type)
 	}
 }
 
-func translater(o object, cache map[string]material.Material) (shapes.Shape, error) {
+func translater(o object, cache *sceneCache) (shapes.Shape, error) {
 	s, err := newShape(o.Type, o.Params, cache)
+	if errors.Is(err, errUnknownShape) {
+		return nil, at("type", err)
+	} else if err != nil {
+		return nil, at("params", err)
+	}
+	finalTransform, err := cache.toInvertibleMatrix(o.Transform)
 	if err != nil {
-		return nil, err
+		return nil, at("transform", err)
 	}
-	finalTransform := matrix.NewIdentity()
-	for _, t := range o.Transform {
-		if mat, err := t.toMatrix(); err != nil {
-			return nil, err
-		} else {
-			finalTransform = finalTransform.Multiply(mat)
+	if len(o.TransformEnd) > 0 {
+		if _, err := cache.toInvertibleMatrix(o.TransformEnd); err != nil {
+			return nil, at("transformEnd", err)
+		}
+		motion, err := cache.toMotion(o.Transform, o.TransformEnd)
+		if err != nil {
+			return nil, at("transformEnd", err)
 		}
+		s = s.WithMotion(motion...)
+	} else {
+		s = s.WithTransform(finalTransform)
 	}
-	s = s.WithTransform(finalTransform)
 	if o.Material != nil {
 		mat, err := o.Material.toMaterial(cache)
 		if err != nil {
-			return nil, err
+			return nil, at("material", err)
 		}
 		s = s.WithMaterial(mat)
 	}
 	return s, nil
 }
 
+// pathError is a problem that the builder found in a scene, with the path of the value
+// that caused it, in the same form as the paths of validation problems
+type pathError struct {
+	path string
+	err  error
+}
+
+func (e *pathError) Error() string {
+	return e.path + ": " + e.err.Error()
+}
+
+func (e *pathError) Unwrap() error {
+	return e.err
+}
+
+// at adds the path of a value to a problem found in it. The path of a problem that was
+// found deeper inside the value is added to the end of the path.
+func at(path string, err error) error {
+	if perr, ok := err.(*pathError); ok {
+		return &pathError{path: join(path, perr.path), err: perr.err}
+	}
+	return &pathError{path: path, err: err}
+}
+
 func NewWorld(file string) (*World, Cam, error) {
+	return NewWorldAt(file, 0)
+}
+
+// NewWorldAt builds the world of a scene file as it is at the given time, in seconds.
+// Keyframed values are interpolated to that time, and expressions can use it as the time
+// variable.
+func NewWorldAt(file string, time float64) (*World, Cam, error) {
 	data, err := ioutil.ReadFile(file)
 	if err != nil {
 		return nil, Cam{}, err
 	}
-	var w world
-	err = yaml.Unmarshal(data, &w)
-	if err != nil {
+	if err := validateScene(file, data, time); err != nil {
 		return nil, Cam{}, err
 	}
+	return buildWorld(file, data, time)
+}
+
+// buildWorld builds a scene without validating it first. The builder stops at the first
+// problem it finds, and reports it with the path of the value that caused it.
+func buildWorld(file string, data []byte, time float64) (*World, Cam, error) {
 	retval := &World{
-		objects: []shapes.Shape{},
-		Lights:  []fixtures.PointLight{},
+		objects:    []shapes.Shape{},
+		Lights:     []fixtures.Light{},
+		bvhOptions: shapes.DefaultBVHOptions(),
+	}
+	cache := newSceneCache()
+	cache.vars[timeVariable] = time
+	in, err := retval.load(file, data, cache, nil)
+	if err != nil {
+		return nil, Cam{}, err
+	}
+	if err := in.Camera.check(); err != nil {
+		return nil, Cam{}, fmt.Errorf("%s: %w", file, at("camera", err))
+	}
+	if err := in.Animation.check(); err != nil {
+		return nil, Cam{}, fmt.Errorf("%s: %w", file, at("animation", err))
+	}
+	retval.Animation = in.Animation
+	return retval, in.Camera, nil
+}
+
+// load adds everything in a scene file to the world. Included files are loaded first, so
+// that their materials and definitions can be used by the file that includes them. Only
+// the camera and the animation of the outermost file are used.
+func (w *World) load(file string, data []byte, cache *sceneCache, including []string) (world, error) {
+	// The includes and the variables are read first, since the rest of the file can use
+	// the variables in its expressions
+	var header struct {
+		Include []string
+		Vars    yaml.MapSlice
+	}
+	if err := yaml.Unmarshal(data, &header); err != nil {
+		return world{}, err
+	}
+	including = append(including, filepath.Clean(file))
+	for _, name := range header.Include {
+		path := includePath(file, name)
+		if slices.Contains(including, path) {
+			return world{}, fmt.Errorf("%s includes itself through %s", path, file)
+		}
+		included, err := os.ReadFile(path)
+		if err != nil {
+			return world{}, err
+		}
+		if _, err := w.load(path, included, cache, including); err != nil {
+			return world{}, err
+		}
+	}
+	if err := cache.vars.define(header.Vars); err != nil {
+		return world{}, fmt.Errorf("%s: %w", file, err)
+	}
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return world{}, err
 	}
-	materialCache := map[string]material.Material{}
-	for _, m := range w.Materials {
-		if _, err := m.toMaterial(materialCache); err != nil {
-			return nil, Cam{}, err
+	animated, err := cache.vars.animate(raw)
+	if err != nil {
+		return world{}, fmt.Errorf("%s: %w", file, err)
+	}
+	var in world
+	if err := cache.vars.decode(animated, &in); err != nil {
+		return world{}, fmt.Errorf("%s: %w", file, err)
+	}
+	// Problems are reported with the file and the path of the value that caused them
+	for i, m := range in.Materials {
+		if _, err := m.toMaterial(cache); err != nil {
+			return world{}, fmt.Errorf("%s: %w", file, at(index("materials", i), err))
 		}
 	}
-	for _, o := range w.Objects {
-		s, err := translater(o, materialCache)
+	for i, d := range in.Define {
+		if err := cache.define(d); err != nil {
+			return world{}, fmt.Errorf("%s: %w", file, at(index("define", i), err))
+		}
+	}
+	for i, o := range in.Objects {
+		s, err := translater(o, cache)
 		if err != nil {
-			return nil, Cam{}, err
+			return world{}, fmt.Errorf("%s: %w", file, at(index("objects", i), err))
 		}
-		retval.AddShapes(s)
+		w.AddShapes(s)
 	}
-	for _, f := range w.Fixtures {
+	for i, f := range in.Fixtures {
 		fix, err := f.toFixture()
 		if err != nil {
-			return nil, Cam{}, err
+			return world{}, fmt.Errorf("%s: %w", file, at(index("fixtures", i), err))
 		}
-		retval.Lights = append(retval.Lights, fix)
+		w.Lights = append(w.Lights, fix)
 	}
-
-	return retval, w.Camera, nil
+	return in, nil
 }
@@ -0,0 +1,207 @@
+package world
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/liorokman/raytrace/pkg/material"
+	"github.com/liorokman/raytrace/pkg/matrix"
+	"github.com/liorokman/raytrace/pkg/shapes"
+	"github.com/liorokman/raytrace/pkg/utils"
+)
+
+const (
+	// instance is the shape that places an object from the define section
+	instance = "instance"
+)
+
+// definition names an object or a list of transforms, so that the rest of the scene can
+// refer to it. Exactly one of Object and Transform is given.
+type definition struct {
+	Name      string
+	Object    *object     `yaml:",omitempty"`
+	Transform []transform `yaml:",flow,omitempty"`
+}
+
+// sceneCache holds everything that's named in a scene: materials, objects, transforms and
+// variables. Names can be used by anything that appears after them. A nil cache has no
+// names in it.
+type sceneCache struct {
+	materials  map[string]material.Material
+	objects    map[string]shapes.Shape
+	transforms map[string]matrix.Matrix
+	vars       variables
+}
+
+func newSceneCache() *sceneCache {
+	return &sceneCache{
+		materials:  map[string]material.Material{},
+		objects:    map[string]shapes.Shape{},
+		transforms: map[string]matrix.Matrix{},
+		vars:       variables{},
+	}
+}
+
+// variables returns the variables defined so far, for evaluating expressions
+func (c *sceneCache) variables() variables {
+	if c == nil {
+		return nil
+	}
+	return c.vars
+}
+
+func (c *sceneCache) material(name string) (material.Material, bool) {
+	if c == nil {
+		return material.Material{}, false
+	}
+	m, ok := c.materials[name]
+	return m, ok
+}
+
+func (c *sceneCache) setMaterial(name string, m material.Material) {
+	if c != nil {
+		c.materials[name] = m
+	}
+}
+
+// define builds the object or the transform of a definition, and keeps it under its name.
+// An object is only built once, no matter how many times it's used.
+func (c *sceneCache) define(d definition) error {
+	if d.Name == "" {
+		return fmt.Errorf("A definition must have a name")
+	}
+	switch {
+	case d.Object != nil && d.Transform != nil:
+		return fmt.Errorf("Definition %s has both an object and a transform", d.Name)
+	case d.Object != nil:
+		s, err := translater(*d.Object, c)
+		if err != nil {
+			return at("object", err)
+		}
+		c.objects[d.Name] = s
+	case d.Transform != nil:
+		m, err := c.toInvertibleMatrix(d.Transform)
+		if err != nil {
+			return at("transform", err)
+		}
+		c.transforms[d.Name] = m
+	default:
+		return fmt.Errorf("Definition %s needs either an object or a transform", d.Name)
+	}
+	return nil
+}
+
+// instance places a defined object. All the instances of an object share its geometry.
+func (c *sceneCache) instance(params map[string]interface{}) (shapes.Shape, error) {
+	name, ok := params["object"].(string)
+	if !ok {
+		return nil, fmt.Errorf("An instance needs the name of a defined object")
+	}
+	var prototype shapes.Shape
+	found := false
+	if c != nil {
+		prototype, found = c.objects[name]
+	}
+	if !found {
+		return nil, fmt.Errorf("Unknown object %s, it must be defined before it's used", name)
+	}
+	return shapes.NewInstance(prototype), nil
+}
+
+// toInvertibleMatrix combines a list of transforms, and checks that the result can be
+// inverted, since shapes and patterns are rendered through the inverse of their
+// transforms
+func (c *sceneCache) toInvertibleMatrix(list []transform) (matrix.Matrix, error) {
+	m, err := c.toMatrix(list)
+	if err != nil {
+		return matrix.Matrix{}, err
+	}
+	if utils.FloatEqual(m.Determinant(), 0) {
+		return matrix.Matrix{}, fmt.Errorf("The transform is singular, it can't be inverted")
+	}
+	return m, nil
+}
+
+// toMatrix combines a list of transforms, some of which may be named transforms
+func (c *sceneCache) toMatrix(list []transform) (matrix.Matrix, error) {
+	retval := matrix.NewIdentity()
+	for _, t := range list {
+		var m matrix.Matrix
+		if t.Use != "" {
+			var ok bool
+			if c != nil {
+				m, ok = c.transforms[t.Use]
+			}
+			if !ok {
+				return matrix.Matrix{}, fmt.Errorf("Unknown transform %s, it must be defined before it's used", t.Use)
+			}
+		} else {
+			var err error
+			if m, err = t.toMatrix(); err != nil {
+				return matrix.Matrix{}, err
+			}
+		}
+		retval = retval.Multiply(m)
+	}
+	return retval, nil
+}
+
+// motionSteps is the number of steps that a moving object's path is divided into, when
+// its transforms are interpolated parameter by parameter
+const motionSteps = 8
+
+// toMotion returns the transforms of an object that moves from start to end while the
+// shutter is open. When both lists have the same types of transforms in the same order,
+// their params are interpolated, so that rotating objects turn around their axis instead
+// of cutting across. Otherwise the object moves straight from start to end.
+func (c *sceneCache) toMotion(start, end []transform) ([]matrix.Matrix, error) {
+	from, err := c.toMatrix(start)
+	if err != nil {
+		return nil, err
+	}
+	to, err := c.toMatrix(end)
+	if err != nil {
+		return nil, err
+	}
+	if !sameTransforms(start, end) {
+		return []matrix.Matrix{from, to}, nil
+	}
+	retval := make([]matrix.Matrix, motionSteps+1)
+	retval[0], retval[motionSteps] = from, to
+	for i := 1; i < motionSteps; i++ {
+		u := float64(i) / motionSteps
+		steps := make([]transform, len(start))
+		for j := range start {
+			steps[j] = transform{Type: start[j].Type, Params: make([]float64, len(start[j].Params))}
+			for k := range steps[j].Params {
+				steps[j].Params[k] = start[j].Params[k] + u*(end[j].Params[k]-start[j].Params[k])
+			}
+		}
+		if retval[i], err = c.toInvertibleMatrix(steps); err != nil {
+			return nil, fmt.Errorf("The transform changes while the shutter is open: %w", err)
+		}
+	}
+	return retval, nil
+}
+
+// sameTransforms reports whether two lists of transforms differ only in their params
+func sameTransforms(a, b []transform) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Use != "" || b[i].Use != "" || a[i].Type != b[i].Type || len(a[i].Params) != len(b[i].Params) {
+			return false
+		}
+	}
+	return true
+}
+
+// includePath returns where an included file is. Relative paths are relative to the
+// directory of the file that includes them.
+func includePath(includer, name string) string {
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name)
+	}
+	return filepath.Join(filepath.Dir(includer), name)
+}
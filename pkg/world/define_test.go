@@ -0,0 +1,173 @@
+package world
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/liorokman/raytrace/pkg/shapes"
+)
+
+const partsScene = `
+fixtures:
+- type: pointlight
+  position: [ -10, 10, -10 ]
+  color: [ 1, 1, 1 ]
+materials:
+- name: red
+  pattern:
+    type: solid
+    colors:
+    - [ 1, 0, 0 ]
+define:
+- name: lift
+  transform:
+  - type: translate
+    params: [ 0, 1, 0 ]
+- name: pair
+  object:
+    type: group
+    params:
+      content:
+      - type: sphere
+        transform:
+        - type: scale
+          params: [ 0.5, 0.5, 0.5 ]
+        material:
+          preset: red
+      - type: cube
+        transform:
+        - use: lift
+        - type: scale
+          params: [ 0.3, 0.3, 0.3 ]
+        material:
+          pattern:
+            type: solid
+            colors:
+            - [ 0, 0, 1 ]
+          reflective: 0.5
+`
+
+func TestInstancesFromScene(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := t.TempDir()
+	g.Expect(os.Mkdir(filepath.Join(dir, "parts"), 0755)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, "parts", "parts.yaml"), []byte(partsScene), 0644)).To(Succeed())
+
+	instanced, err := loadScene(g, dir, validCamera+`
+include:
+- parts/parts.yaml
+objects:
+- type: instance
+  params:
+    object: pair
+  transform:
+  - type: translate
+    params: [ -1.5, 0, 0 ]
+- type: instance
+  params:
+    object: pair
+  transform:
+  - type: translate
+    params: [ 1.5, 0, 0 ]
+  - use: lift
+`)
+	g.Expect(err).To(BeNil())
+	g.Expect(instanced.NumObjects()).To(Equal(2))
+	g.Expect(instanced.Lights).To(HaveLen(1))
+	p1, p2 := shapes.Describe(instanced.Shape(0)).Prototype, shapes.Describe(instanced.Shape(1)).Prototype
+	g.Expect(p1.ID()).To(Equal(p2.ID()))
+
+	explicit, err := loadScene(g, t.TempDir(), validCamera+partsScene+`
+objects:
+- type: group
+  params:
+    content:
+    - &sphere
+      type: sphere
+      transform:
+      - type: scale
+        params: [ 0.5, 0.5, 0.5 ]
+      material:
+        preset: red
+    - &cube
+      type: cube
+      transform:
+      - type: translate
+        params: [ 0, 1, 0 ]
+      - type: scale
+        params: [ 0.3, 0.3, 0.3 ]
+      material:
+        pattern:
+          type: solid
+          colors:
+          - [ 0, 0, 1 ]
+        reflective: 0.5
+  transform:
+  - type: translate
+    params: [ -1.5, 0, 0 ]
+- type: group
+  params:
+    content:
+    - *sphere
+    - *cube
+  transform:
+  - type: translate
+    params: [ 1.5, 1, 0 ]
+`)
+	g.Expect(err).To(BeNil())
+	cam := Cam{From: Point{0, 1.5, -5}, To: Point{0, 1, 0}}
+	expectSameColors(g, explicit, instanced, cam)
+
+	// Saving writes the shared object once, as a definition
+	cam = Cam{Hsize: 100, Vsize: 50, FieldOfView: 1, From: Point{0, 1.5, -5}, To: Point{0, 1, 0}, Up: Vector{0, 1, 0}}
+	loaded := roundTrip(g, t.TempDir(), instanced, cam)
+	expectSameColors(g, instanced, loaded, cam)
+	p1, p2 = shapes.Describe(loaded.Shape(0)).Prototype, shapes.Describe(loaded.Shape(1)).Prototype
+	g.Expect(p1.ID()).To(Equal(p2.ID()))
+}
+
+func TestDefinitionErrors(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := t.TempDir()
+	g.Expect(os.WriteFile(filepath.Join(dir, "loop.yaml"), []byte("include:\n- scene.yaml\n"), 0644)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, "camera.yaml"), []byte(validCamera), 0644)).To(Succeed())
+
+	tests := []struct {
+		scene string
+		file  string
+		path  string
+	}{
+		{"include:\n- loop.yaml\n", "loop.yaml", "include[0]"},
+		{"include:\n- camera.yaml\n", "camera.yaml", "camera"},
+		{"include:\n- missing.yaml\n", "scene.yaml", "include[0]"},
+		{"objects:\n- type: instance\n  params:\n    object: chair\n", "scene.yaml", "objects[0].params.object"},
+		{"objects:\n- type: sphere\n  transform:\n  - use: tilt\n", "scene.yaml", "objects[0].transform[0].use"},
+		{"objects:\n- type: sphere\n  transform:\n  - use: tilt\n    type: scale\n", "scene.yaml", "objects[0].transform[0]"},
+		{"define:\n- name: ball\n", "scene.yaml", "define[0]"},
+		{"define:\n- name: ball\n  object:\n    type: sphere\nobjects:\n- type: instance\n  params:\n    object: ball\n  material:\n    preset: glass\n", "scene.yaml", "objects[0].material"},
+		{"define:\n- name: flat\n  transform:\n  - type: scale\n    params: [ 1, 0, 1 ]\n", "scene.yaml", "define[0].transform"},
+	}
+	for _, test := range tests {
+		_, err := loadScene(g, dir, validCamera+test.scene)
+		var verr *ValidationError
+		g.Expect(errors.As(err, &verr)).To(BeTrue(), test.scene)
+		g.Expect(verr.Problems).To(HaveLen(1), test.scene)
+		g.Expect(filepath.Base(verr.Problems[0].File)).To(Equal(test.file), test.scene)
+		g.Expect(verr.Problems[0].Path).To(Equal(test.path), test.scene)
+	}
+
+	// Definitions are checked by the builder too, for callers that don't validate
+	cache := newSceneCache()
+	g.Expect(cache.define(definition{Name: "ball"})).ToNot(Succeed())
+	g.Expect(cache.define(definition{Object: &object{Type: sphere}})).ToNot(Succeed())
+	_, err := cache.instance(map[string]interface{}{"object": "ball"})
+	g.Expect(err).ToNot(BeNil())
+	_, err = newShape(instance, map[string]interface{}{"object": "ball"}, nil)
+	g.Expect(err).ToNot(BeNil())
+	_, err = cache.toMatrix([]transform{{Use: "tilt"}})
+	g.Expect(err).ToNot(BeNil())
+}
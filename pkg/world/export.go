@@ -0,0 +1,530 @@
+package world
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"reflect"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/liorokman/raytrace/pkg/fixtures"
+	"github.com/liorokman/raytrace/pkg/material"
+	"github.com/liorokman/raytrace/pkg/matrix"
+	"github.com/liorokman/raytrace/pkg/shapes"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+// worldOutput is the scene written by MarshalWorld. It has the same layout as the scene
+// read by NewWorld, but materials are written inline and only with the values that differ
+// from the default material.
+type worldOutput struct {
+	Camera   Cam
+	Fixtures []fixture
+	Define   []definitionOutput `yaml:",omitempty"`
+	Objects  []objectOutput
+}
+
+type definitionOutput struct {
+	Name   string
+	Object objectOutput
+}
+
+type instanceParams struct {
+	Object string `yaml:"object"`
+}
+
+// exporter writes every prototype of instances once, as a definition that all of its
+// instances refer to
+type exporter struct {
+	define []definitionOutput
+	// names holds the name of every prototype's definition by the prototype's ID
+	names map[string]string
+}
+
+type objectOutput struct {
+	Type      string
+	Params    interface{} `yaml:",omitempty"`
+	Transform []transform `yaml:",flow,omitempty"`
+	// TransformEnd only keeps where a moving shape ends up, so a shape that turned while
+	// the shutter was open moves straight to its end transform once it's loaded back
+	TransformEnd []transform     `yaml:"transformEnd,flow,omitempty"`
+	Material     *materialOutput `yaml:",omitempty"`
+}
+
+type materialOutput struct {
+	Pattern         pattern
+	Ambient         *float64 `yaml:"ambient,omitempty"`
+	Diffuse         *float64 `yaml:"diffuse,omitempty"`
+	Specular        *float64 `yaml:"specular,omitempty"`
+	Shininess       *float64 `yaml:"shininess,omitempty"`
+	Reflective      *float64 `yaml:"reflective,omitempty"`
+	Transparency    *float64 `yaml:"transparency,omitempty"`
+	RefractiveIndex *float64 `yaml:"refractiveIndex,omitempty"`
+	Emissive        *color   `yaml:"emissive,flow,omitempty"`
+}
+
+type cylinderParams struct {
+	Minimum *float64 `yaml:"minimum,omitempty"`
+	Maximum *float64 `yaml:"maximum,omitempty"`
+	Closed  bool     `yaml:"closed,omitempty"`
+}
+
+type torusParams struct {
+	Major float64 `yaml:"major"`
+	Minor float64 `yaml:"minor"`
+}
+
+type triangleParams struct {
+	P1  Point     `yaml:"p1,flow"`
+	P2  Point     `yaml:"p2,flow"`
+	P3  Point     `yaml:"p3,flow"`
+	N1  *Vector   `yaml:"n1,flow,omitempty"`
+	N2  *Vector   `yaml:"n2,flow,omitempty"`
+	N3  *Vector   `yaml:"n3,flow,omitempty"`
+	UV1 []float64 `yaml:"uv1,flow,omitempty"`
+	UV2 []float64 `yaml:"uv2,flow,omitempty"`
+	UV3 []float64 `yaml:"uv3,flow,omitempty"`
+}
+
+type meshParams struct {
+	Vertices [][]float64 `yaml:"vertices,flow"`
+	Normals  [][]float64 `yaml:"normals,flow,omitempty"`
+	UVs      [][]float64 `yaml:"uvs,flow,omitempty"`
+	Colors   [][]float64 `yaml:"colors,flow,omitempty"`
+	Faces    [][]int     `yaml:"faces,flow"`
+}
+
+type groupParams struct {
+	Content []objectOutput `yaml:"content"`
+}
+
+type csgParams struct {
+	Left      objectOutput `yaml:"left"`
+	Right     objectOutput `yaml:"right"`
+	Operation string       `yaml:"operation"`
+}
+
+type sdfParams struct {
+	Node sdfNode `yaml:"node"`
+}
+
+var (
+	csgOpNames = map[shapes.CSGOp]string{
+		shapes.UnionOp:      unionop,
+		shapes.IntersectOp:  intersectop,
+		shapes.DifferenceOp: differenceop,
+	}
+	mappingNames = map[material.UVMapping]string{
+		material.ShapeMapping:       shapemapping,
+		material.SphericalMapping:   sphericalmapping,
+		material.PlanarMapping:      planarmapping,
+		material.CylindricalMapping: cylindricalmapping,
+		material.CubeMapping:        cubemapping,
+	}
+	filterNames = map[material.TextureFilter]string{
+		material.NearestFilter:  nearestfilter,
+		material.BilinearFilter: bilinearfilter,
+	}
+	patternNames = map[material.PatternKind]string{
+		material.SolidKind:       solid,
+		material.StripeKind:      stripe,
+		material.GradientKind:    gradient,
+		material.RingKind:        ring,
+		material.CheckerKind:     checkers,
+		material.TextureKind:     texture,
+		material.VertexColorKind: vertexcolor,
+	}
+)
+
+// MarshalWorld writes the world and the camera as a scene that NewWorld can read.
+// Textures are written as the names of the files they were loaded from, so the scene
+// must be read from the same directory the textures were loaded from.
+func MarshalWorld(w *World, cam Cam) ([]byte, error) {
+	out := worldOutput{Camera: cam}
+	e := &exporter{names: map[string]string{}}
+	for _, l := range w.Lights {
+		f, err := fixtureOutput(l)
+		if err != nil {
+			return nil, err
+		}
+		out.Fixtures = append(out.Fixtures, f)
+	}
+	for i := 0; i < w.NumObjects(); i++ {
+		o, err := e.shapeOutput(w.Shape(i))
+		if err != nil {
+			return nil, err
+		}
+		out.Objects = append(out.Objects, o)
+	}
+	out.Define = e.define
+	return yaml.Marshal(out)
+}
+
+// SaveWorld writes the world and the camera to a scene file
+func SaveWorld(file string, w *World, cam Cam) error {
+	data, err := MarshalWorld(w, cam)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+func fixtureOutput(l fixtures.Light) (fixture, error) {
+	switch light := l.(type) {
+	case fixtures.PointLight:
+		return fixture{
+			Type:        POINTLIGHT,
+			Position:    toPoint(light.Position()),
+			Color:       toColor(light.Intensity()),
+			Attenuation: attenuationOutput(light.Attenuation()),
+		}, nil
+	case fixtures.SpotLight:
+		inner, outer := light.Angles()
+		return fixture{
+			Type:        SPOTLIGHT,
+			Position:    toPoint(light.Position()),
+			Direction:   toVector(light.Direction()),
+			InnerAngle:  inner,
+			OuterAngle:  outer,
+			Color:       toColor(light.Intensity()),
+			Attenuation: attenuationOutput(light.Attenuation()),
+		}, nil
+	case fixtures.DirectionalLight:
+		return fixture{
+			Type:      DIRECTIONALLIGHT,
+			Direction: toVector(light.Direction()),
+			Color:     toColor(light.Intensity()),
+		}, nil
+	case fixtures.AreaLight:
+		uvec, vvec := light.Edges()
+		usteps, vsteps := light.Steps()
+		return fixture{
+			Type:   AREALIGHT,
+			Corner: toPoint(light.Corner()),
+			UVec:   toVector(uvec),
+			VVec:   toVector(vvec),
+			USteps: usteps,
+			VSteps: vsteps,
+			Jitter: light.Jittered(),
+			Color:  toColor(light.Intensity()),
+		}, nil
+	case fixtures.SphereLight:
+		return fixture{
+			Type:     SPHERELIGHT,
+			Position: toPoint(light.Position()),
+			Radius:   light.Radius(),
+			Samples:  light.Samples(),
+			Jitter:   light.Jittered(),
+			Color:    toColor(light.Intensity()),
+		}, nil
+	default:
+		return fixture{}, fmt.Errorf("Can't export a light of type %T", l)
+	}
+}
+
+func attenuationOutput(a fixtures.Attenuation) []float64 {
+	if a == fixtures.NoAttenuation() {
+		return nil
+	}
+	return []float64{a.Constant, a.Linear, a.Quadratic}
+}
+
+func (e *exporter) shapeOutput(s shapes.Shape) (objectOutput, error) {
+	out := objectOutput{Transform: transformOutput(s.GetTransform())}
+	if motion := s.GetMotion(); motion != nil {
+		out.TransformEnd = transformOutput(motion[len(motion)-1])
+		if len(out.TransformEnd) == 0 {
+			out.TransformEnd = []transform{{Type: identity}}
+		}
+	}
+	d := shapes.Describe(s)
+	hasMaterial := true
+	switch d.Kind {
+	case shapes.SphereKind:
+		out.Type = sphere
+	case shapes.PlaneKind:
+		out.Type = plane
+	case shapes.CubeKind:
+		out.Type = cube
+	case shapes.CylinderKind, shapes.ConeKind:
+		out.Type = cylinder
+		if d.Kind == shapes.ConeKind {
+			out.Type = cone
+		}
+		params := cylinderParams{Closed: d.Closed}
+		if !math.IsInf(d.Minimum, -1) {
+			params.Minimum = &d.Minimum
+		}
+		if !math.IsInf(d.Maximum, 1) {
+			params.Maximum = &d.Maximum
+		}
+		if params.Minimum != nil || params.Maximum != nil || params.Closed {
+			out.Params = params
+		}
+	case shapes.TorusKind:
+		out.Type = torus
+		out.Params = torusParams{Major: d.Major, Minor: d.Minor}
+	case shapes.TriangleKind, shapes.SmoothTriangleKind:
+		out.Type = triangle
+		params := triangleParams{P1: toPoint(d.Points[0]), P2: toPoint(d.Points[1]), P3: toPoint(d.Points[2])}
+		if d.Kind == shapes.SmoothTriangleKind {
+			n1, n2, n3 := toVector(d.Normals[0]), toVector(d.Normals[1]), toVector(d.Normals[2])
+			params.N1, params.N2, params.N3 = &n1, &n2, &n3
+		}
+		if !shapes.IsDefaultUV(d.UVs) {
+			params.UV1 = []float64{d.UVs[0].U, d.UVs[0].V}
+			params.UV2 = []float64{d.UVs[1].U, d.UVs[1].V}
+			params.UV3 = []float64{d.UVs[2].U, d.UVs[2].V}
+		}
+		out.Params = params
+	case shapes.MeshKind:
+		out.Type = mesh
+		out.Params = meshOutput(d.Mesh)
+	case shapes.GroupKind:
+		out.Type = group
+		hasMaterial = false
+		params := groupParams{Content: []objectOutput{}}
+		for _, c := range d.Children {
+			child, err := e.shapeOutput(c)
+			if err != nil {
+				return objectOutput{}, err
+			}
+			params.Content = append(params.Content, child)
+		}
+		out.Params = params
+	case shapes.CSGKind:
+		out.Type = csg
+		hasMaterial = false
+		left, err := e.shapeOutput(d.Left)
+		if err != nil {
+			return objectOutput{}, err
+		}
+		right, err := e.shapeOutput(d.Right)
+		if err != nil {
+			return objectOutput{}, err
+		}
+		out.Params = csgParams{Left: left, Right: right, Operation: csgOpNames[d.Operation]}
+	case shapes.ImplicitKind:
+		out.Type = sdf
+		node, err := sdfOutput(d.Field)
+		if err != nil {
+			return objectOutput{}, err
+		}
+		out.Params = sdfParams{Node: node}
+	case shapes.InstanceKind:
+		out.Type = instance
+		hasMaterial = false
+		name, err := e.prototypeName(d.Prototype)
+		if err != nil {
+			return objectOutput{}, err
+		}
+		out.Params = instanceParams{Object: name}
+	}
+	if hasMaterial {
+		m, err := materialOutputOf(s.GetMaterial())
+		if err != nil {
+			return objectOutput{}, err
+		}
+		out.Material = m
+	}
+	return out, nil
+}
+
+// prototypeName returns the name of the prototype's definition, and defines it the first
+// time it's seen. Prototypes that have instances inside them are defined after those.
+func (e *exporter) prototypeName(prototype shapes.Shape) (string, error) {
+	if name, ok := e.names[prototype.ID()]; ok {
+		return name, nil
+	}
+	o, err := e.shapeOutput(prototype)
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("object%d", len(e.define)+1)
+	e.names[prototype.ID()] = name
+	e.define = append(e.define, definitionOutput{Name: name, Object: o})
+	return name, nil
+}
+
+// meshOutput writes the vertices, normals and texture coordinates that the mesh's faces
+// use, so that data the mesh shares with other meshes isn't written with every one of them
+func meshOutput(m shapes.Mesh) meshParams {
+	params := meshParams{}
+	data := meshArrays{vertices: m.Vertices(), colors: m.Colors(), normals: m.Normals(), uvs: m.UVs(), faces: m.Faces()}.compact()
+	for _, v := range data.vertices {
+		params.Vertices = append(params.Vertices, []float64{v.X(), v.Y(), v.Z()})
+	}
+	for _, n := range data.normals {
+		params.Normals = append(params.Normals, []float64{n.X(), n.Y(), n.Z()})
+	}
+	for _, uv := range data.uvs {
+		params.UVs = append(params.UVs, []float64{uv.U, uv.V})
+	}
+	for _, c := range data.colors {
+		params.Colors = append(params.Colors, []float64{c.Red(), c.Green(), c.Blue()})
+	}
+	for _, f := range data.faces {
+		face := []int{f.Vertices[0], f.Vertices[1], f.Vertices[2]}
+		if f.Normals != [3]int{-1, -1, -1} || f.UVs != [3]int{-1, -1, -1} {
+			face = append(face, f.Normals[0], f.Normals[1], f.Normals[2], f.UVs[0], f.UVs[1], f.UVs[2])
+		}
+		params.Faces = append(params.Faces, face)
+	}
+	return params
+}
+
+func sdfOutput(f shapes.SDF) (sdfNode, error) {
+	d := shapes.DescribeSDF(f)
+	node := sdfNode{}
+	switch d.Kind {
+	case shapes.SDFSphereKind:
+		node.Type = sphere
+		node.Center = pointOutput(d.Center)
+		node.Radius = d.Radius
+	case shapes.SDFBoxKind:
+		node.Type = box
+		node.Center = pointOutput(d.Center)
+		node.Size = []float64{d.HalfSize.X(), d.HalfSize.Y(), d.HalfSize.Z()}
+		node.Rounding = d.Rounding
+	case shapes.SDFCapsuleKind:
+		node.Type = capsule
+		node.A = []float64{d.A.X(), d.A.Y(), d.A.Z()}
+		node.B = []float64{d.B.X(), d.B.Y(), d.B.Z()}
+		node.Radius = d.Radius
+	case shapes.SDFTorusKind:
+		node.Type = torus
+		node.Major = d.Major
+		node.Minor = d.Minor
+	case shapes.SDFUnionKind:
+		node.Type = unionop
+		if d.Smoothness > 0 {
+			node.Type = smoothunion
+			node.K = d.Smoothness
+		}
+	case shapes.SDFIntersectionKind:
+		node.Type = intersectop
+	case shapes.SDFSubtractionKind:
+		node.Type = differenceop
+		if d.Smoothness > 0 {
+			node.Type = smoothdifference
+			node.K = d.Smoothness
+		}
+	case shapes.SDFRepeatKind:
+		node.Type = repeat
+		node.Period = []float64{d.Period.X(), d.Period.Y(), d.Period.Z()}
+	default:
+		return sdfNode{}, fmt.Errorf("Can't export an sdf built from a distance function")
+	}
+	for _, c := range d.Children {
+		child, err := sdfOutput(c)
+		if err != nil {
+			return sdfNode{}, err
+		}
+		node.Children = append(node.Children, child)
+	}
+	return node, nil
+}
+
+// pointOutput leaves out the origin, which is the default for sdf points
+func pointOutput(p tuple.Tuple) []float64 {
+	if p.X() == 0 && p.Y() == 0 && p.Z() == 0 {
+		return nil
+	}
+	return []float64{p.X(), p.Y(), p.Z()}
+}
+
+func materialOutputOf(m material.Material) (*materialOutput, error) {
+	pat, err := patternOutput(m.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	def := material.Default()
+	out := &materialOutput{
+		Pattern:         pat,
+		Ambient:         changedFloat(m.Ambient(), def.Ambient()),
+		Diffuse:         changedFloat(m.Diffuse(), def.Diffuse()),
+		Specular:        changedFloat(m.Specular(), def.Specular()),
+		Shininess:       changedFloat(m.Shininess(), def.Shininess()),
+		Reflective:      changedFloat(m.Reflective(), def.Reflective()),
+		Transparency:    changedFloat(m.Transparency(), def.Transparency()),
+		RefractiveIndex: changedFloat(m.RefractiveIndex(), def.RefractiveIndex()),
+	}
+	if m.Emissive() != def.Emissive() {
+		emissive := toColor(m.Emissive())
+		out.Emissive = &emissive
+	}
+	defPattern, _ := patternOutput(def.Pattern)
+	if reflect.DeepEqual(*out, materialOutput{Pattern: defPattern}) {
+		// Objects without a material get the default one
+		return nil, nil
+	}
+	return out, nil
+}
+
+// changedFloat returns the value if it's not the default, and nil otherwise
+func changedFloat(val, def float64) *float64 {
+	if val == def {
+		return nil
+	}
+	return &val
+}
+
+func patternOutput(p material.Pattern) (pattern, error) {
+	name, ok := patternNames[p.Kind()]
+	if !ok {
+		return pattern{}, fmt.Errorf("Can't export a test pattern")
+	}
+	out := pattern{Type: name, Transform: transformOutput(p.Transform())}
+	for _, c := range p.Colors() {
+		out.Colors = append(out.Colors, toColor(c))
+	}
+	if p.Kind() == material.TextureKind {
+		tex, mapping, filter := p.Texture()
+		if tex.Source() == "" {
+			return pattern{}, fmt.Errorf("Can't export a texture that wasn't loaded from a file")
+		}
+		out.File = tex.Source()
+		out.Mapping = mappingNames[mapping]
+		out.Filter = filterNames[filter]
+	}
+	return out, nil
+}
+
+// transformOutput writes a transform that only translates and scales as translate and
+// scale transforms, and any other transform as a single matrix. The identity is left out.
+func transformOutput(m matrix.Matrix) []transform {
+	params := make([]float64, 0, 16)
+	scaleOnly := true
+	for row := 0; row < 4; row++ {
+		for col := 0; col < 4; col++ {
+			params = append(params, m.At(row, col))
+			if row != col && (row == 3 || col != 3) && m.At(row, col) != 0 {
+				scaleOnly = false
+			}
+		}
+	}
+	if !scaleOnly || m.At(3, 3) != 1 {
+		return []transform{{Type: matrixop, Params: params}}
+	}
+	retval := []transform{}
+	if m.At(0, 3) != 0 || m.At(1, 3) != 0 || m.At(2, 3) != 0 {
+		retval = append(retval, transform{Type: translate, Params: []float64{m.At(0, 3), m.At(1, 3), m.At(2, 3)}})
+	}
+	if m.At(0, 0) != 1 || m.At(1, 1) != 1 || m.At(2, 2) != 1 {
+		retval = append(retval, transform{Type: scale, Params: []float64{m.At(0, 0), m.At(1, 1), m.At(2, 2)}})
+	}
+	return retval
+}
+
+func toPoint(t tuple.Tuple) Point {
+	return Point{t.X(), t.Y(), t.Z()}
+}
+
+func toVector(t tuple.Tuple) Vector {
+	return Vector{t.X(), t.Y(), t.Z()}
+}
+
+func toColor(c tuple.Color) color {
+	return color{c.Red(), c.Green(), c.Blue()}
+}
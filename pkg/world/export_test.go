@@ -0,0 +1,240 @@
+package world
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v2"
+
+	"github.com/liorokman/raytrace/pkg/fixtures"
+	"github.com/liorokman/raytrace/pkg/material"
+	"github.com/liorokman/raytrace/pkg/matrix"
+	"github.com/liorokman/raytrace/pkg/shapes"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+// roundTrip saves the world and loads it back. Saving the loaded world again must give
+// the same scene file: only the first save can differ, since YAML reads -0 as 0.
+func roundTrip(g *WithT, dir string, w *World, cam Cam) *World {
+	filename := filepath.Join(dir, "exported.yaml")
+	g.Expect(SaveWorld(filename, w, cam)).To(Succeed())
+	loaded, loadedCam, err := NewWorld(filename)
+	g.Expect(err).To(BeNil())
+	g.Expect(loadedCam).To(Equal(cam))
+
+	data, err := MarshalWorld(loaded, loadedCam)
+	g.Expect(err).To(BeNil())
+	g.Expect(os.WriteFile(filename, data, 0644)).To(Succeed())
+	again, _, err := NewWorld(filename)
+	g.Expect(err).To(BeNil())
+	againData, err := MarshalWorld(again, loadedCam)
+	g.Expect(err).To(BeNil())
+	g.Expect(string(againData)).To(Equal(string(data)))
+	return loaded
+}
+
+// expectSameColors fires a grid of rays from the camera around the point it looks at, and
+// expects both worlds to have the same colors along them
+func expectSameColors(g *WithT, w1, w2 *World, cam Cam) {
+	from := cam.From.ToPoint()
+	for x := -2.0; x <= 2; x += 0.25 {
+		for y := -2.0; y <= 2; y += 0.25 {
+			to := cam.To.ToPoint().Add(tuple.NewVector(x, y, 0))
+			r, err := shapes.NewRay(from, to.Subtract(from).Normalize())
+			g.Expect(err).To(BeNil())
+			c1, err := w1.ColorAt(r, 5)
+			g.Expect(err).To(BeNil())
+			c2, err := w2.ColorAt(r, 5)
+			g.Expect(err).To(BeNil())
+			g.Expect(c2.Equals(c1)).To(BeTrue(), "ray towards %v: %v != %v", to, c2, c1)
+		}
+	}
+}
+
+func TestExportSceneFiles(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// The scene files refer to the OBJ files relative to the root of the repository
+	wd, err := os.Getwd()
+	g.Expect(err).To(BeNil())
+	g.Expect(os.Chdir("../..")).To(Succeed())
+	defer os.Chdir(wd)
+
+	for _, file := range []string{"scene.yaml", "teapot.yaml"} {
+		w, cam, err := NewWorld(file)
+		g.Expect(err).To(BeNil(), file)
+		loaded := roundTrip(g, t.TempDir(), w, cam)
+		g.Expect(loaded.NumObjects()).To(Equal(w.NumObjects()), file)
+		g.Expect(loaded.Lights).To(Equal(w.Lights), file)
+		expectSameColors(g, w, loaded, cam)
+	}
+}
+
+func TestExportShapes(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir := t.TempDir()
+	texFile := filepath.Join(dir, "texture.ppm")
+	g.Expect(os.WriteFile(texFile, []byte("P3\n2 1\n255\n255 0 0 0 0 255\n"), 0644)).To(Succeed())
+	tex, err := material.LoadTexture(texFile)
+	g.Expect(err).To(BeNil())
+
+	w := New()
+	w.Lights = []fixtures.Light{
+		fixtures.NewPointLight(tuple.NewPoint(-10, 10, -10), tuple.NewColor(1, 1, 1)).WithAttenuation(fixtures.Attenuation{Constant: 1, Quadratic: 0.01}),
+		fixtures.NewSpotLight(tuple.NewPoint(0, 10, 0), tuple.NewVector(0, -1, 0), 0.2, 0.4, tuple.NewColor(0.5, 0.5, 0.5)),
+		fixtures.NewDirectionalLight(tuple.NewVector(1, -1, 1), tuple.NewColor(0.2, 0.2, 0.2)),
+		fixtures.NewAreaLight(tuple.NewPoint(-1, 5, -1), tuple.NewVector(2, 0, 0), 2, tuple.NewVector(0, 0, 2), 3, tuple.NewColor(0.3, 0.3, 0.3), false),
+		fixtures.NewSphereLight(tuple.NewPoint(5, 5, -5), 0.5, 4, tuple.NewColor(0.1, 0.1, 0.1), false),
+	}
+
+	shiny := material.NewDefaultBuilder().
+		WithPattern(material.NewStripePattern(tuple.Red, tuple.Blue).WithTransform(matrix.NewRotateY(0.5))).
+		WithReflective(0.3).WithEmissive(tuple.NewColor(0.1, 0, 0)).Build()
+	textured := material.NewDefaultBuilder().WithPattern(material.NewTextureMapPattern(tex, material.CubeMapping, material.NearestFilter)).Build()
+
+	left := shapes.NewCube().WithMaterial(shiny)
+	right := shapes.NewSphere().WithTransform(matrix.NewTranslation(0.5, 0.5, -0.5))
+	colored, err := shapes.NewColoredMesh(
+		[]tuple.Tuple{tuple.NewPoint(0, 0, 0), tuple.NewPoint(1, 0, 0), tuple.NewPoint(0, 1, 0), tuple.NewPoint(1, 1, 0)},
+		[]tuple.Color{tuple.Red, tuple.Green, tuple.Blue, tuple.White},
+		[]tuple.Tuple{tuple.NewVector(0, 0, -1)},
+		[]shapes.TextureCoord{{U: 0, V: 0}, {U: 1, V: 1}},
+		[]shapes.MeshFace{
+			shapes.NewMeshFace(0, 1, 2),
+			{Vertices: [3]int{1, 3, 2}, Normals: [3]int{0, 0, 0}, UVs: [3]int{0, 1, 0}},
+		})
+	g.Expect(err).To(BeNil())
+
+	inner := shapes.NewGroup().WithTransform(matrix.NewRotateZ(0.3))
+	shapes.Connect(inner, colored.WithMaterial(material.NewDefaultBuilder().WithPattern(material.NewVertexColorPattern(tuple.White)).Build()))
+	shapes.Connect(inner, shapes.NewTexturedSmoothTriangle(
+		tuple.NewPoint(0, 0, -0.5), tuple.NewPoint(0, 1, -0.5), tuple.NewPoint(1, 0, -0.5),
+		tuple.NewVector(0, 0, -1), tuple.NewVector(0, 0.1, -1), tuple.NewVector(0.1, 0, -1),
+		shapes.TextureCoord{U: 0, V: 0}, shapes.TextureCoord{U: 0, V: 1}, shapes.TextureCoord{U: 1, V: 0}).WithMaterial(textured))
+	outer := shapes.NewGroup().WithTransform(matrix.NewTranslation(2, 0, 0))
+	shapes.Connect(outer, inner)
+
+	w.AddShapes(
+		shapes.NewPlane().WithTransform(matrix.NewTranslation(0, -1, 0).Shear(0.1, 0, 0, 0, 0, 0)),
+		shapes.NewConstrainedCone(-1, 0, true).WithTransform(matrix.NewTranslation(-2, 1, 0)),
+		shapes.NewCylinder().WithTransform(matrix.NewTranslation(-4, 0, 4)),
+		shapes.NewTorus(1, 0.3).WithTransform(matrix.NewTranslation(0, 2, 0).RotateX(math.Pi/4)),
+		shapes.NewCSG(&left, &right, shapes.DifferenceOp).WithTransform(matrix.NewTranslation(0, 0, -2)),
+		shapes.NewImplicit(shapes.NewSDFSmoothUnion(0.2,
+			shapes.NewSDFSphere(tuple.NewPoint(0, 0, 0), 0.5),
+			shapes.NewSDFSmoothSubtraction(0.1, shapes.NewSDFBox(tuple.NewPoint(1, 0, 0), tuple.NewVector(0.5, 0.5, 0.5), 0.1),
+				shapes.NewSDFCapsule(tuple.NewPoint(1, -1, 0), tuple.NewPoint(1, 1, 0), 0.2)),
+			shapes.NewSDFIntersection(shapes.NewSDFTorus(1, 0.2)),
+		)).WithTransform(matrix.NewTranslation(-2, 0, -3)),
+		shapes.NewImplicit(shapes.NewSDFRepeat(tuple.NewVector(3, 0, 0), shapes.NewSDFSphere(tuple.NewPoint(0, 0, 0), 0.2))).WithTransform(matrix.NewTranslation(0, -0.5, 5)),
+		outer,
+	)
+	cam := Cam{
+		Hsize:       100,
+		Vsize:       50,
+		FieldOfView: math.Pi / 3,
+		From:        Point{0, 3, -8},
+		To:          Point{0, 0, 0},
+		Up:          Vector{0, 1, 0},
+		Sampling:    CamSampling{Mode: "jittered", Samples: 2, Seed: 7},
+		Aperture:    0.1,
+	}
+
+	loaded := roundTrip(g, dir, w, cam)
+	g.Expect(loaded.NumObjects()).To(Equal(w.NumObjects()))
+	g.Expect(loaded.Lights).To(Equal(w.Lights))
+	expectSameColors(g, w, loaded, cam)
+}
+
+func TestExportObjGroups(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir := t.TempDir()
+	obj := `
+v 0 0 0
+v 1 0 0
+v 0 1 0
+v 1 1 0
+v 9 9 9
+vn 0 0 -1
+vt 0 0
+vt 1 0
+vt 0 1
+g first
+f 1/1/1 2/2/1 3/3/1
+g second
+f 2 4 3
+`
+	model := filepath.Join(dir, "groups.obj")
+	g.Expect(os.WriteFile(model, []byte(obj), 0644)).To(Succeed())
+	scene := filepath.Join(dir, "scene.yaml")
+	g.Expect(os.WriteFile(scene, []byte(validCamera+"objects:\n- type: group\n  params:\n    meshfile: "+model+"\n"), 0644)).To(Succeed())
+	w, cam, err := NewWorld(scene)
+	g.Expect(err).To(BeNil())
+
+	data, err := MarshalWorld(w, cam)
+	g.Expect(err).To(BeNil())
+	g.Expect(strings.ToLower(string(data))).ToNot(ContainSubstring("nan"))
+
+	// Every mesh is written with just the vertices of its own faces
+	var out struct {
+		Objects []struct {
+			Params struct {
+				Content []struct {
+					Params meshParams
+				}
+			}
+		}
+	}
+	g.Expect(yaml.Unmarshal(data, &out)).To(Succeed())
+	g.Expect(out.Objects).To(HaveLen(1))
+	meshes := out.Objects[0].Params.Content
+	g.Expect(meshes).To(HaveLen(2))
+	g.Expect(meshes[0].Params.Vertices).To(Equal([][]float64{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}}))
+	g.Expect(meshes[0].Params.Normals).To(Equal([][]float64{{0, 0, -1}}))
+	g.Expect(meshes[0].Params.UVs).To(Equal([][]float64{{0, 0}, {1, 0}, {0, 1}}))
+	g.Expect(meshes[0].Params.Faces).To(Equal([][]int{{0, 1, 2, 0, 0, 0, 0, 1, 2}}))
+	g.Expect(meshes[1].Params.Vertices).To(Equal([][]float64{{1, 0, 0}, {1, 1, 0}, {0, 1, 0}}))
+	g.Expect(meshes[1].Params.Normals).To(BeEmpty())
+	g.Expect(meshes[1].Params.UVs).To(BeEmpty())
+	g.Expect(meshes[1].Params.Faces).To(Equal([][]int{{0, 1, 2}}))
+
+	loaded := roundTrip(g, dir, w, cam)
+	g.Expect(loaded.NumObjects()).To(Equal(w.NumObjects()))
+
+	// Meshes built in code may carry data that none of their faces use
+	m, err := shapes.NewColoredMesh(
+		[]tuple.Tuple{tuple.NewPoint(9, 9, 9), tuple.NewPoint(0, 0, 0), tuple.NewPoint(1, 0, 0), tuple.NewPoint(0, 1, 0)},
+		[]tuple.Color{tuple.White, tuple.Red, tuple.Green, tuple.Blue},
+		[]tuple.Tuple{tuple.NewVector(0, 1, 0), tuple.NewVector(0, 0, -1)},
+		nil,
+		[]shapes.MeshFace{{Vertices: [3]int{1, 2, 3}, Normals: [3]int{1, 1, 1}, UVs: [3]int{-1, -1, -1}}})
+	g.Expect(err).To(BeNil())
+	g.Expect(meshOutput(m.InnerShape().(shapes.Mesh))).To(Equal(meshParams{
+		Vertices: [][]float64{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+		Normals:  [][]float64{{0, 0, -1}},
+		Colors:   [][]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}},
+		Faces:    [][]int{{0, 1, 2, 0, 0, 0, -1, -1, -1}},
+	}))
+}
+
+func TestExportErrors(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tex, err := material.NewTexture(1, 1, []tuple.Color{tuple.Red})
+	g.Expect(err).To(BeNil())
+	for _, s := range []shapes.Shape{
+		shapes.NewSphere().WithMaterial(material.NewDefaultBuilder().WithPattern(material.NewTestPattern()).Build()),
+		shapes.NewSphere().WithMaterial(material.NewDefaultBuilder().WithPattern(material.NewTextureMapPattern(tex, material.ShapeMapping, material.BilinearFilter)).Build()),
+		shapes.NewImplicit(shapes.NewDistanceFunc(func(p tuple.Tuple) float64 { return p.Magnitude() - 1 }, shapes.InfiniteBoundingBox())),
+	} {
+		w := New().AddShapes(s)
+		_, err := MarshalWorld(w, Cam{})
+		g.Expect(err).ToNot(BeNil())
+	}
+}
@@ -0,0 +1,399 @@
+package world
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v2"
+)
+
+// variables holds the values of the vars sections of a scene, by name. Every number in a
+// scene can also be written as an arithmetic expression that uses them, such as pi/4 or
+// 2*radius. Angles can be given in degrees with a deg suffix, as in 90deg.
+type variables map[string]float64
+
+var exprConstants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+var exprFunctions = map[string]func(float64) float64{
+	"sqrt": math.Sqrt,
+	"sin":  math.Sin,
+	"cos":  math.Cos,
+	"tan":  math.Tan,
+	"asin": math.Asin,
+	"acos": math.Acos,
+	"atan": math.Atan,
+	"abs":  math.Abs,
+}
+
+const degreesSuffix = "deg"
+
+// define evaluates a vars section in order, so that every variable can use the ones
+// before it. Variables can have keyframes, like any other number.
+func (vars variables) define(section yaml.MapSlice) error {
+	for _, item := range section {
+		name, ok := item.Key.(string)
+		if !ok || !isIdentifier(name) {
+			return fmt.Errorf("Variable name %v must start with a letter, and have only letters, digits and underscores", item.Key)
+		}
+		if reservedName(name) {
+			return fmt.Errorf("%s is a constant, a function or the time, and can't be used as a variable name", name)
+		}
+		animated, err := vars.animate(item.Value)
+		if err != nil {
+			return fmt.Errorf("Variable %s: %w", name, err)
+		}
+		val, err := vars.number(animated)
+		if err != nil {
+			return fmt.Errorf("Variable %s: %w", name, err)
+		}
+		vars[name] = val
+	}
+	return nil
+}
+
+func isIdentifier(name string) bool {
+	for i, r := range name {
+		if !(unicode.IsLetter(r) || r == '_' || (i > 0 && unicode.IsDigit(r))) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+func reservedName(name string) bool {
+	_, constant := exprConstants[name]
+	_, function := exprFunctions[name]
+	return constant || function || name == degreesSuffix || name == timeVariable
+}
+
+// number converts a value read from a scene file to a float. Strings are evaluated as
+// expressions.
+func (vars variables) number(val interface{}) (float64, error) {
+	switch v := val.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case string:
+		return vars.evaluate(v)
+	default:
+		return 0, fmt.Errorf("%v is not a number", val)
+	}
+}
+
+// evaluate computes the value of an arithmetic expression. It supports + - * / and ^,
+// parentheses, the constants pi and e, the functions sqrt, sin, cos, tan, asin, acos,
+// atan and abs, and the deg suffix that converts degrees to radians.
+func (vars variables) evaluate(expr string) (float64, error) {
+	p := &exprParser{input: expr, vars: vars}
+	val, err := p.sum()
+	if err != nil {
+		return 0, fmt.Errorf("Can't evaluate '%s': %w", expr, err)
+	}
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return 0, fmt.Errorf("Can't evaluate '%s': unexpected '%s'", expr, p.input[p.pos:])
+	}
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return 0, fmt.Errorf("Can't evaluate '%s': the result isn't a finite number", expr)
+	}
+	return val, nil
+}
+
+// exprParser is a recursive descent parser that evaluates the expression as it goes
+type exprParser struct {
+	input string
+	pos   int
+	vars  variables
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *exprParser) accept(c byte) bool {
+	p.skipSpaces()
+	if p.pos < len(p.input) && p.input[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) sum() (float64, error) {
+	retval, err := p.product()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		switch {
+		case p.accept('+'):
+			val, err := p.product()
+			if err != nil {
+				return 0, err
+			}
+			retval += val
+		case p.accept('-'):
+			val, err := p.product()
+			if err != nil {
+				return 0, err
+			}
+			retval -= val
+		default:
+			return retval, nil
+		}
+	}
+}
+
+func (p *exprParser) product() (float64, error) {
+	retval, err := p.unary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		switch {
+		case p.accept('*'):
+			val, err := p.unary()
+			if err != nil {
+				return 0, err
+			}
+			retval *= val
+		case p.accept('/'):
+			val, err := p.unary()
+			if err != nil {
+				return 0, err
+			}
+			if val == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			retval /= val
+		default:
+			return retval, nil
+		}
+	}
+}
+
+func (p *exprParser) unary() (float64, error) {
+	if p.accept('-') {
+		val, err := p.unary()
+		return -val, err
+	}
+	if p.accept('+') {
+		return p.unary()
+	}
+	base, err := p.postfix()
+	if err != nil {
+		return 0, err
+	}
+	if p.accept('^') {
+		exponent, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		return math.Pow(base, exponent), nil
+	}
+	return base, nil
+}
+
+// postfix reads a value that may be followed by the deg suffix
+func (p *exprParser) postfix() (float64, error) {
+	val, err := p.primary()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpaces()
+	start := p.pos
+	if p.identifier() == degreesSuffix {
+		return val * math.Pi / 180, nil
+	}
+	p.pos = start
+	return val, nil
+}
+
+func (p *exprParser) identifier() string {
+	start := p.pos
+	for p.pos < len(p.input) {
+		r := rune(p.input[p.pos])
+		if !(unicode.IsLetter(r) || r == '_' || (p.pos > start && unicode.IsDigit(r))) {
+			break
+		}
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *exprParser) primary() (float64, error) {
+	if p.accept('(') {
+		val, err := p.sum()
+		if err != nil {
+			return 0, err
+		}
+		if !p.accept(')') {
+			return 0, fmt.Errorf("missing ')'")
+		}
+		return val, nil
+	}
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return 0, fmt.Errorf("unexpected end of expression")
+	}
+	if c := p.input[p.pos]; c == '.' || (c >= '0' && c <= '9') {
+		return p.numberLiteral()
+	}
+	name := p.identifier()
+	if name == "" {
+		return 0, fmt.Errorf("unexpected '%s'", p.input[p.pos:])
+	}
+	if f, ok := exprFunctions[name]; ok {
+		if !p.accept('(') {
+			return 0, fmt.Errorf("%s needs an argument in parentheses", name)
+		}
+		val, err := p.sum()
+		if err != nil {
+			return 0, err
+		}
+		if !p.accept(')') {
+			return 0, fmt.Errorf("missing ')'")
+		}
+		return f(val), nil
+	}
+	if val, ok := exprConstants[name]; ok {
+		return val, nil
+	}
+	if val, ok := p.vars[name]; ok {
+		return val, nil
+	}
+	return 0, fmt.Errorf("unknown variable '%s'", name)
+}
+
+func (p *exprParser) numberLiteral() (float64, error) {
+	start := p.pos
+	digits := func() {
+		for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+			p.pos++
+		}
+	}
+	digits()
+	if p.pos < len(p.input) && p.input[p.pos] == '.' {
+		p.pos++
+		digits()
+	}
+	// An exponent, as long as the e isn't the start of a word like deg
+	if p.pos+1 < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+		next := p.pos + 1
+		if p.input[next] == '+' || p.input[next] == '-' {
+			next++
+		}
+		if next < len(p.input) && p.input[next] >= '0' && p.input[next] <= '9' {
+			p.pos = next
+			digits()
+		}
+	}
+	return strconv.ParseFloat(p.input[start:p.pos], 64)
+}
+
+// decode reads a value parsed from a scene file into out, like unmarshaling it would.
+// Strings are evaluated as expressions wherever out has a number, but the values of
+// parameter maps are left as they are, for the extract functions to evaluate.
+func (vars variables) decode(val interface{}, out interface{}) error {
+	resolved, err := vars.resolve(val, reflect.TypeOf(out))
+	if err != nil {
+		return err
+	}
+	asYaml, err := yaml.Marshal(resolved)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(asYaml, out)
+}
+
+func (vars variables) resolve(val interface{}, t reflect.Type) (interface{}, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if s, ok := val.(string); ok {
+			return vars.evaluate(s)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if s, ok := val.(string); ok {
+			f, err := vars.evaluate(s)
+			if err != nil {
+				return nil, err
+			}
+			if f != math.Trunc(f) {
+				return nil, fmt.Errorf("'%s' must be an integer, not %g", s, f)
+			}
+			return int64(f), nil
+		}
+	case reflect.Slice, reflect.Array:
+		if list, ok := val.([]interface{}); ok {
+			retval := make([]interface{}, len(list))
+			for i := range list {
+				var err error
+				if retval[i], err = vars.resolve(list[i], t.Elem()); err != nil {
+					return nil, err
+				}
+			}
+			return retval, nil
+		}
+	case reflect.Struct:
+		if m, ok := val.(map[interface{}]interface{}); ok {
+			fields := yamlFields(t)
+			retval := make(map[interface{}]interface{}, len(m))
+			for k, v := range m {
+				retval[k] = v
+				if key, ok := k.(string); ok {
+					if ft, ok := fields[key]; ok {
+						var err error
+						if retval[k], err = vars.resolve(v, ft); err != nil {
+							return nil, fmt.Errorf("%s: %w", key, err)
+						}
+					}
+				}
+			}
+			return retval, nil
+		}
+	}
+	return val, nil
+}
+
+// yamlFields returns the types of a struct's fields by the keys they're read from
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	retval := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("yaml"), ",")
+		if tag[0] == "-" {
+			continue
+		}
+		if strings.Contains(f.Tag.Get("yaml"), ",inline") {
+			if f.Type.Kind() == reflect.Struct {
+				for k, ft := range yamlFields(f.Type) {
+					retval[k] = ft
+				}
+			}
+			continue
+		}
+		name := tag[0]
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		retval[name] = f.Type
+	}
+	return retval
+}
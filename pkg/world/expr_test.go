@@ -0,0 +1,203 @@
+package world
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v2"
+)
+
+func TestExpressions(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	vars := variables{"radius": 2, "r2": 0.5}
+	tests := []struct {
+		expr     string
+		expected float64
+	}{
+		{"1", 1},
+		{"1.5e2", 150},
+		{".25", 0.25},
+		{"pi/4", math.Pi / 4},
+		{"2*radius", 4},
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"12 / 3 / 2", 2},
+		{"-radius^2", -4},
+		{"2^3^2", 512},
+		{"-(1 - 3)", 2},
+		{"90deg", math.Pi / 2},
+		{"-45 deg", -math.Pi / 4},
+		{"(radius * 45)deg", math.Pi / 2},
+		{"sqrt(2) * sqrt(2)", 2},
+		{"cos(pi)", -1},
+		{"abs(r2 - radius)", 1.5},
+		{"e", math.E},
+	}
+	for _, test := range tests {
+		val, err := vars.evaluate(test.expr)
+		g.Expect(err).To(BeNil(), test.expr)
+		g.Expect(val).To(BeNumerically("~", test.expected, 1e-12), test.expr)
+	}
+
+	for _, bad := range []string{"", "1 +", "2 * (3", "radius radius", "diameter", "1/0", "sqrt(-1)", "sqrt 2", "3 $ 4"} {
+		_, err := vars.evaluate(bad)
+		g.Expect(err).ToNot(BeNil(), bad)
+	}
+}
+
+func TestVariables(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	var section yaml.MapSlice
+	g.Expect(yaml.Unmarshal([]byte("radius: 2\ndiameter: 2*radius\nangle: 30deg\n"), &section)).To(Succeed())
+	vars := variables{}
+	g.Expect(vars.define(section)).To(Succeed())
+	g.Expect(vars).To(HaveLen(3))
+	g.Expect(vars["diameter"]).To(Equal(4.0))
+	g.Expect(vars["angle"]).To(BeNumerically("~", math.Pi/6))
+
+	for _, bad := range []string{"a: b\nb: 1\n", "pi: 3\n", "sin: 1\n", "2x: 1\n", "a: [ 1 ]\n"} {
+		var section yaml.MapSlice
+		g.Expect(yaml.Unmarshal([]byte(bad), &section)).To(Succeed())
+		g.Expect(variables{}.define(section)).ToNot(Succeed(), bad)
+	}
+
+	// Typed fields are evaluated, while parameter maps are left for the extract functions
+	var raw interface{}
+	g.Expect(yaml.Unmarshal([]byte(`
+type: cylinder
+transform:
+- type: rotatez
+  params: [ 90deg ]
+- type: translate
+  params: [ radius, 0, -radius ]
+params:
+  maximum: 2*radius
+`), &raw)).To(Succeed())
+	var o object
+	vars = variables{"radius": 1.5}
+	g.Expect(vars.decode(raw, &o)).To(Succeed())
+	g.Expect(o.Transform[0].Params[0]).To(BeNumerically("~", math.Pi/2))
+	g.Expect(o.Transform[1].Params).To(Equal([]float64{1.5, 0, -1.5}))
+	g.Expect(o.Params["maximum"]).To(Equal("2*radius"))
+	val, ok, err := extractFloatParam(o.Params, vars, "maximum")
+	g.Expect(err).To(BeNil())
+	g.Expect(ok).To(BeTrue())
+	g.Expect(val).To(Equal(3.0))
+
+	var cam Cam
+	g.Expect(yaml.Unmarshal([]byte("hsize: 10*radius\nsampling:\n  samples: radius*2\n"), &raw)).To(Succeed())
+	g.Expect(vars.decode(raw, &cam)).To(Succeed())
+	g.Expect(cam.Hsize).To(Equal(uint32(15)))
+	g.Expect(cam.Sampling.Samples).To(Equal(3))
+	g.Expect(yaml.Unmarshal([]byte("vsize: radius\n"), &raw)).To(Succeed())
+	g.Expect(vars.decode(raw, &cam)).ToNot(Succeed())
+}
+
+func TestExpressionsInScene(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir := t.TempDir()
+	withVars, err := loadScene(g, dir, `
+vars:
+  size: 0.5
+  distance: 5
+  tilt: 45deg
+camera:
+  hsize: 100
+  vsize: 50
+  fieldOfView: pi/3
+  from: [ 0, 1.5, -distance ]
+  to: [ 0, 1, 0 ]
+  up: [ 0, 1, 0 ]
+fixtures:
+- type: pointlight
+  position: [ -2*distance, 2*distance, -2*distance ]
+  color: [ 1, 1, 1 ]
+objects:
+- type: cube
+  transform:
+  - type: rotatey
+    params: [ tilt ]
+  - type: scale
+    params: [ size, size, size ]
+  material:
+    pattern:
+      type: solid
+      colors:
+      - [ 1, 0, 0 ]
+    ambient: 1/size/10
+- type: cylinder
+  params:
+    minimum: -size
+    maximum: size
+  transform:
+  - type: translate
+    params: [ 1 + size, 0, 0 ]
+`)
+	g.Expect(err).To(BeNil())
+	_, cam, err := NewWorld(filepath.Join(dir, "scene.yaml"))
+	g.Expect(err).To(BeNil())
+	g.Expect(cam.FieldOfView).To(BeNumerically("~", math.Pi/3))
+	g.Expect(cam.From).To(Equal(Point{0, 1.5, -5}))
+
+	literal, err := loadScene(g, t.TempDir(), `
+camera:
+  hsize: 100
+  vsize: 50
+  fieldOfView: 1.0471975511965976
+  from: [ 0, 1.5, -5 ]
+  to: [ 0, 1, 0 ]
+  up: [ 0, 1, 0 ]
+fixtures:
+- type: pointlight
+  position: [ -10, 10, -10 ]
+  color: [ 1, 1, 1 ]
+objects:
+- type: cube
+  transform:
+  - type: rotatey
+    params: [ 0.7853981633974483 ]
+  - type: scale
+    params: [ 0.5, 0.5, 0.5 ]
+  material:
+    pattern:
+      type: solid
+      colors:
+      - [ 1, 0, 0 ]
+    ambient: 0.2
+- type: cylinder
+  params:
+    minimum: -0.5
+    maximum: 0.5
+  transform:
+  - type: translate
+    params: [ 1.5, 0, 0 ]
+`)
+	g.Expect(err).To(BeNil())
+	expectSameColors(g, literal, withVars, cam)
+
+	// Expression problems are reported where they are, like any other validation problem
+	tests := []struct {
+		scene string
+		path  string
+	}{
+		{"vars:\n  a: b\n", "vars.a"},
+		{"vars:\n  pi: 3\n", "vars.pi"},
+		{"vars:\n  a: 1\n  a: 2\n", "vars.a"},
+		{"objects:\n- type: torus\n  params:\n    minor: 1/0\n", "objects[0].params.minor"},
+		{"vars:\n  n: 1.5\nfixtures:\n- type: spherelight\n  color: [ 1, 1, 1 ]\n  samples: n\n", "fixtures[0].samples"},
+	}
+	for _, test := range tests {
+		_, err := loadScene(g, t.TempDir(), validCamera+test.scene)
+		var verr *ValidationError
+		g.Expect(errors.As(err, &verr)).To(BeTrue(), test.scene)
+		g.Expect(verr.Problems).To(HaveLen(1), test.scene)
+		g.Expect(verr.Problems[0].Path).To(Equal(test.path), test.scene)
+	}
+}
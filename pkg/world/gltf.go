@@ -0,0 +1,1004 @@
+package world
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/liorokman/raytrace/pkg/fixtures"
+	"github.com/liorokman/raytrace/pkg/material"
+	"github.com/liorokman/raytrace/pkg/matrix"
+	"github.com/liorokman/raytrace/pkg/shapes"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+const (
+	glbMagic     uint32 = 0x46546C67 // "glTF"
+	glbJSONChunk uint32 = 0x4E4F534A // "JSON"
+	glbBINChunk  uint32 = 0x004E4942 // "BIN\0"
+
+	gltfByte          = 5120
+	gltfUnsignedByte  = 5121
+	gltfShort         = 5122
+	gltfUnsignedShort = 5123
+	gltfUnsignedInt   = 5125
+	gltfFloat         = 5126
+
+	gltfTriangles     = 4
+	gltfTriangleStrip = 5
+	gltfTriangleFan   = 6
+
+	// gltfImageHeight is the height of the image rendered through a glTF camera. glTF
+	// cameras only have an aspect ratio, which is 4:3 unless given.
+	gltfImageHeight = 480
+	gltfAspectRatio = 4.0 / 3.0
+
+	// maxZeroAccessorCount is the most elements an accessor without a buffer view may have
+	maxZeroAccessorCount = 1 << 20
+)
+
+// gltfSupportedExtensions are the extensions that a file may require
+var gltfSupportedExtensions = map[string]bool{
+	"KHR_lights_punctual":             true,
+	"KHR_materials_emissive_strength": true,
+	"KHR_materials_ior":               true,
+	"KHR_materials_transmission":      true,
+}
+
+type gltfDoc struct {
+	Asset struct {
+		Version string `json:"version"`
+	} `json:"asset"`
+	ExtensionsRequired []string `json:"extensionsRequired"`
+	Scene              *int     `json:"scene"`
+	Scenes             []struct {
+		Nodes []int `json:"nodes"`
+	} `json:"scenes"`
+	Nodes       []gltfNode       `json:"nodes"`
+	Meshes      []gltfMesh       `json:"meshes"`
+	Accessors   []gltfAccessor   `json:"accessors"`
+	BufferViews []gltfBufferView `json:"bufferViews"`
+	Buffers     []gltfBuffer     `json:"buffers"`
+	Materials   []gltfMaterial   `json:"materials"`
+	Textures    []struct {
+		Source *int `json:"source"`
+	} `json:"textures"`
+	Images     []gltfImage  `json:"images"`
+	Cameras    []gltfCamera `json:"cameras"`
+	Extensions struct {
+		Lights struct {
+			Lights []gltfLight `json:"lights"`
+		} `json:"KHR_lights_punctual"`
+	} `json:"extensions"`
+}
+
+type gltfNode struct {
+	Children    []int     `json:"children"`
+	Mesh        *int      `json:"mesh"`
+	Camera      *int      `json:"camera"`
+	Matrix      []float64 `json:"matrix"`
+	Translation []float64 `json:"translation"`
+	Rotation    []float64 `json:"rotation"`
+	Scale       []float64 `json:"scale"`
+	Extensions  struct {
+		Light struct {
+			Light *int `json:"light"`
+		} `json:"KHR_lights_punctual"`
+	} `json:"extensions"`
+}
+
+type gltfMesh struct {
+	Primitives []struct {
+		Attributes map[string]int `json:"attributes"`
+		Indices    *int           `json:"indices"`
+		Material   *int           `json:"material"`
+		Mode       *int           `json:"mode"`
+	} `json:"primitives"`
+}
+
+type gltfAccessor struct {
+	BufferView    *int            `json:"bufferView"`
+	ByteOffset    int             `json:"byteOffset"`
+	ComponentType int             `json:"componentType"`
+	Normalized    bool            `json:"normalized"`
+	Count         int             `json:"count"`
+	Type          string          `json:"type"`
+	Sparse        json.RawMessage `json:"sparse"`
+}
+
+type gltfBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	ByteStride int `json:"byteStride"`
+}
+
+type gltfBuffer struct {
+	URI        string `json:"uri"`
+	ByteLength int    `json:"byteLength"`
+}
+
+type gltfImage struct {
+	URI        string `json:"uri"`
+	BufferView *int   `json:"bufferView"`
+}
+
+type gltfMaterial struct {
+	PBR struct {
+		BaseColorFactor  []float64 `json:"baseColorFactor"`
+		BaseColorTexture *struct {
+			Index    int `json:"index"`
+			TexCoord int `json:"texCoord"`
+		} `json:"baseColorTexture"`
+		MetallicFactor  *float64 `json:"metallicFactor"`
+		RoughnessFactor *float64 `json:"roughnessFactor"`
+	} `json:"pbrMetallicRoughness"`
+	EmissiveFactor []float64 `json:"emissiveFactor"`
+	AlphaMode      string    `json:"alphaMode"`
+	Extensions     struct {
+		EmissiveStrength *struct {
+			EmissiveStrength float64 `json:"emissiveStrength"`
+		} `json:"KHR_materials_emissive_strength"`
+		IOR *struct {
+			IOR float64 `json:"ior"`
+		} `json:"KHR_materials_ior"`
+		Transmission *struct {
+			TransmissionFactor float64 `json:"transmissionFactor"`
+		} `json:"KHR_materials_transmission"`
+	} `json:"extensions"`
+}
+
+type gltfCamera struct {
+	Type        string `json:"type"`
+	Perspective *struct {
+		AspectRatio *float64 `json:"aspectRatio"`
+		Yfov        float64  `json:"yfov"`
+	} `json:"perspective"`
+}
+
+type gltfLight struct {
+	Type      string    `json:"type"`
+	Color     []float64 `json:"color"`
+	Intensity *float64  `json:"intensity"`
+	Spot      struct {
+		InnerConeAngle float64  `json:"innerConeAngle"`
+		OuterConeAngle *float64 `json:"outerConeAngle"`
+	} `json:"spot"`
+}
+
+// gltfPBR is a glTF material after it's been approximated
+type gltfPBR struct {
+	material  material.Material
+	baseColor tuple.Color
+	textured  bool
+}
+
+type gltfLoader struct {
+	doc       gltfDoc
+	dir       string
+	buffers   [][]byte
+	textures  map[int]*material.Texture
+	materials map[int]gltfPBR
+	meshes    map[int][]shapes.Shape
+	visited   map[int]bool
+
+	world  *World
+	camera *Cam
+}
+
+// NewWorldFromGLTF loads the default scene of a glTF 2.0 file, either a .gltf file with its
+// buffers and images or a binary .glb file, as an alternative to a scene file.
+//
+// The node hierarchy becomes a hierarchy of groups, and every primitive of a mesh becomes
+// a mesh shape. glTF uses a right handed coordinate system, so the whole scene is mirrored
+// along the Z axis, which keeps the rendered image the same. The camera is taken from the
+// first node with a camera, and is placed in front of the scene if there is none. Lights
+// come from the KHR_lights_punctual extension, and fade with the square of the distance.
+//
+// Metallic-roughness materials are approximated: metals lose their diffuse color and
+// become reflective as they get smoother, and rougher materials get a weaker and wider
+// specular highlight. The base color texture replaces the base color factor. Vertex colors
+// are multiplied by the base color factor.
+func NewWorldFromGLTF(file string) (*World, Cam, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, Cam{}, err
+	}
+	l := &gltfLoader{
+		dir:       filepath.Dir(file),
+		textures:  map[int]*material.Texture{},
+		materials: map[int]gltfPBR{},
+		meshes:    map[int][]shapes.Shape{},
+		visited:   map[int]bool{},
+		world: &World{
+			objects:    []shapes.Shape{},
+			Lights:     []fixtures.Light{},
+			bvhOptions: shapes.DefaultBVHOptions(),
+		},
+	}
+	cam, err := l.load(data)
+	if err != nil {
+		return nil, Cam{}, fmt.Errorf("%s: %w", file, err)
+	}
+	return l.world, cam, nil
+}
+
+func (l *gltfLoader) load(data []byte) (Cam, error) {
+	var bin []byte
+	jsonData := data
+	if len(data) >= 4 && binary.LittleEndian.Uint32(data) == glbMagic {
+		var err error
+		if jsonData, bin, err = parseGLB(data); err != nil {
+			return Cam{}, err
+		}
+	}
+	if err := json.Unmarshal(jsonData, &l.doc); err != nil {
+		return Cam{}, err
+	}
+	if !strings.HasPrefix(l.doc.Asset.Version, "2.") {
+		return Cam{}, fmt.Errorf("Unsupported glTF version '%s'", l.doc.Asset.Version)
+	}
+	for _, ext := range l.doc.ExtensionsRequired {
+		if !gltfSupportedExtensions[ext] {
+			return Cam{}, fmt.Errorf("Unsupported required extension %s", ext)
+		}
+	}
+	if err := l.loadBuffers(bin); err != nil {
+		return Cam{}, err
+	}
+
+	scene := 0
+	if l.doc.Scene != nil {
+		scene = *l.doc.Scene
+	}
+	if scene < 0 || scene >= len(l.doc.Scenes) {
+		return Cam{}, fmt.Errorf("The file has no scene %d", scene)
+	}
+	// Mirror the right handed scene into this left handed world
+	mirror := matrix.NewScale(1, 1, -1)
+	root := shapes.NewGroup().WithTransform(mirror)
+	for _, n := range l.doc.Scenes[scene].Nodes {
+		if err := l.addNode(n, root, mirror); err != nil {
+			return Cam{}, err
+		}
+	}
+	if root.InnerShape().(shapes.Group).Size() > 0 {
+		l.world.AddShapes(root)
+	}
+	if l.camera == nil {
+		return defaultGLTFCamera(root), nil
+	}
+	return *l.camera, nil
+}
+
+// parseGLB splits a binary glTF file into its JSON and binary chunks
+func parseGLB(data []byte) ([]byte, []byte, error) {
+	if len(data) < 12 {
+		return nil, nil, fmt.Errorf("The GLB header is truncated")
+	}
+	if version := binary.LittleEndian.Uint32(data[4:]); version != 2 {
+		return nil, nil, fmt.Errorf("Unsupported GLB version %d", version)
+	}
+	length := binary.LittleEndian.Uint32(data[8:])
+	if int(length) > len(data) {
+		return nil, nil, fmt.Errorf("The GLB file is truncated")
+	}
+	var jsonChunk, binChunk []byte
+	for rest := data[12:length]; len(rest) > 0; {
+		if len(rest) < 8 {
+			return nil, nil, fmt.Errorf("The GLB chunk header is truncated")
+		}
+		chunkLength := binary.LittleEndian.Uint32(rest)
+		chunkType := binary.LittleEndian.Uint32(rest[4:])
+		if uint64(chunkLength)+8 > uint64(len(rest)) {
+			return nil, nil, fmt.Errorf("The GLB chunk is truncated")
+		}
+		chunk := rest[8 : 8+chunkLength]
+		switch {
+		case chunkType == glbJSONChunk && jsonChunk == nil:
+			jsonChunk = chunk
+		case chunkType == glbBINChunk && binChunk == nil:
+			binChunk = chunk
+		}
+		rest = rest[8+chunkLength:]
+	}
+	if jsonChunk == nil {
+		return nil, nil, fmt.Errorf("The GLB file has no JSON chunk")
+	}
+	return jsonChunk, binChunk, nil
+}
+
+// readURI reads the data that a URI in the file points to, either embedded in a data URI
+// or in a file next to the glTF file
+func (l *gltfLoader) readURI(uri string) ([]byte, error) {
+	if strings.HasPrefix(uri, "data:") {
+		ind := strings.Index(uri, ";base64,")
+		if ind < 0 {
+			return nil, fmt.Errorf("Only base64 data URIs are supported")
+		}
+		return base64.StdEncoding.DecodeString(uri[ind+len(";base64,"):])
+	}
+	path, err := l.uriFile(uri)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+// uriFile returns the file that a URI that isn't a data URI points to
+func (l *gltfLoader) uriFile(uri string) (string, error) {
+	path, err := url.PathUnescape(uri)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(path)), nil
+}
+
+// gltfFiles returns the buffer and image files that a glTF file reads. Embedded data
+// URIs and the binary chunk of a GLB file aren't files, so they aren't returned.
+func gltfFiles(file string) ([]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	jsonData := data
+	if len(data) >= 4 && binary.LittleEndian.Uint32(data) == glbMagic {
+		if jsonData, _, err = parseGLB(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	l := &gltfLoader{dir: filepath.Dir(file)}
+	if err := json.Unmarshal(jsonData, &l.doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	uris := []string{}
+	for _, b := range l.doc.Buffers {
+		uris = append(uris, b.URI)
+	}
+	for _, image := range l.doc.Images {
+		uris = append(uris, image.URI)
+	}
+	retval := []string{}
+	for _, uri := range uris {
+		if uri == "" || strings.HasPrefix(uri, "data:") {
+			continue
+		}
+		if path, err := l.uriFile(uri); err == nil {
+			retval = append(retval, path)
+		}
+	}
+	return retval, nil
+}
+
+func (l *gltfLoader) loadBuffers(bin []byte) error {
+	l.buffers = make([][]byte, len(l.doc.Buffers))
+	for i, b := range l.doc.Buffers {
+		var data []byte
+		if b.URI == "" {
+			// Only the first buffer of a GLB file may refer to the binary chunk
+			if i != 0 || bin == nil {
+				return fmt.Errorf("Buffer %d has no data", i)
+			}
+			data = bin
+		} else {
+			var err error
+			if data, err = l.readURI(b.URI); err != nil {
+				return fmt.Errorf("Buffer %d: %w", i, err)
+			}
+		}
+		if b.ByteLength < 0 {
+			return fmt.Errorf("Buffer %d has a negative length %d", i, b.ByteLength)
+		}
+		if len(data) < b.ByteLength {
+			return fmt.Errorf("Buffer %d should have %d bytes, but has %d", i, b.ByteLength, len(data))
+		}
+		l.buffers[i] = data[:b.ByteLength]
+	}
+	return nil
+}
+
+// bufferView returns the bytes of a buffer view and its stride
+func (l *gltfLoader) bufferView(index int) ([]byte, int, error) {
+	if index < 0 || index >= len(l.doc.BufferViews) {
+		return nil, 0, fmt.Errorf("Undefined buffer view %d", index)
+	}
+	view := l.doc.BufferViews[index]
+	if view.Buffer < 0 || view.Buffer >= len(l.buffers) {
+		return nil, 0, fmt.Errorf("Buffer view %d refers to undefined buffer %d", index, view.Buffer)
+	}
+	buf := l.buffers[view.Buffer]
+	// The checks are written so that huge values can't overflow
+	if view.ByteOffset < 0 || view.ByteLength < 0 || view.ByteOffset > len(buf) || view.ByteLength > len(buf)-view.ByteOffset {
+		return nil, 0, fmt.Errorf("Buffer view %d is outside of buffer %d", index, view.Buffer)
+	}
+	if view.ByteStride != 0 && (view.ByteStride < 4 || view.ByteStride > 252) {
+		return nil, 0, fmt.Errorf("Buffer view %d has a stride of %d, which should be between 4 and 252", index, view.ByteStride)
+	}
+	return buf[view.ByteOffset : view.ByteOffset+view.ByteLength], view.ByteStride, nil
+}
+
+// accessor reads all the elements of an accessor. Normalized integers are converted to
+// the [0,1] or [-1,1] ranges.
+func (l *gltfLoader) accessor(index int, types ...string) ([][]float64, error) {
+	if index < 0 || index >= len(l.doc.Accessors) {
+		return nil, fmt.Errorf("Undefined accessor %d", index)
+	}
+	acc := l.doc.Accessors[index]
+	if len(acc.Sparse) > 0 {
+		return nil, fmt.Errorf("Accessor %d is sparse, which isn't supported", index)
+	}
+	typeOk := false
+	for _, t := range types {
+		typeOk = typeOk || t == acc.Type
+	}
+	if !typeOk {
+		return nil, fmt.Errorf("Accessor %d should be one of %v, not %s", index, types, acc.Type)
+	}
+	components := map[string]int{"SCALAR": 1, "VEC2": 2, "VEC3": 3, "VEC4": 4}[acc.Type]
+	size := map[int]int{
+		gltfByte: 1, gltfUnsignedByte: 1,
+		gltfShort: 2, gltfUnsignedShort: 2,
+		gltfUnsignedInt: 4, gltfFloat: 4,
+	}[acc.ComponentType]
+	if size == 0 {
+		return nil, fmt.Errorf("Accessor %d has an unknown component type %d", index, acc.ComponentType)
+	}
+	if acc.Count < 0 {
+		return nil, fmt.Errorf("Accessor %d has a negative count %d", index, acc.Count)
+	}
+
+	if acc.BufferView == nil {
+		// An accessor without a buffer view is all zeros. There's no data to check its
+		// count against, so it's limited to keep a broken file from exhausting the memory.
+		if acc.Count > maxZeroAccessorCount {
+			return nil, fmt.Errorf("Accessor %d has %d elements but no buffer view, at most %d are supported", index, acc.Count, maxZeroAccessorCount)
+		}
+		retval := make([][]float64, acc.Count)
+		for i := range retval {
+			retval[i] = make([]float64, components)
+		}
+		return retval, nil
+	}
+	data, stride, err := l.bufferView(*acc.BufferView)
+	if err != nil {
+		return nil, fmt.Errorf("Accessor %d: %w", index, err)
+	}
+	elementSize := components * size
+	if stride == 0 {
+		stride = elementSize
+	} else if stride < elementSize {
+		return nil, fmt.Errorf("Accessor %d has %d byte elements, which don't fit the stride of %d bytes", index, elementSize, stride)
+	}
+	// Every element must be inside the view, and the checks are written so that huge
+	// values can't overflow
+	if acc.ByteOffset < 0 || acc.ByteOffset > len(data) {
+		return nil, fmt.Errorf("Accessor %d is outside of its buffer view", index)
+	}
+	if acc.Count > 0 && (elementSize > len(data)-acc.ByteOffset || acc.Count-1 > (len(data)-acc.ByteOffset-elementSize)/stride) {
+		return nil, fmt.Errorf("Accessor %d is outside of its buffer view", index)
+	}
+	retval := make([][]float64, acc.Count)
+	for i := range retval {
+		element := make([]float64, components)
+		for c := range element {
+			b := data[acc.ByteOffset+i*stride+c*size:]
+			var v float64
+			switch acc.ComponentType {
+			case gltfByte:
+				v = float64(int8(b[0]))
+				if acc.Normalized {
+					v = math.Max(v/127, -1)
+				}
+			case gltfUnsignedByte:
+				v = float64(b[0])
+				if acc.Normalized {
+					v /= 255
+				}
+			case gltfShort:
+				v = float64(int16(binary.LittleEndian.Uint16(b)))
+				if acc.Normalized {
+					v = math.Max(v/32767, -1)
+				}
+			case gltfUnsignedShort:
+				v = float64(binary.LittleEndian.Uint16(b))
+				if acc.Normalized {
+					v /= 65535
+				}
+			case gltfUnsignedInt:
+				v = float64(binary.LittleEndian.Uint32(b))
+			default:
+				v = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+			}
+			element[c] = v
+		}
+		retval[i] = element
+	}
+	return retval, nil
+}
+
+func (l *gltfLoader) texture(index int) (*material.Texture, error) {
+	if t, ok := l.textures[index]; ok {
+		return t, nil
+	}
+	if index < 0 || index >= len(l.doc.Textures) || l.doc.Textures[index].Source == nil {
+		return nil, fmt.Errorf("Undefined texture %d", index)
+	}
+	source := *l.doc.Textures[index].Source
+	if source < 0 || source >= len(l.doc.Images) {
+		return nil, fmt.Errorf("Texture %d refers to undefined image %d", index, source)
+	}
+	image := l.doc.Images[source]
+	var data []byte
+	var err error
+	if image.BufferView != nil {
+		data, _, err = l.bufferView(*image.BufferView)
+	} else {
+		data, err = l.readURI(image.URI)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Image %d: %w", source, err)
+	}
+	t, err := material.DecodeTexture(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("Image %d: %w", source, err)
+	}
+	l.textures[index] = t
+	return t, nil
+}
+
+// gltfColor converts a color given as an array with at least three channels
+func gltfColor(c []float64, def tuple.Color) (tuple.Color, error) {
+	if c == nil {
+		return def, nil
+	}
+	if len(c) < 3 {
+		return tuple.Color{}, fmt.Errorf("A color needs 3 channels, got %d", len(c))
+	}
+	if c[0] < 0 || c[1] < 0 || c[2] < 0 {
+		return tuple.Color{}, fmt.Errorf("Color channels can't be negative")
+	}
+	return tuple.NewColor(c[0], c[1], c[2]), nil
+}
+
+// material approximates a metallic-roughness material. A negative index is the default
+// material of primitives that don't have one.
+func (l *gltfLoader) material(index int) (gltfPBR, error) {
+	if m, ok := l.materials[index]; ok {
+		return m, nil
+	}
+	if index < 0 {
+		return gltfPBR{material: material.Default(), baseColor: tuple.NewColor(1, 1, 1)}, nil
+	}
+	if index >= len(l.doc.Materials) {
+		return gltfPBR{}, fmt.Errorf("Undefined material %d", index)
+	}
+	m, err := l.toPBR(l.doc.Materials[index])
+	if err != nil {
+		return gltfPBR{}, fmt.Errorf("Material %d: %w", index, err)
+	}
+	l.materials[index] = m
+	return m, nil
+}
+
+func (l *gltfLoader) toPBR(in gltfMaterial) (gltfPBR, error) {
+	retval := gltfPBR{}
+	var err error
+	if retval.baseColor, err = gltfColor(in.PBR.BaseColorFactor, tuple.NewColor(1, 1, 1)); err != nil {
+		return retval, err
+	}
+	alpha := 1.0
+	if len(in.PBR.BaseColorFactor) == 4 {
+		alpha = in.PBR.BaseColorFactor[3]
+	}
+	metallic, roughness := 1.0, 1.0
+	if in.PBR.MetallicFactor != nil {
+		metallic = *in.PBR.MetallicFactor
+	}
+	if in.PBR.RoughnessFactor != nil {
+		roughness = *in.PBR.RoughnessFactor
+	}
+	for _, f := range []float64{alpha, metallic, roughness} {
+		if f < 0 || f > 1 {
+			return retval, fmt.Errorf("Factors must be in the [0,1] range")
+		}
+	}
+	emissive, err := gltfColor(in.EmissiveFactor, tuple.NewColor(0, 0, 0))
+	if err != nil {
+		return retval, err
+	}
+	if in.Extensions.EmissiveStrength != nil {
+		emissive = emissive.Mult(math.Max(0, in.Extensions.EmissiveStrength.EmissiveStrength))
+	}
+
+	smoothness := 1 - roughness
+	// The specular exponent of a Blinn-Phong highlight that's about as wide as a
+	// microfacet highlight with the same roughness
+	shininess := 1000.0
+	if alpha := roughness * roughness; alpha > 0 {
+		shininess = math.Max(1, math.Min(1000, 2/(alpha*alpha)-2))
+	}
+	b := material.NewDefaultBuilder().
+		WithColor(retval.baseColor).
+		WithDiffuse(0.9 * (1 - metallic)).
+		WithSpecular(0.1 + 0.8*smoothness).
+		WithShininess(shininess).
+		WithReflective(metallic * smoothness).
+		WithEmissive(emissive)
+
+	transparency := 0.0
+	if in.AlphaMode == "BLEND" {
+		transparency = 1 - alpha
+	}
+	if in.Extensions.Transmission != nil {
+		transparency = math.Max(transparency, math.Max(0, math.Min(1, in.Extensions.Transmission.TransmissionFactor)))
+	}
+	if transparency > 0 {
+		ior := 1.5
+		if in.Extensions.IOR != nil && in.Extensions.IOR.IOR >= 1 {
+			ior = in.Extensions.IOR.IOR
+		}
+		b.WithTransparency(transparency).WithRefractiveIndex(ior)
+	}
+	if tex := in.PBR.BaseColorTexture; tex != nil {
+		if tex.TexCoord != 0 {
+			return retval, fmt.Errorf("Only TEXCOORD_0 is supported for textures")
+		}
+		t, err := l.texture(tex.Index)
+		if err != nil {
+			return retval, err
+		}
+		b.WithPattern(material.NewTextureMapPattern(t, material.ShapeMapping, material.BilinearFilter))
+		retval.textured = true
+	}
+	retval.material = b.Build()
+	return retval, nil
+}
+
+// mesh returns a mesh shape for every primitive of the mesh. Primitives of points and
+// lines are skipped, since they have no surface.
+func (l *gltfLoader) mesh(index int) ([]shapes.Shape, error) {
+	if m, ok := l.meshes[index]; ok {
+		return m, nil
+	}
+	if index < 0 || index >= len(l.doc.Meshes) {
+		return nil, fmt.Errorf("Undefined mesh %d", index)
+	}
+	retval := []shapes.Shape{}
+	for i, p := range l.doc.Meshes[index].Primitives {
+		mode := gltfTriangles
+		if p.Mode != nil {
+			mode = *p.Mode
+		}
+		if mode < gltfTriangles {
+			continue
+		}
+		if mode > gltfTriangleFan {
+			return nil, fmt.Errorf("Mesh %d primitive %d: Unknown mode %d", index, i, mode)
+		}
+		materialIndex := -1
+		if p.Material != nil {
+			materialIndex = *p.Material
+		}
+		pbr, err := l.material(materialIndex)
+		if err != nil {
+			return nil, fmt.Errorf("Mesh %d primitive %d: %w", index, i, err)
+		}
+		s, err := l.primitive(p.Attributes, p.Indices, mode, pbr)
+		if err != nil {
+			return nil, fmt.Errorf("Mesh %d primitive %d: %w", index, i, err)
+		}
+		retval = append(retval, s)
+	}
+	l.meshes[index] = retval
+	return retval, nil
+}
+
+func (l *gltfLoader) primitive(attributes map[string]int, indexAccessor *int, mode int, pbr gltfPBR) (shapes.Shape, error) {
+	positionAccessor, ok := attributes["POSITION"]
+	if !ok {
+		return nil, fmt.Errorf("A primitive needs a POSITION attribute")
+	}
+	positions, err := l.accessor(positionAccessor, "VEC3")
+	if err != nil {
+		return nil, err
+	}
+	vertices := make([]tuple.Tuple, len(positions))
+	for i, p := range positions {
+		vertices[i] = tuple.NewPoint(p[0], p[1], p[2])
+	}
+	var normals []tuple.Tuple
+	if a, ok := attributes["NORMAL"]; ok {
+		values, err := l.accessor(a, "VEC3")
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range values {
+			normals = append(normals, tuple.NewVector(n[0], n[1], n[2]))
+		}
+	}
+	var uvs []shapes.TextureCoord
+	if a, ok := attributes["TEXCOORD_0"]; ok {
+		values, err := l.accessor(a, "VEC2")
+		if err != nil {
+			return nil, err
+		}
+		for _, uv := range values {
+			// glTF textures start at the top left corner
+			uvs = append(uvs, shapes.TextureCoord{U: uv[0], V: 1 - uv[1]})
+		}
+	}
+	var colors []tuple.Color
+	if a, ok := attributes["COLOR_0"]; ok {
+		values, err := l.accessor(a, "VEC3", "VEC4")
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range values {
+			colors = append(colors, tuple.NewColor(c[0], c[1], c[2]).MultColor(pbr.baseColor))
+		}
+	}
+	for name, values := range map[string]int{"NORMAL": len(normals), "TEXCOORD_0": len(uvs), "COLOR_0": len(colors)} {
+		if values > 0 && values != len(vertices) {
+			return nil, fmt.Errorf("%s has %d values but POSITION has %d", name, values, len(vertices))
+		}
+	}
+
+	indices := make([]int, len(vertices))
+	for i := range indices {
+		indices[i] = i
+	}
+	if indexAccessor != nil {
+		values, err := l.accessor(*indexAccessor, "SCALAR")
+		if err != nil {
+			return nil, err
+		}
+		indices = make([]int, len(values))
+		for i, v := range values {
+			indices[i] = int(v[0])
+		}
+	}
+	triangles := [][3]int{}
+	switch mode {
+	case gltfTriangles:
+		for i := 0; i+2 < len(indices); i += 3 {
+			triangles = append(triangles, [3]int{indices[i], indices[i+1], indices[i+2]})
+		}
+	case gltfTriangleStrip:
+		for i := 0; i+2 < len(indices); i++ {
+			triangles = append(triangles, [3]int{indices[i], indices[i+1+i%2], indices[i+2-i%2]})
+		}
+	case gltfTriangleFan:
+		for i := 1; i+1 < len(indices); i++ {
+			triangles = append(triangles, [3]int{indices[0], indices[i], indices[i+1]})
+		}
+	}
+	faces := make([]shapes.MeshFace, len(triangles))
+	for i, t := range triangles {
+		faces[i] = shapes.NewMeshFace(t[0], t[1], t[2])
+		// Normals and texture coordinates are given per vertex
+		if len(normals) > 0 {
+			faces[i].Normals = t
+		}
+		if len(uvs) > 0 {
+			faces[i].UVs = t
+		}
+	}
+	m, err := shapes.NewColoredMesh(vertices, colors, normals, uvs, faces)
+	if err != nil {
+		return nil, err
+	}
+	mat := pbr.material
+	if len(colors) > 0 && !pbr.textured {
+		mat = material.NewBuilder(mat).WithPattern(material.NewVertexColorPattern(pbr.baseColor)).Build()
+	}
+	return m.WithMaterial(mat), nil
+}
+
+// nodeTransform returns the transform of a node relative to its parent
+func nodeTransform(n gltfNode) (matrix.Matrix, error) {
+	if n.Matrix != nil {
+		if len(n.Matrix) != 16 {
+			return matrix.Matrix{}, fmt.Errorf("A matrix needs 16 values, got %d", len(n.Matrix))
+		}
+		// glTF matrices are stored column by column
+		m := matrix.New(4, 4)
+		values := make([]float64, 16)
+		for row := 0; row < 4; row++ {
+			for col := 0; col < 4; col++ {
+				values[row*4+col] = n.Matrix[col*4+row]
+			}
+		}
+		m.Fill(values)
+		return m, nil
+	}
+	retval := matrix.NewIdentity()
+	if n.Translation != nil {
+		if len(n.Translation) != 3 {
+			return matrix.Matrix{}, fmt.Errorf("A translation needs 3 values, got %d", len(n.Translation))
+		}
+		retval = retval.Translate(n.Translation[0], n.Translation[1], n.Translation[2])
+	}
+	if n.Rotation != nil {
+		if len(n.Rotation) != 4 {
+			return matrix.Matrix{}, fmt.Errorf("A rotation needs 4 values, got %d", len(n.Rotation))
+		}
+		retval = retval.RotateQuaternion(n.Rotation[0], n.Rotation[1], n.Rotation[2], n.Rotation[3])
+	}
+	if n.Scale != nil {
+		if len(n.Scale) != 3 {
+			return matrix.Matrix{}, fmt.Errorf("A scale needs 3 values, got %d", len(n.Scale))
+		}
+		retval = retval.Scale(n.Scale[0], n.Scale[1], n.Scale[2])
+	}
+	return retval, nil
+}
+
+// addNode adds a node and its children to the parent group. parentWorld is the transform
+// from the parent's space to the world.
+func (l *gltfLoader) addNode(index int, parent shapes.Shape, parentWorld matrix.Matrix) error {
+	if index < 0 || index >= len(l.doc.Nodes) {
+		return fmt.Errorf("Undefined node %d", index)
+	}
+	if l.visited[index] {
+		return fmt.Errorf("Node %d appears more than once in the scene", index)
+	}
+	l.visited[index] = true
+	n := l.doc.Nodes[index]
+	local, err := nodeTransform(n)
+	if err != nil {
+		return fmt.Errorf("Node %d: %w", index, err)
+	}
+	toWorld := parentWorld.Multiply(local)
+
+	if n.Camera != nil && l.camera == nil {
+		cam, err := l.nodeCamera(*n.Camera, toWorld)
+		if err != nil {
+			return fmt.Errorf("Node %d: %w", index, err)
+		}
+		l.camera = &cam
+	}
+	if n.Extensions.Light.Light != nil {
+		light, err := l.nodeLight(*n.Extensions.Light.Light, toWorld)
+		if err != nil {
+			return fmt.Errorf("Node %d: %w", index, err)
+		}
+		l.world.Lights = append(l.world.Lights, light)
+	}
+	if n.Mesh == nil && len(n.Children) == 0 {
+		return nil
+	}
+
+	// The group has to be connected before its content, since shapes keep a copy of
+	// their parent
+	g, err := shapes.Connect(parent, shapes.NewGroup().WithTransform(local))
+	if err != nil {
+		return err
+	}
+	if n.Mesh != nil {
+		primitives, err := l.mesh(*n.Mesh)
+		if err != nil {
+			return fmt.Errorf("Node %d: %w", index, err)
+		}
+		for _, p := range primitives {
+			if _, err := shapes.Connect(g, p); err != nil {
+				return err
+			}
+		}
+	}
+	for _, c := range n.Children {
+		if err := l.addNode(c, g, toWorld); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nodeCamera converts a camera, which looks along the node's -Z axis with its Y axis up
+func (l *gltfLoader) nodeCamera(index int, toWorld matrix.Matrix) (Cam, error) {
+	if index < 0 || index >= len(l.doc.Cameras) {
+		return Cam{}, fmt.Errorf("Undefined camera %d", index)
+	}
+	c := l.doc.Cameras[index]
+	if c.Type != "perspective" || c.Perspective == nil {
+		return Cam{}, fmt.Errorf("Camera %d: Only perspective cameras are supported", index)
+	}
+	if c.Perspective.Yfov <= 0 || c.Perspective.Yfov >= math.Pi {
+		return Cam{}, fmt.Errorf("Camera %d: The field of view must be between 0 and pi", index)
+	}
+	aspect := gltfAspectRatio
+	if c.Perspective.AspectRatio != nil {
+		aspect = *c.Perspective.AspectRatio
+		if aspect <= 0 {
+			return Cam{}, fmt.Errorf("Camera %d: The aspect ratio must be positive", index)
+		}
+	}
+	retval := newGLTFCam(aspect, c.Perspective.Yfov)
+	from := toWorld.MultiplyTuple(tuple.NewPoint(0, 0, 0))
+	to := toWorld.MultiplyTuple(tuple.NewPoint(0, 0, -1))
+	up := toWorld.MultiplyTuple(tuple.NewVector(0, 1, 0))
+	retval.From = Point{from.X(), from.Y(), from.Z()}
+	retval.To = Point{to.X(), to.Y(), to.Z()}
+	retval.Up = Vector{up.X(), up.Y(), up.Z()}
+	return retval, nil
+}
+
+// newGLTFCam creates a camera with the given aspect ratio and vertical field of view. The
+// camera's field of view is measured along the longer side of the image.
+func newGLTFCam(aspect, yfov float64) Cam {
+	retval := Cam{
+		Hsize:       uint32(math.Max(1, math.Round(gltfImageHeight*aspect))),
+		Vsize:       gltfImageHeight,
+		FieldOfView: yfov,
+	}
+	if retval.Hsize > retval.Vsize {
+		retval.FieldOfView = 2 * math.Atan(math.Tan(yfov/2)*aspect)
+	}
+	return retval
+}
+
+// defaultGLTFCamera looks at the front of the scene, from far enough to see all of it
+func defaultGLTFCamera(root shapes.Shape) Cam {
+	retval := newGLTFCam(gltfAspectRatio, math.Pi/3)
+	center, radius := tuple.NewPoint(0, 0, 0), 1.0
+	if b := root.Bounds(); !b.IsEmpty() {
+		center = b.Center()
+		radius = math.Max(radius, b.Max.Subtract(b.Min).Magnitude()/2)
+	}
+	// The front of a glTF scene faces +Z, which is -Z after mirroring
+	distance := radius/math.Sin(math.Pi/6) + radius
+	retval.From = Point{center.X(), center.Y(), center.Z() - distance}
+	retval.To = Point{center.X(), center.Y(), center.Z()}
+	retval.Up = Vector{0, 1, 0}
+	return retval
+}
+
+// nodeLight converts a punctual light, which shines along the node's -Z axis
+func (l *gltfLoader) nodeLight(index int, toWorld matrix.Matrix) (fixtures.Light, error) {
+	lights := l.doc.Extensions.Lights.Lights
+	if index < 0 || index >= len(lights) {
+		return nil, fmt.Errorf("Undefined light %d", index)
+	}
+	in := lights[index]
+	c, err := gltfColor(in.Color, tuple.NewColor(1, 1, 1))
+	if err != nil {
+		return nil, fmt.Errorf("Light %d: %w", index, err)
+	}
+	intensity := 1.0
+	if in.Intensity != nil {
+		intensity = *in.Intensity
+	}
+	if intensity < 0 {
+		return nil, fmt.Errorf("Light %d: The intensity can't be negative", index)
+	}
+	c = c.Mult(intensity)
+	position := toWorld.MultiplyTuple(tuple.NewPoint(0, 0, 0))
+	direction := toWorld.MultiplyTuple(tuple.NewVector(0, 0, -1))
+	if direction.Magnitude() == 0 {
+		return nil, fmt.Errorf("Light %d: The node's transform has no direction", index)
+	}
+	inverseSquare := fixtures.Attenuation{Quadratic: 1}
+	switch in.Type {
+	case "point":
+		return fixtures.NewPointLight(position, c).WithAttenuation(inverseSquare), nil
+	case "directional":
+		return fixtures.NewDirectionalLight(direction, c), nil
+	case "spot":
+		outer := math.Pi / 4
+		if in.Spot.OuterConeAngle != nil {
+			outer = *in.Spot.OuterConeAngle
+		}
+		if in.Spot.InnerConeAngle < 0 || outer < in.Spot.InnerConeAngle || outer > math.Pi/2 {
+			return nil, fmt.Errorf("Light %d: Spot angles must satisfy 0 <= inner <= outer <= pi/2", index)
+		}
+		return fixtures.NewSpotLight(position, direction, in.Spot.InnerConeAngle, outer, c).WithAttenuation(inverseSquare), nil
+	default:
+		return nil, fmt.Errorf("Light %d: Unknown light type '%s'", index, in.Type)
+	}
+}
@@ -0,0 +1,381 @@
+package world
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/liorokman/raytrace/pkg/fixtures"
+	"github.com/liorokman/raytrace/pkg/material"
+	"github.com/liorokman/raytrace/pkg/shapes"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+// gltfBuilder collects the binary data of a glTF file
+type gltfBuilder struct {
+	bin       bytes.Buffer
+	views     []map[string]interface{}
+	accessors []map[string]interface{}
+}
+
+// view adds raw data to the buffer, and returns the index of its buffer view
+func (b *gltfBuilder) view(g *WithT, data interface{}) int {
+	offset := b.bin.Len()
+	g.Expect(binary.Write(&b.bin, binary.LittleEndian, data)).To(Succeed())
+	length := b.bin.Len() - offset
+	for b.bin.Len()%4 != 0 {
+		b.bin.WriteByte(0)
+	}
+	b.views = append(b.views, map[string]interface{}{"buffer": 0, "byteOffset": offset, "byteLength": length})
+	return len(b.views) - 1
+}
+
+// accessor adds the data to the buffer, and returns the index of its accessor
+func (b *gltfBuilder) accessor(g *WithT, data interface{}, componentType int, typ string, count int) int {
+	b.accessors = append(b.accessors, map[string]interface{}{
+		"bufferView":    b.view(g, data),
+		"componentType": componentType,
+		"type":          typ,
+		"count":         count,
+	})
+	return len(b.accessors) - 1
+}
+
+// doc completes the document, with the buffer either embedded in a data URI or left for
+// the binary chunk of a GLB file
+func (b *gltfBuilder) doc(doc map[string]interface{}, embed bool) map[string]interface{} {
+	buffer := map[string]interface{}{"byteLength": b.bin.Len()}
+	if embed {
+		buffer["uri"] = "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(b.bin.Bytes())
+	}
+	doc["asset"] = map[string]interface{}{"version": "2.0"}
+	doc["buffers"] = []interface{}{buffer}
+	doc["bufferViews"] = b.views
+	doc["accessors"] = b.accessors
+	return doc
+}
+
+// quad adds a unit square in the XY plane, facing +Z, and returns its primitive
+func (b *gltfBuilder) quad(g *WithT, material int) map[string]interface{} {
+	positions := b.accessor(g, []float32{-1, -1, 0, 1, -1, 0, 1, 1, 0, -1, 1, 0}, gltfFloat, "VEC3", 4)
+	normals := b.accessor(g, []float32{0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1}, gltfFloat, "VEC3", 4)
+	uvs := b.accessor(g, []float32{0, 1, 1, 1, 1, 0, 0, 0}, gltfFloat, "VEC2", 4)
+	indices := b.accessor(g, []uint16{0, 1, 2, 0, 2, 3}, gltfUnsignedShort, "SCALAR", 6)
+	return map[string]interface{}{
+		"attributes": map[string]int{"POSITION": positions, "NORMAL": normals, "TEXCOORD_0": uvs},
+		"indices":    indices,
+		"material":   material,
+	}
+}
+
+func writeJSON(g *WithT, filename string, doc interface{}) {
+	data, err := json.Marshal(doc)
+	g.Expect(err).To(BeNil())
+	g.Expect(os.WriteFile(filename, data, 0644)).To(Succeed())
+}
+
+func TestGLTFScene(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	b := &gltfBuilder{}
+	doc := b.doc(map[string]interface{}{
+		"scene": 0,
+		"scenes": []interface{}{
+			map[string]interface{}{"nodes": []int{0, 2, 3, 4, 5}},
+		},
+		"nodes": []interface{}{
+			// The quad is moved back by its parent, and then forward by itself
+			map[string]interface{}{"translation": []float64{0, 0, -2}, "children": []int{1}},
+			map[string]interface{}{"translation": []float64{0, 0, 1}, "mesh": 0},
+			map[string]interface{}{"translation": []float64{0, 0, 5}, "camera": 0},
+			map[string]interface{}{"translation": []float64{1, 2, 3}, "extensions": map[string]interface{}{
+				"KHR_lights_punctual": map[string]interface{}{"light": 0}}},
+			// Rotated to point down
+			map[string]interface{}{"rotation": []float64{-math.Sin(math.Pi / 4), 0, 0, math.Cos(math.Pi / 4)}, "extensions": map[string]interface{}{
+				"KHR_lights_punctual": map[string]interface{}{"light": 1}}},
+			map[string]interface{}{"translation": []float64{0, 0, 4}, "extensions": map[string]interface{}{
+				"KHR_lights_punctual": map[string]interface{}{"light": 2}}},
+		},
+		"meshes": []interface{}{
+			map[string]interface{}{"primitives": []interface{}{b.quad(g, 0)}},
+		},
+		"materials": []interface{}{
+			map[string]interface{}{"pbrMetallicRoughness": map[string]interface{}{
+				"baseColorFactor": []float64{1, 0, 0, 1}, "metallicFactor": 0, "roughnessFactor": 0.5}},
+		},
+		"cameras": []interface{}{
+			map[string]interface{}{"type": "perspective", "perspective": map[string]interface{}{"yfov": 0.8, "aspectRatio": 1.5}},
+		},
+		"extensions": map[string]interface{}{
+			"KHR_lights_punctual": map[string]interface{}{"lights": []interface{}{
+				map[string]interface{}{"type": "point", "color": []float64{1, 1, 0.5}, "intensity": 20},
+				map[string]interface{}{"type": "directional"},
+				map[string]interface{}{"type": "spot", "intensity": 2, "spot": map[string]interface{}{"innerConeAngle": 0.1, "outerConeAngle": 0.3}},
+			}},
+		},
+		"extensionsRequired": []string{"KHR_lights_punctual"},
+	}, true)
+	filename := filepath.Join(t.TempDir(), "scene.gltf")
+	writeJSON(g, filename, doc)
+
+	w, cam, err := NewWorldFromGLTF(filename)
+	g.Expect(err).To(BeNil())
+
+	// The scene is mirrored along the Z axis
+	g.Expect(cam.Vsize).To(Equal(uint32(480)))
+	g.Expect(cam.Hsize).To(Equal(uint32(720)))
+	g.Expect(cam.FieldOfView).To(BeNumerically("~", 2*math.Atan(math.Tan(0.4)*1.5), 1e-9))
+	g.Expect(cam.From).To(Equal(Point{0, 0, -5}))
+	g.Expect(cam.To).To(Equal(Point{0, 0, -4}))
+	g.Expect(cam.Up).To(Equal(Vector{0, 1, 0}))
+
+	g.Expect(w.Lights).To(HaveLen(3))
+	point := w.Lights[0].(fixtures.PointLight)
+	g.Expect(point.Position()).To(Equal(tuple.NewPoint(1, 2, -3)))
+	g.Expect(point.Intensity()).To(Equal(tuple.NewColor(20, 20, 10)))
+	g.Expect(point.Attenuation()).To(Equal(fixtures.Attenuation{Quadratic: 1}))
+	directional := w.Lights[1].(fixtures.DirectionalLight)
+	g.Expect(directional.Direction().Equals(tuple.NewVector(0, -1, 0))).To(BeTrue())
+	spot := w.Lights[2].(fixtures.SpotLight)
+	g.Expect(spot.Position()).To(Equal(tuple.NewPoint(0, 0, -4)))
+	g.Expect(spot.Direction().Equals(tuple.NewVector(0, 0, 1))).To(BeTrue())
+
+	// The quad is at z=-1 in glTF, so z=1 here, facing the camera
+	r, err := shapes.NewRay(tuple.NewPoint(0.5, 0.25, -5), tuple.NewVector(0, 0, 1))
+	g.Expect(err).To(BeNil())
+	xs := w.IntersectRay(r)
+	g.Expect(xs).To(HaveLen(1))
+	g.Expect(xs[0].T).To(BeNumerically("~", 6, 1e-9))
+	comps, err := xs[0].PrepareComputation(r, xs...)
+	g.Expect(err).To(BeNil())
+	g.Expect(comps.NormalV.Equals(tuple.NewVector(0, 0, -1))).To(BeTrue())
+	m := comps.Shape.GetMaterial()
+	g.Expect(m.Pattern.ColorAt(tuple.NewPoint(0, 0, 0))).To(Equal(tuple.NewColor(1, 0, 0)))
+	g.Expect(m.Diffuse()).To(Equal(0.9))
+	g.Expect(m.Reflective()).To(Equal(0.0))
+}
+
+func TestGLTFMaterials(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	l := &gltfLoader{textures: map[int]*material.Texture{}}
+	metal := gltfMaterial{}
+	metal.PBR.MetallicFactor = new(float64)
+	*metal.PBR.MetallicFactor = 1
+	metal.PBR.RoughnessFactor = new(float64)
+	pbr, err := l.toPBR(metal)
+	g.Expect(err).To(BeNil())
+	g.Expect(pbr.material.Diffuse()).To(Equal(0.0))
+	g.Expect(pbr.material.Reflective()).To(Equal(1.0))
+	g.Expect(pbr.material.Specular()).To(Equal(0.9))
+	g.Expect(pbr.material.Shininess()).To(Equal(1000.0))
+
+	// Fully rough dielectrics have a dull, wide highlight
+	var rough gltfMaterial
+	rough.PBR.MetallicFactor = new(float64)
+	pbr, err = l.toPBR(rough)
+	g.Expect(err).To(BeNil())
+	g.Expect(pbr.material.Diffuse()).To(Equal(0.9))
+	g.Expect(pbr.material.Specular()).To(BeNumerically("~", 0.1, 1e-9))
+	g.Expect(pbr.material.Shininess()).To(Equal(1.0))
+	g.Expect(pbr.material.Transparency()).To(Equal(0.0))
+
+	var glass gltfMaterial
+	g.Expect(json.Unmarshal([]byte(`{
+		"pbrMetallicRoughness": {"baseColorFactor": [1, 1, 1, 0.5], "metallicFactor": 0},
+		"emissiveFactor": [0.5, 0.25, 0],
+		"extensions": {
+			"KHR_materials_transmission": {"transmissionFactor": 0.9},
+			"KHR_materials_ior": {"ior": 1.33},
+			"KHR_materials_emissive_strength": {"emissiveStrength": 2}
+		}
+	}`), &glass)).To(Succeed())
+	pbr, err = l.toPBR(glass)
+	g.Expect(err).To(BeNil())
+	g.Expect(pbr.material.Transparency()).To(Equal(0.9))
+	g.Expect(pbr.material.RefractiveIndex()).To(Equal(1.33))
+	g.Expect(pbr.material.Emissive()).To(Equal(tuple.NewColor(1, 0.5, 0)))
+
+	// Alpha only counts when the material is blended
+	glass.Extensions.Transmission = nil
+	pbr, err = l.toPBR(glass)
+	g.Expect(err).To(BeNil())
+	g.Expect(pbr.material.Transparency()).To(Equal(0.0))
+	glass.AlphaMode = "BLEND"
+	pbr, err = l.toPBR(glass)
+	g.Expect(err).To(BeNil())
+	g.Expect(pbr.material.Transparency()).To(Equal(0.5))
+
+	var bad gltfMaterial
+	bad.PBR.RoughnessFactor = new(float64)
+	*bad.PBR.RoughnessFactor = 2
+	_, err = l.toPBR(bad)
+	g.Expect(err).ToNot(BeNil())
+}
+
+func TestGLB(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	b := &gltfBuilder{}
+	quad := b.quad(g, 0)
+	// A 1x2 image, green on top and blue at the bottom
+	image := b.view(g, []byte("P3\n1 2\n255\n0 255 0\n0 0 255\n"))
+	// Vertex colors on a triangle strip without a material
+	positions := b.accessor(g, []float32{0, 0, 5, 1, 0, 5, 0, 1, 5, 1, 1, 5}, gltfFloat, "VEC3", 4)
+	colors := b.accessor(g, []uint8{255, 0, 0, 255, 255, 0, 0, 255, 255, 0, 0, 255, 255, 0, 0, 255}, gltfUnsignedByte, "VEC4", 4)
+	b.accessors[colors]["normalized"] = true
+	doc := b.doc(map[string]interface{}{
+		"scenes": []interface{}{map[string]interface{}{"nodes": []int{0, 1}}},
+		"nodes": []interface{}{
+			// Column major: scale by 2 and move along X
+			map[string]interface{}{"mesh": 0, "matrix": []float64{2, 0, 0, 0, 0, 2, 0, 0, 0, 0, 2, 0, 10, 0, 0, 1}},
+			map[string]interface{}{"mesh": 1},
+		},
+		"meshes": []interface{}{
+			map[string]interface{}{"primitives": []interface{}{quad}},
+			map[string]interface{}{"primitives": []interface{}{
+				map[string]interface{}{"attributes": map[string]int{"POSITION": positions, "COLOR_0": colors}, "mode": gltfTriangleStrip},
+				// Lines are skipped
+				map[string]interface{}{"attributes": map[string]int{"POSITION": positions}, "mode": 1},
+			}},
+		},
+		"materials": []interface{}{
+			map[string]interface{}{"pbrMetallicRoughness": map[string]interface{}{"baseColorTexture": map[string]interface{}{"index": 0}}},
+		},
+		"textures": []interface{}{map[string]interface{}{"source": 0}},
+		"images":   []interface{}{map[string]interface{}{"bufferView": image, "mimeType": "image/x-portable-pixmap"}},
+	}, false)
+	jsonData, err := json.Marshal(doc)
+	g.Expect(err).To(BeNil())
+	for len(jsonData)%4 != 0 {
+		jsonData = append(jsonData, ' ')
+	}
+	var glb bytes.Buffer
+	g.Expect(binary.Write(&glb, binary.LittleEndian, []uint32{glbMagic, 2, uint32(12 + 8 + len(jsonData) + 8 + b.bin.Len())})).To(Succeed())
+	g.Expect(binary.Write(&glb, binary.LittleEndian, []uint32{uint32(len(jsonData)), glbJSONChunk})).To(Succeed())
+	glb.Write(jsonData)
+	g.Expect(binary.Write(&glb, binary.LittleEndian, []uint32{uint32(b.bin.Len()), glbBINChunk})).To(Succeed())
+	glb.Write(b.bin.Bytes())
+	filename := filepath.Join(t.TempDir(), "scene.glb")
+	g.Expect(os.WriteFile(filename, glb.Bytes(), 0644)).To(Succeed())
+
+	w, cam, err := NewWorldFromGLTF(filename)
+	g.Expect(err).To(BeNil())
+	g.Expect(w.Lights).To(BeEmpty())
+	// Without a camera, the scene is seen from the front
+	g.Expect(cam.From[2]).To(BeNumerically("<", -5))
+
+	colorAt := func(x, y float64) tuple.Color {
+		r, err := shapes.NewRay(tuple.NewPoint(x, y, -20), tuple.NewVector(0, 0, 1))
+		g.Expect(err).To(BeNil())
+		xs := w.IntersectRay(r)
+		g.Expect(xs).To(HaveLen(1))
+		p := r.Position(xs[0].T)
+		return xs[0].Shape.GetMaterial().Pattern.PatternAtObject(xs[0].Shape, p)
+	}
+	// The top of the texture is at the top of the quad
+	g.Expect(colorAt(10, 1)).To(Equal(tuple.NewColor(0, 1, 0)))
+	g.Expect(colorAt(10, -1)).To(Equal(tuple.NewColor(0, 0, 1)))
+	g.Expect(colorAt(0.1, 0.1)).To(Equal(tuple.NewColor(1, 0, 0)))
+}
+
+func TestGLTFErrors(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	scene := func(extra map[string]interface{}) map[string]interface{} {
+		doc := map[string]interface{}{
+			"asset":  map[string]interface{}{"version": "2.0"},
+			"scenes": []interface{}{map[string]interface{}{"nodes": []int{0}}},
+			"nodes":  []interface{}{map[string]interface{}{}},
+		}
+		for k, v := range extra {
+			doc[k] = v
+		}
+		return doc
+	}
+	// positions is a mesh whose positions are read through an accessor and a buffer view
+	// with the given fields
+	positions := func(accessor, view map[string]interface{}) map[string]interface{} {
+		acc := map[string]interface{}{"bufferView": 0, "componentType": gltfFloat, "type": "VEC3", "count": 1}
+		for k, v := range accessor {
+			if v == nil {
+				delete(acc, k)
+			} else {
+				acc[k] = v
+			}
+		}
+		bv := map[string]interface{}{"buffer": 0, "byteLength": 24}
+		for k, v := range view {
+			bv[k] = v
+		}
+		return scene(map[string]interface{}{
+			"nodes":       []interface{}{map[string]interface{}{"mesh": 0}},
+			"meshes":      []interface{}{map[string]interface{}{"primitives": []interface{}{map[string]interface{}{"attributes": map[string]int{"POSITION": 0}}}}},
+			"accessors":   []interface{}{acc},
+			"bufferViews": []interface{}{bv},
+			"buffers": []interface{}{map[string]interface{}{"byteLength": 24, "uri": "data:application/octet-stream;base64," +
+				base64.StdEncoding.EncodeToString(make([]byte, 24))}},
+		})
+	}
+	tests := []struct {
+		doc      map[string]interface{}
+		expected string
+	}{
+		{map[string]interface{}{"asset": map[string]interface{}{"version": "1.0"}}, "Unsupported glTF version '1.0'"},
+		{scene(map[string]interface{}{"extensionsRequired": []string{"KHR_draco_mesh_compression"}}), "Unsupported required extension KHR_draco_mesh_compression"},
+		{scene(map[string]interface{}{"scene": 3}), "The file has no scene 3"},
+		{scene(map[string]interface{}{"nodes": []interface{}{map[string]interface{}{"children": []int{0}}}}), "Node 0 appears more than once in the scene"},
+		{scene(map[string]interface{}{"nodes": []interface{}{map[string]interface{}{"mesh": 0}}}), "Node 0: Undefined mesh 0"},
+		{scene(map[string]interface{}{"nodes": []interface{}{map[string]interface{}{"scale": []float64{1, 2}}}}), "Node 0: A scale needs 3 values, got 2"},
+		{scene(map[string]interface{}{
+			"nodes":   []interface{}{map[string]interface{}{"camera": 0}},
+			"cameras": []interface{}{map[string]interface{}{"type": "orthographic"}},
+		}), "Camera 0: Only perspective cameras are supported"},
+		{scene(map[string]interface{}{
+			"nodes":  []interface{}{map[string]interface{}{"mesh": 0}},
+			"meshes": []interface{}{map[string]interface{}{"primitives": []interface{}{map[string]interface{}{"attributes": map[string]int{"POSITION": 0}}}}},
+		}), "Mesh 0 primitive 0: Undefined accessor 0"},
+		{scene(map[string]interface{}{
+			"nodes":       []interface{}{map[string]interface{}{"mesh": 0}},
+			"meshes":      []interface{}{map[string]interface{}{"primitives": []interface{}{map[string]interface{}{"attributes": map[string]int{"POSITION": 0}}}}},
+			"accessors":   []interface{}{map[string]interface{}{"bufferView": 0, "componentType": gltfFloat, "type": "VEC3", "count": 3}},
+			"bufferViews": []interface{}{map[string]interface{}{"buffer": 0, "byteLength": 12}},
+			"buffers": []interface{}{map[string]interface{}{"byteLength": 12, "uri": "data:application/octet-stream;base64," +
+				base64.StdEncoding.EncodeToString(make([]byte, 12))}},
+		}), "Mesh 0 primitive 0: Accessor 0 is outside of its buffer view"},
+		{scene(map[string]interface{}{
+			"buffers": []interface{}{map[string]interface{}{"byteLength": 12, "uri": "missing.bin"}},
+		}), "Buffer 0: open"},
+		{scene(map[string]interface{}{
+			"buffers": []interface{}{map[string]interface{}{"byteLength": -1, "uri": "data:application/octet-stream;base64,"}},
+		}), "Buffer 0 has a negative length -1"},
+		{positions(map[string]interface{}{"count": -1}, nil), "Accessor 0 has a negative count -1"},
+		{positions(map[string]interface{}{"count": math.MaxInt64}, nil), "Accessor 0 is outside of its buffer view"},
+		{positions(map[string]interface{}{"count": 1, "byteOffset": math.MaxInt64}, nil), "Accessor 0 is outside of its buffer view"},
+		{positions(map[string]interface{}{"count": 1, "byteOffset": -4}, nil), "Accessor 0 is outside of its buffer view"},
+		{positions(map[string]interface{}{"count": 2}, map[string]interface{}{"byteStride": -12}), "Buffer view 0 has a stride of -12"},
+		{positions(map[string]interface{}{"count": 2}, map[string]interface{}{"byteStride": 8}), "don't fit the stride of 8 bytes"},
+		{positions(map[string]interface{}{"count": 1}, map[string]interface{}{"byteOffset": math.MaxInt64}), "Buffer view 0 is outside of buffer 0"},
+		{positions(map[string]interface{}{"count": 1}, map[string]interface{}{"byteLength": -1}), "Buffer view 0 is outside of buffer 0"},
+		{positions(map[string]interface{}{"count": math.MaxInt32, "bufferView": nil}, nil), "has 2147483647 elements but no buffer view"},
+	}
+	for _, test := range tests {
+		filename := filepath.Join(t.TempDir(), "scene.gltf")
+		writeJSON(g, filename, test.doc)
+		_, _, err := NewWorldFromGLTF(filename)
+		g.Expect(err).To(HaveOccurred(), "%v", test.doc)
+		g.Expect(err.Error()).To(ContainSubstring(test.expected))
+	}
+
+	filename := filepath.Join(t.TempDir(), "truncated.glb")
+	g.Expect(os.WriteFile(filename, []byte{'g', 'l', 'T', 'F', 2, 0, 0, 0, 100, 0, 0, 0}, 0644)).To(Succeed())
+	_, _, err := NewWorldFromGLTF(filename)
+	g.Expect(err).To(MatchError(ContainSubstring("The GLB file is truncated")))
+}
@@ -0,0 +1,188 @@
+package world
+
+import (
+	"math"
+	"math/rand/v2"
+
+	"github.com/liorokman/raytrace/pkg/shapes"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+// Integrator computes the color seen along a camera ray. Integrators that need random
+// numbers draw them from rng, so a render with the same seed is reproducible.
+type Integrator interface {
+	Radiance(w *World, r shapes.Ray, rng *rand.Rand) (tuple.Color, error)
+}
+
+// Whitted is the classic ray tracer: Phong shading with perfect reflections and
+// refractions, up to Depth bounces deep. Jittered lights draw their samples from rng.
+type Whitted struct {
+	Depth int
+}
+
+func (i Whitted) Radiance(w *World, r shapes.Ray, rng *rand.Rand) (tuple.Color, error) {
+	return w.colorAt(r, i.Depth, rng)
+}
+
+// PathTracer is a Monte Carlo path tracer. Diffuse surfaces bounce light in random
+// directions, which adds the light reflected between the objects and the light of
+// emissive materials. The lights of the world are sampled directly at every bounce.
+type PathTracer struct {
+	// Samples is the number of paths traced for every camera ray
+	Samples int
+	// MaxDepth is the maximum number of bounces of a single path
+	MaxDepth int
+	// RouletteDepth is the number of bounces after which paths are randomly terminated,
+	// with a probability that grows as the path contributes less to the result
+	RouletteDepth int
+}
+
+func DefaultPathTracer() PathTracer {
+	return PathTracer{
+		Samples:       1,
+		MaxDepth:      8,
+		RouletteDepth: 3,
+	}
+}
+
+func (p PathTracer) Radiance(w *World, r shapes.Ray, rng *rand.Rand) (tuple.Color, error) {
+	samples := max(p.Samples, 1)
+	retval := tuple.Black
+	for i := 0; i < samples; i++ {
+		c, err := p.tracePath(w, r, rng)
+		if err != nil {
+			return tuple.Color{}, err
+		}
+		retval = retval.Add(c)
+	}
+	return retval.Mult(1.0 / float64(samples)), nil
+}
+
+func (p PathTracer) tracePath(w *World, r shapes.Ray, rng *rand.Rand) (tuple.Color, error) {
+	retval := tuple.Black
+	throughput := tuple.White
+	for depth := 0; depth < p.MaxDepth; depth++ {
+		xs := w.IntersectRay(r)
+		hit, ok := shapes.Hit(xs...)
+		if !ok {
+			break
+		}
+		comps, err := hit.PrepareComputation(r, xs...)
+		if err != nil {
+			return tuple.Color{}, err
+		}
+		m := comps.Shape.GetMaterial()
+		color := m.Pattern.PatternAtObject(comps.Shape, comps.Point)
+
+		retval = retval.Add(throughput.MultColor(m.Emissive()))
+		if m.Diffuse() > 0 {
+			retval = retval.Add(throughput.MultColor(p.directLight(w, comps, color.Mult(m.Diffuse()), rng)))
+		}
+
+		// Pick how the path continues, in proportion to the strength of each kind of bounce
+		diffuseW, reflectW, refractW := m.Diffuse(), m.Reflective(), m.Transparency()
+		if reflectW > 0 && refractW > 0 {
+			reflectance := comps.Schlick()
+			reflectW, refractW = reflectW*reflectance, refractW*(1-reflectance)
+		}
+		total := diffuseW + reflectW + refractW
+		if total <= 0 {
+			break
+		}
+		throughput = throughput.Mult(total)
+		var next shapes.Ray
+		switch choice := rng.Float64() * total; {
+		case choice < diffuseW:
+			throughput = throughput.MultColor(color)
+			next, err = shapes.NewRay(comps.OverPoint, cosineHemisphere(comps.NormalV, rng))
+		case choice < diffuseW+reflectW:
+			next, err = shapes.NewRay(comps.OverPoint, comps.ReflectV)
+		default:
+			if direction, ok := refraction(comps); ok {
+				next, err = shapes.NewRay(comps.UnderPoint, direction)
+			} else {
+				next, err = shapes.NewRay(comps.OverPoint, comps.ReflectV)
+			}
+		}
+		if err != nil {
+			return tuple.Color{}, err
+		}
+		r = next.WithTime(r.Time)
+
+		if depth+1 >= p.RouletteDepth {
+			survival := math.Min(0.95, math.Max(throughput.Red(), math.Max(throughput.Green(), throughput.Blue())))
+			if survival <= 0 || rng.Float64() >= survival {
+				break
+			}
+			throughput = throughput.Mult(1 / survival)
+		}
+	}
+	return retval, nil
+}
+
+// directLight samples a single light, chosen with a probability proportional to the
+// brightness of its light at the point, and returns the diffuse light it contributes
+func (p PathTracer) directLight(w *World, comps shapes.Computation, albedo tuple.Color, rng *rand.Rand) tuple.Color {
+	if len(w.Lights) == 0 {
+		return tuple.Black
+	}
+	weights := make([]float64, len(w.Lights))
+	total := 0.0
+	for i, l := range w.Lights {
+		weights[i] = luminance(l.IntensityAt(comps.Point))
+		total += weights[i]
+	}
+	if total <= 0 {
+		return tuple.Black
+	}
+	choice := rng.Float64() * total
+	chosen := len(w.Lights) - 1
+	for i, wt := range weights {
+		if choice < wt {
+			chosen = i
+			break
+		}
+		choice -= wt
+	}
+	light := w.Lights[chosen]
+	samples := light.Sample(comps.OverPoint, rng)
+	sample := samples[rng.IntN(len(samples))]
+	cos := sample.Direction.Dot(comps.NormalV)
+	if cos <= 0 || w.isShadowedAlong(comps.OverPoint, sample, comps.Time) {
+		return tuple.Black
+	}
+	pdf := weights[chosen] / total
+	return albedo.MultColor(light.IntensityAt(comps.Point)).Mult(cos / pdf)
+}
+
+func luminance(c tuple.Color) float64 {
+	return 0.2126*c.Red() + 0.7152*c.Green() + 0.0722*c.Blue()
+}
+
+// refraction returns the direction of the refracted ray, or false on total internal reflection
+func refraction(comps shapes.Computation) (tuple.Tuple, bool) {
+	nRatio := comps.N1 / comps.N2
+	cosI := comps.EyeV.Dot(comps.NormalV)
+	sin2t := nRatio * nRatio * (1 - cosI*cosI)
+	if sin2t > 1 {
+		return tuple.Tuple{}, false
+	}
+	cosT := math.Sqrt(1.0 - sin2t)
+	return comps.NormalV.Mult(nRatio*cosI - cosT).Subtract(comps.EyeV.Mult(nRatio)), true
+}
+
+// cosineHemisphere picks a random direction around the normal, preferring directions
+// close to the normal the same way a diffuse surface does
+func cosineHemisphere(normal tuple.Tuple, rng *rand.Rand) tuple.Tuple {
+	helper := tuple.NewVector(1, 0, 0)
+	if math.Abs(normal.X()) > 0.9 {
+		helper = tuple.NewVector(0, 1, 0)
+	}
+	u := normal.Cross(helper).Normalize()
+	v := normal.Cross(u)
+
+	phi := 2 * math.Pi * rng.Float64()
+	r2 := rng.Float64()
+	radius := math.Sqrt(r2)
+	return u.Mult(radius * math.Cos(phi)).Add(v.Mult(radius * math.Sin(phi))).Add(normal.Mult(math.Sqrt(1 - r2))).Normalize()
+}
@@ -0,0 +1,113 @@
+package world
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/liorokman/raytrace/pkg/fixtures"
+	"github.com/liorokman/raytrace/pkg/material"
+	"github.com/liorokman/raytrace/pkg/matrix"
+	"github.com/liorokman/raytrace/pkg/shapes"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+// matteMaterial only has a diffuse component, so both integrators agree on direct light
+func matteMaterial(c tuple.Color) material.Material {
+	return material.NewDefaultBuilder().WithColor(c).WithAmbient(0).WithSpecular(0).WithDiffuse(0.8).Build()
+}
+
+// cornerScene has a floor and a wall lit by a light. The part of the floor under the
+// roof is only lit by the light bouncing off the wall and the rest of the floor.
+func cornerScene() *World {
+	w := New()
+	w.Lights = []fixtures.Light{fixtures.NewPointLight(tuple.NewPoint(-5, 5, 0), tuple.NewColor(1, 1, 1))}
+	w.AddShapes(
+		shapes.NewPlane().WithMaterial(matteMaterial(tuple.White)),
+		shapes.NewPlane().WithTransform(matrix.NewTranslation(3, 0, 0).RotateZ(1.5707963267948966)).WithMaterial(matteMaterial(tuple.White)),
+		shapes.NewCube().WithTransform(matrix.NewTranslation(-0.5, 2, 0).Scale(3.5, 0.1, 10)).WithMaterial(matteMaterial(tuple.White)),
+	)
+	return w
+}
+
+func TestPathTracerIsDeterministic(t *testing.T) {
+	g := NewGomegaWithT(t)
+	w := cornerScene()
+	r, err := shapes.NewRay(tuple.NewPoint(1, 1, -5), tuple.NewVector(0, -0.2, 1).Normalize())
+	g.Expect(err).To(BeNil())
+
+	pt := DefaultPathTracer()
+	pt.Samples = 16
+	trace := func(seed uint64) tuple.Color {
+		c, err := pt.Radiance(w, r, rand.New(rand.NewPCG(seed, 0)))
+		g.Expect(err).To(BeNil())
+		return c
+	}
+	first := trace(7)
+	g.Expect(trace(7)).To(Equal(first))
+	g.Expect(trace(8)).ToNot(Equal(first))
+}
+
+func TestPathTracerDirectLightMatchesWhitted(t *testing.T) {
+	g := NewGomegaWithT(t)
+	w := New()
+	w.AddShapes(shapes.NewPlane().WithMaterial(matteMaterial(tuple.NewColor(1, 0.5, 0.25))))
+
+	r, err := shapes.NewRay(tuple.NewPoint(0, 1, -3), tuple.NewVector(0, -1, 1).Normalize())
+	g.Expect(err).To(BeNil())
+	whitted, err := Whitted{Depth: 4}.Radiance(w, r, nil)
+	g.Expect(err).To(BeNil())
+	// Nothing reflects the bounced rays back, so only the direct light is left
+	path, err := DefaultPathTracer().Radiance(w, r, rand.New(rand.NewPCG(1, 2)))
+	g.Expect(err).To(BeNil())
+	g.Expect(path.Equals(whitted)).To(BeTrue())
+	g.Expect(path.Red()).To(BeNumerically(">", 0))
+}
+
+func TestPathTracerEmissive(t *testing.T) {
+	g := NewGomegaWithT(t)
+	w := New()
+	w.Lights = nil
+	glow := material.NewDefaultBuilder().WithEmissive(tuple.NewColor(2, 1, 0)).WithDiffuse(0).Build()
+	w.AddShapes(shapes.NewSphere().WithMaterial(glow))
+
+	r, err := shapes.NewRay(tuple.NewPoint(0, 0, -5), tuple.NewVector(0, 0, 1))
+	g.Expect(err).To(BeNil())
+	c, err := DefaultPathTracer().Radiance(w, r, rand.New(rand.NewPCG(1, 2)))
+	g.Expect(err).To(BeNil())
+	g.Expect(c).To(Equal(tuple.NewColor(2, 1, 0)))
+	c, err = w.ColorAt(r, 4)
+	g.Expect(err).To(BeNil())
+	g.Expect(c).To(Equal(tuple.NewColor(2, 1, 0)))
+
+	// An emissive sphere lights a matte floor without any lights in the world
+	w.AddShapes(shapes.NewPlane().WithTransform(matrix.NewTranslation(0, -1.5, 0)).WithMaterial(matteMaterial(tuple.White)))
+	r, err = shapes.NewRay(tuple.NewPoint(0, 0, -5), tuple.NewVector(0, -1.5, 4).Normalize())
+	g.Expect(err).To(BeNil())
+	pt := DefaultPathTracer()
+	pt.Samples = 64
+	c, err = pt.Radiance(w, r, rand.New(rand.NewPCG(1, 2)))
+	g.Expect(err).To(BeNil())
+	g.Expect(c.Red()).To(BeNumerically(">", 0))
+	g.Expect(c.Blue()).To(Equal(0.0))
+}
+
+func TestPathTracerIndirectLight(t *testing.T) {
+	g := NewGomegaWithT(t)
+	w := cornerScene()
+
+	// A point on the floor under the roof can't see the light
+	r, err := shapes.NewRay(tuple.NewPoint(1, 1, -0.5), tuple.NewVector(0, -1, 0.1).Normalize())
+	g.Expect(err).To(BeNil())
+	whitted, err := w.ColorAt(r, 4)
+	g.Expect(err).To(BeNil())
+	g.Expect(whitted).To(Equal(tuple.Black))
+
+	pt := DefaultPathTracer()
+	pt.Samples = 256
+	path, err := pt.Radiance(w, r, rand.New(rand.NewPCG(3, 4)))
+	g.Expect(err).To(BeNil())
+	g.Expect(path.Red()).To(BeNumerically(">", 0.01))
+	g.Expect(path.Red()).To(Equal(path.Green()))
+}
@@ -0,0 +1,98 @@
+package world
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/liorokman/raytrace/pkg/shapes"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+// readMeshFile reads a mesh from a file, choosing the loader by the file's extension. All
+// the loaders return a group of meshes.
+func readMeshFile(filename string) (shapes.Shape, error) {
+	switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+	case ".obj":
+		objIn := newObjReader()
+		if err := objIn.ReadObj(filename); err != nil {
+			return nil, err
+		}
+		return objIn.AsGroup(), nil
+	case ".ply":
+		return readPly(filename)
+	case ".stl":
+		return readStl(filename)
+	default:
+		return nil, fmt.Errorf("%s: Unsupported mesh file type '%s'", filename, ext)
+	}
+}
+
+// meshArrays holds the data of a mesh, as given to shapes.NewColoredMesh
+type meshArrays struct {
+	vertices []tuple.Tuple
+	colors   []tuple.Color
+	normals  []tuple.Tuple
+	uvs      []shapes.TextureCoord
+	faces    []shapes.MeshFace
+}
+
+// compact returns the mesh with only the vertices, normals and texture coordinates that
+// its faces use, numbered in the order the faces first use them. The colors follow their
+// vertices.
+func (m meshArrays) compact() meshArrays {
+	vertices, normals, uvs := renumbering{}, renumbering{}, renumbering{}
+	retval := meshArrays{faces: make([]shapes.MeshFace, len(m.faces))}
+	for i, f := range m.faces {
+		for j := range f.Vertices {
+			retval.faces[i].Vertices[j] = vertices.of(f.Vertices[j])
+			retval.faces[i].Normals[j] = normals.of(f.Normals[j])
+			retval.faces[i].UVs[j] = uvs.of(f.UVs[j])
+		}
+	}
+	retval.vertices = pick(m.vertices, vertices.used)
+	if len(m.colors) > 0 {
+		retval.colors = pick(m.colors, vertices.used)
+	}
+	retval.normals = pick(m.normals, normals.used)
+	retval.uvs = pick(m.uvs, uvs.used)
+	return retval
+}
+
+// renumbering gives the elements of a slice new consecutive indices, in the order they're
+// first asked for
+type renumbering struct {
+	index map[int]int
+	// used holds the old index of every new index
+	used []int
+}
+
+// of returns the new index of an element. Negative indices mean there's no element, and
+// are kept as they are.
+func (r *renumbering) of(old int) int {
+	if old < 0 {
+		return old
+	}
+	if n, ok := r.index[old]; ok {
+		return n
+	}
+	if r.index == nil {
+		r.index = map[int]int{}
+	}
+	n := len(r.used)
+	r.index[old] = n
+	r.used = append(r.used, old)
+	return n
+}
+
+// pick returns the elements of a slice at the given indices
+func pick[T any](from []T, indices []int) []T {
+	if len(indices) == 0 {
+		return nil
+	}
+	retval := make([]T, len(indices))
+	for i, ind := range indices {
+		retval[i] = from[ind]
+	}
+	return retval
+}
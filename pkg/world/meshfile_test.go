@@ -0,0 +1,248 @@
+package world
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/liorokman/raytrace/pkg/shapes"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+// meshOf returns the single mesh in a group loaded from a mesh file
+func meshOf(g *WithT, s shapes.Shape) shapes.Shape {
+	grp, ok := s.InnerShape().(shapes.Group)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(grp.Size()).To(Equal(1))
+	return grp.Children()[0]
+}
+
+// hitAt intersects the mesh with a ray going along the Z axis and returns the hit
+func hitAt(g *WithT, m shapes.Shape, x, y float64) shapes.Intersection {
+	r, err := shapes.NewRay(tuple.NewPoint(x, y, -5), tuple.NewVector(0, 0, 1))
+	g.Expect(err).To(BeNil())
+	xs := m.LocalIntersect(r)
+	g.Expect(xs).To(HaveLen(1))
+	return xs[0]
+}
+
+const asciiPly = `ply
+format ascii 1.0
+comment A square made of a triangle and a quad
+element vertex 4
+property float x
+property float y
+property float z
+property float nx
+property float ny
+property float nz
+property uchar red
+property uchar green
+property uchar blue
+property float u
+property float v
+element face 1
+property list uchar int vertex_indices
+element edge 1
+property int vertex1
+property int vertex2
+end_header
+0 0 0 0 0 -1 255 0 0 0 0
+1 0 0 0 0 -1 0 255 0 1 0
+1 1 0 0 0 -1 0 0 255 1 1
+0 1 0 0 0 -1 255 255 255 0 1
+4 0 1 2 3
+0 1
+`
+
+func TestPlyAscii(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	filename := filepath.Join(t.TempDir(), "square.ply")
+	g.Expect(os.WriteFile(filename, []byte(asciiPly), 0644)).To(Succeed())
+	s, err := readMeshFile(filename)
+	g.Expect(err).To(BeNil())
+	m := meshOf(g, s)
+	g.Expect(m.InnerShape().(shapes.Mesh).Size()).To(Equal(2))
+
+	// At the first vertex the color is red
+	hit := hitAt(g, m, 0.01, 0.005)
+	c := m.GetMaterial().Pattern.PatternAtObject(hit.Shape, tuple.NewPoint(0.01, 0.005, 0))
+	g.Expect(c.Equals(tuple.NewColor(0.99, 0.005, 0.005))).To(BeTrue(), "%v", c)
+	u, v := hit.Shape.UVAt(tuple.NewPoint(0.01, 0.005, 0))
+	g.Expect(u).To(BeNumerically("~", 0.01, 1e-9))
+	g.Expect(v).To(BeNumerically("~", 0.005, 1e-9))
+	n, err := hit.Shape.NormalAt(tuple.NewPoint(0.01, 0.005, 0), hit)
+	g.Expect(err).To(BeNil())
+	g.Expect(n.Equals(tuple.NewVector(0, 0, -1))).To(BeTrue())
+}
+
+func writeBinaryPly(g *WithT, filename string, order binary.ByteOrder, format string) {
+	var buf bytes.Buffer
+	buf.WriteString("ply\nformat " + format + " 1.0\nelement vertex 3\nproperty double x\nproperty double y\nproperty double z\n" +
+		"property float red\nproperty float green\nproperty float blue\n" +
+		"element face 1\nproperty uchar intensity\nproperty list uchar uint vertex_index\nend_header\n")
+	for _, v := range [][6]float64{{0, 0, 0, 1, 0, 0}, {1, 0, 0, 1, 0, 0}, {0, 1, 0, 1, 0, 0}} {
+		for i := 0; i < 3; i++ {
+			g.Expect(binary.Write(&buf, order, v[i])).To(Succeed())
+		}
+		for i := 3; i < 6; i++ {
+			g.Expect(binary.Write(&buf, order, float32(v[i]))).To(Succeed())
+		}
+	}
+	g.Expect(binary.Write(&buf, order, []uint8{7, 3})).To(Succeed())
+	g.Expect(binary.Write(&buf, order, []uint32{0, 1, 2})).To(Succeed())
+	g.Expect(os.WriteFile(filename, buf.Bytes(), 0644)).To(Succeed())
+}
+
+func TestPlyBinary(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	for format, order := range map[string]binary.ByteOrder{
+		plyLittleEndian: binary.LittleEndian,
+		plyBigEndian:    binary.BigEndian,
+	} {
+		filename := filepath.Join(t.TempDir(), "triangle.ply")
+		writeBinaryPly(g, filename, order, format)
+		s, err := readMeshFile(filename)
+		g.Expect(err).To(BeNil(), format)
+		m := meshOf(g, s)
+		g.Expect(m.InnerShape().(shapes.Mesh).Size()).To(Equal(1))
+		hit := hitAt(g, m, 0.25, 0.25)
+		g.Expect(hit.T).To(BeNumerically("~", 5, 1e-9))
+		c := m.GetMaterial().Pattern.PatternAtObject(hit.Shape, tuple.NewPoint(0.25, 0.25, 0))
+		g.Expect(c.Equals(tuple.NewColor(1, 0, 0))).To(BeTrue())
+	}
+}
+
+const asciiStl = `solid square
+  facet normal 0 0 -1
+    outer loop
+      vertex 0 0 0
+      vertex 1 1 0
+      vertex 1 0 0
+    endloop
+  endfacet
+  facet normal 0 0 0
+    outer loop
+      vertex 0 0 0
+      vertex 0 1 0
+      vertex 1 1 0
+    endloop
+  endfacet
+endsolid square
+`
+
+func TestStlAscii(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	filename := filepath.Join(t.TempDir(), "square.STL")
+	g.Expect(os.WriteFile(filename, []byte(asciiStl), 0644)).To(Succeed())
+	s, err := readMeshFile(filename)
+	g.Expect(err).To(BeNil())
+	m := meshOf(g, s)
+	g.Expect(m.InnerShape().(shapes.Mesh).Size()).To(Equal(2))
+	// No colors, so the default material is kept
+	g.Expect(m.GetMaterial().Pattern.ColorAt(tuple.NewPoint(0, 0, 0))).To(Equal(tuple.NewColor(1, 1, 1)))
+
+	hit := hitAt(g, m, 0.75, 0.25)
+	n, err := hit.Shape.NormalAt(tuple.NewPoint(0.75, 0.25, 0), hit)
+	g.Expect(err).To(BeNil())
+	g.Expect(n.Equals(tuple.NewVector(0, 0, -1))).To(BeTrue())
+	// A zero facet normal falls back to the normal of the triangle
+	hit = hitAt(g, m, 0.25, 0.75)
+	n, err = hit.Shape.NormalAt(tuple.NewPoint(0.25, 0.75, 0), hit)
+	g.Expect(err).To(BeNil())
+	g.Expect(math.Abs(n.Z())).To(BeNumerically("~", 1, 1e-9))
+}
+
+func TestStlBinary(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	var buf bytes.Buffer
+	// Binary files may start with "solid" too
+	header := make([]byte, stlHeaderSize)
+	copy(header, "solid but actually binary")
+	buf.Write(header)
+	g.Expect(binary.Write(&buf, binary.LittleEndian, uint32(2))).To(Succeed())
+	triangles := []struct {
+		data [12]float32
+		attr uint16
+	}{
+		{[12]float32{0, 0, -1, 0, 0, 0, 1, 1, 0, 1, 0, 0}, stlColorValid | 31<<10},
+		{[12]float32{0, 0, -1, 0, 0, 0, 0, 1, 0, 1, 1, 0}, 0},
+	}
+	for _, tr := range triangles {
+		g.Expect(binary.Write(&buf, binary.LittleEndian, tr.data)).To(Succeed())
+		g.Expect(binary.Write(&buf, binary.LittleEndian, tr.attr)).To(Succeed())
+	}
+	filename := filepath.Join(t.TempDir(), "square.stl")
+	g.Expect(os.WriteFile(filename, buf.Bytes(), 0644)).To(Succeed())
+
+	s, err := readMeshFile(filename)
+	g.Expect(err).To(BeNil())
+	m := meshOf(g, s)
+	g.Expect(m.InnerShape().(shapes.Mesh).Size()).To(Equal(2))
+	hit := hitAt(g, m, 0.75, 0.25)
+	c := m.GetMaterial().Pattern.PatternAtObject(hit.Shape, tuple.NewPoint(0.75, 0.25, 0))
+	g.Expect(c.Equals(tuple.NewColor(1, 0, 0))).To(BeTrue())
+	// Triangles without a valid color are white
+	hit = hitAt(g, m, 0.25, 0.75)
+	c = m.GetMaterial().Pattern.PatternAtObject(hit.Shape, tuple.NewPoint(0.25, 0.75, 0))
+	g.Expect(c.Equals(tuple.NewColor(1, 1, 1))).To(BeTrue())
+}
+
+func TestMeshFileErrors(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"a.3ds", "", "Unsupported mesh file type '.3ds'"},
+		{"a.ply", "plx\n", "Not a PLY file"},
+		{"a.ply", "ply\nformat ascii 2.0\nend_header\n", "line 2: Unsupported format 'ascii 2.0'"},
+		{"a.ply", "ply\nformat ascii 1.0\nelement vertex 1\nproperty float x\n", "The header isn't terminated by end_header"},
+		{"a.ply", "ply\nformat ascii 1.0\nelement vertex 1\nproperty quad x\nend_header\n", "line 4: Unknown property type 'quad'"},
+		{"a.ply", "ply\nformat ascii 1.0\nelement vertex 1\nproperty float x\nend_header\n1\n", "vertex 0: Vertices need x, y and z properties"},
+		{"a.ply", "ply\nformat ascii 1.0\nelement vertex 2\nproperty float x\nproperty float y\nproperty float z\nend_header\n1 2 3\n", "vertex 1: unexpected EOF"},
+		{"a.ply", "ply\nformat ascii 1.0\nelement vertex 1\nproperty float x\nproperty float y\nproperty float z\nend_header\n1 2 z\n", "vertex 0: Invalid number 'z'"},
+		{"a.ply", "ply\nformat ascii 1.0\nelement vertex 1\nproperty float x\nproperty float y\nproperty float z\nelement face 1\nproperty list uchar int vertex_indices\nend_header\n1 2 3\n3 0 1 2\n", "Face 0 refers to vertex 1, but the mesh has 1 vertices"},
+		{"a.stl", "not an stl", "Not an STL file"},
+		{"a.stl", "solid a\nfacet normal 0 0 1\nouter loop\nvertex 0 0 0\nendloop\nendfacet\n", "a.stl:6: A facet needs 3 vertices, got 1"},
+		{"a.stl", "solid a\nvertex 0 0 0\n", "a.stl:2: vertex outside of a facet"},
+		{"a.stl", "solid a\nfacet normal 0 0 1\n", "The last facet isn't terminated by endfacet"},
+	}
+	for _, test := range tests {
+		filename := filepath.Join(t.TempDir(), test.name)
+		g.Expect(os.WriteFile(filename, []byte(test.content), 0644)).To(Succeed())
+		_, err := readMeshFile(filename)
+		g.Expect(err).To(HaveOccurred(), test.content)
+		g.Expect(err.Error()).To(ContainSubstring(test.expected), test.content)
+	}
+}
+
+func TestMeshFileFromScene(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	filename := filepath.Join(t.TempDir(), "square.stl")
+	g.Expect(os.WriteFile(filename, []byte(asciiStl), 0644)).To(Succeed())
+	s, err := newShape("group", map[string]interface{}{"meshfile": filename}, nil)
+	g.Expect(err).To(BeNil())
+	g.Expect(meshOf(g, s).InnerShape().(shapes.Mesh).Size()).To(Equal(2))
+
+	s, err = newShape("group", map[string]interface{}{"meshfile": "../../objs/teapot-low.obj"}, nil)
+	g.Expect(err).To(BeNil())
+	g.Expect(s.InnerShape().(shapes.Group).Size()).To(Equal(1))
+
+	_, err = newShape("group", map[string]interface{}{"meshfile": 7}, nil)
+	g.Expect(err).ToNot(BeNil())
+	_, err = newShape("group", map[string]interface{}{"meshfile": "missing.ply"}, nil)
+	g.Expect(err).ToNot(BeNil())
+}
@@ -0,0 +1,246 @@
+package world
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/liorokman/raytrace/pkg/material"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+const (
+	newMaterialInMtl = "newmtl"
+	diffuseInMtl     = "Kd"
+	specularInMtl    = "Ks"
+	emissiveInMtl    = "Ke"
+	shininessInMtl   = "Ns"
+	dissolveInMtl    = "d"
+	transparentInMtl = "Tr"
+	refractionInMtl  = "Ni"
+	illuminationMtl  = "illum"
+	diffuseMapInMtl  = "map_Kd"
+)
+
+// ignoredInMtl are statements that are valid in an MTL file but can't be represented by
+// a material.Material
+var ignoredInMtl = map[string]bool{
+	"Ka":        true,
+	"Tf":        true,
+	"sharpness": true,
+	"map_Ka":    true,
+	"map_Ks":    true,
+	"map_Ke":    true,
+	"map_Ns":    true,
+	"map_d":     true,
+	"map_Bump":  true,
+	"map_bump":  true,
+	"bump":      true,
+	"disp":      true,
+	"decal":     true,
+	"refl":      true,
+}
+
+// mtlEntry collects the statements of a single material until the whole material has
+// been read
+type mtlEntry struct {
+	diffuse      *tuple.Color
+	specular     *tuple.Color
+	emissive     *tuple.Color
+	shininess    *float64
+	transparency *float64
+	refraction   *float64
+	illumination int
+	diffuseMap   string
+}
+
+// readMtl reads a Wavefront MTL material library. Kd sets the material's color, Ks its
+// specular (the brightest of the three channels), Ns its shininess, d or Tr its
+// transparency, Ni its refractive index and Ke its emissive color. The illumination
+// models that enable ray traced reflections (3, 5 and 7) make the material as reflective
+// as its specular. map_Kd wraps a texture around the shape using the shape's own
+// texture coordinates. Texture files are looked up relative to the library.
+func readMtl(filename string) (map[string]material.Material, error) {
+	in, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	entries := map[string]*mtlEntry{}
+	// order keeps errors about the materials deterministic
+	order := []string{}
+	var current *mtlEntry
+	lineNo := 0
+	lineErr := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%s:%d: %s", filename, lineNo, fmt.Sprintf(format, args...))
+	}
+
+	scan := bufio.NewScanner(in)
+	for scan.Scan() {
+		lineNo++
+		line := scan.Text()
+		if ind := strings.Index(line, "#"); ind >= 0 {
+			line = line[0:ind]
+		}
+		parts := strings.Fields(line)
+		if len(parts) == 0 {
+			continue
+		}
+		statement, args := parts[0], parts[1:]
+		if statement == newMaterialInMtl {
+			if len(args) != 1 {
+				return nil, lineErr("newmtl needs a single material name")
+			}
+			if _, ok := entries[args[0]]; ok {
+				return nil, lineErr("Material '%s' is defined more than once", args[0])
+			}
+			current = &mtlEntry{}
+			entries[args[0]] = current
+			order = append(order, args[0])
+			continue
+		}
+		if ignoredInMtl[statement] {
+			continue
+		}
+		if current == nil {
+			return nil, lineErr("'%s' must follow a newmtl statement", statement)
+		}
+		switch statement {
+		case diffuseInMtl, specularInMtl, emissiveInMtl:
+			c, err := mtlColor(args)
+			if err != nil {
+				return nil, lineErr("%s: %v", statement, err)
+			}
+			switch statement {
+			case diffuseInMtl:
+				current.diffuse = &c
+			case specularInMtl:
+				current.specular = &c
+			default:
+				current.emissive = &c
+			}
+		case shininessInMtl, dissolveInMtl, transparentInMtl, refractionInMtl:
+			values, err := toFloat64Slice(args)
+			if err != nil {
+				return nil, lineErr("%s: %v", statement, err)
+			}
+			if len(values) != 1 {
+				return nil, lineErr("%s needs a single value, got %d", statement, len(values))
+			}
+			v := values[0]
+			switch statement {
+			case shininessInMtl:
+				if v < 0 {
+					return nil, lineErr("Shininess can't be negative")
+				}
+				current.shininess = &v
+			case dissolveInMtl, transparentInMtl:
+				if v < 0 || v > 1 {
+					return nil, lineErr("%s must be in the [0,1] range", statement)
+				}
+				if statement == dissolveInMtl {
+					v = 1 - v
+				}
+				current.transparency = &v
+			default:
+				if v < 0 {
+					return nil, lineErr("Refractive index can't be negative")
+				}
+				current.refraction = &v
+			}
+		case illuminationMtl:
+			values, err := toFloat64Slice(args)
+			if err != nil || len(values) != 1 || values[0] != math.Trunc(values[0]) || values[0] < 0 || values[0] > 10 {
+				return nil, lineErr("illum needs an illumination model between 0 and 10")
+			}
+			current.illumination = int(values[0])
+		case diffuseMapInMtl:
+			if len(args) != 1 {
+				return nil, lineErr("map_Kd needs a single file name, texture options aren't supported")
+			}
+			current.diffuseMap = filepath.Join(filepath.Dir(filename), args[0])
+		default:
+			return nil, lineErr("Unsupported statement '%s'", statement)
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	textures := map[string]*material.Texture{}
+	retval := map[string]material.Material{}
+	for _, name := range order {
+		m, err := entries[name].toMaterial(textures)
+		if err != nil {
+			return nil, fmt.Errorf("%s: material '%s': %w", filename, name, err)
+		}
+		retval[name] = m
+	}
+	return retval, nil
+}
+
+// mtlColor reads an RGB color. A single value is used for all three channels.
+func mtlColor(args []string) (tuple.Color, error) {
+	values, err := toFloat64Slice(args)
+	if err != nil {
+		return tuple.Color{}, err
+	}
+	if len(values) == 1 {
+		values = append(values, values[0], values[0])
+	}
+	if len(values) != 3 {
+		return tuple.Color{}, fmt.Errorf("Expected an RGB color, got %d values", len(values))
+	}
+	for _, v := range values {
+		if v < 0 {
+			return tuple.Color{}, fmt.Errorf("Color channels can't be negative")
+		}
+	}
+	return tuple.NewColor(values[0], values[1], values[2]), nil
+}
+
+func (e *mtlEntry) toMaterial(textures map[string]*material.Texture) (material.Material, error) {
+	b := material.NewDefaultBuilder()
+	if e.diffuse != nil {
+		b.WithColor(*e.diffuse)
+	}
+	if e.specular != nil {
+		specular := math.Max(e.specular.Red(), math.Max(e.specular.Green(), e.specular.Blue()))
+		if specular > 1 {
+			return material.Material{}, fmt.Errorf("Specular color can't be brighter than 1")
+		}
+		b.WithSpecular(specular)
+		if e.illumination == 3 || e.illumination == 5 || e.illumination == 7 {
+			b.WithReflective(specular)
+		}
+	}
+	if e.emissive != nil {
+		b.WithEmissive(*e.emissive)
+	}
+	if e.shininess != nil {
+		b.WithShininess(*e.shininess)
+	}
+	if e.transparency != nil {
+		b.WithTransparency(*e.transparency)
+	}
+	if e.refraction != nil {
+		b.WithRefractiveIndex(*e.refraction)
+	}
+	if e.diffuseMap != "" {
+		tex, ok := textures[e.diffuseMap]
+		if !ok {
+			var err error
+			tex, err = material.LoadTexture(e.diffuseMap)
+			if err != nil {
+				return material.Material{}, err
+			}
+			textures[e.diffuseMap] = tex
+		}
+		b.WithPattern(material.NewTextureMapPattern(tex, material.ShapeMapping, material.BilinearFilter))
+	}
+	return b.Build(), nil
+}
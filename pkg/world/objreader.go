@@ -2,156 +2,416 @@ package world
 
 import (
 	"bufio"
-	"math"
+	"fmt"
 	"os"
-	"regexp"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
+	"github.com/liorokman/raytrace/pkg/material"
 	"github.com/liorokman/raytrace/pkg/shapes"
 	"github.com/liorokman/raytrace/pkg/tuple"
 )
 
+// objGroup holds the faces of a group in an OBJ file that use the same material. Every
+// objGroup becomes a single mesh.
+type objGroup struct {
+	object   string
+	name     string
+	material string
+	faces    []shapes.MeshFace
+	shape    shapes.Shape
+}
+
+// objMaterialUse is the first line that uses a material
+type objMaterialUse struct {
+	name string
+	line int
+}
+
+// objGroupKey identifies the objGroup that a face belongs to
+type objGroupKey struct {
+	object   string
+	name     string
+	material string
+}
+
 type objReader struct {
-	ignoredLines   int
 	vertices       []tuple.Tuple
 	verticeNormals []tuple.Tuple
-	groups         map[string]shapes.Shape
+	textureCoords  []shapes.TextureCoord
+	materials      map[string]material.Material
+	// groups is kept in the order the groups first appear in the file, and indexed by
+	// groupIndex
+	groups     []*objGroup
+	groupIndex map[objGroupKey]*objGroup
+	// warnings holds the problems that don't stop the file from being read, together
+	// with the file and line they were found in
+	warnings []string
+	// usedMaterials holds the line where every material is first used. A material library
+	// may come after the materials it defines are used, so they're looked up once the
+	// whole file is read.
+	usedMaterials []objMaterialUse
+	file          string
+	line          int
+
+	currentObject   string
+	currentGroup    string
+	currentMaterial string
 }
 
 func newObjReader() *objReader {
 	return &objReader{
-		vertices:       []tuple.Tuple{tuple.NewPoint(math.NaN(), math.NaN(), math.NaN())},
-		verticeNormals: []tuple.Tuple{tuple.NewVector(math.NaN(), math.NaN(), math.NaN())},
-		groups: map[string]shapes.Shape{
-			"defaultGroup": shapes.NewGroup(),
-		},
+		vertices:       []tuple.Tuple{},
+		verticeNormals: []tuple.Tuple{},
+		textureCoords:  []shapes.TextureCoord{},
+		materials:      map[string]material.Material{},
+		groups:         []*objGroup{},
+		groupIndex:     map[objGroupKey]*objGroup{},
+		currentGroup:   defaultGroup,
 	}
 }
 
 const (
-	vertexInObj  = "v"
-	vertexNormal = "vn"
-	faceInObj    = "f"
-	groupInObj   = "g"
+	defaultGroup = "defaultGroup"
+
+	vertexInObj    = "v"
+	vertexNormal   = "vn"
+	vertexTexture  = "vt"
+	faceInObj      = "f"
+	groupInObj     = "g"
+	objectInObj    = "o"
+	useMaterial    = "usemtl"
+	materialLib    = "mtllib"
+	smoothingInObj = "s"
 )
 
+// ignoredInObj are statements that are valid in an OBJ file but have no effect on how the
+// file is rendered. Smoothing groups are ignored since smooth shading is taken from the
+// vertex normals, and points and lines have no surface to render.
+var ignoredInObj = map[string]bool{
+	smoothingInObj: true,
+	"mg":           true,
+	"p":            true,
+	"l":            true,
+	"lod":          true,
+	"bevel":        true,
+	"c_interp":     true,
+	"d_interp":     true,
+	"shadow_obj":   true,
+	"trace_obj":    true,
+}
+
 func toFloat64Slice(in []string) ([]float64, error) {
 	r := make([]float64, len(in))
 	for i := range in {
 		var err error
 		r[i], err = strconv.ParseFloat(in[i], 64)
 		if err != nil {
-			return []float64{}, err
+			return []float64{}, fmt.Errorf("Invalid number '%s'", in[i])
 		}
 	}
 	return r, nil
 }
 
-func toIntSlice(in []string, section int) ([]int, error) {
-	r := make([]int, len(in))
-	for i := range in {
+// resolveIndex converts an index from a face, which starts at 1, into an index of a slice
+// with count elements. Negative indices count back from the last element.
+func resolveIndex(index string, count int, kind string) (int, error) {
+	i, err := strconv.Atoi(index)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s index '%s'", kind, index)
+	}
+	if i < 0 {
+		i += count
+		if i < 0 {
+			return 0, fmt.Errorf("Relative %s index %s is out of range, only %d were defined so far", kind, index, count)
+		}
+		return i, nil
+	} else if i == 0 {
+		return 0, fmt.Errorf("Invalid %s index 0, indices start at 1", kind)
+	} else if i > count {
+		return 0, fmt.Errorf("Undefined %s %d, only %d were defined so far", kind, i, count)
+	}
+	return i - 1, nil
+}
+
+// parseFace reads the vertices of a face. Every vertex is one of v, v/vt, v//vn or
+// v/vt/vn, and all the vertices of a face must use the same form. Missing texture
+// coordinates or normals are returned as -1.
+func (o *objReader) parseFace(in []string) ([]int, []int, []int, error) {
+	if len(in) < 3 {
+		return nil, nil, nil, fmt.Errorf("A face needs at least 3 vertices, got %d", len(in))
+	}
+	vertices := make([]int, len(in))
+	textures := make([]int, len(in))
+	normals := make([]int, len(in))
+	var form string
+	for i, vertex := range in {
+		parts := strings.Split(vertex, "/")
+		if len(parts) > 3 {
+			return nil, nil, nil, fmt.Errorf("Invalid face vertex '%s'", vertex)
+		}
+		for len(parts) < 3 {
+			parts = append(parts, "")
+		}
+		vertexForm := fmt.Sprintf("%t/%t/%t", parts[0] != "", parts[1] != "", parts[2] != "")
+		if i == 0 {
+			form = vertexForm
+		} else if vertexForm != form {
+			return nil, nil, nil, fmt.Errorf("Face vertex '%s' doesn't have the same form as '%s'", vertex, in[0])
+		}
 		var err error
-		parts := strings.Split(in[i], "/")
-		if len(parts) < section {
-			return []int{}, nil
+		if vertices[i], err = resolveIndex(parts[0], len(o.vertices), "vertex"); err != nil {
+			return nil, nil, nil, err
 		}
-		r[i], err = strconv.Atoi(parts[section])
-		if err != nil {
-			return []int{}, err
+		textures[i], normals[i] = -1, -1
+		if parts[1] != "" {
+			if textures[i], err = resolveIndex(parts[1], len(o.textureCoords), "texture coordinate"); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		if parts[2] != "" {
+			if normals[i], err = resolveIndex(parts[2], len(o.verticeNormals), "normal"); err != nil {
+				return nil, nil, nil, err
+			}
 		}
 	}
-	return r, nil
+	return vertices, textures, normals, nil
+}
+
+// group returns the group that new faces are added to
+func (o *objReader) group() *objGroup {
+	key := objGroupKey{object: o.currentObject, name: o.currentGroup, material: o.currentMaterial}
+	if g, ok := o.groupIndex[key]; ok {
+		return g
+	}
+	g := &objGroup{
+		object:   o.currentObject,
+		name:     o.currentGroup,
+		material: o.currentMaterial,
+		faces:    []shapes.MeshFace{},
+	}
+	o.groups = append(o.groups, g)
+	o.groupIndex[key] = g
+	return g
+}
+
+// warn records a problem found in a line
+func (o *objReader) warn(line int, format string, args ...interface{}) {
+	o.warnings = append(o.warnings, fmt.Sprintf("%s:%d: ", o.file, line)+fmt.Sprintf(format, args...))
 }
 
+// AsGroup returns a group with a mesh for every group in the file. Meshes that belong to
+// a named object are placed in a group of their own.
 func (o *objReader) AsGroup() shapes.Shape {
 	g := shapes.NewGroup()
-	for i := range o.groups {
-		shapes.Connect(g, o.groups[i])
+	objects := map[string]shapes.Shape{}
+	for _, grp := range o.groups {
+		if grp.object == "" {
+			shapes.Connect(g, grp.shape)
+			continue
+		}
+		parent, ok := objects[grp.object]
+		if !ok {
+			parent = shapes.NewGroup()
+			objects[grp.object] = parent
+			shapes.Connect(g, parent)
+		}
+		shapes.Connect(parent, grp.shape)
 	}
 	return g
 }
 
+// ReadObj reads a Wavefront OBJ file. Material libraries are looked up relative to the
+// file. Errors include the file name and the line they were found in. Materials that
+// aren't defined in any library in the file, before or after they're used, are replaced
+// by the default material, with a warning.
 func (o *objReader) ReadObj(filename string) error {
 	in, err := os.Open(filename)
 	if err != nil {
 		return err
 	}
+	defer in.Close()
 
-	whitespaceSqueezer := regexp.MustCompile("(\\s)\\s*")
-	currentGroup := "defaultGroup"
+	o.file, o.line = filename, 0
+	lineErr := func(err error) error {
+		return fmt.Errorf("%s:%d: %w", filename, o.line, err)
+	}
 	scan := bufio.NewScanner(in)
 	for scan.Scan() {
-		line := strings.TrimSpace(scan.Text())
+		o.line++
+		line := scan.Text()
 		if ind := strings.Index(line, "#"); ind >= 0 {
 			line = line[0:ind]
 		}
-		line = whitespaceSqueezer.ReplaceAllString(line, "$1")
-		if line == "" {
+		parts := strings.Fields(line)
+		if len(parts) == 0 {
 			continue
 		}
-		parts := strings.Split(line, " ")
-		switch parts[0] {
-		case vertexInObj, vertexNormal:
-			coords, err := toFloat64Slice(parts[1:])
-			if err != nil {
-				return err
-			}
+		if err := o.readStatement(filepath.Dir(filename), parts[0], parts[1:]); err != nil {
+			return lineErr(err)
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	for _, use := range o.usedMaterials {
+		if _, ok := o.materials[use.name]; !ok {
+			o.warn(use.line, "Material '%s' isn't defined in any material library, using the default material", use.name)
+		}
+	}
+	for _, w := range o.warnings {
+		fmt.Printf("Warn: %s\n", w)
+	}
+	// Every group becomes a mesh with the vertices that its faces use
+	kept := []*objGroup{}
+	for _, grp := range o.groups {
+		if len(grp.faces) == 0 {
+			continue
+		}
+		data := meshArrays{vertices: o.vertices, normals: o.verticeNormals, uvs: o.textureCoords, faces: grp.faces}.compact()
+		m, err := shapes.NewMesh(data.vertices, data.normals, data.uvs, data.faces)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		if mat, ok := o.materials[grp.material]; ok {
+			m = m.WithMaterial(mat)
+		}
+		grp.shape = m
+		kept = append(kept, grp)
+	}
+	o.groups = kept
+	return nil
+}
+
+func (o *objReader) readStatement(dir string, statement string, args []string) error {
+	switch statement {
+	case vertexInObj, vertexNormal:
+		coords, err := toFloat64Slice(args)
+		if err != nil {
+			return err
+		}
+		if statement == vertexNormal {
 			if len(coords) != 3 {
-				o.ignoredLines++
-				continue
-			}
-			if parts[0] == vertexInObj {
-				o.vertices = append(o.vertices, tuple.NewPoint(coords[0], coords[1], coords[2]))
-			} else {
-				o.verticeNormals = append(o.verticeNormals, tuple.NewPoint(coords[0], coords[1], coords[2]))
+				return fmt.Errorf("A vertex normal needs 3 coordinates, got %d", len(coords))
 			}
-		case faceInObj:
-			vertices, err := toIntSlice(parts[1:], 0)
+			o.verticeNormals = append(o.verticeNormals, tuple.NewVector(coords[0], coords[1], coords[2]))
+			return nil
+		}
+		// A vertex may have a weight, which only matters for curves, or a color, which
+		// isn't used
+		if len(coords) != 3 && len(coords) != 4 && len(coords) != 6 {
+			return fmt.Errorf("A vertex needs 3 coordinates, got %d", len(coords))
+		}
+		o.vertices = append(o.vertices, tuple.NewPoint(coords[0], coords[1], coords[2]))
+	case vertexTexture:
+		coords, err := toFloat64Slice(args)
+		if err != nil {
+			return err
+		}
+		// The optional third coordinate is only used by 3D textures
+		if len(coords) < 1 || len(coords) > 3 {
+			return fmt.Errorf("Texture coordinates need 1 to 3 values, got %d", len(coords))
+		}
+		if len(coords) == 1 {
+			coords = append(coords, 0)
+		}
+		o.textureCoords = append(o.textureCoords, shapes.TextureCoord{U: coords[0], V: coords[1]})
+	case faceInObj:
+		vertices, vTextures, vNormals, err := o.parseFace(args)
+		if err != nil {
+			return err
+		}
+		grp := o.group()
+		// Faces with more than three vertices are split into a fan of triangles
+		for i := 1; i < len(vertices)-1; i++ {
+			face := shapes.NewMeshFace(vertices[0], vertices[i], vertices[i+1])
+			face.Normals = [3]int{vNormals[0], vNormals[i], vNormals[i+1]}
+			face.UVs = [3]int{vTextures[0], vTextures[i], vTextures[i+1]}
+			grp.faces = append(grp.faces, face)
+		}
+	case groupInObj:
+		// A face that belongs to several groups is kept in a single group named after all
+		// of them
+		o.currentGroup = defaultGroup
+		if len(args) > 0 {
+			o.currentGroup = strings.Join(args, " ")
+		}
+	case objectInObj:
+		if len(args) == 0 {
+			return fmt.Errorf("An object needs a name")
+		}
+		o.currentObject = strings.Join(args, " ")
+		o.currentGroup = defaultGroup
+	case useMaterial:
+		if len(args) != 1 {
+			return fmt.Errorf("usemtl needs a single material name")
+		}
+		if !slices.ContainsFunc(o.usedMaterials, func(use objMaterialUse) bool { return use.name == args[0] }) {
+			o.usedMaterials = append(o.usedMaterials, objMaterialUse{name: args[0], line: o.line})
+		}
+		o.currentMaterial = args[0]
+	case materialLib:
+		if len(args) == 0 {
+			return fmt.Errorf("mtllib needs at least one file name")
+		}
+		for _, lib := range args {
+			materials, err := readMtl(filepath.Join(dir, lib))
 			if err != nil {
 				return err
 			}
-			if len(vertices) < 3 {
-				o.ignoredLines++
-				continue
-			}
-			vNormals, err := toIntSlice(parts[1:], 2)
-			if err != nil {
-				return err
+			for name, m := range materials {
+				o.materials[name] = m
 			}
-			currGroup := o.groups[currentGroup]
-			for i := 1; i < len(vertices)-1; i++ {
-				var err error
-				var tri shapes.Shape
-				if len(vNormals) == 0 {
-					tri = shapes.NewTriangle(
-						o.vertices[vertices[0]],
-						o.vertices[vertices[i]],
-						o.vertices[vertices[i+1]])
-				} else {
-					tri = shapes.NewSmoothTriangle(
-						o.vertices[vertices[0]],
-						o.vertices[vertices[i]],
-						o.vertices[vertices[i+1]],
-						o.verticeNormals[vNormals[0]],
-						o.verticeNormals[vNormals[i]],
-						o.verticeNormals[vNormals[i+1]],
-					)
+		}
+	default:
+		if !ignoredInObj[statement] {
+			return fmt.Errorf("Unsupported statement '%s'", statement)
+		}
+	}
+	return nil
+}
 
-				}
-				if _, err = shapes.Connect(currGroup, tri); err != nil {
-					return err
+// objFiles returns the material libraries that an OBJ file reads and the textures that
+// they wrap. Files that can't be read are still returned, so that they can be watched
+// until they show up.
+func objFiles(filename string) []string {
+	retval := []string{}
+	for _, libs := range statementArgs(filename, materialLib) {
+		for _, lib := range libs {
+			lib = filepath.Join(filepath.Dir(filename), lib)
+			retval = append(retval, lib)
+			for _, texture := range statementArgs(lib, diffuseMapInMtl) {
+				if len(texture) == 1 {
+					retval = append(retval, filepath.Join(filepath.Dir(lib), texture[0]))
 				}
 			}
-			o.groups[currentGroup] = currGroup
-		case groupInObj:
-			o.groups[parts[1]] = shapes.NewGroup()
-			currentGroup = parts[1]
 		}
+	}
+	return retval
+}
 
+// statementArgs returns the arguments of every statement of the given kind in an OBJ or
+// MTL file, or nothing if the file can't be read
+func statementArgs(filename string, statement string) [][]string {
+	in, err := os.Open(filename)
+	if err != nil {
+		return nil
 	}
-	if err := scan.Err(); err != nil {
-		return err
+	defer in.Close()
+
+	retval := [][]string{}
+	scan := bufio.NewScanner(in)
+	for scan.Scan() {
+		line := scan.Text()
+		if ind := strings.Index(line, "#"); ind >= 0 {
+			line = line[0:ind]
+		}
+		parts := strings.Fields(line)
+		if len(parts) > 0 && parts[0] == statement {
+			retval = append(retval, parts[1:])
+		}
 	}
-	return nil
+	return retval
 }
@@ -0,0 +1,288 @@
+package world
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/liorokman/raytrace/pkg/material"
+	"github.com/liorokman/raytrace/pkg/shapes"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+func TestObjTextureCoords(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	obj := `
+v 0 1 0
+v -1 0 0
+v 1 0 0
+v 0 -1 0
+vt 0.5 1
+vt 0 0.5
+vt 1 0.5
+vt 0.5 0 0
+vn 0 0 -1
+f 1/1 2/2 3/3
+f 2/2/1 4/4/1 3/3/1
+f 1//1 2//1 3//1
+`
+	filename := filepath.Join(t.TempDir(), "textured.obj")
+	g.Expect(os.WriteFile(filename, []byte(obj), 0644)).To(Succeed())
+	o := newObjReader()
+	g.Expect(o.ReadObj(filename)).To(Succeed())
+	g.Expect(o.textureCoords).To(HaveLen(4))
+	g.Expect(o.textureCoords[3]).To(Equal(shapes.TextureCoord{U: 0.5, V: 0}))
+
+	g.Expect(o.groups).To(HaveLen(1))
+	grp := o.groups[0].shape
+	g.Expect(grp.InnerShape().(shapes.Mesh).Size()).To(Equal(3))
+	uvAt := func(x, y float64) [][2]float64 {
+		r, err := shapes.NewRay(tuple.NewPoint(x, y, -2), tuple.NewVector(0, 0, 1))
+		g.Expect(err).To(BeNil())
+		retval := [][2]float64{}
+		for _, xs := range grp.LocalIntersect(r) {
+			u, v := xs.Shape.UVAt(tuple.NewPoint(x, y, 0))
+			retval = append(retval, [2]float64{math.Round(u*1e6) / 1e6, math.Round(v*1e6) / 1e6})
+		}
+		return retval
+	}
+	// The flat textured triangle interpolates its vt coordinates, while the one
+	// without them stretches the texture from its first vertex
+	g.Expect(uvAt(0, 0.5)).To(ConsistOf([2]float64{0.5, 0.75}, [2]float64{0.25, 0.25}))
+	// The smooth textured triangle
+	g.Expect(uvAt(0, -0.5)).To(Equal([][2]float64{{0.5, 0.25}}))
+}
+
+func TestObjRelativeIndices(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	obj := `
+v 0 1 0
+v -1 0 0
+v 1 0 0
+v 0 0 1
+vn 0 0 -1
+f -4//-1 -3//-1 -2//-1
+f 1 -1 3
+`
+	filename := filepath.Join(t.TempDir(), "relative.obj")
+	g.Expect(os.WriteFile(filename, []byte(obj), 0644)).To(Succeed())
+	o := newObjReader()
+	g.Expect(o.ReadObj(filename)).To(Succeed())
+	g.Expect(o.groups).To(HaveLen(1))
+	g.Expect(o.groups[0].faces).To(Equal([]shapes.MeshFace{
+		{Vertices: [3]int{0, 1, 2}, Normals: [3]int{0, 0, 0}, UVs: [3]int{-1, -1, -1}},
+		{Vertices: [3]int{0, 3, 2}, Normals: [3]int{-1, -1, -1}, UVs: [3]int{-1, -1, -1}},
+	}))
+}
+
+func TestObjGroupMeshesKeepTheirOwnVertices(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	obj := `
+v 0 0 0
+v 1 0 0
+v 0 1 0
+v 5 5 5
+v 6 5 5
+v 5 6 5
+vn 0 0 -1
+vn 0 0 1
+vt 0.5 0.5
+g first
+f 1//2 2//2 3//2
+g second
+f 6/1 4/1 5/1
+`
+	filename := filepath.Join(t.TempDir(), "groups.obj")
+	g.Expect(os.WriteFile(filename, []byte(obj), 0644)).To(Succeed())
+	o := newObjReader()
+	g.Expect(o.ReadObj(filename)).To(Succeed())
+	g.Expect(o.groups).To(HaveLen(2))
+
+	first := o.groups[0].shape.InnerShape().(shapes.Mesh)
+	g.Expect(first.Vertices()).To(Equal([]tuple.Tuple{tuple.NewPoint(0, 0, 0), tuple.NewPoint(1, 0, 0), tuple.NewPoint(0, 1, 0)}))
+	g.Expect(first.Normals()).To(Equal([]tuple.Tuple{tuple.NewVector(0, 0, 1)}))
+	g.Expect(first.UVs()).To(BeEmpty())
+	g.Expect(first.Faces()).To(Equal([]shapes.MeshFace{{Vertices: [3]int{0, 1, 2}, Normals: [3]int{0, 0, 0}, UVs: [3]int{-1, -1, -1}}}))
+
+	// Vertices are numbered in the order the faces use them
+	second := o.groups[1].shape.InnerShape().(shapes.Mesh)
+	g.Expect(second.Vertices()).To(Equal([]tuple.Tuple{tuple.NewPoint(5, 6, 5), tuple.NewPoint(5, 5, 5), tuple.NewPoint(6, 5, 5)}))
+	g.Expect(second.Normals()).To(BeEmpty())
+	g.Expect(second.UVs()).To(Equal([]shapes.TextureCoord{{U: 0.5, V: 0.5}}))
+	g.Expect(second.Faces()).To(Equal([]shapes.MeshFace{{Vertices: [3]int{0, 1, 2}, Normals: [3]int{-1, -1, -1}, UVs: [3]int{0, 0, 0}}}))
+}
+
+func TestObjObjectsGroupsAndMaterials(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir := t.TempDir()
+	mtl := `
+# Two materials
+newmtl red
+Kd 1 0 0
+Ks 0.5 0.25 0
+Ns 50
+illum 3
+newmtl glass
+Kd 1
+d 0.25
+Ni 1.5
+newmtl lamp
+Ke 2 2 1
+map_Kd textures/checker.ppm
+`
+	g.Expect(os.WriteFile(filepath.Join(dir, "scene.mtl"), []byte(mtl), 0644)).To(Succeed())
+	g.Expect(os.Mkdir(filepath.Join(dir, "textures"), 0755)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, "textures", "checker.ppm"), []byte("P3\n1 1\n255\n0 255 0\n"), 0644)).To(Succeed())
+
+	obj := `
+mtllib scene.mtl
+v 0 0 0
+v 1 0 0
+v 0 1 0
+v 0 0 1
+s 1
+f 1 2 3
+o first
+usemtl red
+f 1 2 3
+g a
+f 1 2 4
+usemtl glass
+f 2 3 4
+o second
+g a
+usemtl lamp
+f 1 3 4
+`
+	filename := filepath.Join(dir, "scene.obj")
+	g.Expect(os.WriteFile(filename, []byte(obj), 0644)).To(Succeed())
+	o := newObjReader()
+	g.Expect(o.ReadObj(filename)).To(Succeed())
+
+	type entry struct {
+		object, name, material string
+		faces                  int
+	}
+	entries := []entry{}
+	for _, grp := range o.groups {
+		entries = append(entries, entry{grp.object, grp.name, grp.material, len(grp.faces)})
+	}
+	g.Expect(entries).To(Equal([]entry{
+		{"", defaultGroup, "", 1},
+		{"first", defaultGroup, "red", 1},
+		{"first", "a", "red", 1},
+		{"first", "a", "glass", 1},
+		{"second", "a", "lamp", 1},
+	}))
+
+	red := o.groups[1].shape.GetMaterial()
+	g.Expect(red.Pattern.ColorAt(tuple.NewPoint(0, 0, 0))).To(Equal(tuple.NewColor(1, 0, 0)))
+	g.Expect(red.Specular()).To(Equal(0.5))
+	g.Expect(red.Reflective()).To(Equal(0.5))
+	g.Expect(red.Shininess()).To(Equal(50.0))
+	glass := o.groups[3].shape.GetMaterial()
+	g.Expect(glass.Pattern.ColorAt(tuple.NewPoint(0, 0, 0))).To(Equal(tuple.NewColor(1, 1, 1)))
+	g.Expect(glass.Transparency()).To(Equal(0.75))
+	g.Expect(glass.RefractiveIndex()).To(Equal(1.5))
+	g.Expect(glass.Reflective()).To(Equal(0.0))
+	lamp := o.groups[4].shape.GetMaterial()
+	g.Expect(lamp.Emissive()).To(Equal(tuple.NewColor(2, 2, 1)))
+	g.Expect(lamp.Pattern.ColorAt(tuple.NewPoint(0.5, 0.5, 0))).To(Equal(tuple.NewColor(0, 1, 0)))
+
+	// The meshes of every object are grouped together
+	top := o.AsGroup().InnerShape().(shapes.Group)
+	g.Expect(top.Size()).To(Equal(3))
+}
+
+func TestObjUnknownMaterial(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// Exporters often name a material without writing a library for it
+	obj := "v 0 0 0\nv 1 0 0\nv 0 1 0\nusemtl None\nf 1 2 3\n"
+	filename := filepath.Join(t.TempDir(), "nomtl.obj")
+	g.Expect(os.WriteFile(filename, []byte(obj), 0644)).To(Succeed())
+	o := newObjReader()
+	g.Expect(o.ReadObj(filename)).To(Succeed())
+	g.Expect(o.warnings).To(Equal([]string{filename + ":4: Material 'None' isn't defined in any material library, using the default material"}))
+	g.Expect(o.groups).To(HaveLen(1))
+	g.Expect(o.groups[0].shape.GetMaterial()).To(Equal(material.Default()))
+}
+
+func TestObjMaterialLibraryAfterUse(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// The library may come anywhere in the file, even after the faces that use it
+	dir := t.TempDir()
+	g.Expect(os.WriteFile(filepath.Join(dir, "late.mtl"), []byte("newmtl red\nKd 1 0 0\n"), 0644)).To(Succeed())
+	obj := "v 0 0 0\nv 1 0 0\nv 0 1 0\nusemtl red\nf 1 2 3\nusemtl blue\nf 1 3 2\nusemtl blue\nf 2 1 3\nmtllib late.mtl\n"
+	filename := filepath.Join(dir, "late.obj")
+	g.Expect(os.WriteFile(filename, []byte(obj), 0644)).To(Succeed())
+	o := newObjReader()
+	g.Expect(o.ReadObj(filename)).To(Succeed())
+	g.Expect(o.warnings).To(Equal([]string{filename + ":6: Material 'blue' isn't defined in any material library, using the default material"}))
+	g.Expect(o.groups).To(HaveLen(2))
+	g.Expect(o.groups[0].shape.GetMaterial().Pattern.ColorAt(tuple.NewPoint(0, 0, 0))).To(Equal(tuple.NewColor(1, 0, 0)))
+	g.Expect(o.groups[1].shape.GetMaterial()).To(Equal(material.Default()))
+}
+
+func TestObjErrors(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir := t.TempDir()
+	g.Expect(os.WriteFile(filepath.Join(dir, "bad.mtl"), []byte("newmtl a\nKd 1 0\n"), 0644)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, "unsupported.mtl"), []byte("newmtl a\nmap_Kd -s 2 2 2 tex.png\n"), 0644)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, "orphan.mtl"), []byte("Kd 1 1 1\n"), 0644)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, "missingtexture.mtl"), []byte("newmtl a\nmap_Kd nothing.png\n"), 0644)).To(Succeed())
+
+	tests := []struct {
+		obj      string
+		expected string
+	}{
+		{"v 0 0 0\nv 1 0\n", "obj:2: A vertex needs 3 coordinates, got 2"},
+		{"v 0 0 x\n", "obj:1: Invalid number 'x'"},
+		{"vn 0 0\n", "obj:1: A vertex normal needs 3 coordinates, got 2"},
+		{"vt\n", "obj:1: Texture coordinates need 1 to 3 values, got 0"},
+		{"v 0 0 0\nv 1 0 0\n\nf 1 2\n", "obj:4: A face needs at least 3 vertices, got 2"},
+		{"v 0 0 0\nv 1 0 0\nf 1 2 3\n", "obj:3: Undefined vertex 3, only 2 were defined so far"},
+		{"v 0 0 0\nv 1 0 0\nv 1 1 0\nf 0 1 2\n", "obj:4: Invalid vertex index 0, indices start at 1"},
+		{"v 0 0 0\nv 1 0 0\nv 1 1 0\nf -4 1 2\n", "obj:4: Relative vertex index -4 is out of range, only 3 were defined so far"},
+		{"v 0 0 0\nv 1 0 0\nv 1 1 0\nf 1/1 2 3\n", "obj:4: Undefined texture coordinate 1, only 0 were defined so far"},
+		{"v 0 0 0\nv 1 0 0\nv 1 1 0\nvn 0 0 1\nf 1//1 2 3\n", "obj:5: Face vertex '2' doesn't have the same form as '1//1'"},
+		{"v 0 0 0\nv 1 0 0\nv 1 1 0\nf 1/2/3/4 2 3\n", "obj:4: Invalid face vertex '1/2/3/4'"},
+		{"v 0 0 0\nv 1 0 0\nv 1 1 0\nf 1//x 2//x 3//x\n", "obj:4: Invalid normal index 'x'"},
+		{"curv 0 1 1 2\n", "obj:1: Unsupported statement 'curv'"},
+		{"o\n", "obj:1: An object needs a name"},
+		{"# comment\nmtllib missing.mtl\n", "obj:2: open"},
+		{"mtllib bad.mtl\n", "bad.mtl:2: Kd: Expected an RGB color, got 2 values"},
+		{"mtllib unsupported.mtl\n", "unsupported.mtl:2: map_Kd needs a single file name, texture options aren't supported"},
+		{"mtllib orphan.mtl\n", "orphan.mtl:1: 'Kd' must follow a newmtl statement"},
+		{"mtllib missingtexture.mtl\n", "missingtexture.mtl: material 'a': open"},
+	}
+	for _, test := range tests {
+		filename := filepath.Join(dir, "test.obj")
+		g.Expect(os.WriteFile(filename, []byte(test.obj), 0644)).To(Succeed())
+		err := newObjReader().ReadObj(filename)
+		g.Expect(err).To(HaveOccurred(), test.obj)
+		g.Expect(err.Error()).To(ContainSubstring(test.expected), test.obj)
+	}
+}
+
+func TestObjSampleFiles(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	files, err := filepath.Glob("../../objs/*.obj")
+	g.Expect(err).To(BeNil())
+	g.Expect(files).ToNot(BeEmpty())
+	for _, f := range files {
+		o := newObjReader()
+		g.Expect(o.ReadObj(f)).To(Succeed(), f)
+		g.Expect(o.groups).ToNot(BeEmpty(), f)
+	}
+}
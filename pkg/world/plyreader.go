@@ -0,0 +1,367 @@
+package world
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/liorokman/raytrace/pkg/material"
+	"github.com/liorokman/raytrace/pkg/shapes"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+const (
+	plyAscii        = "ascii"
+	plyLittleEndian = "binary_little_endian"
+	plyBigEndian    = "binary_big_endian"
+
+	plyVertexElement = "vertex"
+	plyFaceElement   = "face"
+)
+
+type plyProperty struct {
+	name string
+	typ  string
+	// countType is only set for list properties
+	countType string
+}
+
+type plyElement struct {
+	name       string
+	count      int
+	properties []plyProperty
+}
+
+// plyValues reads the values of the body of a PLY file, one at a time
+type plyValues interface {
+	next(typ string) (float64, error)
+}
+
+type plyAsciiValues struct {
+	scan *bufio.Scanner
+}
+
+func (p plyAsciiValues) next(typ string) (float64, error) {
+	if !p.scan.Scan() {
+		if err := p.scan.Err(); err != nil {
+			return 0, err
+		}
+		return 0, io.ErrUnexpectedEOF
+	}
+	v, err := strconv.ParseFloat(p.scan.Text(), 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid number '%s'", p.scan.Text())
+	}
+	return v, nil
+}
+
+type plyBinaryValues struct {
+	in    io.Reader
+	order binary.ByteOrder
+	buf   [8]byte
+}
+
+func (p *plyBinaryValues) next(typ string) (float64, error) {
+	size := plyTypeSize(typ)
+	if _, err := io.ReadFull(p.in, p.buf[:size]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	b := p.buf[:size]
+	switch typ {
+	case "char", "int8":
+		return float64(int8(b[0])), nil
+	case "uchar", "uint8":
+		return float64(b[0]), nil
+	case "short", "int16":
+		return float64(int16(p.order.Uint16(b))), nil
+	case "ushort", "uint16":
+		return float64(p.order.Uint16(b)), nil
+	case "int", "int32":
+		return float64(int32(p.order.Uint32(b))), nil
+	case "uint", "uint32":
+		return float64(p.order.Uint32(b)), nil
+	case "float", "float32":
+		return float64(math.Float32frombits(p.order.Uint32(b))), nil
+	default:
+		return math.Float64frombits(p.order.Uint64(b)), nil
+	}
+}
+
+// plyTypeSize returns the size in bytes of a PLY scalar type, or 0 for unknown types
+func plyTypeSize(typ string) int {
+	switch typ {
+	case "char", "int8", "uchar", "uint8":
+		return 1
+	case "short", "int16", "ushort", "uint16":
+		return 2
+	case "int", "int32", "uint", "uint32", "float", "float32":
+		return 4
+	case "double", "float64":
+		return 8
+	}
+	return 0
+}
+
+// readPlyHeader reads the header of a PLY file, up to and including end_header
+func readPlyHeader(in *bufio.Reader) (string, []plyElement, error) {
+	format := ""
+	elements := []plyElement{}
+	lineNo := 0
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return "", nil, fmt.Errorf("The header isn't terminated by end_header")
+		}
+		lineNo++
+		lineErr := func(format string, args ...interface{}) error {
+			return fmt.Errorf("line %d: %s", lineNo, fmt.Sprintf(format, args...))
+		}
+		parts := strings.Fields(line)
+		if lineNo == 1 {
+			if len(parts) != 1 || parts[0] != "ply" {
+				return "", nil, fmt.Errorf("Not a PLY file")
+			}
+			continue
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		switch parts[0] {
+		case "comment", "obj_info":
+		case "format":
+			if len(parts) != 3 || parts[2] != "1.0" {
+				return "", nil, lineErr("Unsupported format '%s'", strings.Join(parts[1:], " "))
+			}
+			switch parts[1] {
+			case plyAscii, plyLittleEndian, plyBigEndian:
+				format = parts[1]
+			default:
+				return "", nil, lineErr("Unsupported format '%s'", parts[1])
+			}
+		case "element":
+			if len(parts) != 3 {
+				return "", nil, lineErr("An element needs a name and a count")
+			}
+			count, err := strconv.Atoi(parts[2])
+			if err != nil || count < 0 {
+				return "", nil, lineErr("Invalid element count '%s'", parts[2])
+			}
+			elements = append(elements, plyElement{name: parts[1], count: count})
+		case "property":
+			if len(elements) == 0 {
+				return "", nil, lineErr("A property must follow an element")
+			}
+			var prop plyProperty
+			if len(parts) == 5 && parts[1] == "list" {
+				prop = plyProperty{name: parts[4], typ: parts[3], countType: parts[2]}
+				if plyTypeSize(prop.countType) == 0 {
+					return "", nil, lineErr("Unknown property type '%s'", prop.countType)
+				}
+			} else if len(parts) == 3 {
+				prop = plyProperty{name: parts[2], typ: parts[1]}
+			} else {
+				return "", nil, lineErr("Invalid property")
+			}
+			if plyTypeSize(prop.typ) == 0 {
+				return "", nil, lineErr("Unknown property type '%s'", prop.typ)
+			}
+			last := &elements[len(elements)-1]
+			last.properties = append(last.properties, prop)
+		case "end_header":
+			if format == "" {
+				return "", nil, fmt.Errorf("The header has no format")
+			}
+			return format, elements, nil
+		default:
+			return "", nil, lineErr("Unsupported header line '%s'", parts[0])
+		}
+	}
+}
+
+// readPly reads a PLY file, in either the ASCII or the binary formats, into a group with a
+// single mesh. Vertex normals (nx, ny, nz), texture coordinates (u, v or s, t) and colors
+// (red, green, blue) are used when the vertices have them. A mesh with vertex colors gets a
+// material that uses them.
+func readPly(filename string) (shapes.Shape, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	in := bufio.NewReader(f)
+	format, elements, err := readPlyHeader(in)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	var values plyValues
+	switch format {
+	case plyAscii:
+		scan := bufio.NewScanner(in)
+		scan.Split(bufio.ScanWords)
+		values = plyAsciiValues{scan: scan}
+	case plyLittleEndian:
+		values = &plyBinaryValues{in: in, order: binary.LittleEndian}
+	default:
+		values = &plyBinaryValues{in: in, order: binary.BigEndian}
+	}
+
+	var (
+		vertices []tuple.Tuple
+		colors   []tuple.Color
+		normals  []tuple.Tuple
+		uvs      []shapes.TextureCoord
+		faces    []shapes.MeshFace
+	)
+	for _, element := range elements {
+		for i := 0; i < element.count; i++ {
+			props, lists, err := readPlyElement(values, element)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s %d: %w", filename, element.name, i, err)
+			}
+			switch element.name {
+			case plyVertexElement:
+				v, c, n, uv, err := plyVertex(props, element)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s %d: %w", filename, element.name, i, err)
+				}
+				vertices = append(vertices, v)
+				if c != nil {
+					colors = append(colors, *c)
+				}
+				if n != nil {
+					normals = append(normals, *n)
+				}
+				if uv != nil {
+					uvs = append(uvs, *uv)
+				}
+			case plyFaceElement:
+				indices, ok := lists["vertex_indices"]
+				if !ok {
+					indices, ok = lists["vertex_index"]
+				}
+				if !ok {
+					return nil, fmt.Errorf("%s: faces have no vertex_indices property", filename)
+				}
+				if len(indices) < 3 {
+					return nil, fmt.Errorf("%s: %s %d: A face needs at least 3 vertices, got %d", filename, element.name, i, len(indices))
+				}
+				// Faces with more than three vertices are split into a fan of triangles
+				for j := 1; j < len(indices)-1; j++ {
+					face := shapes.NewMeshFace(int(indices[0]), int(indices[j]), int(indices[j+1]))
+					// Normals and texture coordinates are given per vertex
+					face.Normals = face.Vertices
+					face.UVs = face.Vertices
+					faces = append(faces, face)
+				}
+			}
+		}
+	}
+	// Faces may be listed before the vertices, so the normals and texture coordinates are
+	// only known to be there once all the elements have been read
+	if len(normals) == 0 || len(uvs) == 0 {
+		for i := range faces {
+			if len(normals) == 0 {
+				faces[i].Normals = [3]int{-1, -1, -1}
+			}
+			if len(uvs) == 0 {
+				faces[i].UVs = [3]int{-1, -1, -1}
+			}
+		}
+	}
+	m, err := shapes.NewColoredMesh(vertices, colors, normals, uvs, faces)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if len(colors) > 0 {
+		m = m.WithMaterial(material.NewDefaultBuilder().WithPattern(material.NewVertexColorPattern(tuple.NewColor(1, 1, 1))).Build())
+	}
+	g := shapes.NewGroup()
+	shapes.Connect(g, m)
+	return g, nil
+}
+
+// readPlyElement reads a single element, returning its scalar properties and its lists
+// by name
+func readPlyElement(values plyValues, element plyElement) (map[string]float64, map[string][]float64, error) {
+	props := map[string]float64{}
+	lists := map[string][]float64{}
+	for _, prop := range element.properties {
+		if prop.countType == "" {
+			v, err := values.next(prop.typ)
+			if err != nil {
+				return nil, nil, err
+			}
+			props[prop.name] = v
+			continue
+		}
+		count, err := values.next(prop.countType)
+		if err != nil {
+			return nil, nil, err
+		}
+		if count < 0 || count != math.Trunc(count) {
+			return nil, nil, fmt.Errorf("Invalid list length %v", count)
+		}
+		list := make([]float64, int(count))
+		for i := range list {
+			if list[i], err = values.next(prop.typ); err != nil {
+				return nil, nil, err
+			}
+		}
+		lists[prop.name] = list
+	}
+	return props, lists, nil
+}
+
+// plyVertex converts the properties of a vertex element. The optional values are nil when
+// the vertex doesn't have them.
+func plyVertex(props map[string]float64, element plyElement) (tuple.Tuple, *tuple.Color, *tuple.Tuple, *shapes.TextureCoord, error) {
+	has := func(names ...string) bool {
+		for _, n := range names {
+			if _, ok := props[n]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+	if !has("x", "y", "z") {
+		return tuple.Tuple{}, nil, nil, nil, fmt.Errorf("Vertices need x, y and z properties")
+	}
+	v := tuple.NewPoint(props["x"], props["y"], props["z"])
+	var c *tuple.Color
+	if has("red", "green", "blue") {
+		// Integer colors are in the range of their type, while floating point colors are
+		// already in [0,1]
+		scale := 1.0
+		for _, p := range element.properties {
+			if p.name == "red" && (p.typ == "uchar" || p.typ == "uint8") {
+				scale = 255
+			} else if p.name == "red" && (p.typ == "ushort" || p.typ == "uint16") {
+				scale = 65535
+			}
+		}
+		color := tuple.NewColor(props["red"]/scale, props["green"]/scale, props["blue"]/scale)
+		c = &color
+	}
+	var n *tuple.Tuple
+	if has("nx", "ny", "nz") {
+		normal := tuple.NewVector(props["nx"], props["ny"], props["nz"])
+		n = &normal
+	}
+	var uv *shapes.TextureCoord
+	for _, names := range [][2]string{{"u", "v"}, {"s", "t"}, {"texture_u", "texture_v"}} {
+		if has(names[0], names[1]) {
+			uv = &shapes.TextureCoord{U: props[names[0]], V: props[names[1]]}
+			break
+		}
+	}
+	return v, c, n, uv, nil
+}
@@ -0,0 +1,145 @@
+package world
+
+import (
+	"fmt"
+
+	"github.com/liorokman/raytrace/pkg/shapes"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+const (
+	// signed distance field nodes, in addition to sphere and torus
+	box              = "box"
+	capsule          = "capsule"
+	smoothunion      = "smoothunion"
+	smoothdifference = "smoothdifference"
+	repeat           = "repeat"
+)
+
+// sdfNode describes one node in the tree of an sdf object. Leaves are primitive shapes,
+// and the other nodes combine their children.
+type sdfNode struct {
+	Type     string
+	Center   []float64 `yaml:",flow,omitempty"`
+	Radius   float64   `yaml:",omitempty"`
+	Size     []float64 `yaml:",flow,omitempty"`
+	Rounding float64   `yaml:",omitempty"`
+	A        []float64 `yaml:",flow,omitempty"`
+	B        []float64 `yaml:",flow,omitempty"`
+	Major    float64   `yaml:",omitempty"`
+	Minor    float64   `yaml:",omitempty"`
+	K        float64   `yaml:"k,omitempty"`
+	Period   []float64 `yaml:",flow,omitempty"`
+	Children []sdfNode `yaml:",omitempty"`
+}
+
+func (n sdfNode) toSDF() (shapes.SDF, error) {
+	switch n.Type {
+	case sphere:
+		center, err := n.point("center", n.Center)
+		if err != nil {
+			return nil, err
+		}
+		if n.Radius <= 0 {
+			return nil, fmt.Errorf("sdf sphere needs a positive radius")
+		}
+		return shapes.NewSDFSphere(center, n.Radius), nil
+	case box:
+		center, err := n.point("center", n.Center)
+		if err != nil {
+			return nil, err
+		}
+		if len(n.Size) != 3 {
+			return nil, fmt.Errorf("sdf box needs a size of [ x, y, z ]")
+		}
+		size := tuple.NewVector(n.Size[0], n.Size[1], n.Size[2])
+		if size.X() <= 0 || size.Y() <= 0 || size.Z() <= 0 {
+			return nil, fmt.Errorf("sdf box size must be positive")
+		}
+		if n.Rounding < 0 || n.Rounding > min(size.X(), size.Y(), size.Z()) {
+			return nil, fmt.Errorf("sdf box rounding must be between 0 and the box's smallest half size")
+		}
+		return shapes.NewSDFBox(center, size, n.Rounding), nil
+	case capsule:
+		if n.A == nil || n.B == nil {
+			return nil, fmt.Errorf("sdf capsule needs both an 'a' and a 'b' point")
+		}
+		a, err := n.point("a", n.A)
+		if err != nil {
+			return nil, err
+		}
+		b, err := n.point("b", n.B)
+		if err != nil {
+			return nil, err
+		}
+		if n.Radius <= 0 {
+			return nil, fmt.Errorf("sdf capsule needs a positive radius")
+		}
+		return shapes.NewSDFCapsule(a, b, n.Radius), nil
+	case torus:
+		if n.Major < 0 || n.Minor <= 0 {
+			return nil, fmt.Errorf("sdf torus needs a non-negative major and a positive minor radius")
+		}
+		return shapes.NewSDFTorus(n.Major, n.Minor), nil
+	case unionop, smoothunion, intersectop, differenceop, smoothdifference:
+		children, err := n.children()
+		if err != nil {
+			return nil, err
+		}
+		if n.K < 0 {
+			return nil, fmt.Errorf("sdf %s can't have a negative k", n.Type)
+		}
+		switch n.Type {
+		case unionop:
+			return shapes.NewSDFUnion(children...), nil
+		case smoothunion:
+			return shapes.NewSDFSmoothUnion(n.K, children...), nil
+		case intersectop:
+			return shapes.NewSDFIntersection(children...), nil
+		case differenceop:
+			return shapes.NewSDFSubtraction(children[0], children[1:]...), nil
+		default:
+			return shapes.NewSDFSmoothSubtraction(n.K, children[0], children[1:]...), nil
+		}
+	case repeat:
+		if len(n.Period) != 3 || n.Period[0] < 0 || n.Period[1] < 0 || n.Period[2] < 0 {
+			return nil, fmt.Errorf("sdf repeat needs a period of [ x, y, z ], with no negative values")
+		}
+		if len(n.Children) != 1 {
+			return nil, fmt.Errorf("sdf repeat needs exactly one child")
+		}
+		child, err := n.Children[0].toSDF()
+		if err != nil {
+			return nil, at(index("children", 0), err)
+		}
+		return shapes.NewSDFRepeat(tuple.NewVector(n.Period[0], n.Period[1], n.Period[2]), child), nil
+	default:
+		return nil, fmt.Errorf("Unknown sdf node %s", n.Type)
+	}
+}
+
+// point converts an optional point parameter, which defaults to the origin
+func (n sdfNode) point(name string, s []float64) (tuple.Tuple, error) {
+	if s == nil {
+		return tuple.NewPoint(0, 0, 0), nil
+	}
+	p, err := sliceToPoint(s)
+	if err != nil {
+		return tuple.Tuple{}, fmt.Errorf("sdf %s %s: %w", n.Type, name, err)
+	}
+	return p.ToPoint(), nil
+}
+
+func (n sdfNode) children() ([]shapes.SDF, error) {
+	if len(n.Children) == 0 {
+		return nil, fmt.Errorf("sdf %s needs at least one child", n.Type)
+	}
+	retval := make([]shapes.SDF, len(n.Children))
+	for i := range n.Children {
+		var err error
+		if retval[i], err = n.Children[i].toSDF(); err != nil {
+			return nil, at(index("children", i), err)
+		}
+	}
+	return retval, nil
+}
@@ -0,0 +1,201 @@
+package world
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/liorokman/raytrace/pkg/material"
+	"github.com/liorokman/raytrace/pkg/shapes"
+	"github.com/liorokman/raytrace/pkg/tuple"
+)
+
+const (
+	stlHeaderSize   = 80
+	stlTriangleSize = 50
+	// stlColorValid marks the attribute of a binary triangle as a 15 bit RGB color, as
+	// written by VisCAM and SolidView
+	stlColorValid = 1 << 15
+)
+
+// stlMesh collects the triangles of an STL file. STL files don't share vertices between
+// triangles, so every triangle adds three vertices of its own.
+type stlMesh struct {
+	vertices []tuple.Tuple
+	normals  []tuple.Tuple
+	colors   []tuple.Color
+	faces    []shapes.MeshFace
+	colored  bool
+}
+
+// add adds a triangle. A zero normal means the triangle has no normal, and its normal is
+// computed from its vertices instead.
+func (s *stlMesh) add(normal tuple.Tuple, p1, p2, p3 tuple.Tuple, c *tuple.Color) {
+	base := len(s.vertices)
+	s.vertices = append(s.vertices, p1, p2, p3)
+	face := shapes.NewMeshFace(base, base+1, base+2)
+	if normal.Magnitude() > 0 {
+		n := len(s.normals)
+		s.normals = append(s.normals, normal.Normalize())
+		face.Normals = [3]int{n, n, n}
+	}
+	color := tuple.NewColor(1, 1, 1)
+	if c != nil {
+		color = *c
+		s.colored = true
+	}
+	s.colors = append(s.colors, color, color, color)
+	s.faces = append(s.faces, face)
+}
+
+func (s *stlMesh) asGroup() (shapes.Shape, error) {
+	colors := s.colors
+	if !s.colored {
+		colors = nil
+	}
+	m, err := shapes.NewColoredMesh(s.vertices, colors, s.normals, nil, s.faces)
+	if err != nil {
+		return nil, err
+	}
+	if s.colored {
+		m = m.WithMaterial(material.NewDefaultBuilder().WithPattern(material.NewVertexColorPattern(tuple.NewColor(1, 1, 1))).Build())
+	}
+	g := shapes.NewGroup()
+	shapes.Connect(g, m)
+	return g, nil
+}
+
+// readStl reads an ASCII or binary STL file into a group with a single mesh. The facet
+// normals are used as the normals of the faces, and the colors of binary files that use the
+// VisCAM/SolidView convention become vertex colors.
+func readStl(filename string) (shapes.Shape, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var mesh *stlMesh
+	// ASCII files start with "solid", but so do the headers of some binary files, so the
+	// size of the file decides
+	if len(data) >= stlHeaderSize+4 {
+		count := binary.LittleEndian.Uint32(data[stlHeaderSize:])
+		if uint64(len(data)) == stlHeaderSize+4+uint64(count)*stlTriangleSize {
+			mesh, err = readBinaryStl(data[stlHeaderSize+4:], int(count))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", filename, err)
+			}
+		}
+	}
+	if mesh == nil {
+		if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("solid")) {
+			return nil, fmt.Errorf("%s: Not an STL file", filename)
+		}
+		mesh, err = readAsciiStl(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%w", filename, err)
+		}
+	}
+	g, err := mesh.asGroup()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return g, nil
+}
+
+func readBinaryStl(data []byte, count int) (*stlMesh, error) {
+	mesh := &stlMesh{}
+	vec := func(b []byte) [3]float64 {
+		return [3]float64{
+			float64(math.Float32frombits(binary.LittleEndian.Uint32(b))),
+			float64(math.Float32frombits(binary.LittleEndian.Uint32(b[4:]))),
+			float64(math.Float32frombits(binary.LittleEndian.Uint32(b[8:]))),
+		}
+	}
+	for i := 0; i < count; i++ {
+		t := data[i*stlTriangleSize:]
+		n, p1, p2, p3 := vec(t), vec(t[12:]), vec(t[24:]), vec(t[36:])
+		var c *tuple.Color
+		if attr := binary.LittleEndian.Uint16(t[48:]); attr&stlColorValid != 0 {
+			color := tuple.NewColor(float64((attr>>10)&31)/31, float64((attr>>5)&31)/31, float64(attr&31)/31)
+			c = &color
+		}
+		mesh.add(tuple.NewVector(n[0], n[1], n[2]),
+			tuple.NewPoint(p1[0], p1[1], p1[2]),
+			tuple.NewPoint(p2[0], p2[1], p2[2]),
+			tuple.NewPoint(p3[0], p3[1], p3[2]),
+			c)
+	}
+	return mesh, nil
+}
+
+// readAsciiStl reads the facets of an ASCII STL file. Errors start with the line number,
+// without the file name.
+func readAsciiStl(in io.Reader) (*stlMesh, error) {
+	mesh := &stlMesh{}
+	var normal tuple.Tuple
+	points := []tuple.Tuple{}
+	inFacet := false
+	lineNo := 0
+	lineErr := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%d: %s", lineNo, fmt.Sprintf(format, args...))
+	}
+	scan := bufio.NewScanner(in)
+	for scan.Scan() {
+		lineNo++
+		parts := strings.Fields(scan.Text())
+		if len(parts) == 0 {
+			continue
+		}
+		switch parts[0] {
+		case "solid", "endsolid", "outer", "endloop":
+		case "facet":
+			if inFacet {
+				return nil, lineErr("facet inside a facet")
+			}
+			if len(parts) != 5 || parts[1] != "normal" {
+				return nil, lineErr("Expected 'facet normal nx ny nz'")
+			}
+			n, err := toFloat64Slice(parts[2:])
+			if err != nil {
+				return nil, lineErr("%v", err)
+			}
+			normal = tuple.NewVector(n[0], n[1], n[2])
+			points = points[:0]
+			inFacet = true
+		case "vertex":
+			if !inFacet {
+				return nil, lineErr("vertex outside of a facet")
+			}
+			if len(parts) != 4 {
+				return nil, lineErr("Expected 'vertex x y z'")
+			}
+			p, err := toFloat64Slice(parts[1:])
+			if err != nil {
+				return nil, lineErr("%v", err)
+			}
+			points = append(points, tuple.NewPoint(p[0], p[1], p[2]))
+		case "endfacet":
+			if !inFacet {
+				return nil, lineErr("endfacet outside of a facet")
+			}
+			if len(points) != 3 {
+				return nil, lineErr("A facet needs 3 vertices, got %d", len(points))
+			}
+			mesh.add(normal, points[0], points[1], points[2], nil)
+			inFacet = false
+		default:
+			return nil, lineErr("Unsupported statement '%s'", parts[0])
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+	if inFacet {
+		return nil, lineErr("The last facet isn't terminated by endfacet")
+	}
+	return mesh, nil
+}
@@ -0,0 +1,1400 @@
+package world
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+
+	"github.com/liorokman/raytrace/pkg/matrix"
+	"github.com/liorokman/raytrace/pkg/utils"
+)
+
+// Problem is a mistake found in a scene file, or in a file it includes
+type Problem struct {
+	File   string
+	Line   int
+	Column int
+	// Path is where the problem is in the scene, such as objects[2].material.ambient
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s", p.File, p.Line, p.Column, p.Path, p.Message)
+}
+
+// ValidationError holds all the problems found in a scene file
+type ValidationError struct {
+	File     string
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = p.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+const (
+	// camera sampling modes and filters, as read by camera.SamplingFromScene
+	singlesampling   = "single"
+	regularsampling  = "regular"
+	jitteredsampling = "jittered"
+	adaptivesampling = "adaptive"
+	boxfilter        = "box"
+	tentfilter       = "tent"
+	gaussianfilter   = "gaussian"
+)
+
+// validator walks the nodes of a scene file and collects all the problems it finds,
+// so that they can be reported at once instead of one at a time, each at its line and
+// column. The builder checks the same values again for scenes that are built without
+// the validator, but stops at the first problem.
+type validator struct {
+	problems []Problem
+	// file is the file being checked, and including are the files that include it
+	file      string
+	including []string
+	// materials holds the names of the materials defined so far, which can be used as presets
+	materials map[string]bool
+	// objects and transforms hold the names defined so far in define sections
+	objects    map[string]bool
+	transforms map[string]matrix.Matrix
+	// vars holds the variables defined so far, for the expressions in numeric fields
+	vars variables
+	// keyframe is the keyframe that's checked in place of every keyframed value, and
+	// keyframes is the largest number of keyframes of any value
+	keyframe  int
+	keyframes int
+	// broken holds the keyframed values that are already reported, and can't be checked
+	// any further
+	broken map[*yamlv3.Node]bool
+	// files holds the included files and the model and texture files that the scene reads
+	files []string
+}
+
+func newValidator(file string, keyframe int, time float64) *validator {
+	return &validator{
+		file:       file,
+		materials:  map[string]bool{},
+		objects:    map[string]bool{},
+		transforms: map[string]matrix.Matrix{},
+		vars:       variables{timeVariable: time},
+		keyframe:   keyframe,
+		broken:     map[*yamlv3.Node]bool{},
+	}
+}
+
+// validateScene checks a scene file against the scene format before the frame at the
+// given time is built. Keyframed values are checked one keyframe at a time, by checking
+// the whole scene once for every keyframe, while expressions that use the time are
+// checked at the time of the frame.
+func validateScene(file string, data []byte, time float64) error {
+	var problems []Problem
+	for keyframe, keyframes := 0, 1; keyframe < keyframes; keyframe++ {
+		var doc yamlv3.Node
+		if err := yamlv3.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		v := newValidator(file, keyframe, time)
+		if len(doc.Content) == 0 {
+			v.report(&doc, "", "The scene is empty")
+		} else {
+			v.scene(doc.Content[0], false)
+		}
+		for _, p := range v.problems {
+			if !slices.Contains(problems, p) {
+				problems = append(problems, p)
+			}
+		}
+		keyframes = max(keyframes, v.keyframes)
+	}
+	if len(problems) > 0 {
+		return &ValidationError{File: file, Problems: problems}
+	}
+	return nil
+}
+
+// SceneFiles returns the files that a scene is built from: the scene file, the files it
+// includes and the model and texture files they read, including the material libraries
+// of OBJ models and their textures. A glTF scene is built from the glTF file and its
+// buffer and image files. Tools that rebuild the scene when it changes watch these
+// files. The files are found even when the scene has problems, as long as it can be
+// parsed.
+func SceneFiles(file string) ([]string, error) {
+	if ext := strings.ToLower(filepath.Ext(file)); ext == ".gltf" || ext == ".glb" {
+		files, err := gltfFiles(file)
+		return append([]string{file}, files...), err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return []string{file}, err
+	}
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return []string{file}, fmt.Errorf("%s: %w", file, err)
+	}
+	v := newValidator(file, 0, 0)
+	if len(doc.Content) > 0 {
+		v.scene(doc.Content[0], false)
+	}
+	retval := []string{file}
+	add := func(files ...string) {
+		for _, f := range files {
+			if !slices.Contains(retval, f) {
+				retval = append(retval, f)
+			}
+		}
+	}
+	for _, f := range v.files {
+		add(f)
+		if strings.ToLower(filepath.Ext(f)) == ".obj" {
+			add(objFiles(f)...)
+		}
+	}
+	return retval, nil
+}
+
+func (v *validator) report(n *yamlv3.Node, path string, format string, args ...interface{}) {
+	if v.broken[n] {
+		return
+	}
+	if path == "" {
+		path = "scene"
+	}
+	v.problems = append(v.problems, Problem{
+		File:    v.file,
+		Line:    n.Line,
+		Column:  n.Column,
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func resolve(n *yamlv3.Node) *yamlv3.Node {
+	for n.Kind == yamlv3.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func index(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+// mapping returns the fields of a mapping node. Fields that aren't allowed are reported,
+// along with the allowed field that has the same name in a different case, if any.
+func (v *validator) mapping(n *yamlv3.Node, path string, allowed ...string) (map[string]*yamlv3.Node, bool) {
+	n = resolve(n)
+	if n.Kind != yamlv3.MappingNode {
+		v.report(n, path, "Must be a mapping of fields")
+		return nil, false
+	}
+	fields := map[string]*yamlv3.Node{}
+	// Fields given in the mapping itself override the merged ones, wherever the merge key is
+	var add func(n *yamlv3.Node, merged bool)
+	add = func(n *yamlv3.Node, merged bool) {
+		merges := []*yamlv3.Node{}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, val := n.Content[i], n.Content[i+1]
+			if key.Tag == "!!merge" {
+				val = resolve(val)
+				if val.Kind == yamlv3.SequenceNode {
+					for _, m := range val.Content {
+						merges = append(merges, resolve(m))
+					}
+				} else {
+					merges = append(merges, val)
+				}
+				continue
+			}
+			if _, ok := fields[key.Value]; ok {
+				if !merged {
+					v.report(key, path, "Field '%s' appears more than once", key.Value)
+				}
+				continue
+			}
+			if !contains(allowed, key.Value) {
+				if suggestion := sameName(allowed, key.Value); suggestion != "" {
+					v.report(key, path, "Unknown field '%s', did you mean '%s'?", key.Value, suggestion)
+				} else {
+					v.report(key, path, "Unknown field '%s'", key.Value)
+				}
+				continue
+			}
+			fields[key.Value] = val
+		}
+		for _, m := range merges {
+			add(m, true)
+		}
+	}
+	add(n, false)
+	return fields, true
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func sameName(list []string, s string) string {
+	for _, l := range list {
+		if strings.EqualFold(l, s) {
+			return l
+		}
+	}
+	return ""
+}
+
+// require reports every field in names that's missing
+func (v *validator) require(n *yamlv3.Node, path string, fields map[string]*yamlv3.Node, names ...string) bool {
+	ok := true
+	for _, name := range names {
+		if _, found := fields[name]; !found {
+			v.report(resolve(n), path, "Missing field '%s'", name)
+			ok = false
+		}
+	}
+	return ok
+}
+
+func (v *validator) sequence(n *yamlv3.Node, path string) ([]*yamlv3.Node, bool) {
+	n = resolve(n)
+	if n.Kind != yamlv3.SequenceNode {
+		v.report(n, path, "Must be a list")
+		return nil, false
+	}
+	retval := make([]*yamlv3.Node, len(n.Content))
+	for i := range n.Content {
+		retval[i] = resolve(n.Content[i])
+	}
+	return retval, true
+}
+
+// number checks a number, which can also be given as an expression
+func (v *validator) number(n *yamlv3.Node, path string) (float64, bool) {
+	n = resolve(n)
+	if n.Kind == yamlv3.ScalarNode && n.Tag == "!!str" {
+		f, err := v.vars.evaluate(n.Value)
+		if err != nil {
+			v.report(n, path, "%v", err)
+			return 0, false
+		}
+		return f, true
+	}
+	var f float64
+	if n.Kind != yamlv3.ScalarNode || n.Decode(&f) != nil {
+		v.report(n, path, "Must be a number")
+		return 0, false
+	}
+	return f, true
+}
+
+// numberIn checks that a number is in the inclusive range [min, max]
+func (v *validator) numberIn(n *yamlv3.Node, path string, min, max float64) (float64, bool) {
+	f, ok := v.number(n, path)
+	if !ok {
+		return 0, false
+	}
+	if f < min || f > max {
+		if math.IsInf(max, 1) {
+			v.report(resolve(n), path, "Must be at least %g, not %g", min, f)
+		} else {
+			v.report(resolve(n), path, "Must be between %g and %g, not %g", min, max, f)
+		}
+		return 0, false
+	}
+	return f, true
+}
+
+func (v *validator) positive(n *yamlv3.Node, path string) (float64, bool) {
+	f, ok := v.number(n, path)
+	if ok && f <= 0 {
+		v.report(resolve(n), path, "Must be positive, not %g", f)
+		return 0, false
+	}
+	return f, ok
+}
+
+func (v *validator) integer(n *yamlv3.Node, path string, min int) (int, bool) {
+	n = resolve(n)
+	var i int
+	if n.Kind == yamlv3.ScalarNode && n.Tag == "!!str" {
+		f, ok := v.number(n, path)
+		if !ok {
+			return 0, false
+		}
+		if f != math.Trunc(f) {
+			v.report(n, path, "Must be an integer, not %g", f)
+			return 0, false
+		}
+		i = int(f)
+	} else if n.Kind != yamlv3.ScalarNode || n.Decode(&i) != nil {
+		v.report(n, path, "Must be an integer")
+		return 0, false
+	} else if f, err := strconv.ParseFloat(n.Value, 64); n.Tag == "!!float" && err == nil && f != math.Trunc(f) {
+		v.report(n, path, "Must be an integer, not %g", f)
+		return 0, false
+	}
+	if i < min {
+		v.report(n, path, "Must be at least %d, not %d", min, i)
+		return 0, false
+	}
+	return i, true
+}
+
+func (v *validator) boolean(n *yamlv3.Node, path string) (bool, bool) {
+	n = resolve(n)
+	var b bool
+	if n.Kind != yamlv3.ScalarNode || n.Decode(&b) != nil {
+		v.report(n, path, "Must be true or false")
+		return false, false
+	}
+	return b, true
+}
+
+func (v *validator) str(n *yamlv3.Node, path string) (string, bool) {
+	n = resolve(n)
+	if n.Kind != yamlv3.ScalarNode || n.Tag != "!!str" {
+		v.report(n, path, "Must be a string")
+		return "", false
+	}
+	return n.Value, true
+}
+
+// oneOf checks that a string is one of the given choices
+func (v *validator) oneOf(n *yamlv3.Node, path string, what string, choices ...string) (string, bool) {
+	s, ok := v.str(n, path)
+	if !ok {
+		return "", false
+	}
+	if !contains(choices, s) {
+		v.report(resolve(n), path, "Unknown %s '%s', must be one of %s", what, s, strings.Join(choices, ", "))
+		return "", false
+	}
+	return s, true
+}
+
+// floats checks a list of numbers with one of the given lengths
+func (v *validator) floats(n *yamlv3.Node, path string, sizes ...int) ([]float64, bool) {
+	items, ok := v.sequence(n, path)
+	if !ok {
+		return nil, false
+	}
+	if !containsInt(sizes, len(items)) {
+		v.report(resolve(n), path, "Must have %s values, not %d", joinInts(sizes), len(items))
+		return nil, false
+	}
+	retval := make([]float64, len(items))
+	for i := range items {
+		if retval[i], ok = v.number(items[i], index(path, i)); !ok {
+			return nil, false
+		}
+	}
+	return retval, true
+}
+
+func containsInt(list []int, i int) bool {
+	for _, l := range list {
+		if l == i {
+			return true
+		}
+	}
+	return false
+}
+
+func joinInts(list []int) string {
+	s := make([]string, len(list))
+	for i := range list {
+		s[i] = fmt.Sprint(list[i])
+	}
+	return strings.Join(s, " or ")
+}
+
+func (v *validator) nonZeroVector(n *yamlv3.Node, path string) ([]float64, bool) {
+	vec, ok := v.floats(n, path, 3)
+	if ok && vec[0] == 0 && vec[1] == 0 && vec[2] == 0 {
+		v.report(resolve(n), path, "Must not be the zero vector")
+		return nil, false
+	}
+	return vec, ok
+}
+
+func (v *validator) nonNegativeColor(n *yamlv3.Node, path string) ([]float64, bool) {
+	c, ok := v.floats(n, path, 3)
+	if ok && (c[0] < 0 || c[1] < 0 || c[2] < 0) {
+		v.report(resolve(n), path, "Color values can't be negative")
+		return nil, false
+	}
+	return c, ok
+}
+
+func (v *validator) existingFile(n *yamlv3.Node, path string) (string, bool) {
+	name, ok := v.str(n, path)
+	if !ok {
+		return "", false
+	}
+	// Missing files are watched too, so that the scene is rebuilt once they're there
+	v.files = append(v.files, name)
+	if _, err := os.Stat(name); err != nil {
+		v.report(resolve(n), path, "Can't read '%s': %s", name, err)
+		return "", false
+	}
+	return name, true
+}
+
+// scene checks the content of a scene file. Included files have no camera, since only
+// the camera of the outermost file is used.
+func (v *validator) scene(n *yamlv3.Node, included bool) {
+	fields, ok := v.mapping(n, "", "include", "animation", "vars", "define", "objects", "fixtures", "materials", "camera")
+	if !ok {
+		return
+	}
+	animated := v.animate(n, "")
+	// The builder reads all the included files first, then the variables, the materials
+	// and the definitions, and only then the objects
+	if inc, ok := fields["include"]; ok {
+		if items, ok := v.sequence(inc, "include"); ok {
+			for i, item := range items {
+				v.include(item, index("include", i))
+			}
+		}
+	}
+	if vars, ok := fields["vars"]; ok {
+		v.variables(vars, "vars")
+	}
+	if cam, ok := fields["camera"]; ok {
+		if included {
+			v.report(resolve(cam), "camera", "Included files can't have a camera")
+		} else {
+			v.camera(cam, "camera")
+		}
+	} else if !included {
+		v.report(resolve(n), "", "Missing field 'camera'")
+	}
+	if a, ok := fields["animation"]; ok {
+		if included {
+			v.report(resolve(a), "animation", "Included files can't have an animation")
+		} else {
+			v.animation(a, "animation")
+		}
+	}
+	if f, ok := fields["fixtures"]; ok {
+		if items, ok := v.sequence(f, "fixtures"); ok {
+			for i, item := range items {
+				v.fixture(item, index("fixtures", i))
+			}
+		}
+	}
+	// The builder reads all the materials before any of the objects
+	if m, ok := fields["materials"]; ok {
+		if items, ok := v.sequence(m, "materials"); ok {
+			for i, item := range items {
+				v.material(item, index("materials", i))
+			}
+		}
+	}
+	if d, ok := fields["define"]; ok {
+		if items, ok := v.sequence(d, "define"); ok {
+			for i, item := range items {
+				v.definition(item, index("define", i))
+			}
+		}
+	}
+	if o, ok := fields["objects"]; ok {
+		v.objectList(o, "objects")
+	}
+	// Keyframe times can use any of the variables
+	for _, keys := range animated {
+		v.keyframeTimes(keys)
+	}
+}
+
+// variables checks a vars section. Every variable can use the ones defined before it.
+func (v *validator) variables(n *yamlv3.Node, path string) {
+	n = resolve(n)
+	if n.Kind != yamlv3.MappingNode {
+		v.report(n, path, "Must be a mapping")
+		return
+	}
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, val := n.Content[i], n.Content[i+1]
+		name := key.Value
+		switch {
+		case seen[name]:
+			v.report(key, join(path, name), "Duplicate variable '%s'", name)
+		case !isIdentifier(name):
+			v.report(key, join(path, name), "A variable name must start with a letter, and have only letters, digits and underscores")
+		case reservedName(name):
+			v.report(key, join(path, name), "%s is a constant, a function or the time, and can't be used as a variable name", name)
+		default:
+			seen[name] = true
+			if f, ok := v.number(val, join(path, name)); ok {
+				v.vars[name] = f
+			}
+		}
+	}
+}
+
+func (v *validator) animation(n *yamlv3.Node, path string) {
+	fields, ok := v.mapping(n, path, "frames", "fps", "shutter")
+	if !ok {
+		return
+	}
+	if f, ok := fields["frames"]; ok {
+		v.integer(f, join(path, "frames"), 1)
+	}
+	if f, ok := fields["fps"]; ok {
+		v.positive(f, join(path, "fps"))
+	}
+	if f, ok := fields["shutter"]; ok {
+		v.numberIn(f, join(path, "shutter"), 0, 1)
+	}
+}
+
+// keyframeList is a keyframed value found in a scene
+type keyframeList struct {
+	path  string
+	items []*yamlv3.Node
+}
+
+// animate finds the keyframed values under n, and replaces each one with the value of
+// the keyframe that's being checked, so that the rest of the checks see a plain value
+// with the location of that keyframe. Aliases see the replaced values too.
+func (v *validator) animate(n *yamlv3.Node, path string) []keyframeList {
+	var retval []keyframeList
+	switch n.Kind {
+	case yamlv3.SequenceNode:
+		for i, item := range n.Content {
+			retval = append(retval, v.animate(item, index(path, i))...)
+		}
+	case yamlv3.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == keyframesKey {
+				if keys, ok := v.keyframeList(n, path); ok {
+					retval = append(retval, keys)
+				}
+				return retval
+			}
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			retval = append(retval, v.animate(n.Content[i+1], join(path, n.Content[i].Value))...)
+		}
+	}
+	return retval
+}
+
+// keyframeList checks the keyframes of a value, and replaces it with one of them
+func (v *validator) keyframeList(n *yamlv3.Node, path string) (keyframeList, bool) {
+	fields, ok := v.mapping(n, path, keyframesKey)
+	if !ok {
+		v.broken[n] = true
+		return keyframeList{}, false
+	}
+	keysPath := join(path, keyframesKey)
+	items, ok := v.sequence(fields[keyframesKey], keysPath)
+	if !ok || len(items) == 0 {
+		if ok {
+			v.report(resolve(fields[keyframesKey]), keysPath, "Must have at least one keyframe")
+		}
+		v.broken[n] = true
+		return keyframeList{}, false
+	}
+	v.keyframes = max(v.keyframes, len(items))
+	values := make([]*yamlv3.Node, len(items))
+	for i, item := range items {
+		itemPath := index(keysPath, i)
+		keyFields, ok := v.mapping(item, itemPath, "time", "value", "easing")
+		if !ok || !v.require(item, itemPath, keyFields, "time", "value") {
+			continue
+		}
+		if e, ok := keyFields["easing"]; ok {
+			v.oneOf(e, join(itemPath, "easing"), "easing", lineareasing, easeineasing, easeouteasing, easeinouteasing)
+		}
+		value := resolve(keyFields["value"])
+		switch {
+		case value.Kind == yamlv3.SequenceNode && values[0] != nil && (values[0].Kind != yamlv3.SequenceNode || len(values[0].Content) != len(value.Content)),
+			value.Kind != yamlv3.SequenceNode && values[0] != nil && values[0].Kind == yamlv3.SequenceNode:
+			v.report(value, join(itemPath, "value"), "Must have as many values as the first keyframe")
+		default:
+			values[i] = value
+		}
+	}
+	// The keyframe that's checked, or the last one for values with fewer keyframes
+	for i := min(v.keyframe, len(values)-1); i >= 0; i-- {
+		if values[i] != nil {
+			*n = *values[i]
+			return keyframeList{path: keysPath, items: items}, true
+		}
+	}
+	v.broken[n] = true
+	return keyframeList{path: keysPath, items: items}, true
+}
+
+// keyframeTimes checks that the times of keyframes are in order
+func (v *validator) keyframeTimes(keys keyframeList) {
+	last := math.Inf(-1)
+	for i, item := range keys.items {
+		n := field(item, "time")
+		if n == nil {
+			continue
+		}
+		timePath := join(index(keys.path, i), "time")
+		t, ok := v.number(n, timePath)
+		if !ok {
+			continue
+		}
+		if t <= last {
+			v.report(resolve(n), timePath, "Must be after the time of the keyframe before it")
+		}
+		last = t
+	}
+}
+
+// field returns the value of a key in a mapping that was already checked, or nil
+func field(n *yamlv3.Node, key string) *yamlv3.Node {
+	n = resolve(n)
+	for i := 0; n.Kind == yamlv3.MappingNode && i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// include checks an included file, with the names defined so far
+func (v *validator) include(n *yamlv3.Node, path string) {
+	name, ok := v.str(n, path)
+	if !ok {
+		return
+	}
+	file := includePath(v.file, name)
+	if contains(v.including, file) || file == filepath.Clean(v.file) {
+		v.report(resolve(n), path, "'%s' includes itself", name)
+		return
+	}
+	v.files = append(v.files, file)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		v.report(resolve(n), path, "Can't read '%s': %s", name, err)
+		return
+	}
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		v.report(resolve(n), path, "Can't parse '%s': %s", name, err)
+		return
+	}
+	if len(doc.Content) == 0 {
+		return
+	}
+	outer, including := v.file, v.including
+	v.file, v.including = file, append(v.including, filepath.Clean(outer))
+	v.scene(doc.Content[0], true)
+	v.file, v.including = outer, including
+}
+
+func (v *validator) definition(n *yamlv3.Node, path string) {
+	fields, ok := v.mapping(n, path, "name", "object", "transform")
+	if !ok {
+		return
+	}
+	v.require(n, path, fields, "name")
+	obj, hasObject := fields["object"]
+	trans, hasTransform := fields["transform"]
+	if hasObject == hasTransform {
+		v.report(resolve(n), path, "Needs either an object or a transform")
+	}
+	name, ok := "", false
+	if val, found := fields["name"]; found {
+		name, ok = v.str(val, join(path, "name"))
+	}
+	if hasObject {
+		v.object(obj, join(path, "object"))
+		if ok {
+			v.objects[name] = true
+		}
+	} else if hasTransform {
+		if m, valid := v.transformList(trans, join(path, "transform")); valid && ok {
+			v.transforms[name] = m
+		}
+	}
+}
+
+func (v *validator) camera(n *yamlv3.Node, path string) {
+	fields, ok := v.mapping(n, path, "hsize", "vsize", "fieldOfView", "from", "to", "up", "sampling", "aperture", "focalDistance", "motionBlur")
+	if !ok {
+		return
+	}
+	v.require(n, path, fields, "hsize", "vsize", "fieldOfView", "from", "to", "up")
+	for _, name := range []string{"hsize", "vsize"} {
+		if val, ok := fields[name]; ok {
+			v.integer(val, join(path, name), 1)
+		}
+	}
+	if val, ok := fields["fieldOfView"]; ok {
+		if fov, ok := v.positive(val, join(path, "fieldOfView")); ok && fov >= math.Pi {
+			v.report(resolve(val), join(path, "fieldOfView"), "Must be less than pi, not %g", fov)
+		}
+	}
+	var from, to, up []float64
+	if val, ok := fields["from"]; ok {
+		from, _ = v.floats(val, join(path, "from"), 3)
+	}
+	if val, ok := fields["to"]; ok {
+		to, _ = v.floats(val, join(path, "to"), 3)
+	}
+	if val, ok := fields["up"]; ok {
+		up, _ = v.nonZeroVector(val, join(path, "up"))
+	}
+	if from != nil && to != nil {
+		forward := Point{to[0] - from[0], to[1] - from[1], to[2] - from[2]}
+		if forward.IsZero() {
+			v.report(resolve(fields["to"]), join(path, "to"), "The camera can't look at the point it's at")
+		} else if up != nil {
+			cross := Vector{forward[1]*up[2] - forward[2]*up[1], forward[2]*up[0] - forward[0]*up[2], forward[0]*up[1] - forward[1]*up[0]}
+			if cross.ToVector().Magnitude() < utils.EPSILON {
+				v.report(resolve(fields["up"]), join(path, "up"), "Can't be parallel to the direction the camera looks in")
+			}
+		}
+	}
+	for _, name := range []string{"aperture", "focalDistance"} {
+		if val, ok := fields[name]; ok {
+			v.numberIn(val, join(path, name), 0, math.Inf(1))
+		}
+	}
+	if val, ok := fields["motionBlur"]; ok {
+		v.boolean(val, join(path, "motionBlur"))
+	}
+	if val, ok := fields["sampling"]; ok {
+		v.sampling(val, join(path, "sampling"))
+	}
+}
+
+func (v *validator) sampling(n *yamlv3.Node, path string) {
+	fields, ok := v.mapping(n, path, "mode", "samples", "threshold", "filter", "filterRadius", "seed")
+	if !ok {
+		return
+	}
+	if val, ok := fields["mode"]; ok {
+		v.oneOf(val, join(path, "mode"), "sampling mode", singlesampling, regularsampling, jitteredsampling, adaptivesampling)
+	}
+	if val, ok := fields["samples"]; ok {
+		v.integer(val, join(path, "samples"), 0)
+	}
+	if val, ok := fields["threshold"]; ok {
+		v.numberIn(val, join(path, "threshold"), 0, math.Inf(1))
+	}
+	if val, ok := fields["filter"]; ok {
+		v.oneOf(val, join(path, "filter"), "filter", boxfilter, tentfilter, gaussianfilter)
+	}
+	if val, ok := fields["filterRadius"]; ok {
+		v.numberIn(val, join(path, "filterRadius"), 0, math.Inf(1))
+	}
+	if val, ok := fields["seed"]; ok {
+		v.integer(val, join(path, "seed"), math.MinInt)
+	}
+}
+
+// fixtureFields are the fields used by each type of fixture, in addition to type and color
+var fixtureFields = map[string][]string{
+	POINTLIGHT:       {"position", "attenuation"},
+	SPOTLIGHT:        {"position", "direction", "innerAngle", "outerAngle", "attenuation"},
+	DIRECTIONALLIGHT: {"direction"},
+	AREALIGHT:        {"corner", "uvec", "vvec", "usteps", "vsteps", "jitter"},
+	SPHERELIGHT:      {"position", "radius", "samples", "jitter"},
+}
+
+func (v *validator) fixture(n *yamlv3.Node, path string) {
+	fields, ok := v.mapping(n, path, "type", "color", "position", "direction", "innerAngle", "outerAngle", "attenuation",
+		"corner", "uvec", "vvec", "usteps", "vsteps", "jitter", "radius", "samples")
+	if !ok {
+		return
+	}
+	if !v.require(n, path, fields, "type", "color") {
+		if _, ok := fields["type"]; !ok {
+			return
+		}
+	}
+	fType, ok := v.oneOf(fields["type"], join(path, "type"), "fixture", POINTLIGHT, SPOTLIGHT, DIRECTIONALLIGHT, AREALIGHT, SPHERELIGHT)
+	if !ok {
+		return
+	}
+	for name, val := range fields {
+		if name != "type" && name != "color" && !contains(fixtureFields[fType], name) {
+			v.report(resolve(val), join(path, name), "Isn't used by a %s", fType)
+		}
+	}
+	if val, ok := fields["color"]; ok {
+		v.nonNegativeColor(val, join(path, "color"))
+	}
+	// Positions and corners default to the origin, so they aren't required
+	switch fType {
+	case SPOTLIGHT, DIRECTIONALLIGHT:
+		v.require(n, path, fields, "direction")
+	case AREALIGHT:
+		v.require(n, path, fields, "uvec", "vvec", "usteps", "vsteps")
+	}
+	for _, name := range []string{"position", "corner"} {
+		if val, ok := fields[name]; ok {
+			v.floats(val, join(path, name), 3)
+		}
+	}
+	for _, name := range []string{"direction", "uvec", "vvec"} {
+		if val, ok := fields[name]; ok {
+			v.nonZeroVector(val, join(path, name))
+		}
+	}
+	for _, name := range []string{"usteps", "vsteps"} {
+		if val, ok := fields[name]; ok {
+			v.integer(val, join(path, name), 1)
+		}
+	}
+	if val, ok := fields["samples"]; ok {
+		v.integer(val, join(path, "samples"), 0)
+	}
+	if val, ok := fields["jitter"]; ok {
+		v.boolean(val, join(path, "jitter"))
+	}
+	if val, ok := fields["radius"]; ok {
+		v.numberIn(val, join(path, "radius"), 0, math.Inf(1))
+	}
+	inner := 0.0
+	if val, ok := fields["innerAngle"]; ok {
+		inner, _ = v.numberIn(val, join(path, "innerAngle"), 0, math.Pi)
+	}
+	if val, ok := fields["outerAngle"]; ok {
+		if outer, ok := v.numberIn(val, join(path, "outerAngle"), 0, math.Pi); ok && outer < inner {
+			v.report(resolve(val), join(path, "outerAngle"), "Can't be smaller than innerAngle")
+		}
+	}
+	if val, ok := fields["attenuation"]; ok {
+		if a, ok := v.floats(val, join(path, "attenuation"), 3); ok {
+			if a[0] < 0 || a[1] < 0 || a[2] < 0 {
+				v.report(resolve(val), join(path, "attenuation"), "Attenuation values can't be negative")
+			} else if a[0] == 0 && a[1] == 0 && a[2] == 0 {
+				v.report(resolve(val), join(path, "attenuation"), "At least one attenuation value must be positive")
+			}
+		}
+	}
+}
+
+func (v *validator) material(n *yamlv3.Node, path string) {
+	fields, ok := v.mapping(n, path, "name", "preset", "pattern",
+		ambient, diffuse, specular, shininess, reflective, transparency, refractiveindex, emissive)
+	if !ok {
+		return
+	}
+	knownPreset := true
+	if val, ok := fields["preset"]; ok {
+		if preset, ok := v.str(val, join(path, "preset")); ok {
+			if v.materials[preset] {
+				// The builder uses a named material as it is, without any changes
+				for name, val := range fields {
+					if name != "preset" && name != "name" {
+						v.report(resolve(val), join(path, name), "Isn't used when the preset is the named material '%s'", preset)
+					}
+				}
+				return
+			}
+			if preset != defaultmaterial && preset != glassmaterial {
+				v.report(resolve(val), join(path, "preset"), "Unknown preset '%s', must be default, glass or the name of a material defined above", preset)
+				knownPreset = false
+			}
+		}
+	}
+	if val, ok := fields["pattern"]; ok {
+		v.pattern(val, join(path, "pattern"))
+	} else if knownPreset {
+		// A misspelled preset is already reported, there's no need to ask for a pattern too
+		v.report(resolve(n), path, "Missing field 'pattern'")
+	}
+	for _, name := range []string{ambient, diffuse, specular, reflective} {
+		if val, ok := fields[name]; ok {
+			v.numberIn(val, join(path, name), 0, 1)
+		}
+	}
+	for _, name := range []string{shininess, transparency, refractiveindex} {
+		if val, ok := fields[name]; ok {
+			v.numberIn(val, join(path, name), 0, math.Inf(1))
+		}
+	}
+	if val, ok := fields[emissive]; ok {
+		v.nonNegativeColor(val, join(path, emissive))
+	}
+	if val, ok := fields["name"]; ok {
+		if name, ok := v.str(val, join(path, "name")); ok {
+			v.materials[name] = true
+		}
+	}
+}
+
+// patternColors is the number of colors each pattern needs
+var patternColors = map[string]int{
+	solid:       1,
+	stripe:      2,
+	gradient:    2,
+	ring:        2,
+	checkers:    2,
+	texture:     0,
+	vertexcolor: 1,
+}
+
+func (v *validator) pattern(n *yamlv3.Node, path string) {
+	fields, ok := v.mapping(n, path, "type", "colors", "transform", "file", "mapping", "filter")
+	if !ok {
+		return
+	}
+	if !v.require(n, path, fields, "type") {
+		return
+	}
+	pType, ok := v.oneOf(fields["type"], join(path, "type"), "pattern", solid, stripe, gradient, ring, checkers, texture, vertexcolor)
+	if !ok {
+		return
+	}
+	if pType == texture {
+		v.require(n, path, fields, "file")
+		if val, ok := fields["file"]; ok {
+			v.existingFile(val, join(path, "file"))
+		}
+		if val, ok := fields["mapping"]; ok {
+			v.oneOf(val, join(path, "mapping"), "texture mapping", shapemapping, sphericalmapping, planarmapping, cylindricalmapping, cubemapping)
+		}
+		if val, ok := fields["filter"]; ok {
+			v.oneOf(val, join(path, "filter"), "texture filter", nearestfilter, bilinearfilter)
+		}
+	} else {
+		for _, name := range []string{"file", "mapping", "filter"} {
+			if val, ok := fields[name]; ok {
+				v.report(resolve(val), join(path, name), "Is only used by texture patterns")
+			}
+		}
+	}
+	colors, hasColors := fields["colors"]
+	if want := patternColors[pType]; want == 0 && hasColors {
+		v.report(resolve(colors), join(path, "colors"), "Isn't used by %s patterns", pType)
+	} else if want > 0 && !hasColors {
+		v.report(resolve(n), path, "Missing field 'colors'")
+	} else if hasColors {
+		if items, ok := v.sequence(colors, join(path, "colors")); ok {
+			if len(items) != want {
+				v.report(resolve(colors), join(path, "colors"), "A %s pattern needs %d colors, not %d", pType, want, len(items))
+			}
+			for i, item := range items {
+				v.floats(item, index(join(path, "colors"), i), 3)
+			}
+		}
+	}
+	if val, ok := fields["transform"]; ok {
+		v.transformList(val, join(path, "transform"))
+	}
+}
+
+// transformParams is the number of parameters each transform needs
+var transformParams = map[string]int{
+	identity:  0,
+	translate: 3,
+	scale:     3,
+	rotatex:   1,
+	rotatey:   1,
+	rotatez:   1,
+	shear:     6,
+	matrixop:  16,
+}
+
+// transformList checks a list of transforms, and that together they can be inverted.
+// The combined transform is only returned when the whole list is valid.
+func (v *validator) transformList(n *yamlv3.Node, path string) (matrix.Matrix, bool) {
+	items, ok := v.sequence(n, path)
+	if !ok {
+		return matrix.Matrix{}, false
+	}
+	final := matrix.NewIdentity()
+	valid := true
+	for i, item := range items {
+		itemPath := index(path, i)
+		fields, ok := v.mapping(item, itemPath, "type", "params", "use")
+		if !ok {
+			valid = false
+			continue
+		}
+		if val, ok := fields["use"]; ok {
+			if len(fields) > 1 {
+				v.report(item, itemPath, "A transform that uses a defined transform can't have a type or params")
+				valid = false
+			} else if name, ok := v.str(val, join(itemPath, "use")); ok {
+				if m, found := v.transforms[name]; found {
+					final = final.Multiply(m)
+				} else {
+					v.report(resolve(val), join(itemPath, "use"), "Unknown transform '%s', it must be defined before it's used", name)
+					valid = false
+				}
+			} else {
+				valid = false
+			}
+			continue
+		}
+		if !v.require(item, itemPath, fields, "type") {
+			valid = false
+			continue
+		}
+		tType, ok := v.oneOf(fields["type"], join(itemPath, "type"), "transform", identity, translate, scale, rotatex, rotatey, rotatez, shear, matrixop)
+		if !ok {
+			valid = false
+			continue
+		}
+		t := transform{Type: tType}
+		if val, ok := fields["params"]; ok {
+			if t.Params, ok = v.floats(val, join(itemPath, "params"), transformParams[tType]); !ok {
+				valid = false
+				continue
+			}
+		} else if transformParams[tType] > 0 {
+			v.report(item, itemPath, "Missing field 'params'")
+			valid = false
+			continue
+		}
+		if m, err := t.toMatrix(); err == nil {
+			final = final.Multiply(m)
+		}
+	}
+	if valid && utils.FloatEqual(final.Determinant(), 0) {
+		v.report(resolve(n), path, "The transform is singular, it can't be inverted")
+		valid = false
+	}
+	return final, valid
+}
+
+func (v *validator) objectList(n *yamlv3.Node, path string) {
+	if items, ok := v.sequence(n, path); ok {
+		for i, item := range items {
+			v.object(item, index(path, i))
+		}
+	}
+}
+
+// shapeParams are the params each type of shape can have
+var shapeParams = map[string][]string{
+	sphere:   {},
+	plane:    {},
+	cube:     {},
+	cylinder: {"minimum", "maximum", "closed"},
+	cone:     {"minimum", "maximum", "closed"},
+	torus:    {"major", "minor"},
+	triangle: {"p1", "p2", "p3", "n1", "n2", "n3", "uv1", "uv2", "uv3"},
+	mesh:     {"vertices", "normals", "uvs", "colors", "faces"},
+	group:    {"content", "objfile", "meshfile"},
+	csg:      {"left", "right", "operation"},
+	sdf:      {"node"},
+	instance: {"object"},
+}
+
+func (v *validator) object(n *yamlv3.Node, path string) {
+	fields, ok := v.mapping(n, path, "type", "params", "transform", "transformEnd", "material")
+	if !ok {
+		return
+	}
+	for _, name := range []string{"transform", "transformEnd"} {
+		if val, ok := fields[name]; ok {
+			v.transformList(val, join(path, name))
+		}
+	}
+	sType := v.shape(n, path, fields)
+	// The builder reads the object's material after the shapes inside it
+	if val, ok := fields["material"]; ok {
+		if sType == instance {
+			v.report(resolve(val), join(path, "material"), "Isn't used by instances, they use the materials of the defined object")
+		} else {
+			v.material(val, join(path, "material"))
+		}
+	}
+}
+
+// shape checks the type and the params of an object, and returns its type if it's valid
+func (v *validator) shape(n *yamlv3.Node, path string, fields map[string]*yamlv3.Node) string {
+	if !v.require(n, path, fields, "type") {
+		return ""
+	}
+	sType, ok := v.oneOf(fields["type"], join(path, "type"), "shape", sphere, plane, cube, cylinder, cone, torus, triangle, mesh, group, csg, sdf, instance)
+	if !ok {
+		return ""
+	}
+	paramsPath := join(path, "params")
+	params := map[string]*yamlv3.Node{}
+	paramsNode, hasParams := fields["params"]
+	if hasParams {
+		if resolve(paramsNode).Tag == "!!null" {
+			hasParams = false
+		} else if params, ok = v.mapping(paramsNode, paramsPath, shapeParams[sType]...); !ok {
+			return sType
+		}
+	}
+	if !hasParams {
+		paramsNode = n
+	}
+	switch sType {
+	case cylinder, cone:
+		var min, max float64
+		minOk, maxOk := false, false
+		if val, ok := params["minimum"]; ok {
+			min, minOk = v.number(val, join(paramsPath, "minimum"))
+		}
+		if val, ok := params["maximum"]; ok {
+			max, maxOk = v.number(val, join(paramsPath, "maximum"))
+		}
+		if minOk && maxOk && min > max {
+			v.report(resolve(params["maximum"]), join(paramsPath, "maximum"), "Can't be smaller than the minimum")
+		}
+		if val, ok := params["closed"]; ok {
+			v.boolean(val, join(paramsPath, "closed"))
+		}
+	case torus:
+		if val, ok := params["major"]; ok {
+			v.numberIn(val, join(paramsPath, "major"), 0, math.Inf(1))
+		}
+		if val, ok := params["minor"]; ok {
+			v.positive(val, join(paramsPath, "minor"))
+		}
+	case triangle:
+		v.require(paramsNode, paramsPath, params, "p1", "p2", "p3")
+		for _, name := range []string{"p1", "p2", "p3"} {
+			if val, ok := params[name]; ok {
+				v.floats(val, join(paramsPath, name), 3)
+			}
+		}
+		v.vertexParams(paramsNode, paramsPath, params, 3, "n1", "n2", "n3")
+		v.vertexParams(paramsNode, paramsPath, params, 2, "uv1", "uv2", "uv3")
+	case mesh:
+		v.mesh(paramsNode, paramsPath, params)
+	case group:
+		given := []string{}
+		for _, name := range []string{"content", "objfile", "meshfile"} {
+			if _, ok := params[name]; ok {
+				given = append(given, name)
+			}
+		}
+		if len(given) > 1 {
+			v.report(resolve(paramsNode), paramsPath, "Only one of %s can be given", strings.Join(given, ", "))
+		}
+		if val, ok := params["content"]; ok {
+			v.objectList(val, join(paramsPath, "content"))
+		}
+		if val, ok := params["objfile"]; ok {
+			v.existingFile(val, join(paramsPath, "objfile"))
+		}
+		if val, ok := params["meshfile"]; ok {
+			if name, ok := v.existingFile(val, join(paramsPath, "meshfile")); ok {
+				ext := strings.ToLower(filepath.Ext(name))
+				if ext != ".obj" && ext != ".ply" && ext != ".stl" {
+					v.report(resolve(val), join(paramsPath, "meshfile"), "Unsupported mesh file format '%s', must be .obj, .ply or .stl", ext)
+				}
+			}
+		}
+	case csg:
+		v.require(paramsNode, paramsPath, params, "left", "right", "operation")
+		if val, ok := params["left"]; ok {
+			v.object(val, join(paramsPath, "left"))
+		}
+		if val, ok := params["right"]; ok {
+			v.object(val, join(paramsPath, "right"))
+		}
+		if val, ok := params["operation"]; ok {
+			v.oneOf(val, join(paramsPath, "operation"), "operation", unionop, intersectop, differenceop)
+		}
+	case sdf:
+		if v.require(paramsNode, paramsPath, params, "node") {
+			v.sdfNode(params["node"], join(paramsPath, "node"))
+		}
+	case instance:
+		if v.require(paramsNode, paramsPath, params, "object") {
+			if name, ok := v.str(params["object"], join(paramsPath, "object")); ok && !v.objects[name] {
+				v.report(resolve(params["object"]), join(paramsPath, "object"), "Unknown object '%s', it must be defined before it's used", name)
+			}
+		}
+	}
+	return sType
+}
+
+// vertexParams checks parameters that are given for every vertex of a triangle, either
+// all of them or none
+func (v *validator) vertexParams(n *yamlv3.Node, path string, params map[string]*yamlv3.Node, size int, names ...string) {
+	found := 0
+	for _, name := range names {
+		if val, ok := params[name]; ok {
+			found++
+			v.floats(val, join(path, name), size)
+		}
+	}
+	if found > 0 && found < len(names) {
+		v.report(resolve(n), path, "Either all or none of %s must be given", strings.Join(names, ", "))
+	}
+}
+
+func (v *validator) mesh(n *yamlv3.Node, path string, params map[string]*yamlv3.Node) {
+	v.require(n, path, params, "vertices", "faces")
+	count := func(name string, size int) int {
+		val, ok := params[name]
+		if !ok {
+			return 0
+		}
+		items, ok := v.sequence(val, join(path, name))
+		if !ok {
+			return -1
+		}
+		for i, item := range items {
+			if _, ok := v.floats(item, index(join(path, name), i), size); !ok {
+				return -1
+			}
+		}
+		return len(items)
+	}
+	vertices := count("vertices", 3)
+	normals := count("normals", 3)
+	uvs := count("uvs", 2)
+	colors := count("colors", 3)
+	if colors > 0 && vertices >= 0 && colors != vertices {
+		v.report(resolve(params["colors"]), join(path, "colors"), "Needs a color for every vertex, %d colors for %d vertices", colors, vertices)
+	}
+	val, ok := params["faces"]
+	if !ok {
+		return
+	}
+	items, ok := v.sequence(val, join(path, "faces"))
+	if !ok {
+		return
+	}
+	for i, item := range items {
+		facePath := index(join(path, "faces"), i)
+		face, ok := v.floats(item, facePath, 3, 9)
+		if !ok {
+			continue
+		}
+		for j, idx := range face {
+			limit, what := vertices, "vertices"
+			if j >= 6 {
+				limit, what = uvs, "texture coordinates"
+			} else if j >= 3 {
+				limit, what = normals, "normals"
+			}
+			switch {
+			case idx != math.Trunc(idx):
+				v.report(item, facePath, "Indices must be integers, not %g", idx)
+			case j < 3 && idx < 0:
+				v.report(item, facePath, "Vertex indices can't be negative")
+			case j >= 3 && idx < -1:
+				v.report(item, facePath, "Normal and texture coordinate indices must be -1 or more")
+			case limit >= 0 && int(idx) >= limit:
+				v.report(item, facePath, "Index %d is out of range, there are %d %s", int(idx), limit, what)
+			default:
+				continue
+			}
+			break
+		}
+	}
+}
+
+// sdfFields are the fields each type of sdf node can have, in addition to type
+var sdfFields = map[string][]string{
+	sphere:           {"center", "radius"},
+	box:              {"center", "size", "rounding"},
+	capsule:          {"a", "b", "radius"},
+	torus:            {"major", "minor"},
+	unionop:          {"children"},
+	intersectop:      {"children"},
+	differenceop:     {"children"},
+	smoothunion:      {"k", "children"},
+	smoothdifference: {"k", "children"},
+	repeat:           {"period", "children"},
+}
+
+func (v *validator) sdfNode(n *yamlv3.Node, path string) {
+	fields, ok := v.mapping(n, path, "type", "center", "radius", "size", "rounding", "a", "b", "major", "minor", "k", "period", "children")
+	if !ok {
+		return
+	}
+	if !v.require(n, path, fields, "type") {
+		return
+	}
+	nType, ok := v.oneOf(fields["type"], join(path, "type"), "sdf node", sphere, box, capsule, torus, unionop, intersectop, differenceop, smoothunion, smoothdifference, repeat)
+	if !ok {
+		return
+	}
+	for name, val := range fields {
+		if name != "type" && !contains(sdfFields[nType], name) {
+			v.report(resolve(val), join(path, name), "Isn't used by an sdf %s", nType)
+		}
+	}
+	switch nType {
+	case sphere, capsule:
+		v.require(n, path, fields, "radius")
+		if nType == capsule {
+			v.require(n, path, fields, "a", "b")
+		}
+	case box:
+		v.require(n, path, fields, "size")
+	case torus:
+		v.require(n, path, fields, "minor")
+	default:
+		v.require(n, path, fields, "children")
+	}
+	for _, name := range []string{"center", "a", "b"} {
+		if val, ok := fields[name]; ok {
+			v.floats(val, join(path, name), 3)
+		}
+	}
+	for _, name := range []string{"radius", "minor"} {
+		if val, ok := fields[name]; ok {
+			v.positive(val, join(path, name))
+		}
+	}
+	for _, name := range []string{"major", "k"} {
+		if val, ok := fields[name]; ok {
+			v.numberIn(val, join(path, name), 0, math.Inf(1))
+		}
+	}
+	if val, ok := fields["size"]; ok {
+		if size, ok := v.floats(val, join(path, "size"), 3); ok {
+			if size[0] <= 0 || size[1] <= 0 || size[2] <= 0 {
+				v.report(resolve(val), join(path, "size"), "Must be positive along every axis")
+			} else if r, ok := fields["rounding"]; ok {
+				v.numberIn(r, join(path, "rounding"), 0, min(size[0], size[1], size[2]))
+			}
+		}
+	}
+	if val, ok := fields["period"]; ok {
+		if period, ok := v.floats(val, join(path, "period"), 3); ok && (period[0] < 0 || period[1] < 0 || period[2] < 0) {
+			v.report(resolve(val), join(path, "period"), "Can't be negative")
+		}
+	}
+	if val, ok := fields["children"]; ok {
+		if items, ok := v.sequence(val, join(path, "children")); ok {
+			if len(items) == 0 {
+				v.report(resolve(val), join(path, "children"), "Needs at least one child")
+			} else if nType == repeat && len(items) != 1 {
+				v.report(resolve(val), join(path, "children"), "A repeat needs exactly one child")
+			}
+			for i, item := range items {
+				v.sdfNode(item, index(join(path, "children"), i))
+			}
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package world
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+const validCamera = `
+camera:
+  hsize: 100
+  vsize: 50
+  fieldOfView: 1.0
+  from: [ 0, 1.5, -5 ]
+  to: [ 0, 1, 0 ]
+  up: [ 0, 1, 0 ]
+`
+
+func loadScene(g *WithT, dir, scene string) (*World, error) {
+	filename := filepath.Join(dir, "scene.yaml")
+	g.Expect(os.WriteFile(filename, []byte(strings.TrimPrefix(scene, "\n")), 0644)).To(Succeed())
+	w, _, err := NewWorld(filename)
+	return w, err
+}
+
+// buildScene builds a scene without validating it, like the builder does for scenes
+// that don't come from a file
+func buildScene(g *WithT, dir, scene string) (*World, error) {
+	filename := filepath.Join(dir, "scene.yaml")
+	data := []byte(strings.TrimPrefix(scene, "\n"))
+	g.Expect(os.WriteFile(filename, data, 0644)).To(Succeed())
+	w, _, err := buildWorld(filename, data, 0)
+	return w, err
+}
+
+// expectBuildProblem checks that the builder reports its problem with the path of the
+// value that caused it
+func expectBuildProblem(g *WithT, err error, path string, scene string) {
+	g.Expect(err).To(HaveOccurred(), scene)
+	g.Expect(err.Error()).To(ContainSubstring("scene.yaml: "+path+": "), scene)
+}
+
+func TestValidationReportsAllProblems(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	scene := `
+camera:
+  hsize: 100
+  vsize: 50
+  fieldOfView: 1.0
+  from: [ 0, 1.5, -5 ]
+  to: [ 0, 1, 0 ]
+materials:
+- name: shiny
+  pattern:
+    type: solid
+    colors:
+    - [ 1, 0, 0 ]
+  refractiveindex: 1.5
+objects:
+- type: sphere
+  material:
+    preset: metal
+- type: cube
+  transform:
+  - type: scale
+    params: [ 1, 0, 1 ]
+  material:
+    preset: shiny
+    ambient: 0.5
+- type: torus
+  params:
+    major: 1
+    minor: big
+  material:
+    pattern:
+      type: solid
+      colors:
+      - [ 1, 1, 1 ]
+    ambient: 2
+`
+	_, err := loadScene(g, t.TempDir(), scene)
+	g.Expect(err).ToNot(BeNil())
+	var verr *ValidationError
+	g.Expect(errors.As(err, &verr)).To(BeTrue())
+	file := verr.File
+	g.Expect(verr.Problems).To(Equal([]Problem{
+		{File: file, Line: 2, Column: 3, Path: "camera", Message: "Missing field 'up'"},
+		{File: file, Line: 13, Column: 3, Path: "materials[0]", Message: "Unknown field 'refractiveindex', did you mean 'refractiveIndex'?"},
+		{File: file, Line: 17, Column: 13, Path: "objects[0].material.preset", Message: "Unknown preset 'metal', must be default, glass or the name of a material defined above"},
+		{File: file, Line: 20, Column: 3, Path: "objects[1].transform", Message: "The transform is singular, it can't be inverted"},
+		{File: file, Line: 24, Column: 14, Path: "objects[1].material.ambient", Message: "Isn't used when the preset is the named material 'shiny'"},
+		{File: file, Line: 28, Column: 12, Path: "objects[2].params.minor", Message: "Can't evaluate 'big': unknown variable 'big'"},
+		{File: file, Line: 34, Column: 14, Path: "objects[2].material.ambient", Message: "Must be between 0 and 1, not 2"},
+	}))
+	g.Expect(filepath.Base(file)).To(Equal("scene.yaml"))
+	g.Expect(err.Error()).To(HavePrefix(file + ":2:3: camera: Missing field 'up'\n"))
+}
+
+func TestValidationTypes(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := t.TempDir()
+
+	tests := []struct {
+		scene string
+		path  string
+	}{
+		{"objects: {}\n", "objects"},
+		{"objects:\n- type: teapot\n", "objects[0].type"},
+		{"objects:\n- params: {}\n", "objects[0]"},
+		{"objects:\n- type: sphere\n  params:\n    radius: 1\n", "objects[0].params"},
+		{"objects:\n- type: cylinder\n  params:\n    minimum: 1\n    maximum: 0\n", "objects[0].params.maximum"},
+		{"objects:\n- type: cylinder\n  params:\n    closed: maybe\n", "objects[0].params.closed"},
+		{"objects:\n- type: triangle\n  params:\n    p1: [ 0, 0, 0 ]\n    p2: [ 1, 0, 0 ]\n    p3: [ 0, 1 ]\n", "objects[0].params.p3"},
+		{"objects:\n- type: triangle\n  params:\n    p1: [ 0, 0, 0 ]\n    p2: [ 1, 0, 0 ]\n    p3: [ 0, 1, 0 ]\n    n1: [ 0, 0, 1 ]\n", "objects[0].params"},
+		{"objects:\n- type: mesh\n  params:\n    vertices: [ [ 0, 0, 0 ] ]\n    faces: [ [ 0, 0, 1 ] ]\n", "objects[0].params.faces[0]"},
+		{"objects:\n- type: group\n  params:\n    content: []\n    objfile: validate_test.go\n", "objects[0].params"},
+		{"objects:\n- type: group\n  params:\n    objfile: missing.obj\n", "objects[0].params.objfile"},
+		{"objects:\n- type: csg\n  params:\n    left:\n      type: sphere\n    right:\n      type: cube\n    operation: xor\n", "objects[0].params.operation"},
+		{"objects:\n- type: sdf\n  params:\n    node:\n      type: repeat\n      period: [ 1, 1, 1 ]\n      children: []\n", "objects[0].params.node.children"},
+		{"objects:\n- type: sdf\n  params:\n    node:\n      type: sphere\n      radius: 1\n      size: [ 1, 1, 1 ]\n", "objects[0].params.node.size"},
+		{"objects:\n- type: sphere\n  transform:\n  - type: rotatex\n    params: [ 1, 2 ]\n", "objects[0].transform[0].params"},
+		{"objects:\n- type: sphere\n  material:\n    pattern:\n      type: stripe\n      colors:\n      - [ 1, 1, 1 ]\n", "objects[0].material.pattern.colors"},
+		{"objects:\n- type: sphere\n  material:\n    pattern:\n      type: solid\n      colors:\n      - [ 1, 1, 1 ]\n      mapping: planar\n", "objects[0].material.pattern.mapping"},
+		{"objects:\n- type: sphere\n  material:\n    ambient: 0.5\n", "objects[0].material"},
+		{"fixtures:\n- type: pointlight\n  color: [ 1, 1, 1 ]\n  radius: 1\n", "fixtures[0].radius"},
+		{"fixtures:\n- type: spotlight\n  color: [ 1, 1, 1 ]\n  innerAngle: 1\n  outerAngle: 0.5\n  direction: [ 0, -1, 0 ]\n", "fixtures[0].outerAngle"},
+		{"fixtures:\n- type: directionallight\n  color: [ 1, 1, 1 ]\n  direction: [ 0, 0, 0 ]\n", "fixtures[0].direction"},
+		{"fixtures:\n- type: arealight\n  color: [ 1, 1, 1 ]\n  uvec: [ 1, 0, 0 ]\n  vvec: [ 0, 1, 0 ]\n  usteps: 0\n  vsteps: 2\n", "fixtures[0].usteps"},
+	}
+	for _, test := range tests {
+		_, err := loadScene(g, dir, validCamera+test.scene)
+		var verr *ValidationError
+		g.Expect(errors.As(err, &verr)).To(BeTrue(), test.scene)
+		g.Expect(verr.Problems).To(HaveLen(1), test.scene)
+		g.Expect(verr.Problems[0].Path).To(Equal(test.path), test.scene)
+	}
+
+	for _, scene := range []string{
+		"camera:\n  hsize: 100\n  vsize: 50\n  fieldOfView: 1.0\n  from: [ 0, 0, 0 ]\n  to: [ 0, 0, 0 ]\n  up: [ 0, 1, 0 ]\n",
+		"camera:\n  hsize: 100\n  vsize: 50\n  fieldOfView: 1.0\n  from: [ 0, 0, 0 ]\n  to: [ 0, 1, 0 ]\n  up: [ 0, 1, 0 ]\n",
+		"camera:\n  hsize: -1\n  vsize: 50\n  fieldOfView: 1.0\n  from: [ 0, 0, 0 ]\n  to: [ 0, 0, 1 ]\n  up: [ 0, 1, 0 ]\n",
+		validCamera + "  sampling:\n    mode: random\n",
+		"camera:\n  hsize: 100.5\n  vsize: 50\n  fieldOfView: 1.0\n  from: [ 0, 0, 0 ]\n  to: [ 0, 0, 1 ]\n  up: [ 0, 1, 0 ]\n",
+		"objects: []\n",
+		"",
+	} {
+		_, err := loadScene(g, dir, scene)
+		var verr *ValidationError
+		g.Expect(errors.As(err, &verr)).To(BeTrue(), scene)
+		g.Expect(verr.Problems).To(HaveLen(1), scene)
+	}
+}
+
+func TestBuilderProblems(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := t.TempDir()
+
+	// The builder checks the values again for scenes that are built without the
+	// validator, and reports them with the path of the value
+	tests := []struct {
+		scene string
+		path  string
+	}{
+		{"objects:\n- type: cylinder\n  params:\n    minimum: 1\n    maximum: 0\n", "objects[0].params.maximum"},
+		{"objects:\n- type: torus\n  params:\n    minor: 0\n", "objects[0].params.minor"},
+		{"objects:\n- type: mesh\n  params:\n    vertices: [ [ 0, 0, 0 ] ]\n    faces: [ [ 0, 0, 1 ] ]\n", "objects[0].params"},
+		{"objects:\n- type: sdf\n  params:\n    node:\n      type: union\n      children:\n      - type: sphere\n        radius: -1\n", "objects[0].params.node.children[0]"},
+		{"objects:\n- type: sphere\n  transform:\n  - type: scale\n    params: [ 1, 0, 1 ]\n", "objects[0].transform"},
+		{"objects:\n- type: group\n  params:\n    content:\n    - type: sphere\n    - type: sphere\n      material:\n        pattern:\n          type: solid\n          colors:\n          - [ 1, 1, 1 ]\n        diffuse: 2\n", "objects[0].params.content[1].material.diffuse"},
+		{"objects:\n- type: csg\n  params:\n    left:\n      type: sphere\n    right:\n      type: cube\n      material:\n        pattern:\n          type: solid\n          colors:\n          - [ 1, 1, 1 ]\n        shininess: -1\n    operation: union\n", "objects[0].params.right.material.shininess"},
+		{"materials:\n- name: glow\n  pattern:\n    type: solid\n    colors:\n    - [ 1, 1, 1 ]\n  emissive: [ 1, -1, 1 ]\n", "materials[0].emissive"},
+		{"fixtures:\n- type: spotlight\n  color: [ 1, 1, 1 ]\n  innerAngle: 1\n  outerAngle: 0.5\n  direction: [ 0, -1, 0 ]\n", "fixtures[0]"},
+		{"fixtures:\n- type: directionallight\n  color: [ 1, 1, 1 ]\n  direction: [ 0, 0, 0 ]\n", "fixtures[0]"},
+		{"fixtures:\n- type: pointlight\n  color: [ 1, -1, 1 ]\n", "fixtures[0].color"},
+		{"animation:\n  frames: -1\n", "animation.frames"},
+		{"animation:\n  fps: -24\n", "animation.fps"},
+		{"animation:\n  shutter: 2\n", "animation.shutter"},
+	}
+	for _, test := range tests {
+		_, err := buildScene(g, dir, validCamera+test.scene)
+		expectBuildProblem(g, err, test.path, test.scene)
+	}
+
+	for _, test := range []struct {
+		camera string
+		path   string
+	}{
+		{"  hsize: 0\n  vsize: 50\n  fieldOfView: 1.0\n  from: [ 0, 0, 0 ]\n  to: [ 0, 0, 1 ]\n  up: [ 0, 1, 0 ]\n", "camera.hsize"},
+		{"  hsize: 100\n  vsize: 50\n  fieldOfView: 4\n  from: [ 0, 0, 0 ]\n  to: [ 0, 0, 1 ]\n  up: [ 0, 1, 0 ]\n", "camera.fieldOfView"},
+		{"  hsize: 100\n  vsize: 50\n  fieldOfView: 1.0\n  from: [ 0, 0, 0 ]\n  to: [ 0, 0, 0 ]\n  up: [ 0, 1, 0 ]\n", "camera.to"},
+		{"  hsize: 100\n  vsize: 50\n  fieldOfView: 1.0\n  from: [ 0, 0, 0 ]\n  to: [ 0, 1, 0 ]\n  up: [ 0, 1, 0 ]\n", "camera.up"},
+	} {
+		_, err := buildScene(g, dir, "camera:\n"+test.camera)
+		expectBuildProblem(g, err, test.path, test.camera)
+	}
+
+	// Unknown presets are found by the builder too, for callers that don't validate
+	_, err := materialInput{Params: map[string]interface{}{"preset": "metal"}}.toMaterial(newSceneCache())
+	g.Expect(err).To(MatchError("preset: Unknown preset 'metal', must be default, glass or the name of a material defined above"))
+}
+
+func TestValidationReportsEveryValue(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// Every out-of-range value is reported with its position, not only the first one
+	_, err := loadScene(g, t.TempDir(), validCamera+`objects:
+- type: sphere
+  transform:
+  - type: scale
+    params: [ 1, 0, 1 ]
+  material:
+    pattern:
+      type: solid
+      colors:
+      - [ 1, 1, 1 ]
+    ambient: 2
+    diffuse: -1
+`)
+	var verr *ValidationError
+	g.Expect(errors.As(err, &verr)).To(BeTrue())
+	type located struct {
+		line, column int
+		path         string
+	}
+	found := []located{}
+	for _, p := range verr.Problems {
+		found = append(found, located{p.Line, p.Column, p.Path})
+	}
+	g.Expect(found).To(Equal([]located{
+		{11, 3, "objects[0].transform"},
+		{18, 14, "objects[0].material.ambient"},
+		{19, 14, "objects[0].material.diffuse"},
+	}))
+}
+
+func TestValidationFollowsAliases(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	scene := validCamera + `
+materials:
+- &red
+  name: red
+  pattern:
+    type: solid
+    colors:
+    - [ 1, 0, 0 ]
+  ambient: 0.2
+objects:
+- type: sphere
+  material:
+    <<: *red
+    name: brightred
+    ambient: 0.9
+- type: cube
+  material:
+    preset: brightred
+`
+	w, err := loadScene(g, t.TempDir(), scene)
+	g.Expect(err).To(BeNil())
+	g.Expect(w.NumObjects()).To(Equal(2))
+	g.Expect(w.Shape(0).GetMaterial().Ambient()).To(Equal(0.9))
+	g.Expect(w.Shape(1).GetMaterial().Ambient()).To(Equal(0.9))
+}
+
+func TestSceneFiles(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := t.TempDir()
+	model := filepath.Join(dir, "model.obj")
+	g.Expect(os.WriteFile(model, []byte("v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n"), 0644)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, "shared.yaml"), []byte("define:\n- name: model\n  object:\n    type: group\n    params:\n      objfile: "+model+"\n"), 0644)).To(Succeed())
+
+	// Missing files are returned too, and so are the files of scenes with problems
+	missing := filepath.Join(dir, "missing.obj")
+	_, err := loadScene(g, dir, validCamera+"include:\n- shared.yaml\n- shared.yaml\nobjects:\n- type: group\n  params:\n    objfile: "+missing+"\n")
+	g.Expect(err).ToNot(BeNil())
+	files, err := SceneFiles(filepath.Join(dir, "scene.yaml"))
+	g.Expect(err).To(BeNil())
+	g.Expect(files).To(Equal([]string{filepath.Join(dir, "scene.yaml"), filepath.Join(dir, "shared.yaml"), model, missing}))
+
+	files, err = SceneFiles(filepath.Join(dir, "nothing.yaml"))
+	g.Expect(err).ToNot(BeNil())
+	g.Expect(files).To(Equal([]string{filepath.Join(dir, "nothing.yaml")}))
+}
+
+func TestSceneFilesOfModels(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := t.TempDir()
+	g.Expect(os.MkdirAll(filepath.Join(dir, "models", "materials"), 0755)).To(Succeed())
+
+	// Material libraries are relative to the OBJ file, and their textures to the library
+	model := filepath.Join(dir, "models", "model.obj")
+	g.Expect(os.WriteFile(model, []byte("mtllib materials/a.mtl materials/missing.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n"), 0644)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, "models", "materials", "a.mtl"), []byte("newmtl a\nmap_Kd wood.png # the grain\n"), 0644)).To(Succeed())
+	// The missing library breaks the scene, but its files are still found
+	_, err := loadScene(g, dir, validCamera+"objects:\n- type: group\n  params:\n    meshfile: "+model+"\n")
+	g.Expect(err).ToNot(BeNil())
+	files, err := SceneFiles(filepath.Join(dir, "scene.yaml"))
+	g.Expect(err).To(BeNil())
+	g.Expect(files).To(Equal([]string{
+		filepath.Join(dir, "scene.yaml"),
+		model,
+		filepath.Join(dir, "models", "materials", "a.mtl"),
+		filepath.Join(dir, "models", "materials", "wood.png"),
+		filepath.Join(dir, "models", "materials", "missing.mtl"),
+	}))
+
+	// glTF buffers and images are files unless they're embedded
+	gltf := filepath.Join(dir, "models", "scene.gltf")
+	g.Expect(os.WriteFile(gltf, []byte(`{
+		"asset": {"version": "2.0"},
+		"buffers": [{"uri": "mesh%20data.bin", "byteLength": 4}, {"uri": "data:application/octet-stream;base64,AAAAAA==", "byteLength": 4}],
+		"images": [{"uri": "textures/wood.png"}, {"bufferView": 0}]
+	}`), 0644)).To(Succeed())
+	files, err = SceneFiles(gltf)
+	g.Expect(err).To(BeNil())
+	g.Expect(files).To(Equal([]string{gltf, filepath.Join(dir, "models", "mesh data.bin"), filepath.Join(dir, "models", "textures", "wood.png")}))
+}
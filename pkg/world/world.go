@@ -2,8 +2,9 @@ package world
 
 import (
 	"fmt"
-	"math"
-	"sort"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
 
 	"github.com/liorokman/raytrace/pkg/fixtures"
 	"github.com/liorokman/raytrace/pkg/shapes"
@@ -11,14 +12,28 @@ import (
 )
 
 type World struct {
-	objects []shapes.Shape
-	Lights  []fixtures.PointLight
+	objects    []shapes.Shape
+	Lights     []fixtures.Light
+	bvhOptions shapes.BVHOptions
+	// accel is created on the first intersection, so that a zero World works too
+	accel atomic.Pointer[worldAccel]
+	// Animation describes the frames of the scene the world was built from. Every frame
+	// is built with NewWorldAt.
+	Animation Animation
+}
+
+// worldAccel holds the bounding volume hierarchy over the top-level objects. It's
+// built on the first intersection, and replaced whenever the objects change.
+type worldAccel struct {
+	once sync.Once
+	bvh  *shapes.BVH
 }
 
 func New() *World {
 	return &World{
-		objects: []shapes.Shape{},
-		Lights:  []fixtures.PointLight{fixtures.NewPointLight(tuple.NewPoint(-10, 10, -10), tuple.NewColor(1, 1, 1))},
+		objects:    []shapes.Shape{},
+		Lights:     []fixtures.Light{fixtures.NewPointLight(tuple.NewPoint(-10, 10, -10), tuple.NewColor(1, 1, 1))},
+		bvhOptions: shapes.DefaultBVHOptions(),
 	}
 }
 
@@ -47,64 +62,84 @@ func (w *World) SetShape(i int, s shapes.Shape) *World {
 		return w
 	}
 	w.objects[i] = s
+	w.accel.Store(&worldAccel{})
 	return w
 }
 
 func (w *World) AddShapes(s ...shapes.Shape) *World {
 	w.objects = append(w.objects, s...)
+	w.accel.Store(&worldAccel{})
 	return w
 }
 
-func (w *World) IntersectRay(r shapes.Ray) []shapes.Intersection {
-	retval := []shapes.Intersection{}
-	for _, o := range w.objects {
-		retval = append(retval, r.Intersect(o)...)
+// WithBVHOptions sets how the bounding volume hierarchy over the world's top-level
+// objects is built
+func (w *World) WithBVHOptions(opts shapes.BVHOptions) *World {
+	w.bvhOptions = opts
+	w.accel.Store(&worldAccel{})
+	return w
+}
+
+func (w *World) hierarchy() *shapes.BVH {
+	accel := w.accel.Load()
+	if accel == nil {
+		w.accel.CompareAndSwap(nil, &worldAccel{})
+		accel = w.accel.Load()
 	}
+	accel.once.Do(func() {
+		accel.bvh = shapes.NewBVH(w.objects, w.bvhOptions)
+	})
+	return accel.bvh
+}
 
-	sort.Sort(shapes.ByTime(retval))
-	return retval
+func (w *World) IntersectRay(r shapes.Ray) []shapes.Intersection {
+	return w.hierarchy().Intersect(r)
 }
 
+// ShadeHit computes the color at a hit. Jittered lights are sampled at the centers of
+// their cells, see Whitted for jittered samples.
 func (w *World) ShadeHit(comps shapes.Computation, depth int) tuple.Color {
-	colorFromL := make([]tuple.Color, len(w.Lights))
+	return w.shadeHit(comps, depth, nil)
+}
+
+// shadeHit is ShadeHit with the jittered samples of the lights drawn from rng. The
+// reflected and refracted colors don't depend on the lights, so they're traced once and
+// added to the light of all of them.
+func (w *World) shadeHit(comps shapes.Computation, depth int, rng *rand.Rand) tuple.Color {
+	m := comps.Shape.GetMaterial()
+	retval := m.Emissive()
 	for ind, light := range w.Lights {
-		shadowed := w.IsShadowed(comps.OverPoint, ind)
-		colorFromL[ind] = comps.Shape.GetMaterial().Lighting(comps.Shape, light, comps.Point, comps.EyeV, comps.NormalV, shadowed)
-		// TODO: Actually do something with these errors
-		reflect, _ := w.ReflectedColor(comps, depth)
-		refract, _ := w.RefractedColor(comps, depth)
-		if comps.Shape.GetMaterial().Reflective() > 0.0 && comps.Shape.GetMaterial().Transparency() > 0.0 {
-			reflectence := comps.Schlick()
-			colorFromL[ind] = colorFromL[ind].Add(reflect.Mult(reflectence)).Add(refract.Mult((1 - reflectence)))
-		} else {
-			colorFromL[ind] = colorFromL[ind].Add(reflect).Add(refract)
-		}
+		samples, visibility := w.lightSamples(comps.OverPoint, ind, comps.Time, rng)
+		retval = retval.Add(m.Lighting(comps.Shape, light, comps.Point, comps.EyeV, comps.NormalV, samples, visibility))
 	}
-	retval := tuple.Black
-	for _, c := range colorFromL {
-		retval = retval.Add(c)
+	// TODO: Actually do something with these errors
+	reflect, _ := w.reflectedColor(comps, depth, rng)
+	refract, _ := w.refractedColor(comps, depth, rng)
+	if m.Reflective() > 0.0 && m.Transparency() > 0.0 {
+		reflectence := comps.Schlick()
+		return retval.Add(reflect.Mult(reflectence)).Add(refract.Mult((1 - reflectence)))
 	}
-	return retval
+	return retval.Add(reflect).Add(refract)
 }
 
 func (w *World) RefractedColor(comps shapes.Computation, depth int) (tuple.Color, error) {
+	return w.refractedColor(comps, depth, nil)
+}
+
+func (w *World) refractedColor(comps shapes.Computation, depth int, rng *rand.Rand) (tuple.Color, error) {
 	if depth == 0 || comps.Shape.GetMaterial().Transparency() == 0 {
 		return tuple.Black, nil
 	}
-	nRatio := comps.N1 / comps.N2
-	cosI := comps.EyeV.Dot(comps.NormalV)
-	sin2t := math.Pow(nRatio, 2) * (1 - math.Pow(cosI, 2))
-	if sin2t > 1 {
+	direction, ok := refraction(comps)
+	if !ok {
 		// This means that this case is total internal reflection
 		return tuple.Black, nil
 	}
-	cosT := math.Sqrt(1.0 - sin2t)
-	direction := comps.NormalV.Mult(nRatio*cosI - cosT).Subtract(comps.EyeV.Mult(nRatio))
 	refractRay, err := shapes.NewRay(comps.UnderPoint, direction)
 	if err != nil {
 		return tuple.Color{}, err
 	}
-	c, err := w.ColorAt(refractRay, depth-1)
+	c, err := w.colorAt(refractRay.WithTime(comps.Time), depth-1, rng)
 	if err != nil {
 		return tuple.Color{}, err
 	}
@@ -112,6 +147,10 @@ func (w *World) RefractedColor(comps shapes.Computation, depth int) (tuple.Color
 }
 
 func (w *World) ReflectedColor(comps shapes.Computation, depth int) (tuple.Color, error) {
+	return w.reflectedColor(comps, depth, nil)
+}
+
+func (w *World) reflectedColor(comps shapes.Computation, depth int, rng *rand.Rand) (tuple.Color, error) {
 	if comps.Shape.GetMaterial().Reflective() == 0 || depth <= 0 {
 		return tuple.Black, nil
 	}
@@ -119,44 +158,77 @@ func (w *World) ReflectedColor(comps shapes.Computation, depth int) (tuple.Color
 	if err != nil {
 		return tuple.Color{}, err
 	}
-	c, err := w.ColorAt(reflectedRay, depth-1)
+	c, err := w.colorAt(reflectedRay.WithTime(comps.Time), depth-1, rng)
 	if err != nil {
 		return tuple.Color{}, err
 	}
 	return c.Mult(comps.Shape.GetMaterial().Reflective()), nil
 }
 
+// ColorAt computes the color seen along the ray. Jittered lights are sampled at the
+// centers of their cells, see Whitted for jittered samples.
 func (w *World) ColorAt(r shapes.Ray, depth int) (tuple.Color, error) {
+	return w.colorAt(r, depth, nil)
+}
+
+func (w *World) colorAt(r shapes.Ray, depth int, rng *rand.Rand) (tuple.Color, error) {
 	xs := w.IntersectRay(r)
 	if h, ok := shapes.Hit(xs...); ok {
 		comps, err := h.PrepareComputation(r, xs...)
 		if err != nil {
 			return tuple.Color{}, err
 		}
-		return w.ShadeHit(comps, depth), nil
+		return w.shadeHit(comps, depth, rng), nil
 	} else {
 		return tuple.Black, nil
 	}
 }
 
+// IsShadowed reports whether none of the light's samples can be seen from p
 func (w *World) IsShadowed(p tuple.Tuple, lightIndex int) bool {
+	return w.LightVisibility(p, lightIndex) == 0
+}
+
+// LightVisibility returns the fraction of the light's samples that can be seen from p.
+// For a single sample light this is either 0 or 1, area lights cast soft shadows.
+// Jittered lights are sampled at the centers of their cells.
+func (w *World) LightVisibility(p tuple.Tuple, lightIndex int) float64 {
+	_, visibility := w.lightSamples(p, lightIndex, 0, nil)
+	visible := 0.0
+	for _, v := range visibility {
+		visible += v
+	}
+	return visible / float64(len(visibility))
+}
+
+// lightSamples samples the light from p, drawing jittered samples from rng, and returns
+// the samples together with the visibility of each of them. The shadow rays are cast at
+// the given time, so they see moving shapes where they were at that time.
+func (w *World) lightSamples(p tuple.Tuple, lightIndex int, time float64, rng *rand.Rand) ([]fixtures.LightSample, []float64) {
 	if !p.IsPoint() {
 		panic("Expecting a point, not a vector")
 	}
 	if lightIndex < 0 || lightIndex >= len(w.Lights) {
 		panic("No such light source in world")
 	}
-	v := w.Lights[lightIndex].Position().Subtract(p)
-	direction := v.Normalize()
+	samples := w.Lights[lightIndex].Sample(p, rng)
+	visibility := make([]float64, len(samples))
+	for i, sample := range samples {
+		if !w.isShadowedAlong(p, sample, time) {
+			visibility[i] = 1
+		}
+	}
+	return samples, visibility
+}
 
-	r, err := shapes.NewRay(p, direction)
+func (w *World) isShadowedAlong(p tuple.Tuple, sample fixtures.LightSample, time float64) bool {
+	r, err := shapes.NewRay(p, sample.Direction)
 	if err != nil {
 		panic(err)
 	}
-	intersections := w.IntersectRay(r)
+	intersections := w.IntersectRay(r.WithTime(time))
 	if hit, ok := shapes.Hit(intersections...); ok {
-		distance := v.Magnitude()
-		return hit.T < distance
+		return hit.T < sample.Distance
 	}
 	return false
 }
@@ -2,6 +2,9 @@ package world
 
 import (
 	"math"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -11,6 +14,7 @@ import (
 	"github.com/liorokman/raytrace/pkg/matrix"
 	"github.com/liorokman/raytrace/pkg/shapes"
 	"github.com/liorokman/raytrace/pkg/tuple"
+	"github.com/liorokman/raytrace/pkg/utils"
 )
 
 func defaultWorld() *World {
@@ -72,6 +76,27 @@ func TestReflection(t *testing.T) {
 	g.Expect(color.Equals(tuple.NewColor(0.8767577, 0.9243407, 0.82917462))).To(BeTrue())
 }
 
+func TestReflectionWithSeveralLights(t *testing.T) {
+	g := NewGomegaWithT(t)
+	w := defaultWorld()
+	s := shapes.NewPlane().WithMaterial(material.NewDefaultBuilder().WithReflective(0.5).Build()).WithTransform(matrix.NewTranslation(0, -1, 0))
+	w.AddShapes(s)
+	r, e := shapes.NewRay(tuple.NewPoint(0, 0, -3), tuple.NewVector(0, -math.Sqrt(2)/2.0, math.Sqrt(2.0)/2.0))
+	g.Expect(e).To(BeNil())
+	comps, err := shapes.Intersection{T: math.Sqrt(2), Shape: s}.PrepareComputation(r)
+	g.Expect(err).To(BeNil())
+	reflected, err := w.ReflectedColor(comps, 5)
+	g.Expect(err).To(BeNil())
+	direct := w.ShadeHit(comps, 5).Subtract(reflected)
+
+	// A second light adds its own light, but the reflection is only counted once
+	w.Lights = append(w.Lights, w.Lights[0])
+	reflected, err = w.ReflectedColor(comps, 5)
+	g.Expect(err).To(BeNil())
+	color := w.ShadeHit(comps, 5)
+	g.Expect(color.Equals(direct.Mult(2).Add(reflected))).To(BeTrue())
+}
+
 func TestNoInfiniteRecursionInReflection(t *testing.T) {
 	g := NewGomegaWithT(t)
 	w := defaultWorld()
@@ -112,6 +137,17 @@ func TestIntersectWorld(t *testing.T) {
 	}
 }
 
+func TestIntersectZeroWorld(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	var w World
+	r, e := shapes.NewRay(tuple.NewPoint(0, 0, -5), tuple.NewVector(0, 0, 1))
+	g.Expect(e).To(BeNil())
+	g.Expect(w.IntersectRay(r)).To(BeEmpty())
+	w.AddShapes(shapes.NewSphere())
+	g.Expect(w.IntersectRay(r)).To(HaveLen(2))
+}
+
 func TestShadeWorld(t *testing.T) {
 	g := NewGomegaWithT(t)
 	w := defaultWorld()
@@ -177,6 +213,61 @@ func TestIsShadowed(t *testing.T) {
 	g.Expect(w.IsShadowed(tuple.NewPoint(-2, 2, -2), 0)).To(BeFalse())
 }
 
+func TestLightVisibility(t *testing.T) {
+	g := NewGomegaWithT(t)
+	w := defaultWorld()
+
+	// A point light is either fully visible or fully hidden
+	g.Expect(w.LightVisibility(tuple.NewPoint(0, 10, 0), 0)).To(Equal(1.0))
+	g.Expect(w.LightVisibility(tuple.NewPoint(10, -10, 10), 0)).To(Equal(0.0))
+
+	w.Lights[0] = fixtures.NewAreaLight(tuple.NewPoint(-0.5, -0.5, -5), tuple.NewVector(1, 0, 0), 2, tuple.NewVector(0, 1, 0), 2, tuple.NewColor(1, 1, 1), false)
+	tests := []struct {
+		point    tuple.Tuple
+		expected float64
+	}{
+		{tuple.NewPoint(0, 0, 2), 0.0},
+		{tuple.NewPoint(1, -1, 2), 0.25},
+		{tuple.NewPoint(1.5, 0, 2), 0.5},
+		{tuple.NewPoint(1.25, 1.25, 3), 0.75},
+		{tuple.NewPoint(0, 0, -2), 1.0},
+	}
+	for _, test := range tests {
+		g.Expect(w.LightVisibility(test.point, 0)).To(Equal(test.expected), test.point.String())
+	}
+}
+
+func TestSoftShadows(t *testing.T) {
+	g := NewGomegaWithT(t)
+	w := New()
+	w.AddShapes(
+		shapes.NewPlane(),
+		shapes.NewCube().WithTransform(matrix.NewTranslation(0, 2, 0).Scale(0.5, 0.1, 0.5)),
+	)
+
+	// Walking out of the shadow of the cube, the visibility rises gradually
+	w.Lights = []fixtures.Light{fixtures.NewSphereLight(tuple.NewPoint(0, 4, 0), 1, 32, tuple.NewColor(1, 1, 1), false)}
+	previous := -1.0
+	partial := 0
+	for x := 0.0; x <= 4; x += 0.25 {
+		v := w.LightVisibility(tuple.NewPoint(x, 0.001, 0), 0)
+		g.Expect(v).To(BeNumerically(">=", previous))
+		if v > 0 && v < 1 {
+			partial++
+		}
+		previous = v
+	}
+	g.Expect(previous).To(Equal(1.0))
+	g.Expect(partial).To(BeNumerically(">", 1))
+
+	// The same scene lit by a point light has a hard edge
+	w.Lights = []fixtures.Light{fixtures.NewPointLight(tuple.NewPoint(0, 4, 0), tuple.NewColor(1, 1, 1))}
+	for x := 0.0; x <= 4; x += 0.25 {
+		v := w.LightVisibility(tuple.NewPoint(x, 0.001, 0), 0)
+		g.Expect(v == 0 || v == 1).To(BeTrue())
+	}
+}
+
 func TestShadeHit(t *testing.T) {
 
 	g := NewGomegaWithT(t)
@@ -299,3 +390,350 @@ func TestSchlickEnabledShader(t *testing.T) {
 	g.Expect(c.Equals(tuple.NewColor(0.93391, 0.69643, 0.69243))).To(BeTrue())
 
 }
+
+func TestBVHOnObjFile(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	loadTeapot := func(opts shapes.BVHOptions) *World {
+		objIn := newObjReader()
+		g.Expect(objIn.ReadObj("../../objs/teapot-low.obj")).To(Succeed())
+		for _, m := range objIn.groups {
+			m.shape.InnerShape().(shapes.Mesh).SetBVHOptions(opts)
+		}
+		teapot := objIn.AsGroup()
+		teapot.InnerShape().(shapes.Group).SetBVHOptions(opts)
+		w := New().WithBVHOptions(opts)
+		w.AddShapes(teapot.WithTransform(matrix.NewRotateX(-math.Pi/2.0).Scale(0.1, 0.1, 0.1)), shapes.NewPlane())
+		return w
+	}
+	accelerated := loadTeapot(shapes.DefaultBVHOptions())
+	linear := loadTeapot(shapes.BVHOptions{Disabled: true})
+
+	hits := 0
+	for x := -2.0; x <= 2.0; x += 0.2 {
+		for y := -0.5; y <= 2.0; y += 0.2 {
+			r, err := shapes.NewRay(tuple.NewPoint(x, y, -5), tuple.NewVector(0, 0, 1))
+			g.Expect(err).To(BeNil())
+			expected := linear.IntersectRay(r)
+			actual := accelerated.IntersectRay(r)
+			g.Expect(len(actual)).To(Equal(len(expected)))
+			for i := range expected {
+				g.Expect(utils.FloatEqual(actual[i].T, expected[i].T)).To(BeTrue())
+			}
+			hits += len(expected)
+		}
+	}
+	g.Expect(hits).To(BeNumerically(">", 0))
+}
+
+func TestLightFixturesFromScene(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	scene := `
+fixtures:
+- type: pointlight
+  position: [ -10, 10, -10 ]
+  color: [ 1, 1, 1 ]
+- type: arealight
+  corner: [ -1, 2, 4 ]
+  uvec: [ 2, 0, 0 ]
+  vvec: [ 0, 2, 0 ]
+  usteps: 4
+  vsteps: 2
+  jitter: true
+  color: [ 1.5, 1.5, 1.5 ]
+- type: spherelight
+  position: [ 0, 5, 0 ]
+  radius: 0.5
+  samples: 16
+  color: [ 1, 1, 1 ]
+- type: spotlight
+  position: [ 0, 10, 0 ]
+  direction: [ 0, -1, 0 ]
+  innerAngle: 0.5
+  outerAngle: 0.7
+  attenuation: [ 1, 0.1, 0 ]
+  color: [ 1, 1, 1 ]
+- type: directionallight
+  direction: [ 1, -1, 0 ]
+  color: [ 0.5, 0.5, 0.5 ]
+camera:
+  hsize: 10
+  vsize: 10
+  fieldOfView: 1
+  from: [ 0, 0, -5 ]
+  to: [ 0, 0, 0 ]
+  up: [ 0, 1, 0 ]
+`
+	filename := filepath.Join(t.TempDir(), "lights.yaml")
+	g.Expect(os.WriteFile(filename, []byte(scene), 0644)).To(Succeed())
+	w, _, err := NewWorld(filename)
+	g.Expect(err).To(BeNil())
+	g.Expect(w.Lights).To(HaveLen(5))
+
+	area, ok := w.Lights[1].(fixtures.AreaLight)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(area.Samples()).To(Equal(8))
+	g.Expect(area.Position().Equals(tuple.NewPoint(0, 3, 4))).To(BeTrue())
+	g.Expect(area.Intensity()).To(Equal(tuple.NewColor(1.5, 1.5, 1.5)))
+
+	sphere, ok := w.Lights[2].(fixtures.SphereLight)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(sphere.Samples()).To(Equal(16))
+	g.Expect(sphere.Radius()).To(Equal(0.5))
+
+	spot, ok := w.Lights[3].(fixtures.SpotLight)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(spot.IntensityAt(tuple.NewPoint(0, 0, 0)).Equals(tuple.NewColor(0.5, 0.5, 0.5))).To(BeTrue())
+	g.Expect(spot.IntensityAt(tuple.NewPoint(10, 0, 0))).To(Equal(tuple.Black))
+
+	sun, ok := w.Lights[4].(fixtures.DirectionalLight)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(sun.Direction().Equals(tuple.NewVector(math.Sqrt2/2, -math.Sqrt2/2, 0))).To(BeTrue())
+
+	for _, bad := range []struct{ from, to string }{
+		{"usteps: 4", "usteps: 0"},
+		{"outerAngle: 0.7", "outerAngle: 0.2"},
+		{"attenuation: [ 1, 0.1, 0 ]", "attenuation: [ 1, 0.1 ]"},
+		{"direction: [ 1, -1, 0 ]", "direction: [ 0, 0, 0 ]"},
+	} {
+		g.Expect(os.WriteFile(filename, []byte(strings.Replace(scene, bad.from, bad.to, 1)), 0644)).To(Succeed())
+		_, _, err = NewWorld(filename)
+		g.Expect(err).ToNot(BeNil(), bad.to)
+	}
+}
+
+func TestSpotAndDirectionalLights(t *testing.T) {
+	g := NewGomegaWithT(t)
+	w := New()
+	w.AddShapes(
+		shapes.NewPlane(),
+		shapes.NewCube().WithTransform(matrix.NewTranslation(0, 2, 0).Scale(0.5, 0.1, 0.5)),
+	)
+	shade := func(x, z float64) tuple.Color {
+		r, err := shapes.NewRay(tuple.NewPoint(x, 1, z), tuple.NewVector(0, -1, 0))
+		g.Expect(err).To(BeNil())
+		c, err := w.ColorAt(r, 1)
+		g.Expect(err).To(BeNil())
+		return c
+	}
+
+	// The sun casts a shadow of the cube offset along its direction
+	w.Lights = []fixtures.Light{fixtures.NewDirectionalLight(tuple.NewVector(1, -1, 0), tuple.NewColor(1, 1, 1))}
+	g.Expect(w.IsShadowed(tuple.NewPoint(2, 0.001, 0), 0)).To(BeTrue())
+	g.Expect(w.IsShadowed(tuple.NewPoint(0, 0.001, 0), 0)).To(BeFalse())
+	g.Expect(w.IsShadowed(tuple.NewPoint(-200, 0.001, 0), 0)).To(BeFalse())
+	g.Expect(shade(2, 0).Red()).To(BeNumerically("<", shade(-2, 0).Red()))
+
+	// A spot light only lights the inside of its cone
+	w.Lights = []fixtures.Light{fixtures.NewSpotLight(tuple.NewPoint(5, 5, 0), tuple.NewVector(0, -1, 0), 0.2, 0.4, tuple.NewColor(1, 1, 1))}
+	lit := shade(5, 0)
+	dark := shade(-5, 0)
+	g.Expect(lit.Red()).To(BeNumerically(">", 0.5))
+	g.Expect(dark.Equals(tuple.NewColor(0.1, 0.1, 0.1))).To(BeTrue())
+}
+
+func TestTexturePatternFromScene(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir := t.TempDir()
+	// The left half of the texture is red, the right half is blue
+	g.Expect(os.WriteFile(filepath.Join(dir, "texture.ppm"), []byte("P3\n2 1\n255\n255 0 0 0 0 255\n"), 0644)).To(Succeed())
+	scene := `
+fixtures:
+- type: pointlight
+  position: [ -10, 10, -10 ]
+  color: [ 1, 1, 1 ]
+objects:
+- type: plane
+  material:
+    pattern:
+      type: texture
+      file: TEXTURE
+      mapping: planar
+      filter: nearest
+    ambient: 1
+    diffuse: 0
+    specular: 0
+camera:
+  hsize: 10
+  vsize: 10
+  fieldOfView: 1
+  from: [ 0, 0, -5 ]
+  to: [ 0, 0, 0 ]
+  up: [ 0, 1, 0 ]
+`
+	scene = strings.Replace(scene, "TEXTURE", filepath.Join(dir, "texture.ppm"), 1)
+	filename := filepath.Join(dir, "scene.yaml")
+	g.Expect(os.WriteFile(filename, []byte(scene), 0644)).To(Succeed())
+	w, _, err := NewWorld(filename)
+	g.Expect(err).To(BeNil())
+
+	colorAt := func(x float64) tuple.Color {
+		r, err := shapes.NewRay(tuple.NewPoint(x, 1, 0.5), tuple.NewVector(0, -1, 0))
+		g.Expect(err).To(BeNil())
+		c, err := w.ColorAt(r, 1)
+		g.Expect(err).To(BeNil())
+		return c
+	}
+	g.Expect(colorAt(0.25)).To(Equal(tuple.NewColor(1, 0, 0)))
+	g.Expect(colorAt(0.75)).To(Equal(tuple.NewColor(0, 0, 1)))
+
+	for _, bad := range []struct{ from, to string }{
+		{"mapping: planar", "mapping: conical"},
+		{"filter: nearest", "filter: trilinear"},
+		{"texture.ppm", "missing.ppm"},
+	} {
+		g.Expect(os.WriteFile(filename, []byte(strings.Replace(scene, bad.from, bad.to, 1)), 0644)).To(Succeed())
+		_, _, err = NewWorld(filename)
+		g.Expect(err).ToNot(BeNil(), bad.to)
+	}
+}
+
+func TestEmissiveMaterialFromScene(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	scene := `
+objects:
+- type: sphere
+  material:
+    pattern:
+      type: solid
+      colors:
+      - [ 1, 1, 1 ]
+    emissive: [ 4, 2, 1 ]
+camera:
+  hsize: 10
+  vsize: 10
+  fieldOfView: 1
+  from: [ 0, 0, -5 ]
+  to: [ 0, 0, 0 ]
+  up: [ 0, 1, 0 ]
+`
+	filename := filepath.Join(t.TempDir(), "scene.yaml")
+	g.Expect(os.WriteFile(filename, []byte(scene), 0644)).To(Succeed())
+	w, _, err := NewWorld(filename)
+	g.Expect(err).To(BeNil())
+	g.Expect(w.objects[0].GetMaterial().Emissive()).To(Equal(tuple.NewColor(4, 2, 1)))
+
+	g.Expect(os.WriteFile(filename, []byte(strings.Replace(scene, "[ 4, 2, 1 ]", "[ 4, -2, 1 ]", 1)), 0644)).To(Succeed())
+	_, _, err = NewWorld(filename)
+	g.Expect(err).ToNot(BeNil())
+}
+
+func TestTorusFromScene(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	s, err := newShape("torus", map[string]interface{}{"major": 2, "minor": 0.5}, nil)
+	g.Expect(err).To(BeNil())
+	b := s.LocalBounds()
+	g.Expect(b.Max.Equals(tuple.NewPoint(2.5, 0.5, 2.5))).To(BeTrue())
+
+	s, err = newShape("torus", map[string]interface{}{}, nil)
+	g.Expect(err).To(BeNil())
+	g.Expect(s.LocalBounds().Max.Equals(tuple.NewPoint(1.25, 0.25, 1.25))).To(BeTrue())
+
+	_, err = newShape("torus", map[string]interface{}{"minor": 0}, nil)
+	g.Expect(err).ToNot(BeNil())
+	_, err = newShape("torus", map[string]interface{}{"major": "big"}, nil)
+	g.Expect(err).ToNot(BeNil())
+}
+
+func TestMeshFromScene(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	vertices := []interface{}{
+		[]interface{}{0, 0, 0}, []interface{}{1, 0, 0}, []interface{}{0, 1, 0}, []interface{}{1, 1, 0},
+	}
+	s, err := newShape("mesh", map[string]interface{}{
+		"vertices": vertices,
+		"normals":  []interface{}{[]interface{}{0, 0, -1}},
+		"faces":    []interface{}{[]interface{}{0, 1, 2}, []interface{}{1, 3, 2, 0, 0, 0, -1, -1, -1}},
+	}, nil)
+	g.Expect(err).To(BeNil())
+	m := s.InnerShape().(shapes.Mesh)
+	g.Expect(m.Size()).To(Equal(2))
+	g.Expect(m.Faces()[1].Normals).To(Equal([3]int{0, 0, 0}))
+	g.Expect(m.Faces()[1].UVs).To(Equal([3]int{-1, -1, -1}))
+
+	for _, bad := range []map[string]interface{}{
+		{"faces": []interface{}{[]interface{}{0, 1, 2}}},
+		{"vertices": vertices},
+		{"vertices": vertices, "faces": []interface{}{[]interface{}{0, 1}}},
+		{"vertices": vertices, "faces": []interface{}{[]interface{}{0, 1, 4}}},
+		{"vertices": vertices, "faces": []interface{}{[]interface{}{0, 1, 2.5}}},
+		{"vertices": vertices, "faces": []interface{}{[]interface{}{0, 1, "two"}}},
+		{"vertices": vertices, "faces": []interface{}{[]interface{}{0, 1, 2, 0, 0, 0, -1, -1, -1}}},
+		{"vertices": vertices, "colors": []interface{}{[]interface{}{1, 0, 0}}, "faces": []interface{}{[]interface{}{0, 1, 2}}},
+		{"vertices": 3, "faces": []interface{}{[]interface{}{0, 1, 2}}},
+	} {
+		_, err := newShape("mesh", bad, nil)
+		g.Expect(err).ToNot(BeNil(), "%v", bad)
+	}
+}
+
+func TestSDFFromScene(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	scene := `
+objects:
+- type: sdf
+  params:
+    node:
+      type: smoothdifference
+      k: 0.1
+      children:
+      - type: smoothunion
+        k: 0.5
+        children:
+        - type: sphere
+          center: [ -0.75, 0, 0 ]
+          radius: 1
+        - type: sphere
+          center: [ 0.75, 0, 0 ]
+          radius: 1
+        - type: capsule
+          a: [ 0, -1, 0 ]
+          b: [ 0, 1, 0 ]
+          radius: 0.25
+      - type: box
+        center: [ 0, 0, -2 ]
+        size: [ 0.5, 0.5, 0.5 ]
+        rounding: 0.1
+camera:
+  hsize: 10
+  vsize: 10
+  fieldOfView: 1
+  from: [ 0, 0, -5 ]
+  to: [ 0, 0, 0 ]
+  up: [ 0, 1, 0 ]
+`
+	filename := filepath.Join(t.TempDir(), "scene.yaml")
+	g.Expect(os.WriteFile(filename, []byte(scene), 0644)).To(Succeed())
+	w, _, err := NewWorld(filename)
+	g.Expect(err).To(BeNil())
+	g.Expect(w.objects).To(HaveLen(1))
+	r, err := shapes.NewRay(tuple.NewPoint(0, 0, -5), tuple.NewVector(0, 0, 1))
+	g.Expect(err).To(BeNil())
+	xs := w.IntersectRay(r)
+	g.Expect(len(xs)).To(BeNumerically(">=", 2))
+	// The blended spheres fill the gap at the origin, but the box cuts into their front
+	g.Expect(xs[0].T).To(BeNumerically(">", 5-1.75))
+
+	for _, broken := range []string{
+		strings.Replace(scene, "type: capsule", "type: pyramid", 1),
+		strings.Replace(scene, "radius: 0.25", "radius: 0", 1),
+		strings.Replace(scene, "size: [ 0.5, 0.5, 0.5 ]", "size: [ 0.5, 0.5 ]", 1),
+		strings.Replace(scene, "node:", "nodes:", 1),
+	} {
+		g.Expect(os.WriteFile(filename, []byte(broken), 0644)).To(Succeed())
+		_, _, err = NewWorld(filename)
+		g.Expect(err).ToNot(BeNil())
+	}
+
+	_, err = sdfNode{Type: "repeat", Period: []float64{2, 0, 0}}.toSDF()
+	g.Expect(err).ToNot(BeNil())
+	field, err := sdfNode{Type: "repeat", Period: []float64{4, 0, 0}, Children: []sdfNode{{Type: "sphere", Radius: 1}}}.toSDF()
+	g.Expect(err).To(BeNil())
+	g.Expect(field.Distance(tuple.NewPoint(8, 0, 0))).To(BeNumerically("~", -1, 1e-9))
+}